@@ -13,6 +13,7 @@ import (
 
 	"github.com/zbiljic/fget/pkg/fbackup"
 	"github.com/zbiljic/fget/pkg/gitinspect"
+	"github.com/zbiljic/fget/pkg/gitlfs"
 )
 
 type (
@@ -98,7 +99,7 @@ func inspectBackupLocalRepository(ctx context.Context, repoPath string, runner b
 		probe.HasLFSAttributes = hasLFSAttributes
 	}
 
-	localLFSObjects, err := backupHasLocalLFSObjects(repoPath)
+	localLFSObjects, err := backupHasLocalLFSObjects(ctx, repoPath, runner)
 	if err != nil {
 		probe.addError("lfs-objects-failed", "lfs-objects", "local Git LFS objects could not be inspected")
 	} else {
@@ -149,6 +150,84 @@ func verifyBackupRemote(ctx context.Context, repoPath string, runner backupGitRu
 	return fbackup.RemoteStateNetworkError, "remote verification failed"
 }
 
+// backupLFSCheck is the result of asking the LFS server which local LFS
+// objects it already stores.
+type backupLFSCheck struct {
+	State       fbackup.LFSState
+	Reason      string
+	ObjectCount int
+	Missing     []gitlfs.Object
+}
+
+func verifyBackupLFSObjects(ctx context.Context, repoPath, remoteURL string, runner backupGitRunner) backupLFSCheck {
+	gitDirPath, err := gitinspect.GitDirPath(ctx, repoPath, runner)
+	if err != nil {
+		return backupLFSCheck{State: fbackup.LFSStateFailed, Reason: "local LFS objects could not be listed"}
+	}
+	objects, err := gitlfs.LocalObjects(gitDirPath)
+	if err != nil {
+		return backupLFSCheck{State: fbackup.LFSStateFailed, Reason: "local LFS objects could not be listed"}
+	}
+	check := backupLFSCheck{State: fbackup.LFSStateFailed, ObjectCount: len(objects)}
+
+	endpoint, err := backupLFSEndpoint(ctx, repoPath, remoteURL, runner)
+	if err != nil {
+		check.Reason = "LFS endpoint could not be determined"
+		return check
+	}
+	missing, err := (&gitlfs.Client{}).Missing(ctx, endpoint, objects)
+	if err != nil {
+		check.Reason = backupLFSFailureReason(err)
+		return check
+	}
+
+	check.State = fbackup.LFSStateVerified
+	check.Missing = missing
+	return check
+}
+
+// backupLFSEndpoint resolves the LFS server of a repository in the order
+// git-lfs uses: lfs.url, .lfsconfig, remote.origin.lfsurl, then the remote.
+func backupLFSEndpoint(ctx context.Context, repoPath, remoteURL string, runner backupGitRunner) (string, error) {
+	lookups := [][]string{
+		{"config", "--get", "lfs.url"},
+		{"config", "--file", ".lfsconfig", "--get", "lfs.url"},
+		{"config", "--get", "remote.origin.lfsurl"},
+	}
+	for _, args := range lookups {
+		out, err := runner.Run(ctx, repoPath, args...)
+		if err == nil {
+			if endpoint := strings.TrimSpace(out.Stdout); endpoint != "" {
+				return endpoint, nil
+			}
+			continue
+		}
+		if gitErr, ok := err.(*backupGitCommandError); !ok || gitErr.ExitCode != 1 {
+			return "", err
+		}
+	}
+
+	return gitlfs.Endpoint(remoteURL)
+}
+
+func backupLFSFailureReason(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return "LFS verification timed out"
+	}
+	var statusErr *gitlfs.StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case 401, 403:
+			return "LFS server authentication failed"
+		case 404:
+			return "LFS server not found"
+		default:
+			return "LFS server returned HTTP " + strconv.Itoa(statusErr.StatusCode)
+		}
+	}
+	return "LFS verification failed"
+}
+
 func backupRemoteFailureReason(err *backupGitCommandError, out backupGitOutput) string {
 	if err == nil {
 		return ""
@@ -340,6 +419,37 @@ func backupHasSubmodules(ctx context.Context, repoPath string, runner backupGitR
 	return false, err
 }
 
+// backupGitlink is a submodule recorded in the index of its parent.
+type backupGitlink struct {
+	Path   string
+	Commit string
+}
+
+func backupSubmoduleGitlinks(ctx context.Context, repoPath string, runner backupGitRunner) ([]backupGitlink, error) {
+	out, err := runner.Run(ctx, repoPath, "ls-files", "--stage", "-z")
+	if err != nil {
+		return nil, err
+	}
+
+	var gitlinks []backupGitlink
+	for _, entry := range strings.Split(out.Stdout, "\x00") {
+		metadata, path, ok := strings.Cut(entry, "\t")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(metadata)
+		if len(fields) != 3 || fields[0] != "160000" || fields[2] != "0" {
+			continue
+		}
+		gitlinks = append(gitlinks, backupGitlink{Path: path, Commit: fields[1]})
+	}
+
+	sort.Slice(gitlinks, func(i, j int) bool {
+		return gitlinks[i].Path < gitlinks[j].Path
+	})
+	return gitlinks, nil
+}
+
 func backupHasLFSAttributes(ctx context.Context, repoPath string, runner backupGitRunner) (bool, error) {
 	out, err := runner.Run(ctx, repoPath, "config", "--local", "--name-only", "--get-regexp", "^filter\\.lfs\\.")
 	if err == nil && strings.TrimSpace(out.Stdout) != "" {
@@ -373,8 +483,12 @@ func backupHasLFSAttributes(ctx context.Context, repoPath string, runner backupG
 	return false, nil
 }
 
-func backupHasLocalLFSObjects(repoPath string) (bool, error) {
-	path := filepath.Join(repoPath, ".git", "lfs", "objects")
+func backupHasLocalLFSObjects(ctx context.Context, repoPath string, runner backupGitRunner) (bool, error) {
+	gitDirPath, err := gitinspect.GitDirPath(ctx, repoPath, runner)
+	if err != nil {
+		return false, err
+	}
+	path := filepath.Join(gitDirPath, "lfs", "objects")
 	info, err := os.Stat(path)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+
+	"github.com/zbiljic/fget/pkg/fbackup"
+)
+
+// readBackupPassphrase reads a passphrase from the first line of a file, so it
+// never appears in the process list or shell history.
+func readBackupPassphrase(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read passphrase file: %w", err)
+	}
+	passphrase, _, _ := strings.Cut(string(data), "\n")
+	passphrase = strings.TrimSuffix(passphrase, "\r")
+	if passphrase == "" {
+		return "", errors.New("passphrase file is empty")
+	}
+	return passphrase, nil
+}
+
+func loadBackupEncryption(recipient, passphraseFile string) (fbackup.Encryption, error) {
+	if recipient != "" && passphraseFile != "" {
+		return fbackup.Encryption{}, errors.New("--recipient and --passphrase-file cannot be used together")
+	}
+	encryption := fbackup.Encryption{Recipient: strings.TrimSpace(recipient)}
+	if passphraseFile != "" {
+		passphrase, err := readBackupPassphrase(passphraseFile)
+		if err != nil {
+			return encryption, err
+		}
+		encryption.Passphrase = passphrase
+	}
+	return encryption, nil
+}
+
+func loadBackupKeys(identityFiles []string, passphraseFile string) (fbackup.Keys, error) {
+	var keys fbackup.Keys
+	for _, path := range identityFiles {
+		file, err := os.Open(path)
+		if err != nil {
+			return keys, fmt.Errorf("read identity file: %w", err)
+		}
+		identities, err := age.ParseIdentities(file)
+		_ = file.Close()
+		if err != nil {
+			return keys, fmt.Errorf("parse identity file %s: %w", path, err)
+		}
+		keys.Identities = append(keys.Identities, identities...)
+	}
+	if passphraseFile != "" {
+		passphrase, err := readBackupPassphrase(passphraseFile)
+		if err != nil {
+			return keys, err
+		}
+		keys.Passphrase = passphrase
+	}
+	return keys, nil
+}
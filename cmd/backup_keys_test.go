@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestLoadBackupKeysReadsIdentityAndPassphraseFiles(t *testing.T) {
+	dir := t.TempDir()
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	identityPath := filepath.Join(dir, "key.txt")
+	if err := os.WriteFile(identityPath, []byte("# created: test\n"+identity.String()+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	passphrasePath := filepath.Join(dir, "passphrase")
+	if err := os.WriteFile(passphrasePath, []byte("correct horse\r\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := loadBackupKeys([]string{identityPath}, passphrasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys.Identities) != 1 || keys.Passphrase != "correct horse" {
+		t.Fatalf("loadBackupKeys() = %d identities, passphrase %q", len(keys.Identities), keys.Passphrase)
+	}
+
+	if _, err := loadBackupEncryption(identity.Recipient().String(), passphrasePath); err == nil {
+		t.Fatal("loadBackupEncryption() accepted both a recipient and a passphrase")
+	}
+	empty := filepath.Join(dir, "empty")
+	if err := os.WriteFile(empty, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadBackupEncryption("", empty); err == nil {
+		t.Fatal("loadBackupEncryption() accepted an empty passphrase file")
+	}
+}
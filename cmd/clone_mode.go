@@ -0,0 +1,265 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/spf13/pflag"
+	giturls "github.com/whilp/git-urls"
+
+	"github.com/zbiljic/fget/pkg/fconfig"
+	"github.com/zbiljic/fget/pkg/giturl"
+)
+
+// addCloneModeFlags adds the flags selecting a shallow, partial or
+// single-branch clone.
+func addCloneModeFlags(flags *pflag.FlagSet, mode *fconfig.CloneMode) {
+	flags.IntVar(&mode.Depth, "depth", 0, "Create a shallow clone with history truncated to this many commits")
+	flags.StringVar(&mode.Filter, "filter", "", "Create a partial clone with this object filter, such as blob:none")
+	flags.BoolVar(&mode.SingleBranch, "single-branch", false, "Clone only the history of the default branch")
+	flags.BoolVar(&mode.NoTags, "no-tags", false, "Do not clone or fetch tags")
+}
+
+func validateCloneMode(mode fconfig.CloneMode) error {
+	if mode.Depth < 0 {
+		return errors.New("--depth must not be negative")
+	}
+	if strings.ContainsAny(mode.Filter, " \t\n") {
+		return fmt.Errorf("invalid --filter %q", mode.Filter)
+	}
+
+	return nil
+}
+
+func gitCloneModeArgs(mode fconfig.CloneMode) []string {
+	var args []string
+	if mode.Depth > 0 {
+		args = append(args, "--depth="+strconv.Itoa(mode.Depth))
+	}
+	if mode.Filter != "" {
+		args = append(args, "--filter="+mode.Filter)
+	}
+	if mode.SingleBranch {
+		args = append(args, "--single-branch")
+	}
+	if mode.NoTags {
+		args = append(args, "--no-tags")
+	}
+	return args
+}
+
+// gitClone clones repoURL into repoPath as the named remote. Regular clones
+// use go-git with the configured credentials; the other modes use git, because
+// go-git cannot create partial clones.
+func gitClone(ctx context.Context, repoURL, repoPath, remoteName string, mode fconfig.CloneMode, progress io.Writer) error {
+	if mode.IsZero() {
+		cloneOptions := &git.CloneOptions{
+			URL:        repoURL,
+			RemoteName: remoteName,
+			Progress:   progress,
+		}
+		if parsedURL, err := giturls.Parse(repoURL); err == nil {
+			credential, err := lookupGitCredential(ctx, parsedURL)
+			if err != nil {
+				return err
+			}
+			if credential != nil {
+				cloneOptions.Auth = &githttp.BasicAuth{Username: credential.Username, Password: credential.Token}
+			}
+		}
+		_, err := git.PlainCloneContext(ctx, repoPath, false, cloneOptions)
+		return err
+	}
+
+	if _, err := os.Stat(filepath.Join(repoPath, ".git")); err == nil {
+		return git.ErrRepositoryAlreadyExists
+	}
+
+	if err := os.MkdirAll(filepath.Dir(repoPath), os.ModePerm); err != nil {
+		return err
+	}
+
+	out, err := gitRepoClone(filepath.Dir(repoPath), repoURL, repoPath, remoteName, gitCloneModeArgs(mode))
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// repoCloneMode is the clone mode of a local repository.
+type repoCloneMode struct {
+	fconfig.CloneMode
+	// Shallow is set for shallow repositories. Their depth is known only when
+	// the catalog records it.
+	Shallow bool
+}
+
+// cloneMode returns the mode to clone or fetch the repository again with.
+// Shallow repositories of unknown depth keep only their latest commit.
+func (mode repoCloneMode) cloneMode() fconfig.CloneMode {
+	cloneMode := mode.CloneMode
+	if mode.Shallow && cloneMode.Depth <= 0 {
+		cloneMode.Depth = 1
+	}
+	return cloneMode
+}
+
+// gitDetectCloneMode reads the clone mode from the repository, which records
+// the partial clone filter, the fetched branches and the tag option of the
+// primary remote.
+func gitDetectCloneMode(repoPath string) (repoCloneMode, error) {
+	mode := repoCloneMode{}
+
+	repo, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return mode, err
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		return mode, err
+	}
+
+	remoteName, err := gitRepoPrimaryRemoteName(repo)
+	if err != nil {
+		return mode, err
+	}
+
+	if remote, ok := cfg.Remotes[remoteName]; ok && len(remote.Fetch) > 0 {
+		mode.SingleBranch = !slices.ContainsFunc(remote.Fetch, func(refSpec config.RefSpec) bool {
+			return refSpec.IsWildcard()
+		})
+	}
+
+	remoteSection := cfg.Raw.Section("remote").Subsection(remoteName)
+	mode.Filter = remoteSection.Option("partialclonefilter")
+	mode.NoTags = remoteSection.Option("tagopt") == "--no-tags"
+
+	shallowCommits, err := repo.Storer.Shallow()
+	if err != nil {
+		return mode, err
+	}
+	mode.Shallow = len(shallowCommits) > 0
+
+	return mode, nil
+}
+
+// catalogCloneModes maps catalog locations to the clone mode of their
+// repository. It is loaded once, and is empty without a catalog.
+var catalogCloneModes = sync.OnceValue(func() map[string]fconfig.CloneMode {
+	set, err := loadCatalogSetForCurrentRuntimeContext()
+	if err != nil {
+		return nil
+	}
+
+	return catalogCloneModesByLocation(set.View)
+})
+
+func catalogCloneModesByLocation(catalog *fconfig.Catalog) map[string]fconfig.CloneMode {
+	modes := make(map[string]fconfig.CloneMode)
+	if catalog == nil {
+		return modes
+	}
+
+	for _, repo := range catalog.Repos {
+		if repo.Clone == nil {
+			continue
+		}
+		for _, location := range repo.Locations {
+			modes[filepath.Clean(location.Path)] = *repo.Clone
+		}
+	}
+
+	return modes
+}
+
+// lookupRepoCloneMode returns the clone mode of a local repository, with the
+// depth of shallow repositories taken from the catalog.
+func lookupRepoCloneMode(repoPath string) (repoCloneMode, error) {
+	mode, err := gitDetectCloneMode(repoPath)
+	if err != nil {
+		return mode, err
+	}
+
+	if mode.Shallow {
+		if recorded, ok := catalogCloneModes()[filepath.Clean(repoPath)]; ok {
+			mode.Depth = recorded.Depth
+		}
+	}
+
+	return mode, nil
+}
+
+// recordCatalogCloneMode stores the clone mode of a new clone in the catalogs
+// of its scope, adding the repository to the owned catalog when none lists
+// it. Nothing is recorded for regular clones or without a catalog.
+func recordCatalogCloneMode(id, remoteURL, repoPath string, mode fconfig.CloneMode) error {
+	if mode.IsZero() {
+		return nil
+	}
+
+	runtimeCtx, err := loadConfigRuntimeContext()
+	if err != nil {
+		return err
+	}
+
+	return recordCatalogCloneModeInRuntimeContext(id, remoteURL, repoPath, mode, runtimeCtx)
+}
+
+func recordCatalogCloneModeInRuntimeContext(id, remoteURL, repoPath string, mode fconfig.CloneMode, runtimeCtx configRuntimeContext) error {
+	runtimeCtx.Cwd = repoPath
+
+	cfg, err := fconfig.LoadEffectiveConfig(runtimeCtx.HomeDir, runtimeCtx.Cwd, runtimeCtx.XDGConfigHome)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(cfg.Catalog.Path); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	set, err := loadCatalogSetForEffectiveConfig(cfg, runtimeCtx.HomeDir)
+	if err != nil {
+		return err
+	}
+
+	entry := fconfig.RepoEntry{
+		ID:        id,
+		RemoteURL: giturl.Sanitize(remoteURL),
+		Locations: []fconfig.RepoLocation{{Path: filepath.Clean(repoPath)}},
+		Clone:     &mode,
+	}
+
+	sources, err := set.resolveTagSources(id)
+	if err != nil {
+		// not cataloged yet
+		sources = []*catalogSource{&set.Sources[0]}
+	}
+
+	for _, source := range sources {
+		source.Catalog.Upsert(entry)
+		if err := fconfig.SaveCatalog(source.CatalogPath, source.Catalog); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
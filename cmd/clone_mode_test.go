@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+
+	"github.com/zbiljic/fget/pkg/fconfig"
+)
+
+func TestGitCloneModeIsDetectedAndKeptShallow(t *testing.T) {
+	repo, remote := initCommittedRepo(t)
+	configureOrigin(t, repo, remote)
+	writeTestFile(t, filepath.Join(repo, "tracked.txt"), "second\n")
+	gitRun(t, repo, "commit", "-am", "second")
+	gitRun(t, repo, "branch", "feature")
+	pushMain(t, repo)
+	gitRun(t, repo, "push", "origin", "feature")
+	gitRun(t, remote, "symbolic-ref", "HEAD", "refs/heads/main")
+	gitRun(t, remote, "config", "uploadpack.allowfilter", "true")
+
+	target := filepath.Join(t.TempDir(), "example.com", "acme", "api")
+	mode := fconfig.CloneMode{Depth: 1, Filter: "blob:none", SingleBranch: true, NoTags: true}
+	if err := gitClone(context.Background(), "file://"+remote, target, git.DefaultRemoteName, mode, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	detected, err := gitDetectCloneMode(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := repoCloneMode{CloneMode: fconfig.CloneMode{Filter: "blob:none", SingleBranch: true, NoTags: true}, Shallow: true}
+	if detected != want {
+		t.Fatalf("gitDetectCloneMode() = %+v, want %+v", detected, want)
+	}
+	if got := detected.cloneMode(); got != mode {
+		t.Fatalf("cloneMode() = %+v, want %+v", got, mode)
+	}
+
+	if err := gitClone(context.Background(), "file://"+remote, target, git.DefaultRemoteName, mode, nil); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("second gitClone() error = %v, want already exists", err)
+	}
+
+	writeTestFile(t, filepath.Join(repo, "tracked.txt"), "third\n")
+	gitRun(t, repo, "commit", "-am", "third")
+	pushMain(t, repo)
+	if out, err := gitRepoPathPull(target); err != nil {
+		t.Fatalf("pull error = %v\n%s", err, out)
+	}
+
+	ctx := context.WithValue(context.Background(), ctxKeyPrintProjectInfoHeaderFn{}, func() {})
+	if err := gitFetchDepth(ctx, target, 1); err != nil {
+		t.Fatal(err)
+	}
+	count, err := gitRepoCommitCountContext(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("commit count = %d, want 1", count)
+	}
+	if got, want := gitOutput(t, target, "rev-parse", "HEAD"), gitOutput(t, repo, "rev-parse", "HEAD"); got != want {
+		t.Fatalf("HEAD = %s, want %s", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(target, ".git", "shallow")); err != nil {
+		t.Fatalf("repository is no longer shallow: %v", err)
+	}
+}
+
+func TestCatalogCloneModesByLocation(t *testing.T) {
+	t.Parallel()
+
+	catalog := &fconfig.Catalog{Repos: []fconfig.RepoEntry{
+		{
+			ID:        "github.com/acme/api",
+			Locations: []fconfig.RepoLocation{{Path: "/src/github.com/acme/api/"}},
+			Clone:     &fconfig.CloneMode{Depth: 5},
+		},
+		{
+			ID:        "github.com/acme/web",
+			Locations: []fconfig.RepoLocation{{Path: "/src/github.com/acme/web"}},
+		},
+	}}
+
+	modes := catalogCloneModesByLocation(catalog)
+	if len(modes) != 1 || modes["/src/github.com/acme/api"].Depth != 5 {
+		t.Fatalf("catalogCloneModesByLocation() = %+v", modes)
+	}
+}
+
+func TestRecordCatalogCloneModeInRuntimeContext(t *testing.T) {
+	t.Parallel()
+
+	scopeRoot := t.TempDir()
+	homeDir := t.TempDir()
+	repoPath := filepath.Join(scopeRoot, "src", "github.com", "acme", "api")
+	mustMkdirAll(t, repoPath)
+	runtimeCtx := configRuntimeContext{HomeDir: homeDir, Cwd: scopeRoot}
+	mode := fconfig.CloneMode{Depth: 1, Filter: "blob:none"}
+
+	if err := recordCatalogCloneModeInRuntimeContext("github.com/acme/api", "https://github.com/acme/api", repoPath, mode, runtimeCtx); err != nil {
+		t.Fatalf("recordCatalogCloneModeInRuntimeContext() without catalog error = %v, want nil", err)
+	}
+
+	configContent := "version: \"2\"\n" +
+		"roots:\n" +
+		"  - ./src\n" +
+		"catalog:\n" +
+		"  path: ./fget.catalog.yaml\n"
+	writeTestFile(t, filepath.Join(scopeRoot, fconfigFilename), configContent)
+	catalogPath := filepath.Join(scopeRoot, "fget.catalog.yaml")
+	if err := fconfig.SaveCatalog(catalogPath, &fconfig.Catalog{Version: fconfig.CatalogVersionV1, ScopeRoot: scopeRoot}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := recordCatalogCloneModeInRuntimeContext("github.com/acme/api", "https://github.com/acme/api", repoPath, mode, runtimeCtx); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := fconfig.LoadCatalogWithScope(catalogPath, scopeRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := fconfig.ResolveRepoIndex(saved, "github.com/acme/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := saved.Repos[index]
+	if entry.Clone == nil || *entry.Clone != mode {
+		t.Fatalf("saved clone mode = %+v, want %+v", entry.Clone, mode)
+	}
+	if len(entry.Locations) != 1 || entry.Locations[0].Path != repoPath {
+		t.Fatalf("saved locations = %+v", entry.Locations)
+	}
+}
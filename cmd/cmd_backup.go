@@ -4,7 +4,7 @@ import "github.com/spf13/cobra"
 
 var backupCmd = &cobra.Command{
 	Use:   "backup",
-	Short: "Audit, create, and verify repository backups",
+	Short: "Audit, create, verify, restore, and prune repository backups",
 }
 
 func init() {
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"os"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -18,13 +20,17 @@ import (
 	"github.com/zbiljic/fget/pkg/fsfind"
 )
 
-const backupAuditRemoteTimeout = 10 * time.Second
+const (
+	backupAuditRemoteTimeout = 10 * time.Second
+	backupAuditLFSTimeout    = time.Minute
+)
 
 type backupAuditFlags struct {
-	CatalogPath   string
-	Output        string
-	VerifyRemotes bool
-	Workers       int
+	CatalogPath       string
+	Output            string
+	VerifyRemotes     bool
+	RecurseSubmodules bool
+	Workers           int
 }
 
 type backupAuditCatalog struct {
@@ -46,7 +52,7 @@ var (
 	backupAuditInspectRepoFn      = inspectBackupAuditRepository
 	backupAuditNowFn              = func() time.Time { return time.Now().UTC() }
 	backupAuditLoadCatalogFn      = loadBackupAuditCatalog
-	backupAuditGitRunnerFactoryFn = func() backupGitRunner { return backupGitCLI{} }
+	backupAuditGitRunnerFactoryFn = func() backupGitRunner { return gitRemoteRunner() }
 )
 
 var backupAuditCmd = &cobra.Command{
@@ -62,6 +68,7 @@ func init() {
 	backupAuditCmd.Flags().StringVar(&backupAuditCmdFlags.CatalogPath, "catalog", "", "Explicit catalog file")
 	backupAuditCmd.Flags().StringVar(&backupAuditCmdFlags.Output, "output", "-", "Output file path, or - for stdout")
 	backupAuditCmd.Flags().BoolVar(&backupAuditCmdFlags.VerifyRemotes, "verify-remotes", false, "Verify remote reachability with git ls-remote")
+	backupAuditCmd.Flags().BoolVar(&backupAuditCmdFlags.RecurseSubmodules, "recurse-submodules", false, "Inspect initialized submodules and classify them with their parent")
 	backupAuditCmd.Flags().IntVarP(&backupAuditCmdFlags.Workers, "workers", "j", int(poolDefaultMaxWorkers), "Set the maximum number of workers to use")
 }
 
@@ -297,6 +304,23 @@ func inspectBackupAuditRepository(
 		}
 	}
 
+	record := buildBackupAuditEntry(ctx, repoPath, repoID, remoteURL, localProbe, flags, runner)
+	if record.ID == "" {
+		record.ID = filepath.Clean(repoPath)
+	}
+
+	return record, nil
+}
+
+func buildBackupAuditEntry(
+	ctx context.Context,
+	repoPath string,
+	repoID string,
+	remoteURL string,
+	localProbe backupLocalProbe,
+	flags backupAuditFlags,
+	runner backupGitRunner,
+) fbackup.RepositoryEntry {
 	remoteState := fbackup.RemoteStateUnchecked
 	remoteReason := ""
 	if flags.VerifyRemotes {
@@ -310,7 +334,17 @@ func inspectBackupAuditRepository(
 		}
 	}
 
-	record := fbackup.BuildRepositoryEntry(fbackup.RepositoryProbe{
+	lfsCheck := backupLFSCheck{}
+	if localProbe.HasLocalLFSObjects {
+		lfsCheck.State = fbackup.LFSStateUnchecked
+		if remoteState == fbackup.RemoteStateReachable {
+			lfsCtx, cancel := context.WithTimeout(ctx, backupAuditLFSTimeout)
+			lfsCheck = verifyBackupLFSObjects(lfsCtx, repoPath, remoteURL, runner)
+			cancel()
+		}
+	}
+
+	probe := fbackup.RepositoryProbe{
 		ID:                   repoID,
 		Path:                 filepath.Clean(repoPath),
 		RemoteURL:            remoteURL,
@@ -323,15 +357,74 @@ func inspectBackupAuditRepository(
 		RemoteReason:         remoteReason,
 		HasLFSAttributes:     localProbe.HasLFSAttributes,
 		HasLocalLFSObjects:   localProbe.HasLocalLFSObjects,
+		LFSState:             lfsCheck.State,
+		LFSReason:            lfsCheck.Reason,
+		LocalLFSObjectCount:  lfsCheck.ObjectCount,
+		MissingLFSObjects:    lfsCheck.Missing,
 		HasSubmodules:        localProbe.HasSubmodules,
 		EstimatedSourceBytes: localProbe.EstimatedSourceBytes,
 		Errors:               append([]fbackup.RepositoryError(nil), localProbe.Errors...),
-	})
-	if record.ID == "" {
-		record.ID = filepath.Clean(repoPath)
+	}
+	if flags.RecurseSubmodules && localProbe.HasSubmodules {
+		submodules, err := inspectBackupSubmodules(ctx, repoPath, repoID, flags, runner)
+		if err != nil {
+			probe.Errors = append(probe.Errors, fbackup.RepositoryError{
+				Code:      "submodule-inspection-failed",
+				Operation: "submodules",
+				Message:   "initialized submodules could not be inspected",
+			})
+		} else {
+			probe.Submodules = submodules
+			probe.SubmodulesInspected = true
+		}
 	}
 
-	return record, nil
+	return fbackup.BuildRepositoryEntry(probe)
+}
+
+// inspectBackupSubmodules probes every initialized submodule of repoPath and
+// recurses into nested submodules. Uninitialized submodules have no local
+// state to lose and are skipped.
+func inspectBackupSubmodules(
+	ctx context.Context,
+	repoPath string,
+	parentID string,
+	flags backupAuditFlags,
+	runner backupGitRunner,
+) ([]fbackup.SubmoduleEntry, error) {
+	gitlinks, err := backupSubmoduleGitlinks(ctx, repoPath, runner)
+	if err != nil {
+		return nil, err
+	}
+
+	submodules := make([]fbackup.SubmoduleEntry, 0, len(gitlinks))
+	for _, gitlink := range gitlinks {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		submodulePath := filepath.Join(repoPath, filepath.FromSlash(gitlink.Path))
+		if _, err := os.Lstat(filepath.Join(submodulePath, ".git")); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+
+		localProbe := inspectBackupLocalRepository(ctx, submodulePath, runner)
+		submoduleID := parentID + "/" + gitlink.Path
+		if localProbe.RemoteURL != "" {
+			if derivedID, err := gitRemoteURLProjectID(localProbe.RemoteURL); err == nil {
+				submoduleID = derivedID
+			}
+		}
+		submodules = append(submodules, fbackup.SubmoduleEntry{
+			Path:           gitlink.Path,
+			RecordedCommit: gitlink.Commit,
+			Repository:     buildBackupAuditEntry(ctx, submodulePath, submoduleID, localProbe.RemoteURL, localProbe, flags, runner),
+		})
+	}
+
+	return submodules, nil
 }
 
 func backupCatalogLookup(index *backupCatalogIndex, repoPath, remoteURL string) *fconfig.RepoEntry {
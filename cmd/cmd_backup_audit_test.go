@@ -3,6 +3,8 @@ package cmd
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,6 +12,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -18,6 +21,8 @@ import (
 
 	"github.com/zbiljic/fget/pkg/fbackup"
 	"github.com/zbiljic/fget/pkg/fconfig"
+	"github.com/zbiljic/fget/pkg/gitlfs"
+	"github.com/zbiljic/fget/pkg/gitlfs/gitlfstest"
 )
 
 func TestBackupAuditDeterministicJSON(t *testing.T) {
@@ -367,6 +372,118 @@ func TestBackupAuditSubmoduleWithHiddenBranchIsProblem(t *testing.T) {
 	}
 }
 
+func TestBackupAuditRecurseSubmodulesClassifiesNestedRepositories(t *testing.T) {
+	rootDir := t.TempDir()
+	superRepoDir := filepath.Join(rootDir, "super")
+	subRepoDir := filepath.Join(rootDir, "sub-work")
+	superRemoteDir := filepath.Join(rootDir, "super-remote.git")
+	subRemoteDir := filepath.Join(rootDir, "sub-remote.git")
+
+	initRepoAtPath(t, superRepoDir, superRemoteDir)
+	configureOrigin(t, superRepoDir, superRemoteDir)
+	pushMain(t, superRepoDir)
+
+	initRepoAtPath(t, subRepoDir, subRemoteDir)
+	configureOrigin(t, subRepoDir, subRemoteDir)
+	pushMain(t, subRepoDir)
+
+	gitRunWithEnv(t, superRepoDir, []string{"GIT_ALLOW_PROTOCOL=file"}, "submodule", "add", subRemoteDir, "deps/sub")
+	gitRun(t, superRepoDir, "commit", "-am", "add submodule")
+	gitRun(t, superRepoDir, "push", "origin", "main")
+	recordedCommit := strings.TrimSpace(gitOutput(t, filepath.Join(superRepoDir, "deps", "sub"), "rev-parse", "HEAD"))
+
+	flags := backupAuditFlags{VerifyRemotes: true, RecurseSubmodules: true, Workers: 1}
+	record, err := inspectBackupAuditRepository(context.Background(), superRepoDir, flags, nil)
+	if err != nil {
+		t.Fatalf("inspectBackupAuditRepository() error = %v", err)
+	}
+	if record.Classification != fbackup.ClassificationRecloneable {
+		t.Fatalf("Classification = %q, want %q (reasons %v, errors %+v)", record.Classification, fbackup.ClassificationRecloneable, record.ReasonCodes, record.Errors)
+	}
+	if len(record.Submodules) != 1 {
+		t.Fatalf("len(Submodules) = %d, want 1", len(record.Submodules))
+	}
+	submodule := record.Submodules[0]
+	if submodule.Path != "deps/sub" || submodule.RecordedCommit != recordedCommit {
+		t.Fatalf("submodule = %q at %q, want deps/sub at %q", submodule.Path, submodule.RecordedCommit, recordedCommit)
+	}
+	if submodule.Repository.Classification != fbackup.ClassificationRecloneable {
+		t.Fatalf("submodule Classification = %q, want %q", submodule.Repository.Classification, fbackup.ClassificationRecloneable)
+	}
+
+	submodulePath := filepath.Join(superRepoDir, "deps", "sub")
+	writeTestFile(t, filepath.Join(submodulePath, "scratch.txt"), "scratch\n")
+
+	record, err = inspectBackupAuditRepository(context.Background(), superRepoDir, flags, nil)
+	if err != nil {
+		t.Fatalf("inspectBackupAuditRepository() error = %v", err)
+	}
+	if got := record.Submodules[0].Repository.Classification; got != fbackup.ClassificationDelta {
+		t.Fatalf("submodule Classification = %q, want %q", got, fbackup.ClassificationDelta)
+	}
+	if record.Classification != fbackup.ClassificationFull {
+		t.Fatalf("Classification = %q, want %q", record.Classification, fbackup.ClassificationFull)
+	}
+	if !slices.Contains(record.ReasonCodes, "submodule-not-recloneable") {
+		t.Fatalf("ReasonCodes = %v, want submodule-not-recloneable", record.ReasonCodes)
+	}
+}
+
+func TestBackupAuditLFSObjectsMissingUpstreamAreDelta(t *testing.T) {
+	repoDir, remoteDir := initCommittedRepo(t)
+	configureOrigin(t, repoDir, remoteDir)
+	pushMain(t, repoDir)
+	stored := writeTestLFSObject(t, repoDir, "already uploaded\n")
+	local := writeTestLFSObject(t, repoDir, "only on this machine\n")
+
+	server := gitlfstest.NewServer(t, stored)
+	gitRun(t, repoDir, "config", "lfs.url", server.Endpoint())
+
+	flags := backupAuditFlags{VerifyRemotes: true, Workers: 1}
+	record, err := inspectBackupAuditRepository(context.Background(), repoDir, flags, nil)
+	if err != nil {
+		t.Fatalf("inspectBackupAuditRepository() error = %v", err)
+	}
+	if record.Classification != fbackup.ClassificationDelta {
+		t.Fatalf("Classification = %q, want %q (reasons %v, lfs %q %q)", record.Classification, fbackup.ClassificationDelta, record.ReasonCodes, record.LFSState, record.LFSReason)
+	}
+	if record.LFSState != fbackup.LFSStateVerified || record.LocalLFSObjectCount != 2 {
+		t.Fatalf("LFS state = %q with %d objects, want verified with 2", record.LFSState, record.LocalLFSObjectCount)
+	}
+	if len(record.MissingLFSObjects) != 1 || record.MissingLFSObjects[0] != local {
+		t.Fatalf("MissingLFSObjects = %v, want [%v]", record.MissingLFSObjects, local)
+	}
+
+	server.Add(local)
+	record, err = inspectBackupAuditRepository(context.Background(), repoDir, flags, nil)
+	if err != nil {
+		t.Fatalf("inspectBackupAuditRepository() error = %v", err)
+	}
+	if record.Classification != fbackup.ClassificationRecloneable || len(record.MissingLFSObjects) != 0 {
+		t.Fatalf("Classification = %q with missing %v, want recloneable", record.Classification, record.MissingLFSObjects)
+	}
+
+	server.Username = "user"
+	record, err = inspectBackupAuditRepository(context.Background(), repoDir, flags, nil)
+	if err != nil {
+		t.Fatalf("inspectBackupAuditRepository() error = %v", err)
+	}
+	if record.Classification != fbackup.ClassificationFull || record.LFSState != fbackup.LFSStateFailed {
+		t.Fatalf("Classification = %q with LFS state %q, want full after a failed check", record.Classification, record.LFSState)
+	}
+	if record.LFSReason != "LFS server authentication failed" {
+		t.Fatalf("LFSReason = %q", record.LFSReason)
+	}
+}
+
+func writeTestLFSObject(t *testing.T, repoDir, content string) gitlfs.Object {
+	t.Helper()
+	sum := sha256.Sum256([]byte(content))
+	object := gitlfs.Object{OID: hex.EncodeToString(sum[:]), Size: int64(len(content))}
+	writeTestFile(t, filepath.Join(repoDir, ".git", "lfs", "objects", filepath.FromSlash(gitlfs.ObjectPath(object.OID))), content)
+	return object
+}
+
 func TestBackupAuditManifestRemoteReasonRedacted(t *testing.T) {
 	state, reason := verifyBackupRemote(context.Background(), "/repo", backupGitStub{
 		result: backupGitOutput{},
@@ -12,11 +12,22 @@ import (
 )
 
 type backupCreateFlags struct {
-	Manifest    string
-	Destination string
+	Manifest         string
+	Destination      string
+	Staging          string
+	Base             string
+	Compression      string
+	CompressionLevel int
+	Recipient        string
+	PassphraseFile   string
+	ChunkStore       string
+	Workers          int
 }
 
-var backupCreateCmdFlags backupCreateFlags
+var backupCreateCmdFlags = backupCreateFlags{
+	Compression: fbackup.CodecGzip,
+	Workers:     int(poolDefaultMaxWorkers),
+}
 
 var backupCreateCmd = &cobra.Command{
 	Use:   "create",
@@ -28,7 +39,15 @@ var backupCreateCmd = &cobra.Command{
 func init() {
 	backupCmd.AddCommand(backupCreateCmd)
 	backupCreateCmd.Flags().StringVar(&backupCreateCmdFlags.Manifest, "manifest", "", "Audit manifest JSON file")
-	backupCreateCmd.Flags().StringVar(&backupCreateCmdFlags.Destination, "destination", "", "Backup destination directory")
+	backupCreateCmd.Flags().StringVar(&backupCreateCmdFlags.Destination, "destination", "", "Backup destination directory or s3://bucket/prefix")
+	backupCreateCmd.Flags().StringVar(&backupCreateCmdFlags.Staging, "staging", "", "Local directory for the checkpoint of an s3:// backup")
+	backupCreateCmd.Flags().StringVar(&backupCreateCmdFlags.Base, "base", "", "Previous complete backup to reuse unchanged artifacts from")
+	backupCreateCmd.Flags().StringVar(&backupCreateCmdFlags.Compression, "compression", fbackup.CodecGzip, "Tar archive compression: gzip, zstd, or none")
+	backupCreateCmd.Flags().IntVar(&backupCreateCmdFlags.CompressionLevel, "compression-level", 0, "Compression level (gzip 1-9, zstd 1-22; 0 uses the codec default)")
+	backupCreateCmd.Flags().StringVar(&backupCreateCmdFlags.Recipient, "recipient", "", "Encrypt artifacts to this age public key")
+	backupCreateCmd.Flags().StringVar(&backupCreateCmdFlags.PassphraseFile, "passphrase-file", "", "Encrypt artifacts with the passphrase in this file")
+	backupCreateCmd.Flags().StringVar(&backupCreateCmdFlags.ChunkStore, "chunk-store", "", "Store artifacts as deduplicated chunks in this shared directory")
+	backupCreateCmd.Flags().IntVarP(&backupCreateCmdFlags.Workers, "workers", "j", int(poolDefaultMaxWorkers), "Set the maximum number of workers to use")
 }
 
 func runBackupCreate(cmd *cobra.Command, _ []string) error {
@@ -39,6 +58,13 @@ func runBackupCreate(cmd *cobra.Command, _ []string) error {
 	if strings.TrimSpace(flags.Destination) == "" {
 		return errors.New("--destination is required")
 	}
+	if flags.Workers <= 0 {
+		return errors.New("--workers must be greater than zero")
+	}
+	encryption, err := loadBackupEncryption(flags.Recipient, flags.PassphraseFile)
+	if err != nil {
+		return err
+	}
 	data, err := os.ReadFile(flags.Manifest)
 	if err != nil {
 		return fmt.Errorf("read manifest: %w", err)
@@ -52,7 +78,14 @@ func runBackupCreate(cmd *cobra.Command, _ []string) error {
 	}
 	return fbackup.Create(cmd.Context(), fbackup.CreateOptions{
 		Destination: flags.Destination,
+		Staging:     flags.Staging,
 		Manifest:    manifest,
+		Base:        flags.Base,
+		Compression: fbackup.Compression{Codec: flags.Compression, Level: flags.CompressionLevel},
+		Encryption:  encryption,
+		ChunkStore:  flags.ChunkStore,
+		Workers:     flags.Workers,
+		GitRunner:   gitRemoteRunner(),
 		Progress: func(id, status string) {
 			_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "%s: %s\n", id, status)
 		},
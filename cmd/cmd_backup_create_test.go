@@ -33,7 +33,7 @@ func TestRunBackupCreateAndVerifyCommands(t *testing.T) {
 	originalCreate := backupCreateCmdFlags
 	originalVerify := backupVerifyCmdFlags
 	t.Cleanup(func() { backupCreateCmdFlags = originalCreate; backupVerifyCmdFlags = originalVerify })
-	backupCreateCmdFlags = backupCreateFlags{Manifest: manifestPath, Destination: destination}
+	backupCreateCmdFlags = backupCreateFlags{Manifest: manifestPath, Destination: destination, Compression: fbackup.CodecZstd, Workers: 2}
 	command := &cobra.Command{}
 	command.SetContext(context.Background())
 	var stderr bytes.Buffer
@@ -53,8 +53,9 @@ func TestRunBackupCreateFlagValidation(t *testing.T) {
 	command := &cobra.Command{}
 	command.SetContext(context.Background())
 	cases := []backupCreateFlags{
-		{Destination: "backup"},
-		{Manifest: "manifest.json"},
+		{Destination: "backup", Workers: 1},
+		{Manifest: "manifest.json", Workers: 1},
+		{Manifest: "manifest.json", Destination: "backup"},
 	}
 	for _, flags := range cases {
 		backupCreateCmdFlags = flags
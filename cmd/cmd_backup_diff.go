@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/zbiljic/fget/pkg/fbackup"
+)
+
+type backupDiffFlags struct {
+	Output string
+}
+
+var backupDiffCmdFlags = backupDiffFlags{Output: "text"}
+
+var backupDiffCmd = &cobra.Command{
+	Use:   "diff FROM TO",
+	Short: "Compare two audit manifests or backups",
+	Long: `Compare two audit manifests or backups by repository ID.
+
+FROM and TO are audit manifest files, backup.json files, or backup
+directories. The report lists added and removed repositories and, for the
+others, changes to classification, remote state, HEAD, upstream, local-only
+commit count, and untracked bytes.`,
+	Args: cobra.ExactArgs(2),
+	RunE: runBackupDiff,
+}
+
+func init() {
+	backupCmd.AddCommand(backupDiffCmd)
+	backupDiffCmd.Flags().StringVarP(&backupDiffCmdFlags.Output, "output", "o", "text", "Output format: text, json, or tsv")
+}
+
+func runBackupDiff(cmd *cobra.Command, args []string) error {
+	switch backupDiffCmdFlags.Output {
+	case "text", "json", "tsv":
+	default:
+		return fmt.Errorf("unsupported output format %q", backupDiffCmdFlags.Output)
+	}
+	from, err := fbackup.ReadManifest(args[0])
+	if err != nil {
+		return err
+	}
+	to, err := fbackup.ReadManifest(args[1])
+	if err != nil {
+		return err
+	}
+	diff := fbackup.DiffManifests(from, to)
+	diff.From, diff.To = args[0], args[1]
+	return writeBackupDiff(cmd.OutOrStdout(), backupDiffCmdFlags.Output, diff)
+}
+
+func writeBackupDiff(w io.Writer, format string, diff fbackup.ManifestDiff) error {
+	switch format {
+	case "json":
+		return outputJSON(w, diff)
+	case "tsv":
+		return writeBackupDiffTSV(w, diff)
+	}
+
+	markers := map[string]string{fbackup.DiffAdded: "+", fbackup.DiffRemoved: "-", fbackup.DiffChanged: "~"}
+	for _, repository := range diff.Repositories {
+		if _, err := fmt.Fprintf(w, "%s %s (%s)\n", markers[repository.Status], repository.ID, repository.Classification); err != nil {
+			return err
+		}
+		for _, change := range repository.Changes {
+			line := fmt.Sprintf("    %s: %s -> %s", change.Field, backupDiffValue(change.From), backupDiffValue(change.To))
+			if change.Delta != nil {
+				line += fmt.Sprintf(" (%+d)", *change.Delta)
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func backupDiffValue(value string) string {
+	if value == "" {
+		return "(none)"
+	}
+	return value
+}
+
+// writeBackupDiffTSV writes one row per changed field. Added and removed
+// repositories get a single row without a field.
+func writeBackupDiffTSV(w io.Writer, diff fbackup.ManifestDiff) error {
+	writer := csv.NewWriter(w)
+	writer.Comma = '\t'
+	if err := writer.Write([]string{"id", "status", "classification", "field", "from", "to", "delta"}); err != nil {
+		return err
+	}
+	for _, repository := range diff.Repositories {
+		prefix := []string{repository.ID, repository.Status, string(repository.Classification)}
+		if len(repository.Changes) == 0 {
+			if err := writer.Write(append(prefix, "", "", "", "")); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, change := range repository.Changes {
+			delta := ""
+			if change.Delta != nil {
+				delta = strconv.FormatInt(*change.Delta, 10)
+			}
+			if err := writer.Write(append(prefix, change.Field, change.From, change.To, delta)); err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
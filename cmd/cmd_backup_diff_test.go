@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+
+	"github.com/zbiljic/fget/pkg/fbackup"
+)
+
+func TestRunBackupDiffWritesTSVAndText(t *testing.T) {
+	root := t.TempDir()
+	write := func(name string, repositories ...fbackup.RepositoryEntry) string {
+		path := filepath.Join(root, name)
+		data, err := json.Marshal(fbackup.Manifest{Version: fbackup.ManifestVersion, Repositories: repositories})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	from := write("from.json",
+		fbackup.RepositoryEntry{ID: "github.com/acme/work", Classification: fbackup.ClassificationDelta, UntrackedBytes: 10},
+	)
+	to := write("to.json",
+		fbackup.RepositoryEntry{ID: "github.com/acme/new", Classification: fbackup.ClassificationRecloneable},
+		fbackup.RepositoryEntry{ID: "github.com/acme/work", Classification: fbackup.ClassificationFull, UntrackedBytes: 25},
+	)
+
+	original := backupDiffCmdFlags
+	t.Cleanup(func() { backupDiffCmdFlags = original })
+	command := &cobra.Command{}
+	command.SetContext(context.Background())
+	var output bytes.Buffer
+	command.SetOut(&output)
+
+	backupDiffCmdFlags = backupDiffFlags{Output: "tsv"}
+	if err := runBackupDiff(command, []string{from, to}); err != nil {
+		t.Fatal(err)
+	}
+	want := "id\tstatus\tclassification\tfield\tfrom\tto\tdelta\n" +
+		"github.com/acme/new\tadded\trecloneable\t\t\t\t\n" +
+		"github.com/acme/work\tchanged\tfull\tclassification\tdelta\tfull\t\n" +
+		"github.com/acme/work\tchanged\tfull\tuntracked_bytes\t10\t25\t15\n"
+	if got := output.String(); got != want {
+		t.Fatalf("tsv output = %q, want %q", got, want)
+	}
+
+	output.Reset()
+	backupDiffCmdFlags = backupDiffFlags{Output: "text"}
+	if err := runBackupDiff(command, []string{from, to}); err != nil {
+		t.Fatal(err)
+	}
+	want = "+ github.com/acme/new (recloneable)\n" +
+		"~ github.com/acme/work (full)\n" +
+		"    classification: delta -> full\n" +
+		"    untracked_bytes: 10 -> 25 (+15)\n"
+	if got := output.String(); got != want {
+		t.Fatalf("text output = %q, want %q", got, want)
+	}
+
+	backupDiffCmdFlags = backupDiffFlags{Output: "yaml"}
+	if err := runBackupDiff(command, []string{from, to}); err == nil {
+		t.Fatal("runBackupDiff() accepted an unsupported output format")
+	}
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/zbiljic/fget/pkg/fbackup"
+)
+
+type backupPruneFlags struct {
+	Root        string
+	KeepDaily   int
+	KeepWeekly  int
+	KeepMonthly int
+	DryRun      bool
+	Output      string
+}
+
+var backupPruneCmdFlags = backupPruneFlags{Output: "text"}
+
+var backupPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete dated backup directories outside the retention policy",
+	Args:  cobra.NoArgs,
+	RunE:  runBackupPrune,
+}
+
+func init() {
+	backupCmd.AddCommand(backupPruneCmd)
+	backupPruneCmd.Flags().StringVar(&backupPruneCmdFlags.Root, "root", "", "Directory holding one backup directory per run")
+	backupPruneCmd.Flags().IntVar(&backupPruneCmdFlags.KeepDaily, "keep-daily", 0, "Keep the newest backup of this many days")
+	backupPruneCmd.Flags().IntVar(&backupPruneCmdFlags.KeepWeekly, "keep-weekly", 0, "Keep the newest backup of this many weeks")
+	backupPruneCmd.Flags().IntVar(&backupPruneCmdFlags.KeepMonthly, "keep-monthly", 0, "Keep the newest backup of this many months")
+	backupPruneCmd.Flags().BoolVar(&backupPruneCmdFlags.DryRun, "dry-run", false, "Report what would be deleted without deleting")
+	backupPruneCmd.Flags().StringVarP(&backupPruneCmdFlags.Output, "output", "o", "text", "Output format: text or json")
+}
+
+func runBackupPrune(cmd *cobra.Command, _ []string) error {
+	flags := backupPruneCmdFlags
+	if err := validateBackupPruneFlags(flags); err != nil {
+		return err
+	}
+	result, err := fbackup.Prune(cmd.Context(), fbackup.PruneOptions{
+		Root:        flags.Root,
+		KeepDaily:   flags.KeepDaily,
+		KeepWeekly:  flags.KeepWeekly,
+		KeepMonthly: flags.KeepMonthly,
+		DryRun:      flags.DryRun,
+	})
+	if err != nil {
+		return err
+	}
+	return writeBackupPruneResult(cmd.OutOrStdout(), flags.Output, result)
+}
+
+func validateBackupPruneFlags(flags backupPruneFlags) error {
+	if strings.TrimSpace(flags.Root) == "" {
+		return errors.New("--root is required")
+	}
+	if flags.KeepDaily < 0 || flags.KeepWeekly < 0 || flags.KeepMonthly < 0 {
+		return errors.New("--keep-* values cannot be negative")
+	}
+	if flags.KeepDaily == 0 && flags.KeepWeekly == 0 && flags.KeepMonthly == 0 {
+		return errors.New("at least one of --keep-daily, --keep-weekly, or --keep-monthly is required")
+	}
+	switch flags.Output {
+	case "text", "json":
+	default:
+		return fmt.Errorf("unsupported output format %q", flags.Output)
+	}
+	return nil
+}
+
+func writeBackupPruneResult(w io.Writer, format string, result fbackup.PruneResult) error {
+	if format == "json" {
+		return outputJSON(w, result)
+	}
+
+	deleted := "delete"
+	if result.DryRun {
+		deleted = "would delete"
+	}
+	for _, entry := range result.Backups {
+		created := "-"
+		if !entry.CreatedAt.IsZero() {
+			created = entry.CreatedAt.UTC().Format(time.RFC3339)
+		}
+		action := deleted
+		if entry.Keep {
+			action = "keep (" + strings.Join(entry.Reasons, ", ") + ")"
+		}
+		if _, err := fmt.Fprintf(w, "%s\t%s\t%s\n", filepath.Base(entry.Path), created, action); err != nil {
+			return err
+		}
+	}
+	return nil
+}
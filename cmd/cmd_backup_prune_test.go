@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/zbiljic/fget/pkg/fbackup"
+)
+
+func TestRunBackupPruneFlagValidation(t *testing.T) {
+	original := backupPruneCmdFlags
+	t.Cleanup(func() { backupPruneCmdFlags = original })
+	command := &cobra.Command{}
+	command.SetContext(context.Background())
+	cases := []backupPruneFlags{
+		{KeepDaily: 7, Output: "text"},
+		{Root: "backups", Output: "text"},
+		{Root: "backups", KeepWeekly: -1, KeepDaily: 1, Output: "text"},
+		{Root: "backups", KeepMonthly: 12, Output: "yaml"},
+	}
+	for _, flags := range cases {
+		backupPruneCmdFlags = flags
+		if err := runBackupPrune(command, nil); err == nil {
+			t.Fatalf("runBackupPrune(%+v) succeeded", flags)
+		}
+	}
+}
+
+func TestWriteBackupPruneResultText(t *testing.T) {
+	result := fbackup.PruneResult{DryRun: true, Backups: []fbackup.PruneEntry{
+		{Path: "/backup/fget/2026-10-02", CreatedAt: time.Date(2026, 10, 2, 3, 0, 0, 0, time.UTC), Complete: true, Keep: true, Reasons: []string{"daily", "weekly"}},
+		{Path: "/backup/fget/2026-07-01", CreatedAt: time.Date(2026, 7, 1, 3, 0, 0, 0, time.UTC), Complete: true},
+	}}
+	var output bytes.Buffer
+	if err := writeBackupPruneResult(&output, "text", result); err != nil {
+		t.Fatal(err)
+	}
+	want := "2026-10-02\t2026-10-02T03:00:00Z\tkeep (daily, weekly)\n2026-07-01\t2026-07-01T03:00:00Z\twould delete\n"
+	if got := output.String(); got != want {
+		t.Fatalf("output = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/zbiljic/fget/pkg/fbackup"
+	"github.com/zbiljic/fget/pkg/fconfig"
+)
+
+type backupRestoreFlags struct {
+	Backup         string
+	Target         string
+	Repos          []string
+	Tags           []string
+	CatalogPath    string
+	Plan           bool
+	Output         string
+	Identities     []string
+	PassphraseFile string
+}
+
+var backupRestoreCmdFlags = backupRestoreFlags{Output: "text"}
+
+var backupRestoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Rebuild repositories from a verified backup directory",
+	Args:  cobra.NoArgs,
+	RunE:  runBackupRestore,
+}
+
+func init() {
+	backupCmd.AddCommand(backupRestoreCmd)
+	backupRestoreCmd.Flags().StringVar(&backupRestoreCmdFlags.Backup, "backup", "", "Backup directory or s3://bucket/prefix")
+	backupRestoreCmd.Flags().StringVar(&backupRestoreCmdFlags.Target, "target", "", "Root directory to restore repositories into")
+	backupRestoreCmd.Flags().StringSliceVar(&backupRestoreCmdFlags.Repos, "repo", nil, "Restore repository ID or glob pattern (repeatable)")
+	backupRestoreCmd.Flags().StringSliceVar(&backupRestoreCmdFlags.Tags, "tag", nil, "Restore repositories with any catalog tag (repeatable)")
+	backupRestoreCmd.Flags().StringVar(&backupRestoreCmdFlags.CatalogPath, "catalog", "", "Explicit catalog file used to resolve --tag")
+	backupRestoreCmd.Flags().BoolVar(&backupRestoreCmdFlags.Plan, "plan", false, "Print the restore plan without touching the target")
+	backupRestoreCmd.Flags().StringVarP(&backupRestoreCmdFlags.Output, "output", "o", "text", "Plan output format: text or json")
+	backupRestoreCmd.Flags().StringSliceVar(&backupRestoreCmdFlags.Identities, "identity", nil, "age identity file to decrypt artifacts with (repeatable)")
+	backupRestoreCmd.Flags().StringVar(&backupRestoreCmdFlags.PassphraseFile, "passphrase-file", "", "File with the passphrase to decrypt artifacts with")
+}
+
+func runBackupRestore(cmd *cobra.Command, _ []string) error {
+	flags := backupRestoreCmdFlags
+	if err := validateBackupRestoreFlags(flags); err != nil {
+		return err
+	}
+
+	keys, err := loadBackupKeys(flags.Identities, flags.PassphraseFile)
+	if err != nil {
+		return err
+	}
+	options := fbackup.RestoreOptions{
+		Backup:       flags.Backup,
+		Target:       flags.Target,
+		Repositories: flags.Repos,
+		Keys:         keys,
+		GitRunner:    gitRemoteRunner(),
+		Progress: func(id, status string) {
+			_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "%s: %s\n", id, status)
+		},
+	}
+	if len(flags.Tags) > 0 {
+		catalog, _, err := loadCatalogForExport(catalogExportFlags{CatalogPath: flags.CatalogPath})
+		if err != nil {
+			return err
+		}
+		options.Filter = backupRestoreTagFilter(catalog, flags.Tags)
+	}
+
+	if flags.Plan {
+		plan, err := fbackup.PlanRestore(cmd.Context(), options)
+		if err != nil {
+			return err
+		}
+		return writeBackupRestorePlan(cmd.OutOrStdout(), flags.Output, plan)
+	}
+
+	return fbackup.Restore(cmd.Context(), options)
+}
+
+func validateBackupRestoreFlags(flags backupRestoreFlags) error {
+	if strings.TrimSpace(flags.Backup) == "" {
+		return errors.New("--backup is required")
+	}
+	if strings.TrimSpace(flags.Target) == "" {
+		return errors.New("--target is required")
+	}
+	switch flags.Output {
+	case "text", "json":
+	default:
+		return fmt.Errorf("unsupported output format %q", flags.Output)
+	}
+	if flags.Output != "text" && !flags.Plan {
+		return errors.New("--output requires --plan")
+	}
+	return nil
+}
+
+func backupRestoreTagFilter(catalog *fconfig.Catalog, tags []string) func(fbackup.RepositoryEntry) bool {
+	wanted := normalizedStringSet(tags)
+	selected := make(map[string]struct{})
+	if catalog != nil {
+		for _, repo := range catalog.Repos {
+			if hasAnyCatalogTag(repo.Tags, wanted) {
+				selected[repo.ID] = struct{}{}
+			}
+		}
+	}
+
+	return func(entry fbackup.RepositoryEntry) bool {
+		_, ok := selected[entry.ID]
+		return ok
+	}
+}
+
+func writeBackupRestorePlan(w io.Writer, format string, plan fbackup.RestorePlan) error {
+	if format == "json" {
+		return outputJSON(w, plan)
+	}
+
+	for _, entry := range plan.Repositories {
+		state := "new"
+		if entry.TargetExists {
+			state = "exists"
+		}
+		if _, err := fmt.Fprintf(w, "%s (%s)\n  target: %s [%s]\n", entry.ID, entry.Classification, entry.Target, state); err != nil {
+			return err
+		}
+		if entry.RemoteURL != "" {
+			if _, err := fmt.Fprintf(w, "  clone: %s\n", entry.RemoteURL); err != nil {
+				return err
+			}
+		}
+		for _, artifact := range entry.Artifacts {
+			if _, err := fmt.Fprintf(w, "  %s: %s (%d bytes)\n", artifact.Kind, artifact.Path, artifact.Size); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+
+	"github.com/zbiljic/fget/pkg/fbackup"
+	"github.com/zbiljic/fget/pkg/fconfig"
+	"github.com/zbiljic/fget/pkg/gitinspect"
+)
+
+func TestRunBackupRestoreFlagValidation(t *testing.T) {
+	original := backupRestoreCmdFlags
+	t.Cleanup(func() { backupRestoreCmdFlags = original })
+	command := &cobra.Command{}
+	command.SetContext(context.Background())
+	cases := []backupRestoreFlags{
+		{Target: "restore", Output: "text"},
+		{Backup: "backup", Output: "text"},
+		{Backup: "backup", Target: "restore", Output: "yaml", Plan: true},
+		{Backup: "backup", Target: "restore", Output: "json"},
+	}
+	for _, flags := range cases {
+		backupRestoreCmdFlags = flags
+		if err := runBackupRestore(command, nil); err == nil {
+			t.Fatalf("runBackupRestore(%+v) succeeded", flags)
+		}
+	}
+}
+
+func TestRunBackupRestorePlanSelectsByTag(t *testing.T) {
+	root := t.TempDir()
+	repositories := make([]fbackup.RepositoryEntry, 0, 2)
+	for _, id := range []string{"github.com/acme/work", "github.com/acme/play"} {
+		repoPath := filepath.Join(root, "src", filepath.FromSlash(id))
+		mustMkdirAll(t, filepath.Dir(repoPath))
+		if output, err := exec.Command("git", "init", "-q", repoPath).CombinedOutput(); err != nil {
+			t.Fatalf("git init: %v (%s)", err, output)
+		}
+		state, err := gitinspect.InspectState(context.Background(), repoPath, gitinspect.CLIRunner{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		repositories = append(repositories, fbackup.RepositoryEntry{ID: id, Path: repoPath, Classification: fbackup.ClassificationFull, Git: state})
+	}
+	destination := filepath.Join(root, "backup")
+	manifest := fbackup.Manifest{Version: fbackup.ManifestVersion, Repositories: repositories}
+	if err := fbackup.Create(context.Background(), fbackup.CreateOptions{Destination: destination, Manifest: manifest}); err != nil {
+		t.Fatal(err)
+	}
+	catalogPath := filepath.Join(root, "fget.catalog.yaml")
+	if err := fconfig.SaveCatalog(catalogPath, &fconfig.Catalog{Repos: []fconfig.RepoEntry{
+		{ID: "github.com/acme/work", Tags: []string{"work"}},
+		{ID: "github.com/acme/play", Tags: []string{"fun"}},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	original := backupRestoreCmdFlags
+	t.Cleanup(func() { backupRestoreCmdFlags = original })
+	target := filepath.Join(root, "restore")
+	backupRestoreCmdFlags = backupRestoreFlags{
+		Backup:      destination,
+		Target:      target,
+		Tags:        []string{"work"},
+		CatalogPath: catalogPath,
+		Plan:        true,
+		Output:      "json",
+	}
+	command := &cobra.Command{}
+	command.SetContext(context.Background())
+	var stdout bytes.Buffer
+	command.SetOut(&stdout)
+	if err := runBackupRestore(command, nil); err != nil {
+		t.Fatal(err)
+	}
+	var plan fbackup.RestorePlan
+	if err := json.Unmarshal(stdout.Bytes(), &plan); err != nil {
+		t.Fatalf("decode plan: %v (%s)", err, stdout.String())
+	}
+	if len(plan.Repositories) != 1 || plan.Repositories[0].ID != "github.com/acme/work" {
+		t.Fatalf("plan repositories = %+v", plan.Repositories)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Fatalf("--plan created the target: %v", err)
+	}
+}
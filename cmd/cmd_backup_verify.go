@@ -9,8 +9,10 @@ import (
 )
 
 type backupVerifyFlags struct {
-	Backup string
-	Deep   bool
+	Backup         string
+	Deep           bool
+	Identities     []string
+	PassphraseFile string
 }
 
 var backupVerifyCmdFlags backupVerifyFlags
@@ -24,13 +26,19 @@ var backupVerifyCmd = &cobra.Command{
 
 func init() {
 	backupCmd.AddCommand(backupVerifyCmd)
-	backupVerifyCmd.Flags().StringVar(&backupVerifyCmdFlags.Backup, "backup", "", "Backup directory")
+	backupVerifyCmd.Flags().StringVar(&backupVerifyCmdFlags.Backup, "backup", "", "Backup directory or s3://bucket/prefix")
 	backupVerifyCmd.Flags().BoolVar(&backupVerifyCmdFlags.Deep, "deep", false, "Verify Git bundles and tar contents")
+	backupVerifyCmd.Flags().StringSliceVar(&backupVerifyCmdFlags.Identities, "identity", nil, "age identity file to decrypt artifacts with (repeatable)")
+	backupVerifyCmd.Flags().StringVar(&backupVerifyCmdFlags.PassphraseFile, "passphrase-file", "", "File with the passphrase to decrypt artifacts with")
 }
 
 func runBackupVerify(cmd *cobra.Command, _ []string) error {
 	if strings.TrimSpace(backupVerifyCmdFlags.Backup) == "" {
 		return errors.New("--backup is required")
 	}
-	return fbackup.Verify(cmd.Context(), backupVerifyCmdFlags.Backup, backupVerifyCmdFlags.Deep)
+	keys, err := loadBackupKeys(backupVerifyCmdFlags.Identities, backupVerifyCmdFlags.PassphraseFile)
+	if err != nil {
+		return err
+	}
+	return fbackup.VerifyWithKeys(cmd.Context(), backupVerifyCmdFlags.Backup, backupVerifyCmdFlags.Deep, keys)
 }
@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+
+	"github.com/zbiljic/fget/pkg/fconfig"
+)
+
+type catalogMaterializeFlags struct {
+	CatalogPath string
+	Root        string
+	Hosts       []string
+	Tags        []string
+	MaxWorkers  uint16
+	DryRun      bool
+}
+
+var catalogMaterializeCmdFlags catalogMaterializeFlags
+
+var catalogMaterializeCmd = &cobra.Command{
+	Use:     "materialize [repo...]",
+	Aliases: []string{"clone"},
+	Short:   "Clone catalog repositories missing under a root",
+	Args:    cobra.ArbitraryArgs,
+	RunE:    runCatalogMaterialize,
+}
+
+func init() {
+	catalogMaterializeCmd.Flags().StringVar(&catalogMaterializeCmdFlags.CatalogPath, "catalog", "", "Explicit catalog file")
+	catalogMaterializeCmd.Flags().StringVar(&catalogMaterializeCmdFlags.Root, "root", "", "Root to clone into (default: current directory)")
+	catalogMaterializeCmd.Flags().StringSliceVar(&catalogMaterializeCmdFlags.Hosts, "host", nil, "Include repository host (repeatable)")
+	catalogMaterializeCmd.Flags().StringSliceVar(&catalogMaterializeCmdFlags.Tags, "tag", nil, "Include repositories with any tag (repeatable)")
+	catalogMaterializeCmd.Flags().Uint16VarP(&catalogMaterializeCmdFlags.MaxWorkers, "workers", "j", poolDefaultMaxWorkers, "Set the maximum number of workers to use")
+	catalogMaterializeCmd.Flags().BoolVar(&catalogMaterializeCmdFlags.DryRun, "dry-run", false, "Print the repositories that would be cloned")
+
+	catalogCmd.AddCommand(catalogMaterializeCmd)
+}
+
+func runCatalogMaterialize(cmd *cobra.Command, args []string) error {
+	flags := catalogMaterializeCmdFlags
+	if flags.Root == "" {
+		flags.Root = getWd()
+	}
+	root, err := filepath.Abs(flags.Root)
+	if err != nil {
+		return err
+	}
+	flags.Root = root
+
+	set, err := loadCatalogSetForMaterialize(flags.CatalogPath)
+	if err != nil {
+		return err
+	}
+
+	repos, err := selectCatalogRepos(set.View, args)
+	if err != nil {
+		return err
+	}
+
+	tasks := planCatalogMaterialize(repos, flags)
+	if flags.DryRun {
+		for _, task := range tasks {
+			pterm.Printf("%s\t%s\n", task.ID, task.Path)
+		}
+		ptermInfoMessageStyle.Printfln("%d repositories would be cloned into %s", len(tasks), flags.Root)
+		return nil
+	}
+	if len(tasks) == 0 {
+		ptermSuccessMessageStyle.Printfln("every selected repository exists under %s", flags.Root)
+		return nil
+	}
+
+	startedAt := time.Now()
+
+	results, err := materializeCatalog(cmd.Context(), set, tasks, flags.MaxWorkers)
+	if err != nil {
+		return err
+	}
+
+	return printCloneSummary("materialize", results, startedAt)
+}
+
+// loadCatalogSetForMaterialize loads the catalog set of the current
+// configuration, or only the given catalog file, whose locations are relative
+// to its directory.
+func loadCatalogSetForMaterialize(catalogPath string) (*catalogSet, error) {
+	if catalogPath == "" {
+		return loadCatalogSetForCurrentRuntimeContext()
+	}
+
+	catalogPath, err := filepath.Abs(catalogPath)
+	if err != nil {
+		return nil, err
+	}
+	catalog, err := loadExistingCatalog(catalogPath, filepath.Dir(catalogPath))
+	if err != nil {
+		return nil, err
+	}
+
+	return &catalogSet{
+		Sources: []catalogSource{{CatalogPath: catalogPath, Catalog: catalog}},
+		View:    catalog,
+	}, nil
+}
+
+// planCatalogMaterialize returns the repositories matching the host and tag
+// filters that have a remote URL but no existing location under the root.
+// Each is cloned into the host/owner/repo layout of its catalog ID.
+func planCatalogMaterialize(repos []fconfig.RepoEntry, flags catalogMaterializeFlags) []cloneTask {
+	hosts := normalizedStringSet(flags.Hosts)
+	tags := normalizedStringSet(flags.Tags)
+
+	tasks := make([]cloneTask, 0, len(repos))
+	for _, repo := range repos {
+		if repo.RemoteURL == "" {
+			continue
+		}
+		host, _ := splitCatalogRepoID(repo.ID)
+		if len(hosts) > 0 {
+			if _, ok := hosts[strings.ToLower(host)]; !ok {
+				continue
+			}
+		}
+		if len(tags) > 0 && !hasAnyCatalogTag(repo.Tags, tags) {
+			continue
+		}
+
+		present := false
+		for _, location := range repo.Locations {
+			if !pathUnderAnyRoot(location.Path, []string{flags.Root}) {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(location.Path, ".git")); err == nil {
+				present = true
+				break
+			}
+		}
+		if present {
+			continue
+		}
+
+		task := cloneTask{
+			ID:   repo.ID,
+			URL:  repo.RemoteURL,
+			Path: filepath.Join(flags.Root, filepath.FromSlash(repo.ID)),
+		}
+		if repo.Clone != nil {
+			task.Mode = *repo.Clone
+		}
+		tasks = append(tasks, task)
+	}
+
+	return tasks
+}
+
+// materializeCatalog clones the planned repositories and records the location
+// of every new clone in the catalogs that list the repository.
+func materializeCatalog(ctx context.Context, set *catalogSet, tasks []cloneTask, maxWorkers uint16) ([]cloneResult, error) {
+	if set == nil {
+		return nil, errors.New("nil catalog set")
+	}
+
+	results, err := runCloneTasks(ctx, tasks, maxWorkers)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	dirtyCatalogs := make(map[string]struct{})
+	for _, result := range results {
+		if result.Status != cloneStatusCloned {
+			continue
+		}
+
+		sources, err := set.resolveTagSources(result.ID)
+		if err != nil {
+			return results, err
+		}
+		for _, source := range sources {
+			source.Catalog.Upsert(fconfig.RepoEntry{
+				ID:        result.ID,
+				Locations: []fconfig.RepoLocation{{Path: result.Path, LastSeenAt: now}},
+			})
+			dirtyCatalogs[source.CatalogPath] = struct{}{}
+		}
+	}
+
+	for i := range set.Sources {
+		if _, ok := dirtyCatalogs[set.Sources[i].CatalogPath]; !ok {
+			continue
+		}
+		if err := fconfig.SaveCatalog(set.Sources[i].CatalogPath, set.Sources[i].Catalog); err != nil {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zbiljic/fget/pkg/fconfig"
+)
+
+func TestMaterializeCatalogClonesMissingRepositories(t *testing.T) {
+	repo, remote := initCommittedRepo(t)
+	configureOrigin(t, repo, remote)
+	pushMain(t, repo)
+	gitRun(t, remote, "symbolic-ref", "HEAD", "refs/heads/main")
+
+	root := filepath.Join(t.TempDir(), "dev")
+	present := filepath.Join(root, "example.com", "acme", "present")
+	initRepoAtPath(t, present, filepath.Join(t.TempDir(), "present.git"))
+	elsewhere := filepath.Join(t.TempDir(), "old", "api")
+
+	catalogPath := filepath.Join(t.TempDir(), "fget.catalog.yaml")
+	catalog, err := fconfig.LoadCatalog(catalogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog.Upsert(fconfig.RepoEntry{
+		ID:        "example.com/acme/api",
+		RemoteURL: remote,
+		Tags:      []string{"work"},
+		Locations: []fconfig.RepoLocation{{Path: elsewhere}},
+	})
+	catalog.Upsert(fconfig.RepoEntry{
+		ID:        "example.com/acme/present",
+		RemoteURL: remote,
+		Tags:      []string{"work"},
+		Locations: []fconfig.RepoLocation{{Path: present}},
+	})
+	catalog.Upsert(fconfig.RepoEntry{ID: "example.com/acme/personal", RemoteURL: remote, Tags: []string{"home"}})
+	catalog.Upsert(fconfig.RepoEntry{ID: "example.com/acme/no-remote", Tags: []string{"work"}})
+	if err := fconfig.SaveCatalog(catalogPath, catalog); err != nil {
+		t.Fatal(err)
+	}
+
+	set, err := loadCatalogSetForMaterialize(catalogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flags := catalogMaterializeFlags{Root: root, Tags: []string{"work"}, MaxWorkers: 2}
+	tasks := planCatalogMaterialize(set.View.Repos, flags)
+	target := filepath.Join(root, "example.com", "acme", "api")
+	if len(tasks) != 1 || tasks[0].ID != "example.com/acme/api" || tasks[0].Path != target {
+		t.Fatalf("planned tasks = %+v, want only the missing work repository", tasks)
+	}
+
+	results, err := materializeCatalog(context.Background(), set, tasks, flags.MaxWorkers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Status != cloneStatusCloned {
+		t.Fatalf("results = %+v", results)
+	}
+	if got := gitOutput(t, target, "rev-parse", "HEAD"); got != gitOutput(t, repo, "rev-parse", "HEAD") {
+		t.Fatalf("materialized HEAD = %s", got)
+	}
+
+	saved, err := fconfig.LoadCatalogWithScope(catalogPath, filepath.Dir(catalogPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := fconfig.ResolveRepoIndex(saved, "example.com/acme/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := saved.Repos[index]
+	if len(entry.Locations) != 2 || len(entry.Tags) != 1 || entry.Tags[0] != "work" {
+		t.Fatalf("saved entry = %+v, want the old and new locations and the tag", entry)
+	}
+	if _, err := os.Stat(filepath.Join(elsewhere, ".git")); !os.IsNotExist(err) {
+		t.Fatalf("stale location was created: %v", err)
+	}
+
+	set, err = loadCatalogSetForMaterialize(catalogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tasks := planCatalogMaterialize(set.View.Repos, flags); len(tasks) != 0 {
+		t.Fatalf("tasks after materializing = %+v, want none", tasks)
+	}
+}
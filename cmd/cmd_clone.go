@@ -1,30 +1,48 @@
 package cmd
 
 import (
-	"bytes"
+	"bufio"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
+	"dario.cat/mergo"
+	"github.com/alitto/pond/v2"
 	"github.com/go-git/go-git/v5"
 	"github.com/pterm/pterm"
 	"github.com/spf13/cobra"
+	giturls "github.com/whilp/git-urls"
 
+	"github.com/zbiljic/fget/pkg/fconfig"
 	"github.com/zbiljic/fget/pkg/fsfind"
 )
 
 var cloneCmd = &cobra.Command{
-	Use:         "clone",
-	Short:       "Clone a repository into a new directory",
+	Use:         "clone [url...] [root]",
+	Short:       "Clone repositories into a new directory",
 	Annotations: map[string]string{"group": "update"},
 	Args:        cobra.ArbitraryArgs,
 	RunE:        runClone,
 }
 
+var cloneCmdFlags = &cloneOptions{
+	MaxWorkers: poolDefaultMaxWorkers,
+}
+
 func init() {
+	cloneCmd.Flags().Uint16VarP(&cloneCmdFlags.MaxWorkers, "workers", "j", poolDefaultMaxWorkers, "Set the maximum number of workers to use")
+	cloneCmd.Flags().StringVar(&cloneCmdFlags.FromFile, "from-file", "", "Read repository URLs from this file, or - for stdin")
+	addCloneModeFlags(cloneCmd.Flags(), &cloneCmdFlags.Mode)
+
 	rootCmd.AddCommand(cloneCmd)
 }
 
@@ -33,75 +51,530 @@ type cloneOptions struct {
 	URLs []*url.URL
 	// The name of the directory root to clone into.
 	RootDirectory string
+	// The maximum number of concurrent clones.
+	MaxWorkers uint16
+	// The file with additional URLs, or - for stdin.
+	FromFile string
+	// The shallow, partial or single-branch clone options.
+	Mode fconfig.CloneMode
+}
+
+type cloneStatus string
+
+const (
+	cloneStatusCloned  cloneStatus = "cloned"
+	cloneStatusSkipped cloneStatus = "skipped"
+	cloneStatusFailed  cloneStatus = "failed"
+)
+
+type cloneResult struct {
+	ID       string
+	Path     string
+	Status   cloneStatus
+	Err      error
+	Duration time.Duration
 }
 
 func runClone(cmd *cobra.Command, args []string) error {
-	opts, err := parseCloneArgs(args)
+	var (
+		opts cloneOptions
+		err  error
+	)
+	if cloneCmdFlags.FromFile != "" {
+		opts, err = parseCloneRootArgs(args)
+	} else {
+		opts, err = parseCloneArgs(args)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := mergo.Merge(&opts, cloneCmdFlags); err != nil {
+		return err
+	}
+
+	if err := validateCloneMode(opts.Mode); err != nil {
+		return err
+	}
+
+	if opts.FromFile != "" {
+		urls, err := readCloneURLsFile(opts.FromFile, cmd.InOrStdin())
+		if err != nil {
+			return err
+		}
+		opts.URLs = uniqueCloneURLs(append(opts.URLs, urls...))
+		if len(opts.URLs) == 0 {
+			return fmt.Errorf("no repository URLs in %s", opts.FromFile)
+		}
+	}
+
+	startedAt := time.Now()
+
+	results, err := cloneRepositories(cmd.Context(), opts)
 	if err != nil {
 		return err
 	}
 
-	for _, url := range opts.URLs {
-		var (
-			domainDirectory = filepath.Join(opts.RootDirectory, url.Host)
-			projectID       = filepath.Join(url.Host, url.Path)
-			repoURL         = url.String()
-		)
+	for _, result := range results {
+		if result.Status != cloneStatusCloned {
+			continue
+		}
+		remoteURL, err := gitRemoteConfigURL(result.Path)
+		if err == nil {
+			err = recordCatalogCloneMode(result.ID, remoteURL.String(), result.Path, opts.Mode)
+		}
+		if err != nil {
+			ptermWarningWithPrefixText("catalog").Printfln("%s: %v", result.ID, err)
+		}
+	}
 
+	return printCloneSummary("clone", results, startedAt)
+}
+
+// printCloneSummary prints how many repositories were cloned, skipped and
+// failed, followed by the failures, which are also returned as an error.
+func printCloneSummary(prefix string, results []cloneResult, startedAt time.Time) error {
+	counts := make(map[cloneStatus]int, 3)
+	for _, result := range results {
+		counts[result.Status]++
+	}
+
+	pterm.Println()
+	summary := fmt.Sprintf(
+		"cloned %d, skipped %d, failed %d, took %s",
+		counts[cloneStatusCloned],
+		counts[cloneStatusSkipped],
+		counts[cloneStatusFailed],
+		time.Since(startedAt).Round(time.Millisecond).String(),
+	)
+	if counts[cloneStatusFailed] > 0 {
+		ptermWarningWithPrefixText(prefix).Println(summary)
+		for _, result := range results {
+			if result.Status == cloneStatusFailed {
+				ptermErrorMessageStyle.Println(fmt.Sprintf("%s: %v", result.ID, result.Err))
+			}
+		}
+		return fmt.Errorf("clone failed for %d of %d repositories", counts[cloneStatusFailed], len(results))
+	}
+	ptermSuccessWithPrefixText(prefix).Println(summary)
+
+	return nil
+}
+
+// cloneTask is a repository to clone into Path.
+type cloneTask struct {
+	ID   string
+	URL  string
+	Path string
+	Mode fconfig.CloneMode
+	// DomainDirectory must exist when set. Otherwise the parent directories
+	// of Path are created.
+	DomainDirectory string
+}
+
+// cloneRepositories clones the URLs into the host/owner/repo layout under the
+// root directory, which must already contain the host directories.
+func cloneRepositories(ctx context.Context, opts cloneOptions) ([]cloneResult, error) {
+	tasks := make([]cloneTask, 0, len(opts.URLs))
+	for _, repoURL := range opts.URLs {
+		projectID := cloneProjectID(repoURL)
+		tasks = append(tasks, cloneTask{
+			ID:              projectID,
+			URL:             repoURL.String(),
+			Path:            filepath.Join(opts.RootDirectory, projectID),
+			Mode:            opts.Mode,
+			DomainDirectory: filepath.Join(opts.RootDirectory, repoURL.Host),
+		})
+	}
+
+	return runCloneTasks(ctx, tasks, opts.MaxWorkers)
+}
+
+// runCloneTasks clones repositories concurrently. A failed clone does not
+// stop the others; its error is reported in the results, which are sorted by
+// repository ID.
+func runCloneTasks(ctx context.Context, tasks []cloneTask, maxWorkers uint16) ([]cloneResult, error) {
+	progress := newCloneProgress(dynamicOutput)
+	defer progress.stop()
+
+	resultPool := pond.NewResultPool[cloneResult](
+		int(maxWorkers),
+		pond.WithQueueSize(poolDefaultMaxCapacity),
+	)
+	defer resultPool.StopAndWait()
+
+	group := resultPool.NewGroupContext(ctx)
+	for _, task := range tasks {
+		group.SubmitErr(func() (cloneResult, error) {
+			if err := ctx.Err(); err != nil {
+				return cloneResult{}, err
+			}
+			return cloneRepository(ctx, task, progress), nil
+		})
+	}
+
+	results, err := group.Wait()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].ID < results[j].ID
+	})
+
+	return results, nil
+}
+
+func cloneRepository(ctx context.Context, task cloneTask, progress *cloneProgress) (result cloneResult) {
+	result = cloneResult{ID: task.ID, Path: task.Path}
+
+	startedAt := time.Now()
+	progress.start(task.ID)
+	defer func() {
+		result.Duration = time.Since(startedAt)
+		progress.finish(result)
+	}()
+
+	if task.DomainDirectory != "" {
 		// check domain directory
-		domainDirFileInfo, err := os.Stat(domainDirectory)
+		domainDirFileInfo, err := os.Stat(task.DomainDirectory)
 		if err != nil {
-			return fmt.Errorf("domain path: %v", err)
+			result.Status, result.Err = cloneStatusFailed, fmt.Errorf("domain path: %v", err)
+			return result
 		}
 
 		if !domainDirFileInfo.IsDir() {
-			return fmt.Errorf("not directory: %s", domainDirectory)
+			result.Status, result.Err = cloneStatusFailed, fmt.Errorf("not directory: %s", task.DomainDirectory)
+			return result
 		}
+	} else if err := os.MkdirAll(filepath.Dir(task.Path), 0o755); err != nil {
+		result.Status, result.Err = cloneStatusFailed, err
+		return result
+	}
 
-		// create path into which to clone
-		repoPath := filepath.Join(opts.RootDirectory, projectID)
+	err := gitClone(ctx, task.URL, task.Path, git.DefaultRemoteName, task.Mode, progress.writer(task.ID))
+	switch {
+	case errors.Is(err, git.ErrRepositoryAlreadyExists):
+		result.Status, result.Err = cloneStatusSkipped, err
+	case err != nil:
+		result.Status, result.Err = cloneStatusFailed, err
+	default:
+		result.Status = cloneStatusCloned
+	}
 
-		pterm.Println(repoPath)
-		ptermInfoMessageStyle.Println(projectID)
+	return result
+}
 
-		// clone
-		startedAt := time.Now()
+// cloneProgress prints a line for every finished repository. On a terminal,
+// the clones in progress are redrawn below them, one line each.
+type cloneProgress struct {
+	mu       sync.Mutex
+	w        io.Writer
+	area     *pterm.AreaPrinter
+	active   []string
+	started  map[string]time.Time
+	messages map[string]string
+	frame    int
+	done     chan struct{}
+	stopped  chan struct{}
+}
 
-		spinner, err := pterm.DefaultSpinner.
-			WithWriter(dynamicOutput).
-			Start("cloning...")
-		if err != nil {
-			return err
+func newCloneProgress(w io.Writer) *cloneProgress {
+	p := &cloneProgress{
+		w:        w,
+		started:  make(map[string]time.Time),
+		messages: make(map[string]string),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+
+	if !isInteractiveWriter(w) {
+		close(p.stopped)
+		return p
+	}
+
+	p.area, _ = pterm.DefaultArea.Start()
+
+	go func() {
+		defer close(p.stopped)
+
+		ticker := time.NewTicker(pterm.DefaultSpinner.Delay)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-ticker.C:
+				p.mu.Lock()
+				p.frame++
+				p.render()
+				p.mu.Unlock()
+			}
+		}
+	}()
+
+	return p
+}
+
+func (p *cloneProgress) start(id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.active = append(p.active, id)
+	p.started[id] = time.Now()
+	p.render()
+}
+
+func (p *cloneProgress) update(id, message string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.messages[id] = message
+}
+
+func (p *cloneProgress) finish(result cloneResult) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, id := range p.active {
+		if id == result.ID {
+			p.active = append(p.active[:i], p.active[i+1:]...)
+			break
 		}
+	}
+	delete(p.started, result.ID)
+	delete(p.messages, result.ID)
+
+	var line string
+	switch result.Status {
+	case cloneStatusCloned:
+		line = pterm.Success.Sprintfln("%s (took %s)", result.ID, result.Duration.Round(time.Millisecond).String())
+	case cloneStatusSkipped:
+		line = pterm.Warning.Sprintfln("%s: %v", result.ID, result.Err)
+	default:
+		line = pterm.Error.Sprintfln("%s: %v", result.ID, result.Err)
+	}
+
+	if p.area != nil {
+		// clear the clones in progress, so the line stays above them
+		p.area.Update("")
+	}
+	pterm.Fprint(p.w, line)
+	p.render()
+}
+
+// render redraws the clones in progress. It must be called with the lock held.
+func (p *cloneProgress) render() {
+	if p.area == nil {
+		return
+	}
 
-		buf := bytes.NewBuffer(nil)
+	sequence := pterm.DefaultSpinner.Sequence
+
+	var content strings.Builder
+	for _, id := range p.active {
+		content.WriteString(pterm.DefaultSpinner.Style.Sprint(sequence[p.frame%len(sequence)]))
+		content.WriteString(id)
+		if message := p.messages[id]; message != "" {
+			content.WriteString(" ")
+			content.WriteString(pterm.Gray(message))
+		}
+		content.WriteString(pterm.Gray(fmt.Sprintf(" (%s)", time.Since(p.started[id]).Round(time.Second).String())))
+		content.WriteString("\n")
+	}
+
+	p.area.Update(content.String())
+}
+
+func (p *cloneProgress) stop() {
+	select {
+	case <-p.done:
+	default:
+		close(p.done)
+	}
+	<-p.stopped
+
+	if p.area != nil {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		p.area.Update("")
+		p.area.Stop() //nolint:errcheck
+	}
+}
 
-		_, err = git.PlainClone(repoPath, false, &git.CloneOptions{
-			URL:      repoURL,
-			Progress: buf,
+// writer returns the progress writer of a clone. It keeps the last line of
+// the remote progress, which ends its lines with carriage returns.
+func (p *cloneProgress) writer(id string) io.Writer {
+	return cloneProgressWriterFunc(func(b []byte) (int, error) {
+		lines := strings.FieldsFunc(string(b), func(r rune) bool {
+			return r == '\r' || r == '\n'
 		})
-		if err != nil {
-			if errors.Is(err, git.ErrRepositoryAlreadyExists) {
-				spinner.Warning(err.Error())
-				pterm.Println()
-				continue
+		if len(lines) > 0 {
+			p.update(id, strings.TrimSpace(lines[len(lines)-1]))
+		}
+		return len(b), nil
+	})
+}
+
+type cloneProgressWriterFunc func([]byte) (int, error)
+
+func (fn cloneProgressWriterFunc) Write(b []byte) (int, error) {
+	return fn(b)
+}
+
+// readCloneURLsFile reads repository URLs from path, or from stdin when path
+// is "-".
+func readCloneURLsFile(path string, stdin io.Reader) ([]*url.URL, error) {
+	if path == "-" {
+		return readCloneURLs(stdin)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	urls, err := readCloneURLs(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return urls, nil
+}
+
+// readCloneURLs reads one URL per line, skipping blank lines and # comments.
+// It also accepts `catalog export` output in any of its formats, taking the
+// URLs from the remote_url field and skipping records without one.
+func readCloneURLs(r io.Reader) ([]*url.URL, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var rawURLs []string
+
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "[") {
+		var records []struct {
+			RemoteURL string `json:"remote_url"`
+		}
+		if err := json.Unmarshal([]byte(trimmed), &records); err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			rawURLs = append(rawURLs, record.RemoteURL)
+		}
+	} else {
+		tsvColumn := -1
+
+		scanner := bufio.NewScanner(strings.NewReader(string(data)))
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for lineNumber := 1; scanner.Scan(); lineNumber++ {
+			line := strings.TrimSpace(scanner.Text())
+			switch {
+			case line == "" || strings.HasPrefix(line, "#"):
+			case strings.HasPrefix(line, "{"):
+				var record struct {
+					RemoteURL string `json:"remote_url"`
+				}
+				if err := json.Unmarshal([]byte(line), &record); err != nil {
+					return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+				}
+				rawURLs = append(rawURLs, record.RemoteURL)
+			case tsvColumn >= 0:
+				fields := strings.Split(scanner.Text(), "\t")
+				if tsvColumn >= len(fields) {
+					return nil, fmt.Errorf("line %d: missing remote_url column", lineNumber)
+				}
+				rawURLs = append(rawURLs, fields[tsvColumn])
+			case strings.Contains(line, "\t"):
+				for i, field := range strings.Split(line, "\t") {
+					if field == "remote_url" {
+						tsvColumn = i
+					}
+				}
+				if tsvColumn < 0 {
+					return nil, fmt.Errorf("line %d: tab-separated header without remote_url column", lineNumber)
+				}
+			default:
+				rawURLs = append(rawURLs, line)
 			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
 
-			spinner.Fail(err.Error())
-			pterm.Println()
-			return err
+	var urls []*url.URL
+	for _, rawURL := range rawURLs {
+		rawURL = strings.TrimSpace(rawURL)
+		if rawURL == "" {
+			continue
 		}
 
-		if buf.Len() > 0 {
-			pterm.Fprintln(dynamicOutput)
-			pterm.Fprintln(dynamicOutput, buf.String())
+		parsedURL, err := parseCloneURL(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		if parsedURL.Host == "" {
+			return nil, fmt.Errorf("repository URL without host: %s", rawURL)
 		}
 
-		spinner.Success(fmt.Sprintf("took %s", time.Since(startedAt).Round(time.Millisecond).String()))
-		pterm.Println()
+		urls = append(urls, parsedURL)
 	}
 
-	return nil
+	return uniqueCloneURLs(urls), nil
+}
+
+// parseCloneURL parses a repository URL. Without a scheme it is either an
+// scp-like SSH address, such as git@github.com:owner/repo.git, or an HTTPS URL.
+func parseCloneURL(rawURL string) (*url.URL, error) {
+	var (
+		parsedURL *url.URL
+		err       error
+	)
+	switch {
+	case hasScheme(rawURL):
+		parsedURL, err = url.ParseRequestURI(rawURL)
+	case strings.Contains(rawURL, "@") && strings.Contains(rawURL, ":"):
+		parsedURL, err = giturls.Parse(rawURL)
+	default:
+		parsedURL, err = url.ParseRequestURI("https://" + rawURL)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// remove query and fragment
+	parsedURL.RawQuery = ""
+	parsedURL.RawFragment = ""
+
+	return parsedURL, nil
+}
+
+// cloneProjectID returns the path of the repository relative to the root
+// directory, such as github.com/owner/repo.
+func cloneProjectID(repoURL *url.URL) string {
+	return filepath.Join(repoURL.Host, repoURL.Path)
+}
+
+// uniqueCloneURLs keeps the first URL of every repository, so that the same
+// repository over HTTPS and SSH is not cloned twice. URLs with and without
+// the .git suffix name the same repository.
+func uniqueCloneURLs(urls []*url.URL) []*url.URL {
+	seen := make(map[string]struct{}, len(urls))
+	unique := make([]*url.URL, 0, len(urls))
+	for _, u := range urls {
+		id := strings.TrimSuffix(cloneProjectID(u), ".git")
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		unique = append(unique, u)
+	}
+	return unique
 }
 
 func parseCloneArgs(args []string) (cloneOptions, error) {
@@ -158,6 +631,31 @@ func parseCloneArgs(args []string) (cloneOptions, error) {
 		opts.RootDirectory = getWd()
 	}
 
+	opts.URLs = uniqueCloneURLs(opts.URLs)
+
+	return opts, nil
+}
+
+// parseCloneRootArgs parses the arguments when URLs are read from a file,
+// where the only argument is the optional root directory.
+func parseCloneRootArgs(args []string) (cloneOptions, error) {
+	opts := cloneOptions{}
+
+	switch len(args) {
+	case 0:
+		// fallback to current working directory
+		opts.RootDirectory = getWd()
+	case 1:
+		path, err := fsfind.DirAbsPath(args[0])
+		if err != nil {
+			return opts, err
+		}
+
+		opts.RootDirectory = path
+	default:
+		return opts, errors.New("--from-file accepts only the root directory argument")
+	}
+
 	return opts, nil
 }
 
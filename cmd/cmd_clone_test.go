@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadCloneURLsAcceptsCatalogExport(t *testing.T) {
+	t.Parallel()
+
+	records := []catalogExportRecord{
+		{ID: "github.com/acme/api", RemoteURL: "https://github.com/acme/api.git", Tags: []string{"work"}},
+		{ID: "github.com/acme/web", RemoteURL: "git@github.com:acme/web.git"},
+		{ID: "github.com/acme/api", RemoteURL: "git@github.com:acme/api.git"},
+		{ID: "example.com/local"},
+	}
+	want := []string{"https://github.com/acme/api.git", "ssh://git@github.com/acme/web.git"}
+
+	for _, format := range []string{"json", "jsonl", "tsv"} {
+		var export bytes.Buffer
+		if err := writeCatalogExport(&export, format, records); err != nil {
+			t.Fatal(err)
+		}
+
+		urls, err := readCloneURLs(&export)
+		if err != nil {
+			t.Fatalf("%s: readCloneURLs() error = %v", format, err)
+		}
+		if got := cloneURLStrings(urls); !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: readCloneURLs() = %v, want %v", format, got, want)
+		}
+	}
+
+	urls, err := readCloneURLs(strings.NewReader("# team repositories\ngithub.com/acme/api?tab=readme\n\nhttps://gitlab.com/acme/tools\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cloneURLStrings(urls), []string{"https://github.com/acme/api", "https://gitlab.com/acme/tools"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("readCloneURLs() = %v, want %v", got, want)
+	}
+}
+
+func TestCloneRepositoriesContinuesAfterFailure(t *testing.T) {
+	repo, remote := initCommittedRepo(t)
+	configureOrigin(t, repo, remote)
+	pushMain(t, repo)
+	gitRun(t, remote, "symbolic-ref", "HEAD", "refs/heads/main")
+
+	root := t.TempDir()
+	opts := cloneOptions{
+		URLs: []*url.URL{
+			{Scheme: "file", Path: filepath.Join(t.TempDir(), "missing.git")},
+			{Scheme: "file", Path: remote},
+		},
+		RootDirectory: root,
+		MaxWorkers:    2,
+	}
+
+	results, err := cloneRepositories(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := make(map[string]cloneStatus, len(results))
+	for _, result := range results {
+		statuses[result.ID] = result.Status
+	}
+	// the directory keeps the .git suffix of the URL
+	clonedID := remote
+	if len(results) != 2 || statuses[clonedID] != cloneStatusCloned {
+		t.Fatalf("results = %+v, want one clone and one failure", results)
+	}
+	if got := gitOutput(t, filepath.Join(root, clonedID), "rev-parse", "HEAD"); got != gitOutput(t, repo, "rev-parse", "HEAD") {
+		t.Fatalf("cloned HEAD = %s", got)
+	}
+
+	results, err = cloneRepositories(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if result.ID == clonedID && result.Status != cloneStatusSkipped {
+			t.Fatalf("second clone result = %+v, want skipped", result)
+		}
+		if result.ID != clonedID && (result.Status != cloneStatusFailed || result.Err == nil) {
+			t.Fatalf("missing repository result = %+v, want failed", result)
+		}
+	}
+}
+
+func cloneURLStrings(urls []*url.URL) []string {
+	values := make([]string, 0, len(urls))
+	for _, u := range urls {
+		values = append(values, u.String())
+	}
+	return values
+}
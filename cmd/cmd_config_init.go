@@ -155,6 +155,9 @@ func applyInitConfig(target string, roots []string, force, withCatalog bool) (*f
 			config.Version = existing.Version
 		}
 		config.Catalog = existing.Catalog
+		config.Remotes = existing.Remotes
+		config.Credentials = existing.Credentials
+		config.Inactive = existing.Inactive
 		config.Roots = sortedUnique(append(existing.Roots, roots...))
 	}
 
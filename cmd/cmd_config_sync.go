@@ -13,6 +13,7 @@ import (
 
 	"github.com/zbiljic/fget/pkg/fconfig"
 	"github.com/zbiljic/fget/pkg/fsfind"
+	"github.com/zbiljic/fget/pkg/giturl"
 )
 
 var configSyncCmd = &cobra.Command{
@@ -226,10 +227,20 @@ func inspectRepoMetadata(repoPath string) (fconfig.RepoMetadata, error) {
 		return fconfig.RepoMetadata{}, err
 	}
 
+	remotes, err := gitRemoteURLs(repoPath)
+	if err != nil {
+		return fconfig.RepoMetadata{}, err
+	}
+	if len(remotes) < 2 {
+		// a single remote is the remote URL
+		remotes = nil
+	}
+
 	return fconfig.RepoMetadata{
 		ID:        meta.ID,
 		Path:      repoPath,
 		RemoteURL: meta.RemoteURL,
+		Remotes:   remotes,
 	}, nil
 }
 
@@ -246,7 +257,7 @@ func inspectSyncRepoMetadata(repoPath string) (syncRepoMetadata, error) {
 
 	return syncRepoMetadata{
 		ID:        repoID,
-		RemoteURL: remoteURL.String(),
+		RemoteURL: giturl.Sanitize(remoteURL.String()),
 	}, nil
 }
 
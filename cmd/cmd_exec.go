@@ -0,0 +1,352 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"dario.cat/mergo"
+	"github.com/alitto/pond/v2"
+	"github.com/pterm/pterm"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+	"github.com/tevino/abool/v2"
+
+	"github.com/zbiljic/fget/pkg/fsfind"
+)
+
+var execCmd = &cobra.Command{
+	Use:         "exec [root...] -- <command> [args...]",
+	Short:       "Run a command in every repository",
+	Annotations: map[string]string{"group": "update"},
+	Args:        cobra.MinimumNArgs(1),
+	RunE:        runExec,
+}
+
+var execCmdFlags = &execOptions{}
+
+func init() {
+	execCmd.Flags().Uint16VarP(&execCmdFlags.MaxWorkers, "workers", "j", poolDefaultMaxWorkers, "Set the maximum number of workers to use")
+	execCmd.Flags().BoolVarP(&execCmdFlags.KeepGoing, "keep-going", "k", false, "Keep running in other repositories after a command fails")
+	execCmd.Flags().StringSliceVar(&execCmdFlags.Selection.Tags, "tag", nil, "Run in catalog repositories with any tag (repeatable)")
+	execCmd.Flags().StringSliceVar(&execCmdFlags.Selection.Hosts, "host", nil, "Run in catalog repositories on this host (repeatable)")
+	execCmd.Flags().StringVar(&execCmdFlags.Selection.CatalogPath, "catalog", "", "Select repositories from this catalog file instead of scanning roots")
+	execCmd.Flags().StringVar(&execCmdFlags.SummaryPath, "summary", "", "Write a JSON summary of exit codes to this file")
+	execCmd.Flags().DurationVar(&execCmdFlags.ExecTimeout, "exec-timeout", 0, "Duration after which process should stop")
+
+	rootCmd.AddCommand(execCmd)
+}
+
+type execOptions struct {
+	Roots         []string
+	ExplicitRoots bool
+	Command       []string
+	MaxWorkers    uint16
+	KeepGoing     bool
+	Selection     repoSelection
+	SummaryPath   string
+	ExecTimeout   time.Duration
+}
+
+type execSummary struct {
+	Command    []string     `json:"command"`
+	StartedAt  time.Time    `json:"started_at"`
+	FinishedAt time.Time    `json:"finished_at"`
+	Total      int          `json:"total"`
+	Succeeded  int          `json:"succeeded"`
+	Failed     int          `json:"failed"`
+	Results    []execResult `json:"results"`
+}
+
+type execResult struct {
+	Path       string `json:"path"`
+	ExitCode   int    `json:"exit_code"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// execResults collects the results of concurrently running commands.
+type execResults struct {
+	mu      sync.Mutex
+	results []execResult
+}
+
+func (r *execResults) add(result execResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results = append(r.results, result)
+}
+
+func runExec(cmd *cobra.Command, args []string) error {
+	opts, err := parseExecArgs(args, cmd.ArgsLenAtDash())
+	if err != nil {
+		return err
+	}
+
+	if err := mergo.Merge(&opts, execCmdFlags); err != nil {
+		return err
+	}
+
+	summary, err := runExecOptions(cmd.Context(), opts)
+	if opts.SummaryPath != "" && summary != nil {
+		writeErr := writeAtomicOutputFile(opts.SummaryPath, ".fget-exec-summary-*.tmp", func(w io.Writer) error {
+			return outputJSON(w, summary)
+		})
+		if writeErr != nil {
+			return errors.Join(err, fmt.Errorf("write summary: %w", writeErr))
+		}
+	}
+	return err
+}
+
+// runExecOptions runs the command in the selected repositories. Repositories
+// whose command failed stay in the checkpoint, so running the same command
+// again continues with them and with those an interruption skipped.
+func runExecOptions(ctx context.Context, opts execOptions) (*execSummary, error) {
+	cmdName := execStateName(opts)
+
+	// for configuration
+	baseDir := opts.Roots[0]
+
+	config, err := loadOrCreateConfigState(baseDir, cmdName, opts.Roots...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := finishConfigState(baseDir, cmdName, config); err != nil {
+			ptermErrorMessageStyle.Println(err.Error())
+		}
+	}()
+
+	if len(config.Paths) == 0 {
+		spinner, err := pterm.DefaultSpinner.
+			WithWriter(dynamicOutput).
+			WithRemoveWhenDone(true).
+			Start("finding repositories...")
+		if err != nil {
+			return nil, err
+		}
+
+		repoPaths, err := selectRepositories(ctx, opts.Roots, opts.ExplicitRoots, opts.Selection)
+		spinner.Stop() //nolint:errcheck
+		if err != nil {
+			return nil, err
+		}
+
+		config.TotalCount = len(repoPaths)
+		config.Paths = repoPaths
+
+		if err := saveConfigState(baseDir, cmdName, config); err != nil {
+			return nil, err
+		}
+	}
+
+	// make a copy
+	activeRepoPaths := make([]string, len(config.Paths))
+	copy(activeRepoPaths, config.Paths)
+
+	var failed []string
+	cleanupFn := func(repoPath string, index int, err error) error {
+		if err != nil {
+			failed = append(failed, repoPath)
+			if opts.KeepGoing {
+				return nil
+			}
+			return err
+		}
+
+		// update active
+		activeRepoPaths = lo.Without(activeRepoPaths, repoPath)
+
+		config.Paths = activeRepoPaths
+
+		if err := saveCheckpointConfigState(baseDir, cmdName, config, index); err != nil {
+			ptermErrorMessageStyle.Println(err.Error())
+		}
+
+		return nil
+	}
+
+	// start
+	summary := &execSummary{Command: opts.Command, StartedAt: time.Now().UTC()}
+	results := &execResults{}
+
+	startOffset := 1 + config.TotalCount - len(activeRepoPaths)
+
+	// worker pool
+	pool := pond.NewPool(int(opts.MaxWorkers), pond.WithQueueSize(poolDefaultMaxCapacity))
+	defer pool.StopAndWait()
+
+	if opts.ExecTimeout > 0 {
+		var ctxCancelFn context.CancelFunc
+
+		ctx, ctxCancelFn = context.WithTimeout(ctx, opts.ExecTimeout)
+		defer ctxCancelFn()
+	}
+
+	// task group associated to a context
+	group := pool.NewGroupContext(ctx)
+	groupCtx := group.Context()
+
+	for i, path := range config.Paths {
+		i := i + startOffset
+
+		repoPath := path
+
+		task := taskUpdateFn(
+			groupCtx,
+			"exec",
+			config,
+			i,
+			repoPath,
+			execRunFn(opts.Command, results),
+			cleanupFn,
+		)
+
+		group.SubmitErr(task)
+	}
+
+	groupErr := group.Wait()
+
+	summary.FinishedAt = time.Now().UTC()
+	summary.Results = append([]execResult{}, results.results...)
+	sort.Slice(summary.Results, func(i, j int) bool {
+		return summary.Results[i].Path < summary.Results[j].Path
+	})
+	summary.Total = len(summary.Results)
+	for _, result := range summary.Results {
+		if result.ExitCode == 0 && result.Error == "" {
+			summary.Succeeded++
+		} else {
+			summary.Failed++
+		}
+	}
+
+	if groupErr != nil {
+		return summary, groupErr
+	}
+	if len(failed) > 0 {
+		return summary, fmt.Errorf("command failed in %d of %d repositories", len(failed), summary.Total)
+	}
+
+	pterm.Println()
+	ptermSuccessWithPrefixText("exec").
+		Printfln(
+			"took %s (total: %s)",
+			summary.FinishedAt.Sub(summary.StartedAt).Round(time.Millisecond).String(),
+			time.Since(config.CreateTime).Round(time.Millisecond).String(),
+		)
+
+	return summary, nil
+}
+
+// execRunFn returns the task that runs command in a repository. Its output is
+// buffered and printed below the repository header once it exits, so output
+// of concurrent commands does not interleave.
+func execRunFn(command []string, results *execResults) func(context.Context, string) error {
+	return func(ctx context.Context, repoPath string) error {
+		var output bytes.Buffer
+
+		started := time.Now()
+		process := exec.CommandContext(ctx, command[0], command[1:]...)
+		process.Dir = repoPath
+		process.Stdout = &output
+		process.Stderr = &output
+		runErr := process.Run()
+
+		result := execResult{
+			Path:       repoPath,
+			DurationMS: time.Since(started).Milliseconds(),
+		}
+		var exitErr *exec.ExitError
+		switch {
+		case runErr == nil:
+		case errors.As(runErr, &exitErr) && exitErr.ExitCode() >= 0:
+			result.ExitCode = exitErr.ExitCode()
+		default:
+			result.ExitCode = -1
+			result.Error = runErr.Error()
+		}
+		results.add(result)
+
+		// complicated update locking
+		if isUpdateMutexLocked, ok := ctx.Value(ctxKeyIsUpdateMutexLocked{}).(*abool.AtomicBool); ok {
+			if isUpdateMutexLocked.IsNotSet() {
+				updateMutex.Lock()
+				isUpdateMutexLocked.Set()
+			}
+		} else {
+			// simple
+			updateMutex.Lock()
+			defer updateMutex.Unlock()
+		}
+
+		printProjectInfoContext(ctx)
+		if output.Len() > 0 {
+			pterm.Print(output.String())
+			if !bytes.HasSuffix(output.Bytes(), []byte("\n")) {
+				pterm.Println()
+			}
+		}
+
+		if runErr != nil {
+			if result.Error != "" {
+				return runErr
+			}
+			return fmt.Errorf("exit status %d", result.ExitCode)
+		}
+
+		return nil
+	}
+}
+
+// execStateName names the checkpoint of a run after its command and
+// selection, so that only the same invocation resumes it.
+func execStateName(opts execOptions) string {
+	parts := []string{strings.Join(opts.Command, "\x00")}
+	if selection := opts.Selection; selection.fromCatalog() {
+		tags := append([]string{}, selection.Tags...)
+		hosts := append([]string{}, selection.Hosts...)
+		sort.Strings(tags)
+		sort.Strings(hosts)
+		parts = append(parts, selection.CatalogPath, strings.Join(tags, ","), strings.Join(hosts, ","))
+	}
+	digest := sha256.Sum256([]byte(strings.Join(parts, "\x01")))
+	return "exec-" + hex.EncodeToString(digest[:6])
+}
+
+func parseExecArgs(args []string, dash int) (execOptions, error) {
+	opts := execOptions{}
+
+	if dash < 0 || dash >= len(args) {
+		return opts, errors.New("missing command: use fget exec [root...] -- <command> [args...]")
+	}
+	opts.Command = append(opts.Command, args[dash:]...)
+
+	if dash > 0 {
+		opts.ExplicitRoots = true
+		for _, arg := range args[:dash] {
+			path, err := fsfind.DirAbsPath(arg)
+			if err != nil {
+				return opts, err
+			}
+
+			opts.Roots = append(opts.Roots, path)
+		}
+	} else {
+		// fallback to current working directory
+		opts.Roots = append(opts.Roots, getWd())
+	}
+
+	return opts, nil
+}
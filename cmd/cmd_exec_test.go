@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExecKeepGoingResumesFailedRepositories(t *testing.T) {
+	t.Cleanup(func() { cacheConfigStateV2 = nil })
+
+	root := t.TempDir()
+	var repos []string
+	for _, name := range []string{"a", "b", "c"} {
+		repo := filepath.Join(root, name)
+		initRepoAtPath(t, repo, filepath.Join(t.TempDir(), "remote.git"))
+		repos = append(repos, repo)
+	}
+	for _, repo := range repos[:2] {
+		writeTestFile(t, filepath.Join(repo, "ok"), "")
+	}
+
+	opts := execOptions{
+		Roots:      []string{root},
+		Command:    []string{"sh", "-c", "test -f ok || exit 3"},
+		MaxWorkers: 2,
+		KeepGoing:  true,
+	}
+	summary, err := runExecOptions(context.Background(), opts)
+	if err == nil || !strings.Contains(err.Error(), "1 of 3") {
+		t.Fatalf("runExecOptions() error = %v, want one failure", err)
+	}
+	if summary.Total != 3 || summary.Succeeded != 2 || summary.Failed != 1 {
+		t.Fatalf("summary = %+v", summary)
+	}
+	if got := summary.Results[2]; got.Path != repos[2] || got.ExitCode != 3 {
+		t.Fatalf("failed result = %+v", got)
+	}
+	stateFile := configStateFilename(root, execStateName(opts))
+	if _, err := os.Stat(stateFile); err != nil {
+		t.Fatalf("checkpoint of the failed run: %v", err)
+	}
+
+	writeTestFile(t, filepath.Join(repos[2], "ok"), "")
+	summary, err = runExecOptions(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Total != 1 || summary.Results[0].Path != repos[2] || summary.Results[0].ExitCode != 0 {
+		t.Fatalf("resumed summary = %+v, want only the failed repository", summary)
+	}
+	if _, err := os.Stat(stateFile); !os.IsNotExist(err) {
+		t.Fatalf("checkpoint after a complete run: %v", err)
+	}
+	if execStateName(opts) == execStateName(execOptions{Command: opts.Command, Selection: repoSelection{Tags: []string{"work"}}}) {
+		t.Fatal("catalog selection shares the checkpoint of a root scan")
+	}
+}
+
+func TestExecChildrenDoNotSeeCredentialHeaders(t *testing.T) {
+	t.Cleanup(func() {
+		cacheConfigStateV2 = nil
+		setGitCredentialEnv(nil)
+	})
+	setGitCredentialEnv(gitCredentialHeaderEnv(os.Getenv, map[string]gitCredential{
+		"git.example.com": {Username: "bot", Token: "secret"},
+	}))
+
+	root := t.TempDir()
+	repo := filepath.Join(root, "a")
+	initRepoAtPath(t, repo, filepath.Join(t.TempDir(), "remote.git"))
+
+	opts := execOptions{
+		Roots:      []string{root},
+		Command:    []string{"sh", "-c", "env > env.out"},
+		MaxWorkers: 1,
+	}
+	if _, err := runExecOptions(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	env, err := os.ReadFile(filepath.Join(repo, "env.out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(env), "Authorization") || strings.Contains(string(env), "git.example.com") {
+		t.Fatalf("exec command sees the credential headers:\n%s", env)
+	}
+
+	out, err := gitRemoteCommand(context.Background(), repo, "config", "--get", "http.https://git.example.com/.extraHeader")
+	if err != nil {
+		t.Fatalf("git command does not see the credential headers: %v: %s", err, out)
+	}
+	if got := strings.TrimSpace(string(out)); got != "Authorization: Basic Ym90OnNlY3JldA==" {
+		t.Fatalf("extraHeader = %q", got)
+	}
+}
+
+func TestParseExecArgsRequiresCommand(t *testing.T) {
+	t.Parallel()
+
+	if _, err := parseExecArgs([]string{"."}, -1); err == nil {
+		t.Fatal("parseExecArgs() without -- succeeded")
+	}
+	opts, err := parseExecArgs([]string{"git", "status"}, 0)
+	if err != nil || opts.ExplicitRoots || strings.Join(opts.Command, " ") != "git status" {
+		t.Fatalf("parseExecArgs() = %+v, %v", opts, err)
+	}
+}
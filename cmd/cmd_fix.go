@@ -30,6 +30,7 @@ func init() {
 	fixCmd.Flags().BoolVarP(&fixCmdFlags.NoErrors, "no-errors", "s", false, "Suppress some errors")
 	fixCmd.Flags().BoolVarP(&fixCmdFlags.OnlyUpdated, "only-updated", "u", false, "Print only updated projects")
 	fixCmd.Flags().DurationVar(&fixCmdFlags.ExecTimeout, "exec-timeout", 0, "Duration after which process should stop")
+	fixCmd.Flags().BoolVar(&fixCmdFlags.RecheckInactive, "recheck-inactive", false, "Check repositories recorded as inactive in the catalog again")
 
 	rootCmd.AddCommand(fixCmd)
 }
@@ -41,6 +42,8 @@ type fixOptions struct {
 	NoErrors    bool
 	OnlyUpdated bool
 	ExecTimeout time.Duration
+	// RecheckInactive checks repositories recorded as inactive again.
+	RecheckInactive bool
 }
 
 func runFix(cmd *cobra.Command, args []string) error {
@@ -152,6 +155,7 @@ func runFix(cmd *cobra.Command, args []string) error {
 		// context setup
 		taskCtx := context.WithValue(groupCtx, ctxKeyDryRun{}, opts.DryRun)
 		taskCtx = context.WithValue(taskCtx, ctxKeyOnlyUpdated{}, opts.OnlyUpdated)
+		taskCtx = context.WithValue(taskCtx, ctxKeyRecheckInactive{}, opts.RecheckInactive)
 
 		task := taskUpdateFn(
 			taskCtx,
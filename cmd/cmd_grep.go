@@ -0,0 +1,318 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"dario.cat/mergo"
+	"github.com/alitto/pond/v2"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+
+	"github.com/zbiljic/fget/pkg/fsfind"
+	"github.com/zbiljic/fget/pkg/gitinspect"
+)
+
+var grepCmd = &cobra.Command{
+	Use:         "grep <pattern> [root...]",
+	Short:       "Search tracked files across repositories",
+	Annotations: map[string]string{"group": "view"},
+	Args:        cobra.MinimumNArgs(1),
+	RunE:        runGrep,
+}
+
+var grepCmdFlags = &grepOptions{
+	MaxWorkers: poolDefaultMaxWorkers,
+}
+
+var grepGitRunnerFactoryFn = func() gitinspect.Runner { return gitinspect.CLIRunner{} }
+
+func init() {
+	grepCmd.Flags().Uint16VarP(&grepCmdFlags.MaxWorkers, "workers", "j", poolDefaultMaxWorkers, "Set the maximum number of workers to use")
+	grepCmd.Flags().BoolVarP(&grepCmdFlags.FilesOnly, "files-only", "l", false, "Print only the names of matching files")
+	grepCmd.Flags().BoolVarP(&grepCmdFlags.Count, "count", "c", false, "Print the number of matching lines per file")
+	grepCmd.Flags().BoolVar(&grepCmdFlags.JSON, "json", false, "Print matches as JSON")
+	grepCmd.Flags().BoolVarP(&grepCmdFlags.IgnoreCase, "ignore-case", "i", false, "Ignore case differences")
+	grepCmd.Flags().BoolVarP(&grepCmdFlags.FixedStrings, "fixed-strings", "F", false, "Match the pattern as a fixed string")
+	grepCmd.Flags().StringVarP(&grepCmdFlags.Revision, "rev", "r", "", "Search this revision, such as HEAD, instead of the working tree")
+	grepCmd.Flags().StringSliceVar(&grepCmdFlags.Selection.Tags, "tag", nil, "Search catalog repositories with any tag (repeatable)")
+	grepCmd.Flags().StringSliceVar(&grepCmdFlags.Selection.Hosts, "host", nil, "Search catalog repositories on this host (repeatable)")
+	grepCmd.Flags().StringVar(&grepCmdFlags.Selection.CatalogPath, "catalog", "", "Select repositories from this catalog file instead of scanning roots")
+
+	rootCmd.AddCommand(grepCmd)
+}
+
+type grepOptions struct {
+	Pattern       string
+	Roots         []string
+	ExplicitRoots bool
+	MaxWorkers    uint16
+	FilesOnly     bool
+	Count         bool
+	JSON          bool
+	IgnoreCase    bool
+	FixedStrings  bool
+	Revision      string
+	Selection     repoSelection
+}
+
+// grepRepoResult holds the matches of one repository. Matches carry a line
+// and its text, a count with --count, or only the file with --files-only.
+type grepRepoResult struct {
+	ID      string      `json:"id"`
+	Path    string      `json:"path"`
+	Matches []grepMatch `json:"matches,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+type grepMatch struct {
+	File  string `json:"file"`
+	Line  int    `json:"line,omitempty"`
+	Text  string `json:"text,omitempty"`
+	Count int    `json:"count,omitempty"`
+}
+
+func runGrep(cmd *cobra.Command, args []string) error {
+	opts, err := parseGrepArgs(args)
+	if err != nil {
+		return err
+	}
+
+	if err := mergo.Merge(&opts, grepCmdFlags); err != nil {
+		return err
+	}
+	if opts.FilesOnly && opts.Count {
+		return errors.New("--files-only and --count cannot be used together")
+	}
+
+	spinner, err := pterm.DefaultSpinner.
+		WithWriter(dynamicOutput).
+		WithRemoveWhenDone(true).
+		Start("finding repositories...")
+	if err != nil {
+		return err
+	}
+
+	repoPaths, err := selectRepositories(cmd.Context(), opts.Roots, opts.ExplicitRoots, opts.Selection)
+	if err != nil {
+		spinner.Stop() //nolint:errcheck
+		return err
+	}
+
+	spinner.UpdateText("searching repositories...")
+	results, err := collectGrepResults(cmd.Context(), repoPaths, opts)
+	spinner.Stop() //nolint:errcheck
+	if err != nil {
+		return err
+	}
+
+	if opts.JSON {
+		if err := outputJSON(cmd.OutOrStdout(), results); err != nil {
+			return err
+		}
+	} else if err := outputGrepText(cmd.OutOrStdout(), results, opts); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+			if !opts.JSON {
+				ptermErrorMessageStyle.Println(fmt.Sprintf("%s: %s", result.ID, result.Error))
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("search failed in %d repositories", failed)
+	}
+	return nil
+}
+
+// collectGrepResults searches repositories concurrently and returns those
+// with matches or errors, sorted by repository ID.
+func collectGrepResults(ctx context.Context, repoPaths []string, opts grepOptions) ([]grepRepoResult, error) {
+	resultPool := pond.NewResultPool[grepRepoResult](
+		int(opts.MaxWorkers),
+		pond.WithQueueSize(poolDefaultMaxCapacity),
+	)
+	defer resultPool.StopAndWait()
+
+	group := resultPool.NewGroupContext(ctx)
+	for _, repoPath := range repoPaths {
+		group.SubmitErr(func() (grepRepoResult, error) {
+			if err := ctx.Err(); err != nil {
+				return grepRepoResult{}, err
+			}
+			return grepRepository(ctx, repoPath, opts, grepGitRunnerFactoryFn()), nil
+		})
+	}
+
+	repoResults, err := group.Wait()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]grepRepoResult, 0, len(repoResults))
+	for _, result := range repoResults {
+		if len(result.Matches) > 0 || result.Error != "" {
+			results = append(results, result)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].ID == results[j].ID {
+			return results[i].Path < results[j].Path
+		}
+		return results[i].ID < results[j].ID
+	})
+	return results, nil
+}
+
+func grepRepository(ctx context.Context, repoPath string, opts grepOptions, runner gitinspect.Runner) grepRepoResult {
+	result := grepRepoResult{ID: repoPath, Path: repoPath}
+	if project, _, _, err := gitProjectInfo(repoPath); err == nil {
+		result.ID = project
+	}
+
+	args := []string{"grep", "--null", "--no-color", "-I"}
+	switch {
+	case opts.FilesOnly:
+		args = append(args, "--files-with-matches")
+	case opts.Count:
+		args = append(args, "--count")
+	default:
+		args = append(args, "--line-number")
+	}
+	if opts.IgnoreCase {
+		args = append(args, "--ignore-case")
+	}
+	if opts.FixedStrings {
+		args = append(args, "--fixed-strings")
+	}
+	args = append(args, "-e", opts.Pattern)
+	if opts.Revision != "" {
+		args = append(args, opts.Revision)
+	}
+	args = append(args, "--")
+
+	out, err := runner.Run(ctx, repoPath, args...)
+	if err != nil {
+		var gitErr *gitinspect.CommandError
+		if errors.As(err, &gitErr) && gitErr.ExitCode == 1 && strings.TrimSpace(gitErr.Stderr) == "" {
+			// no matches
+			return result
+		}
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Matches, err = parseGrepOutput(out.Stdout, opts)
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// parseGrepOutput parses `git grep --null` output. Paths searched in a
+// revision are prefixed with it, which is removed.
+func parseGrepOutput(output string, opts grepOptions) ([]grepMatch, error) {
+	prefix := ""
+	if opts.Revision != "" {
+		prefix = opts.Revision + ":"
+	}
+
+	var matches []grepMatch
+	if opts.FilesOnly {
+		for _, file := range strings.Split(output, "\x00") {
+			if file != "" {
+				matches = append(matches, grepMatch{File: strings.TrimPrefix(file, prefix)})
+			}
+		}
+		return matches, nil
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.SplitN(line, "\x00", 3)
+		if opts.Count && len(fields) == 2 {
+			count, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("malformed git grep count %q", line)
+			}
+			matches = append(matches, grepMatch{File: strings.TrimPrefix(fields[0], prefix), Count: count})
+			continue
+		}
+		if opts.Count || len(fields) != 3 {
+			return nil, fmt.Errorf("malformed git grep output %q", line)
+		}
+		number, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("malformed git grep line number %q", line)
+		}
+		matches = append(matches, grepMatch{File: strings.TrimPrefix(fields[0], prefix), Line: number, Text: fields[2]})
+	}
+	return matches, nil
+}
+
+// outputGrepText prints the matches grouped under their repository ID.
+func outputGrepText(w io.Writer, results []grepRepoResult, opts grepOptions) error {
+	first := true
+	for _, result := range results {
+		if len(result.Matches) == 0 {
+			continue
+		}
+		if !first {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+		first = false
+
+		if _, err := fmt.Fprintln(w, result.ID); err != nil {
+			return err
+		}
+		for _, match := range result.Matches {
+			var err error
+			switch {
+			case opts.FilesOnly:
+				_, err = fmt.Fprintln(w, match.File)
+			case opts.Count:
+				_, err = fmt.Fprintf(w, "%s:%d\n", match.File, match.Count)
+			default:
+				_, err = fmt.Fprintf(w, "%s:%d:%s\n", match.File, match.Line, match.Text)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func parseGrepArgs(args []string) (grepOptions, error) {
+	opts := grepOptions{Pattern: args[0]}
+
+	if len(args) > 1 {
+		opts.ExplicitRoots = true
+		for _, arg := range args[1:] {
+			path, err := fsfind.DirAbsPath(arg)
+			if err != nil {
+				return opts, err
+			}
+
+			opts.Roots = append(opts.Roots, path)
+		}
+	} else {
+		// fallback to current working directory
+		opts.Roots = append(opts.Roots, getWd())
+	}
+
+	return opts, nil
+}
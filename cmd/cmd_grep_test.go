@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCollectGrepResultsGroupsMatchesByRepository(t *testing.T) {
+	root := t.TempDir()
+	first := filepath.Join(root, "first")
+	second := filepath.Join(root, "second")
+	quiet := filepath.Join(root, "quiet")
+	for _, repo := range []string{first, second, quiet} {
+		initRepoAtPath(t, repo, filepath.Join(t.TempDir(), "remote.git"))
+	}
+	writeTestFile(t, filepath.Join(first, "main.go"), "package main\n\nfunc main() { legacyCall() }\n")
+	writeTestFile(t, filepath.Join(first, "dir with space", "util.go"), "// LegacyCall wrapper\nfunc legacyCall() {}\n")
+	gitRun(t, first, "add", ".")
+	gitRun(t, first, "commit", "-m", "legacy")
+	writeTestFile(t, filepath.Join(second, "README"), "legacyCall is gone\n")
+	gitRun(t, second, "add", ".")
+	gitRun(t, second, "commit", "-m", "readme")
+	// Only in the working tree, so searching HEAD does not see it.
+	writeTestFile(t, filepath.Join(second, "README"), "nothing here\n")
+
+	repoPaths := []string{first, second, quiet}
+	results, err := collectGrepResults(context.Background(), repoPaths, grepOptions{Pattern: "legacyCall", MaxWorkers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Path != first {
+		t.Fatalf("working tree results = %+v, want only the first repository", results)
+	}
+	want := []grepMatch{
+		{File: "dir with space/util.go", Line: 2, Text: "func legacyCall() {}"},
+		{File: "main.go", Line: 3, Text: "func main() { legacyCall() }"},
+	}
+	if !reflect.DeepEqual(results[0].Matches, want) {
+		t.Fatalf("matches = %+v, want %+v", results[0].Matches, want)
+	}
+
+	results, err = collectGrepResults(context.Background(), repoPaths, grepOptions{Pattern: "legacycall", IgnoreCase: true, Count: true, Revision: "HEAD", MaxWorkers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Path != first || results[1].Path != second {
+		t.Fatalf("HEAD results = %+v, want both repositories with matches", results)
+	}
+	if want := []grepMatch{{File: "dir with space/util.go", Count: 2}, {File: "main.go", Count: 1}}; !reflect.DeepEqual(results[0].Matches, want) {
+		t.Fatalf("counts = %+v, want %+v", results[0].Matches, want)
+	}
+
+	opts := grepOptions{Pattern: "legacyCall", FilesOnly: true, Revision: "HEAD", MaxWorkers: 2}
+	results, err = collectGrepResults(context.Background(), repoPaths, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var text bytes.Buffer
+	if err := outputGrepText(&text, results, opts); err != nil {
+		t.Fatal(err)
+	}
+	wantText := first + "\ndir with space/util.go\nmain.go\n\n" + second + "\nREADME\n"
+	if text.String() != wantText {
+		t.Fatalf("text output = %q, want %q", text.String(), wantText)
+	}
+
+	results, err = collectGrepResults(context.Background(), []string{first}, grepOptions{Pattern: "x", Revision: "missing-branch", MaxWorkers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Error == "" {
+		t.Fatalf("results for a missing revision = %+v, want an error", results)
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/thediveo/enumflag/v2"
 
+	"github.com/zbiljic/fget/pkg/forge"
 	"github.com/zbiljic/fget/pkg/fsfind"
 )
 
@@ -92,6 +93,8 @@ type repoInfo struct {
 	LastUpdated *time.Time `json:"last_updated,omitempty"`
 	CommitCount *int       `json:"commit_count,omitempty"`
 	Active      *bool      `json:"active,omitempty"`
+	// Remotes lists every remote of repositories with more than one.
+	Remotes map[string]string `json:"remotes,omitempty"`
 }
 
 const (
@@ -349,6 +352,14 @@ func processRepoInfo(ctx context.Context, repoPath string, opts listOptions) (*r
 		commitCount = &count
 	}
 
+	remotes, err := gitRemoteURLs(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(remotes) < 2 {
+		remotes = nil
+	}
+
 	repo := &repoInfo{
 		Path:        project,
 		URL:         url,
@@ -356,6 +367,7 @@ func processRepoInfo(ctx context.Context, repoPath string, opts listOptions) (*r
 		IsClean:     isClean,
 		LastUpdated: lastUpdated,
 		CommitCount: commitCount,
+		Remotes:     remotes,
 	}
 	if checked {
 		repo.Active = &active
@@ -426,6 +438,17 @@ func listRepoState(ctx context.Context, repoPath string, opts listOptions) (bool
 		defer cancel()
 	}
 
+	// the forge API also knows archived repositories, which still answer
+	if remoteURL, err := gitRemoteConfigURL(repoPath); err == nil {
+		forgeRepo, err := gitLookupForgeRepository(checkCtx, remoteURL)
+		if err == nil {
+			return !forgeRepo.Archived && gitForgeRemoteError(remoteURL, forgeRepo) == nil, true
+		}
+		if errors.Is(err, forge.ErrDisabled) {
+			return false, true
+		}
+	}
+
 	_, err := gitFindRemoteHeadReference(checkCtx, repoPath)
 	if err == nil || errors.Is(err, ErrGitMissingRemoteHeadReference) {
 		return true, true
@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var orgCmd = &cobra.Command{
+	Use:         "org",
+	Short:       "Mirror organizations and users of a forge",
+	Annotations: map[string]string{"group": "update"},
+}
+
+func init() {
+	rootCmd.AddCommand(orgCmd)
+}
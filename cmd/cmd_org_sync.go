@@ -0,0 +1,380 @@
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+
+	"github.com/zbiljic/fget/pkg/fconfig"
+	"github.com/zbiljic/fget/pkg/forge"
+	"github.com/zbiljic/fget/pkg/fsfind"
+	"github.com/zbiljic/fget/pkg/giturl"
+)
+
+const (
+	orgVisibilityAll     = "all"
+	orgVisibilityPublic  = "public"
+	orgVisibilityPrivate = "private"
+
+	// orgMissingUpstreamTag marks local repositories their forge no longer
+	// lists.
+	orgMissingUpstreamTag = "missing-upstream"
+)
+
+type orgSyncFlags struct {
+	CatalogPath string
+	Root        string
+	Tag         string
+	Archived    bool
+	Forks       bool
+	Topics      []string
+	Visibility  string
+	FlagMissing bool
+	MaxWorkers  uint16
+	DryRun      bool
+	Mode        fconfig.CloneMode
+}
+
+var orgSyncCmdFlags orgSyncFlags
+
+// orgSyncForgeClientFn returns the forge API client of a host.
+var orgSyncForgeClientFn = gitForgeClient
+
+var orgSyncCmd = &cobra.Command{
+	Use:   "sync <host/owner>",
+	Short: "Clone the missing repositories of an organization, user or group",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runOrgSync,
+}
+
+func init() {
+	orgSyncCmd.Flags().StringVar(&orgSyncCmdFlags.CatalogPath, "catalog", "", "Explicit catalog file")
+	orgSyncCmd.Flags().StringVar(&orgSyncCmdFlags.Root, "root", "", "Root to clone into (default: current directory)")
+	orgSyncCmd.Flags().StringVar(&orgSyncCmdFlags.Tag, "tag", "", "Catalog tag of the repositories (default: org:<owner>)")
+	orgSyncCmd.Flags().BoolVar(&orgSyncCmdFlags.Archived, "archived", false, "Include archived repositories")
+	orgSyncCmd.Flags().BoolVar(&orgSyncCmdFlags.Forks, "forks", false, "Include forks")
+	orgSyncCmd.Flags().StringSliceVar(&orgSyncCmdFlags.Topics, "topic", nil, "Include repositories with any topic (repeatable)")
+	orgSyncCmd.Flags().StringVar(&orgSyncCmdFlags.Visibility, "visibility", orgVisibilityAll, "Include repositories by visibility: all, public or private")
+	orgSyncCmd.Flags().BoolVar(&orgSyncCmdFlags.FlagMissing, "flag-missing", false, "Tag local repositories the forge no longer lists as "+orgMissingUpstreamTag)
+	orgSyncCmd.Flags().Uint16VarP(&orgSyncCmdFlags.MaxWorkers, "workers", "j", poolDefaultMaxWorkers, "Set the maximum number of workers to use")
+	orgSyncCmd.Flags().BoolVar(&orgSyncCmdFlags.DryRun, "dry-run", false, "Print the repositories that would be cloned")
+	addCloneModeFlags(orgSyncCmd.Flags(), &orgSyncCmdFlags.Mode)
+
+	orgCmd.AddCommand(orgSyncCmd)
+}
+
+func runOrgSync(cmd *cobra.Command, args []string) error {
+	flags := orgSyncCmdFlags
+
+	host, owner, err := parseOrgTarget(args[0])
+	if err != nil {
+		return err
+	}
+	switch flags.Visibility {
+	case orgVisibilityAll, orgVisibilityPublic, orgVisibilityPrivate:
+	default:
+		return fmt.Errorf("invalid --visibility %q", flags.Visibility)
+	}
+	if err := validateCloneMode(flags.Mode); err != nil {
+		return err
+	}
+	if flags.Tag == "" {
+		flags.Tag = "org:" + owner
+	}
+	if flags.Root == "" {
+		flags.Root = getWd()
+	}
+	root, err := filepath.Abs(flags.Root)
+	if err != nil {
+		return err
+	}
+	flags.Root = root
+
+	client, err := orgSyncForgeClientFn(cmd.Context(), host)
+	if err != nil {
+		if errors.Is(err, errGitNoForge) {
+			return fmt.Errorf("no forge API known for %s", host)
+		}
+		return err
+	}
+
+	upstream, err := client.Repositories(cmd.Context(), owner)
+	if err != nil {
+		return fmt.Errorf("list repositories of %s/%s: %w", host, owner, err)
+	}
+
+	planned := planOrgSync(host, filterOrgRepos(upstream, flags), flags)
+
+	var missing []string
+	if flags.FlagMissing {
+		missing, err = findOrgMissingRepos(cmd.Context(), flags.Root, host, owner, upstream)
+		if err != nil {
+			return err
+		}
+	}
+
+	if flags.DryRun {
+		count := 0
+		for _, repo := range planned {
+			if !repo.Present {
+				pterm.Printf("%s\t%s\n", repo.ID, repo.Path)
+				count++
+			}
+		}
+		for _, repoPath := range missing {
+			ptermWarningWithPrefixText("missing").Println(repoPath)
+		}
+		ptermInfoMessageStyle.Printfln("%d of %d repositories would be cloned into %s", count, len(planned), flags.Root)
+		return nil
+	}
+
+	set, err := loadCatalogSetForMaterialize(flags.CatalogPath)
+	if err != nil {
+		return err
+	}
+
+	startedAt := time.Now()
+
+	results, err := syncOrg(cmd.Context(), set, planned, missing, flags)
+	if err != nil {
+		return err
+	}
+
+	for _, repoPath := range missing {
+		ptermWarningWithPrefixText("missing").Printfln("%s: no longer listed upstream", repoPath)
+	}
+
+	return printCloneSummary("org sync", results, startedAt)
+}
+
+// parseOrgTarget splits host/owner, optionally given as a URL. GitLab owners
+// may be nested groups.
+func parseOrgTarget(target string) (string, string, error) {
+	target = strings.TrimSpace(target)
+	if strings.Contains(target, "://") {
+		parsedURL, err := url.Parse(target)
+		if err != nil {
+			return "", "", err
+		}
+		target = parsedURL.Host + parsedURL.Path
+	}
+
+	host, owner, _ := strings.Cut(strings.Trim(target, "/"), "/")
+	owner = strings.Trim(owner, "/")
+	if host == "" || owner == "" {
+		return "", "", fmt.Errorf("invalid organization %q, want host/owner", target)
+	}
+
+	return strings.ToLower(host), owner, nil
+}
+
+// filterOrgRepos keeps the repositories matching the archived, fork, topic
+// and visibility filters.
+func filterOrgRepos(repos []forge.Repository, flags orgSyncFlags) []forge.Repository {
+	topics := normalizedStringSet(flags.Topics)
+
+	filtered := make([]forge.Repository, 0, len(repos))
+	for _, repo := range repos {
+		if repo.Archived && !flags.Archived {
+			continue
+		}
+		if repo.Fork && !flags.Forks {
+			continue
+		}
+		if len(topics) > 0 && !hasAnyCatalogTag(repo.Topics, topics) {
+			continue
+		}
+		switch flags.Visibility {
+		case orgVisibilityPublic:
+			if repo.Private {
+				continue
+			}
+		case orgVisibilityPrivate:
+			if !repo.Private {
+				continue
+			}
+		}
+		filtered = append(filtered, repo)
+	}
+
+	return filtered
+}
+
+// orgSyncRepo is a repository of the organization with its place under the
+// root. Present repositories are not cloned, only cataloged.
+type orgSyncRepo struct {
+	cloneTask
+	Present bool
+}
+
+// planOrgSync places each repository into the host/owner/repo layout under
+// the root.
+func planOrgSync(host string, repos []forge.Repository, flags orgSyncFlags) []orgSyncRepo {
+	planned := make([]orgSyncRepo, 0, len(repos))
+	for _, repo := range repos {
+		id := cloneProjectID(&url.URL{Host: host, Path: "/" + repo.FullName})
+		task := cloneTask{
+			ID:   id,
+			URL:  cmp.Or(repo.CloneURL, "https://"+host+"/"+repo.FullName+".git"),
+			Path: filepath.Join(flags.Root, id),
+			Mode: flags.Mode,
+		}
+
+		_, err := os.Stat(filepath.Join(task.Path, ".git"))
+		planned = append(planned, orgSyncRepo{cloneTask: task, Present: err == nil})
+	}
+
+	return planned
+}
+
+// findOrgMissingRepos returns the local repositories under the owner
+// directory of the root that are not among the upstream repositories.
+func findOrgMissingRepos(ctx context.Context, root, host, owner string, upstream []forge.Repository) ([]string, error) {
+	hostDir := filepath.Join(root, host)
+	ownerDir := filepath.Join(hostDir, filepath.FromSlash(owner))
+	if _, err := os.Stat(ownerDir); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	listed := make(map[string]struct{}, len(upstream))
+	for _, repo := range upstream {
+		listed[strings.ToLower(repo.FullName)] = struct{}{}
+	}
+
+	repoPaths, err := fsfind.GitDirectoriesStrictContext(ctx, ownerDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, repoPath := range repoPaths {
+		rel, err := filepath.Rel(hostDir, repoPath)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := listed[strings.ToLower(filepath.ToSlash(rel))]; !ok {
+			missing = append(missing, repoPath)
+		}
+	}
+
+	return missing, nil
+}
+
+// syncOrg clones the repositories that are not present and records every
+// present or new one in the catalogs that list it, or in the owned catalog,
+// with the organization tag. Missing repositories are tagged
+// missing-upstream, and the tag is removed from listed ones.
+func syncOrg(ctx context.Context, set *catalogSet, planned []orgSyncRepo, missing []string, flags orgSyncFlags) ([]cloneResult, error) {
+	if set == nil || len(set.Sources) == 0 {
+		return nil, errors.New("nil catalog set")
+	}
+
+	tasks := make([]cloneTask, 0, len(planned))
+	for _, repo := range planned {
+		if !repo.Present {
+			tasks = append(tasks, repo.cloneTask)
+		}
+	}
+
+	results, err := runCloneTasks(ctx, tasks, flags.MaxWorkers)
+	if err != nil {
+		return nil, err
+	}
+
+	cloned := make(map[string]struct{}, len(results))
+	for _, result := range results {
+		if result.Status == cloneStatusCloned {
+			cloned[result.ID] = struct{}{}
+		}
+	}
+
+	now := time.Now().UTC()
+	dirtyCatalogs := make(map[string]struct{})
+	upsert := func(entry fconfig.RepoEntry, addTag, removeTag string) error {
+		sources, err := set.resolveTagSources(entry.ID)
+		if err != nil {
+			// not cataloged yet
+			sources = []*catalogSource{&set.Sources[0]}
+		}
+		for _, source := range sources {
+			source.Catalog.Upsert(entry)
+			if err := fconfig.AddTags(source.Catalog, entry.ID, []string{addTag}); err != nil {
+				return err
+			}
+			if removeTag != "" {
+				if err := fconfig.RemoveTags(source.Catalog, entry.ID, []string{removeTag}); err != nil {
+					return err
+				}
+			}
+			dirtyCatalogs[source.CatalogPath] = struct{}{}
+		}
+		return nil
+	}
+
+	for _, repo := range planned {
+		_, isCloned := cloned[repo.ID]
+		if !repo.Present && !isCloned {
+			continue
+		}
+
+		remoteURL := repo.URL
+		if repo.Present {
+			// keep the remote the repository was cloned with, such as SSH,
+			// and the cataloged one without a remote
+			remoteURL = ""
+			if parsedURL, err := gitRemoteConfigURL(repo.Path); err == nil {
+				remoteURL = parsedURL.String()
+			}
+		}
+
+		entry := fconfig.RepoEntry{
+			ID:        repo.ID,
+			RemoteURL: giturl.Sanitize(remoteURL),
+			Locations: []fconfig.RepoLocation{{Path: repo.Path, LastSeenAt: now}},
+		}
+		if isCloned && !repo.Mode.IsZero() {
+			mode := repo.Mode
+			entry.Clone = &mode
+		}
+		if err := upsert(entry, flags.Tag, orgMissingUpstreamTag); err != nil {
+			return results, err
+		}
+	}
+
+	for _, repoPath := range missing {
+		rel, err := filepath.Rel(flags.Root, repoPath)
+		if err != nil {
+			return results, err
+		}
+		entry := fconfig.RepoEntry{
+			ID:        filepath.ToSlash(rel),
+			Locations: []fconfig.RepoLocation{{Path: repoPath, LastSeenAt: now}},
+		}
+		if err := upsert(entry, orgMissingUpstreamTag, ""); err != nil {
+			return results, err
+		}
+	}
+
+	for i := range set.Sources {
+		if _, ok := dirtyCatalogs[set.Sources[i].CatalogPath]; !ok {
+			continue
+		}
+		if err := fconfig.SaveCatalog(set.Sources[i].CatalogPath, set.Sources[i].Catalog); err != nil {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
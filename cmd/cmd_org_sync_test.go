@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/zbiljic/fget/pkg/fconfig"
+	"github.com/zbiljic/fget/pkg/forge"
+	"github.com/zbiljic/fget/pkg/forge/forgetest"
+)
+
+func TestParseOrgTarget(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		target string
+		host   string
+		owner  string
+	}{
+		{target: "github.com/acme", host: "github.com", owner: "acme"},
+		{target: "GitLab.com/acme/platform/", host: "gitlab.com", owner: "acme/platform"},
+		{target: "https://codeberg.org/acme", host: "codeberg.org", owner: "acme"},
+	}
+
+	for _, test := range tests {
+		host, owner, err := parseOrgTarget(test.target)
+		if err != nil || host != test.host || owner != test.owner {
+			t.Fatalf("parseOrgTarget(%q) = %q, %q, %v, want %q, %q", test.target, host, owner, err, test.host, test.owner)
+		}
+	}
+
+	if _, _, err := parseOrgTarget("github.com"); err == nil {
+		t.Fatal("parseOrgTarget() without owner error = nil")
+	}
+}
+
+func TestSyncOrgClonesTagsAndFlagsMissing(t *testing.T) {
+	repo, remote := initCommittedRepo(t)
+	configureOrigin(t, repo, remote)
+	pushMain(t, repo)
+	gitRun(t, remote, "symbolic-ref", "HEAD", "refs/heads/main")
+
+	server := forgetest.NewServer(t,
+		forge.Repository{FullName: "acme/api", DefaultBranch: "main", CloneURL: remote, Topics: []string{"go"}},
+		forge.Repository{FullName: "acme/web", DefaultBranch: "main", CloneURL: remote, Private: true},
+		forge.Repository{FullName: "acme/legacy", DefaultBranch: "main", CloneURL: remote, Archived: true},
+		forge.Repository{FullName: "acme/fork", DefaultBranch: "main", CloneURL: remote, Fork: true},
+	)
+	client, err := forge.New(forge.KindGitHub, "github.com", forge.Options{BaseURL: server.BaseURL(forge.KindGitHub)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream, err := client.Repositories(context.Background(), "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := filepath.Join(t.TempDir(), "dev")
+	present := filepath.Join(root, "github.com", "acme", "web")
+	initRepoAtPath(t, present, filepath.Join(t.TempDir(), "web.git"))
+	gitRun(t, present, "remote", "add", "origin", "git@github.com:acme/web.git")
+	gone := filepath.Join(root, "github.com", "acme", "gone")
+	initRepoAtPath(t, gone, filepath.Join(t.TempDir(), "gone.git"))
+
+	flags := orgSyncFlags{Root: root, Tag: "org:acme", Visibility: orgVisibilityAll, MaxWorkers: 2}
+	if got := filterOrgRepos(upstream, orgSyncFlags{Visibility: orgVisibilityPrivate}); len(got) != 1 || got[0].FullName != "acme/web" {
+		t.Fatalf("filterOrgRepos(private) = %+v", got)
+	}
+	if got := filterOrgRepos(upstream, orgSyncFlags{Visibility: orgVisibilityAll, Topics: []string{"Go"}}); len(got) != 1 || got[0].FullName != "acme/api" {
+		t.Fatalf("filterOrgRepos(topic) = %+v", got)
+	}
+
+	planned := planOrgSync("github.com", filterOrgRepos(upstream, flags), flags)
+	if len(planned) != 2 {
+		t.Fatalf("planned = %+v, want api and web", planned)
+	}
+
+	missing, err := findOrgMissingRepos(context.Background(), root, "github.com", "acme", upstream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 1 || missing[0] != gone {
+		t.Fatalf("missing = %v, want %s", missing, gone)
+	}
+
+	catalogPath := filepath.Join(t.TempDir(), "fget.catalog.yaml")
+	if err := fconfig.SaveCatalog(catalogPath, &fconfig.Catalog{Version: fconfig.CatalogVersionV1}); err != nil {
+		t.Fatal(err)
+	}
+	set, err := loadCatalogSetForMaterialize(catalogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := syncOrg(context.Background(), set, planned, missing, flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].ID != "github.com/acme/api" || results[0].Status != cloneStatusCloned {
+		t.Fatalf("results = %+v", results)
+	}
+	target := filepath.Join(root, "github.com", "acme", "api")
+	if got := gitOutput(t, target, "rev-parse", "HEAD"); got != gitOutput(t, repo, "rev-parse", "HEAD") {
+		t.Fatalf("cloned HEAD = %s", got)
+	}
+
+	saved, err := fconfig.LoadCatalogWithScope(catalogPath, filepath.Dir(catalogPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantTags := map[string]string{
+		"github.com/acme/api":  "org:acme",
+		"github.com/acme/web":  "org:acme",
+		"github.com/acme/gone": orgMissingUpstreamTag,
+	}
+	if index, err := fconfig.ResolveRepoIndex(saved, "github.com/acme/web"); err != nil {
+		t.Fatal(err)
+	} else if got, want := saved.Repos[index].RemoteURL, "ssh://git@github.com/acme/web.git"; got != want {
+		t.Fatalf("remote of the present repository = %q, want %q", got, want)
+	}
+	for id, tag := range wantTags {
+		index, err := fconfig.ResolveRepoIndex(saved, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tags := saved.Repos[index].Tags; !slices.Equal(tags, []string{tag}) {
+			t.Fatalf("tags of %s = %v, want %s", id, tags, tag)
+		}
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/pterm/pterm"
 	"github.com/spf13/cobra"
 
+	"github.com/zbiljic/fget/pkg/fconfig"
 	"github.com/zbiljic/fget/pkg/fsfind"
 )
 
@@ -29,6 +30,7 @@ var recloneCmdFlags = &recloneOptions{}
 func init() {
 	recloneCmd.Flags().BoolVar(&recloneCmdFlags.DryRun, "dry-run", false, "Displays the operations that would be performed using the specified command without actually running them")
 	recloneCmd.Flags().BoolVarP(&recloneCmdFlags.AssumeYes, "yes", "y", false, "Skip confirmation prompt")
+	addCloneModeFlags(recloneCmd.Flags(), &recloneCmdFlags.Mode)
 
 	rootCmd.AddCommand(recloneCmd)
 }
@@ -37,6 +39,8 @@ type recloneOptions struct {
 	RepoPaths []string
 	DryRun    bool
 	AssumeYes bool
+	// Mode replaces the clone mode of the repositories when set.
+	Mode fconfig.CloneMode
 }
 
 func runReclone(cmd *cobra.Command, args []string) error {
@@ -47,6 +51,11 @@ func runReclone(cmd *cobra.Command, args []string) error {
 
 	opts.DryRun = recloneCmdFlags.DryRun
 	opts.AssumeYes = recloneCmdFlags.AssumeYes
+	opts.Mode = recloneCmdFlags.Mode
+
+	if err := validateCloneMode(opts.Mode); err != nil {
+		return err
+	}
 
 	if opts.DryRun {
 		opts.AssumeYes = true
@@ -86,6 +95,9 @@ func runReclone(cmd *cobra.Command, args []string) error {
 
 		taskCtx := context.WithValue(cmd.Context(), ctxKeyPrintProjectInfoHeaderFn{}, printProjectInfoHeaderFn)
 		taskCtx = context.WithValue(taskCtx, ctxKeyDryRun{}, opts.DryRun)
+		if !opts.Mode.IsZero() {
+			taskCtx = context.WithValue(taskCtx, ctxKeyCloneMode{}, opts.Mode)
+		}
 
 		if err := gitRunReclone(taskCtx, repoPath); err != nil {
 			ptermErrorMessageStyle.Printfln("reclone '%s': %s", repoPath, err.Error())
@@ -33,6 +33,10 @@ var rootCmd = &cobra.Command{
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
 		ctx, _ := signal.NotifyContext(context.Background(), os.Interrupt)
 		cmd.SetContext(ctx)
+
+		if err := setupGitCredentialHeaders(ctx); err != nil {
+			ptermWarningWithPrefixText("credentials").Println(err.Error())
+		}
 	},
 }
 
@@ -0,0 +1,477 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"dario.cat/mergo"
+	"github.com/alitto/pond/v2"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"github.com/thediveo/enumflag/v2"
+
+	"github.com/zbiljic/fget/pkg/fsfind"
+	"github.com/zbiljic/fget/pkg/gitinspect"
+)
+
+var statusCmd = &cobra.Command{
+	Use:         "status [root...]",
+	Aliases:     []string{"st"},
+	Short:       "Show local work across repositories",
+	Annotations: map[string]string{"group": "view"},
+	Args:        cobra.ArbitraryArgs,
+	RunE:        runStatus,
+}
+
+var statusCmdFlags = statusOptions{
+	OutputFormat: OutputFormatText,
+	MaxWorkers:   poolDefaultMaxWorkers,
+}
+
+var statusGitRunnerFactoryFn = func() gitinspect.Runner { return gitinspect.CLIRunner{} }
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+
+	statusCmd.Flags().VarP(
+		enumflag.New(&statusCmdFlags.OutputFormat, "output", OutputFormatIds, enumflag.EnumCaseInsensitive),
+		"output", "o",
+		"Output format: text|json|table",
+	)
+	statusCmd.Flags().Uint16VarP(&statusCmdFlags.MaxWorkers, "workers", "j", poolDefaultMaxWorkers, "Set the maximum number of workers to use")
+	statusCmd.Flags().BoolVar(&statusCmdFlags.Filter.Dirty, "dirty", false, "Show repositories with staged, unstaged or untracked changes")
+	statusCmd.Flags().BoolVar(&statusCmdFlags.Filter.Ahead, "ahead", false, "Show repositories with commits not on their upstream")
+	statusCmd.Flags().BoolVar(&statusCmdFlags.Filter.Behind, "behind", false, "Show repositories missing commits from their upstream")
+	statusCmd.Flags().BoolVar(&statusCmdFlags.Filter.NoUpstream, "no-upstream", false, "Show repositories whose branch has no upstream")
+	statusCmd.Flags().BoolVar(&statusCmdFlags.Filter.Detached, "detached", false, "Show repositories with a detached HEAD")
+	statusCmd.Flags().BoolVar(&statusCmdFlags.Filter.Stashed, "stashed", false, "Show repositories with stash entries")
+	statusCmd.Flags().BoolVar(&statusCmdFlags.Filter.InProgress, "in-progress", false, "Show repositories with a rebase, merge or similar operation in progress")
+}
+
+type statusOptions struct {
+	Roots        []string
+	OutputFormat OutputFormat
+	MaxWorkers   uint16
+	Filter       statusFilter
+}
+
+// statusFilter selects repositories that match any of the set conditions.
+// Without conditions every repository is shown.
+type statusFilter struct {
+	Dirty      bool
+	Ahead      bool
+	Behind     bool
+	NoUpstream bool
+	Detached   bool
+	Stashed    bool
+	InProgress bool
+}
+
+type repoStatus struct {
+	Path         string `json:"path"`
+	Project      string `json:"project,omitempty"`
+	Branch       string `json:"branch,omitempty"`
+	Head         string `json:"head,omitempty"`
+	Detached     bool   `json:"detached,omitempty"`
+	Upstream     string `json:"upstream,omitempty"`
+	UpstreamGone bool   `json:"upstream_gone,omitempty"`
+	Ahead        int    `json:"ahead"`
+	Behind       int    `json:"behind"`
+	Staged       int    `json:"staged"`
+	Unstaged     int    `json:"unstaged"`
+	Untracked    int    `json:"untracked"`
+	Stashes      int    `json:"stashes"`
+	InProgress   string `json:"in_progress,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// repoOperationMarkers maps files in the Git directory to the operation they
+// show to be in progress, in the order Git itself reports them.
+var repoOperationMarkers = []struct {
+	name      string
+	operation string
+}{
+	{"rebase-merge", "rebase"},
+	{"rebase-apply", "rebase"},
+	{"MERGE_HEAD", "merge"},
+	{"CHERRY_PICK_HEAD", "cherry-pick"},
+	{"REVERT_HEAD", "revert"},
+	{"BISECT_LOG", "bisect"},
+}
+
+func runStatus(cmd *cobra.Command, args []string) error {
+	listOpts, err := parseListArgs(args)
+	if err != nil {
+		return err
+	}
+	opts := statusOptions{Roots: listOpts.Roots}
+	if err := mergo.Merge(&opts, statusCmdFlags); err != nil {
+		return err
+	}
+
+	spinner, err := pterm.DefaultSpinner.
+		WithWriter(dynamicOutput).
+		WithRemoveWhenDone(true).
+		Start("finding repositories...")
+	if err != nil {
+		return err
+	}
+
+	repoPaths, err := fsfind.GitDirectoriesTreeContext(cmd.Context(), opts.Roots...)
+	if err != nil {
+		spinner.Stop() //nolint:errcheck
+		return err
+	}
+
+	var repoPathSlice []string
+	for it := repoPaths.Iterator(); it.HasNext(); {
+		node, _ := it.Next()
+		repoPathSlice = append(repoPathSlice, string(node.Key()))
+	}
+
+	spinner.UpdateText("inspecting repositories...")
+	statuses, err := collectRepoStatuses(cmd.Context(), repoPathSlice, opts)
+	spinner.Stop() //nolint:errcheck
+	if err != nil {
+		return err
+	}
+
+	w := pterm.DefaultBasicText.WithWriter(dynamicOutput).Writer
+	switch opts.OutputFormat {
+	case OutputFormatJSON:
+		return outputJSON(w, statuses)
+	case OutputFormatTable:
+		return outputStatusTable(w, statuses)
+	default:
+		return outputStatusText(w, statuses)
+	}
+}
+
+// collectRepoStatuses inspects repositories concurrently and returns those
+// matching the filter, sorted by path. Repositories that could not be
+// inspected are always returned, with the error in their status.
+func collectRepoStatuses(ctx context.Context, repoPaths []string, opts statusOptions) ([]repoStatus, error) {
+	resultPool := pond.NewResultPool[*repoStatus](
+		int(opts.MaxWorkers),
+		pond.WithQueueSize(poolDefaultMaxCapacity),
+	)
+	defer resultPool.StopAndWait()
+
+	group := resultPool.NewGroupContext(ctx)
+	for _, repoPath := range repoPaths {
+		group.Submit(func() *repoStatus {
+			status, err := inspectRepoStatus(ctx, repoPath, statusGitRunnerFactoryFn())
+			if err != nil {
+				status.Error = err.Error()
+				return &status
+			}
+			if !opts.Filter.matches(status) {
+				return nil
+			}
+			return &status
+		})
+	}
+
+	results, err := group.Wait()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]repoStatus, 0, len(results))
+	for _, status := range results {
+		if status != nil {
+			statuses = append(statuses, *status)
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Path < statuses[j].Path
+	})
+	return statuses, nil
+}
+
+func inspectRepoStatus(ctx context.Context, repoPath string, runner gitinspect.Runner) (repoStatus, error) {
+	status := repoStatus{Path: repoPath}
+	if project, _, _, err := gitProjectInfo(repoPath); err == nil {
+		status.Project = project
+	}
+
+	state, err := gitinspect.InspectState(ctx, repoPath, runner)
+	if err != nil {
+		return status, err
+	}
+	status.Head = state.Head.Commit
+	status.Branch = strings.TrimPrefix(state.Head.Ref, "refs/heads/")
+	status.Detached = state.Head.Ref == "" && state.Head.Commit != ""
+
+	if state.Upstream != nil {
+		status.Upstream = shortRefName(state.Upstream.Ref)
+		status.UpstreamGone = state.Upstream.Commit == ""
+	}
+	if state.Upstream != nil && !status.UpstreamGone {
+		out, err := runner.Run(ctx, repoPath, "rev-list", "--left-right", "--count", "HEAD..."+state.Upstream.Ref)
+		if err != nil {
+			return status, err
+		}
+		fields := strings.Fields(out.Stdout)
+		if len(fields) != 2 {
+			return status, fmt.Errorf("unexpected rev-list output %q", out.Stdout)
+		}
+		if status.Ahead, err = strconv.Atoi(fields[0]); err != nil {
+			return status, err
+		}
+		if status.Behind, err = strconv.Atoi(fields[1]); err != nil {
+			return status, err
+		}
+	}
+
+	out, err := runner.Run(ctx, repoPath, "status", "--porcelain=v1", "-z")
+	if err != nil {
+		return status, err
+	}
+	status.Staged, status.Unstaged, status.Untracked = countStatusEntries(out.Stdout)
+
+	if status.Stashes, err = repoStashCount(ctx, repoPath, runner); err != nil {
+		return status, err
+	}
+
+	gitDir, err := gitinspect.GitDirPath(ctx, repoPath, runner)
+	if err != nil {
+		return status, err
+	}
+	for _, marker := range repoOperationMarkers {
+		if _, err := os.Stat(filepath.Join(gitDir, marker.name)); err == nil {
+			status.InProgress = marker.operation
+			break
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return status, err
+		}
+	}
+
+	return status, nil
+}
+
+// countStatusEntries counts staged, unstaged and untracked entries of
+// `git status --porcelain=v1 -z` output. Unmerged entries count as both
+// staged and unstaged.
+func countStatusEntries(output string) (int, int, int) {
+	var staged, unstaged, untracked int
+	entries := strings.Split(output, "\x00")
+	for index := 0; index < len(entries); index++ {
+		entry := entries[index]
+		if len(entry) < 3 {
+			continue
+		}
+		x, y := entry[0], entry[1]
+		if x == '?' {
+			untracked++
+			continue
+		}
+		if x == '!' {
+			continue
+		}
+		if x != ' ' {
+			staged++
+		}
+		if y != ' ' {
+			unstaged++
+		}
+		if x == 'R' || x == 'C' {
+			// The source path of a rename or copy follows as its own entry.
+			index++
+		}
+	}
+	return staged, unstaged, untracked
+}
+
+func repoStashCount(ctx context.Context, repoPath string, runner gitinspect.Runner) (int, error) {
+	refs, err := gitinspect.RefNames(ctx, repoPath, runner, "refs/stash")
+	if err != nil || len(refs) == 0 {
+		return 0, err
+	}
+	out, err := runner.Run(ctx, repoPath, "rev-list", "--walk-reflogs", "--count", "refs/stash")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(out.Stdout))
+}
+
+func shortRefName(ref string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/remotes/"} {
+		if short, ok := strings.CutPrefix(ref, prefix); ok {
+			return short
+		}
+	}
+	return ref
+}
+
+func (f statusFilter) matches(status repoStatus) bool {
+	if f == (statusFilter{}) {
+		return true
+	}
+	return f.Dirty && status.dirty() ||
+		f.Ahead && status.Ahead > 0 ||
+		f.Behind && status.Behind > 0 ||
+		f.NoUpstream && status.Branch != "" && (status.Upstream == "" || status.UpstreamGone) ||
+		f.Detached && status.Detached ||
+		f.Stashed && status.Stashes > 0 ||
+		f.InProgress && status.InProgress != ""
+}
+
+func (s repoStatus) dirty() bool {
+	return s.Staged > 0 || s.Unstaged > 0 || s.Untracked > 0
+}
+
+func (s repoStatus) name() string {
+	if s.Project != "" {
+		return s.Project
+	}
+	return s.Path
+}
+
+func (s repoStatus) headLabel() string {
+	switch {
+	case s.Error != "" && s.Head == "":
+		return "-"
+	case s.Detached:
+		return "(detached " + abbreviateCommit(s.Head) + ")"
+	case s.Branch == "":
+		return "(no commits)"
+	case s.Upstream != "":
+		return s.Branch + "..." + s.Upstream
+	default:
+		return s.Branch
+	}
+}
+
+// summary describes the local work of a repository, or "clean".
+func (s repoStatus) summary() string {
+	if s.Error != "" {
+		return "error: " + s.Error
+	}
+
+	var parts []string
+	add := func(count int, label string) {
+		if count > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", label, count))
+		}
+	}
+	add(s.Ahead, "ahead")
+	add(s.Behind, "behind")
+	add(s.Staged, "staged")
+	add(s.Unstaged, "unstaged")
+	add(s.Untracked, "untracked")
+	add(s.Stashes, "stashes")
+	if s.Branch != "" && s.Upstream == "" {
+		parts = append(parts, "no upstream")
+	}
+	if s.UpstreamGone {
+		parts = append(parts, "upstream gone")
+	}
+	if s.InProgress != "" {
+		parts = append(parts, s.InProgress+" in progress")
+	}
+	if len(parts) == 0 {
+		return "clean"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func abbreviateCommit(commit string) string {
+	if len(commit) > 12 {
+		return commit[:12]
+	}
+	return commit
+}
+
+func outputStatusText(w io.Writer, statuses []repoStatus) error {
+	for _, status := range statuses {
+		if _, err := fmt.Fprintf(w, "%s\t%s\t%s\n", status.name(), status.headLabel(), status.summary()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func outputStatusTable(w io.Writer, statuses []repoStatus) error {
+	if len(statuses) == 0 {
+		return nil
+	}
+
+	header := []string{"Repository", "Branch", "Upstream", "Ahead", "Behind", "Staged", "Unstaged", "Untracked", "Stashes", "In Progress", "Error"}
+	rows := make([][]string, 0, len(statuses))
+	for _, status := range statuses {
+		branch := status.Branch
+		if status.Detached {
+			branch = status.headLabel()
+		}
+		upstream := status.Upstream
+		if status.UpstreamGone {
+			upstream += " (gone)"
+		}
+		rows = append(rows, []string{
+			status.name(),
+			branch,
+			valueOrDash(upstream),
+			strconv.Itoa(status.Ahead),
+			strconv.Itoa(status.Behind),
+			strconv.Itoa(status.Staged),
+			strconv.Itoa(status.Unstaged),
+			strconv.Itoa(status.Untracked),
+			strconv.Itoa(status.Stashes),
+			valueOrDash(status.InProgress),
+			valueOrDash(status.Error),
+		})
+	}
+
+	widths := make([]int, len(header))
+	for column, title := range header {
+		widths[column] = len(title)
+		for _, row := range rows {
+			widths[column] = max(widths[column], len(row[column]))
+		}
+		// Add some padding
+		widths[column] += 2
+	}
+
+	writeRow := func(cells []string) error {
+		var b strings.Builder
+		b.WriteString("|")
+		for column, cell := range cells {
+			fmt.Fprintf(&b, " %-*s |", widths[column], cell)
+		}
+		b.WriteString("\n")
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+
+	if err := writeRow(header); err != nil {
+		return err
+	}
+	separator := make([]string, len(header))
+	for column, width := range widths {
+		separator[column] = strings.Repeat("-", width)
+	}
+	if err := writeRow(separator); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := writeRow(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCountStatusEntries(t *testing.T) {
+	t.Parallel()
+
+	output := "M  staged.txt\x00 M unstaged.txt\x00MM both.txt\x00R  new.txt\x00old.txt\x00UU conflict.txt\x00?? untracked.txt\x00"
+	staged, unstaged, untracked := countStatusEntries(output)
+	if staged != 4 || unstaged != 3 || untracked != 1 {
+		t.Fatalf("countStatusEntries() = %d, %d, %d, want 4, 3, 1", staged, unstaged, untracked)
+	}
+}
+
+func TestCollectRepoStatusesReportsLocalWork(t *testing.T) {
+	clean, remote := initCommittedRepo(t)
+	configureOrigin(t, clean, remote)
+	pushMain(t, clean)
+
+	ahead := filepath.Join(t.TempDir(), "ahead")
+	gitRun(t, filepath.Dir(ahead), "clone", "-q", "-b", "main", remote, ahead)
+	gitRun(t, ahead, "config", "user.name", "Status")
+	gitRun(t, ahead, "config", "user.email", "status@example.com")
+	writeTestFile(t, filepath.Join(ahead, "local.txt"), "local\n")
+	gitRun(t, ahead, "add", "local.txt")
+	gitRun(t, ahead, "commit", "-qm", "local")
+	writeTestFile(t, filepath.Join(ahead, "tracked.txt"), "changed\n")
+	writeTestFile(t, filepath.Join(ahead, "scratch.txt"), "scratch\n")
+	writeTestFile(t, filepath.Join(ahead, "stashed.txt"), "stashed\n")
+	gitRun(t, ahead, "add", "stashed.txt")
+	gitRun(t, ahead, "stash", "push", "-q", "--", "stashed.txt")
+
+	detached, _ := initCommittedRepo(t)
+	gitRun(t, detached, "checkout", "-q", "--detach")
+	writeTestFile(t, filepath.Join(detached, ".git", "MERGE_HEAD"), gitOutput(t, detached, "rev-parse", "HEAD"))
+
+	repoPaths := []string{clean, ahead, detached}
+	statuses, err := collectRepoStatuses(context.Background(), repoPaths, statusOptions{MaxWorkers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byPath := make(map[string]repoStatus, len(statuses))
+	for _, status := range statuses {
+		byPath[status.Path] = status
+	}
+	if len(byPath) != 3 {
+		t.Fatalf("statuses = %+v, want three repositories", statuses)
+	}
+	if got := byPath[clean]; got.Branch != "main" || got.Upstream != "origin/main" || got.summary() != "clean" {
+		t.Fatalf("clean status = %+v (%s)", got, got.summary())
+	}
+	got := byPath[ahead]
+	if got.Ahead != 1 || got.Behind != 0 || got.Unstaged != 1 || got.Untracked != 1 || got.Staged != 0 || got.Stashes != 1 {
+		t.Fatalf("ahead status = %+v", got)
+	}
+	if got := byPath[detached]; !got.Detached || got.Branch != "" || got.InProgress != "merge" {
+		t.Fatalf("detached status = %+v", got)
+	}
+
+	filtered, err := collectRepoStatuses(context.Background(), repoPaths, statusOptions{MaxWorkers: 2, Filter: statusFilter{Ahead: true, Detached: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filtered) != 2 || filtered[0].Path == clean || filtered[1].Path == clean {
+		t.Fatalf("filtered statuses = %+v, want the ahead and detached repositories", filtered)
+	}
+
+	var table bytes.Buffer
+	if err := outputStatusTable(&table, statuses); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(table.String()), "\n")
+	if len(lines) != 5 || !strings.Contains(lines[0], "Unstaged") || !strings.Contains(table.String(), "origin/main") {
+		t.Fatalf("table output = %q", table.String())
+	}
+	for _, line := range lines[1:] {
+		if len(line) != len(lines[0]) {
+			t.Fatalf("table rows are not aligned:\n%s", table.String())
+		}
+	}
+}
+
+func TestCollectRepoStatusesReportsGoneUpstreamAndErrors(t *testing.T) {
+	repo, remote := initCommittedRepo(t)
+	configureOrigin(t, repo, remote)
+	pushMain(t, repo)
+	gitRun(t, repo, "checkout", "-q", "-b", "feature")
+	gitRun(t, repo, "push", "-q", "-u", "origin", "feature")
+	gitRun(t, repo, "push", "-q", "origin", "--delete", "feature")
+	gitRun(t, repo, "fetch", "-q", "--prune")
+
+	broken := t.TempDir()
+
+	statuses, err := collectRepoStatuses(context.Background(), []string{repo, broken}, statusOptions{MaxWorkers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byPath := make(map[string]repoStatus, len(statuses))
+	for _, status := range statuses {
+		byPath[status.Path] = status
+	}
+	if got := byPath[repo]; got.Branch != "feature" || got.Upstream != "origin/feature" || !got.UpstreamGone || got.Error != "" || got.summary() != "upstream gone" {
+		t.Fatalf("gone upstream status = %+v (%s)", got, got.summary())
+	}
+	if got := byPath[broken]; got.Error == "" || !strings.HasPrefix(got.summary(), "error: ") {
+		t.Fatalf("broken status = %+v, want its error", got)
+	}
+
+	filtered, err := collectRepoStatuses(context.Background(), []string{repo, broken}, statusOptions{MaxWorkers: 2, Filter: statusFilter{Dirty: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filtered) != 1 || filtered[0].Path != broken {
+		t.Fatalf("filtered statuses = %+v, want only the broken repository", filtered)
+	}
+}
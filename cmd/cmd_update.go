@@ -31,6 +31,7 @@ func init() {
 	updateCmd.Flags().BoolVarP(&pullCmdFlags.NoErrors, "no-errors", "s", false, "Suppress some errors")
 	updateCmd.Flags().BoolVarP(&pullCmdFlags.OnlyUpdated, "only-updated", "u", false, "Print only updated projects")
 	updateCmd.Flags().DurationVar(&pullCmdFlags.ExecTimeout, "exec-timeout", 0, "Duration after which process should stop")
+	updateCmd.Flags().BoolVar(&pullCmdFlags.RecheckInactive, "recheck-inactive", false, "Check repositories recorded as inactive in the catalog again")
 	updateCmd.Flags().DurationVar(&pullCmdFlags.RetryTimeout, "retry-timeout", defaultRetryMaxElapsedTime, "Duration for retry operation")
 
 	rootCmd.AddCommand(updateCmd)
@@ -44,6 +45,8 @@ type updateOptions struct {
 	OnlyUpdated  bool
 	ExecTimeout  time.Duration
 	RetryTimeout time.Duration
+	// RecheckInactive checks repositories recorded as inactive again.
+	RecheckInactive bool
 }
 
 func runUpdate(cmd *cobra.Command, args []string) error {
@@ -157,6 +160,7 @@ func runUpdate(cmd *cobra.Command, args []string) error {
 		// context setup
 		taskCtx := context.WithValue(groupCtx, ctxKeyDryRun{}, opts.DryRun)
 		taskCtx = context.WithValue(taskCtx, ctxKeyOnlyUpdated{}, opts.OnlyUpdated)
+		taskCtx = context.WithValue(taskCtx, ctxKeyRecheckInactive{}, opts.RecheckInactive)
 
 		task := taskUpdateFn(
 			taskCtx,
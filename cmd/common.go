@@ -14,6 +14,9 @@ type (
 	ctxKeyPrintProjectInfoHeaderFn struct{}
 	ctxKeyIsUpdateMutexLocked      struct{}
 	ctxKeyShouldUpdateMutexUnlock  struct{}
+	ctxKeyCloneMode                struct{}
+	ctxKeyRecheckInactive          struct{}
+	ctxKeyRemoteArchived           struct{}
 )
 
 const (
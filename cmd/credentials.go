@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/zbiljic/fget/pkg/fconfig"
+)
+
+// defaultCredentialUsername is sent with tokens of credentials without a
+// username.
+const defaultCredentialUsername = "x-access-token"
+
+// configuredCredentials is the credentials section of the current
+// configuration, loaded once.
+var configuredCredentials = sync.OnceValue(func() map[string]fconfig.CredentialConfig {
+	runtimeCtx, err := loadConfigRuntimeContext()
+	if err != nil {
+		return nil
+	}
+
+	cfg, err := fconfig.LoadEffectiveConfig(runtimeCtx.HomeDir, runtimeCtx.Cwd, runtimeCtx.XDGConfigHome)
+	if err != nil {
+		return nil
+	}
+
+	return cfg.Credentials
+})
+
+// gitCredential is the username and token to authenticate to one host with.
+type gitCredential struct {
+	Username string
+	Token    string
+}
+
+var (
+	gitCredentialsMu sync.Mutex
+	// gitCredentials caches the resolved credential of each host, so a
+	// credential helper runs once per host.
+	gitCredentials = make(map[string]*gitCredential)
+)
+
+// lookupGitCredential returns the configured credential for the host of an
+// HTTP remote, or nil when there is none.
+func lookupGitCredential(ctx context.Context, remoteURL *url.URL) (*gitCredential, error) {
+	if !gitIsHTTPRemote(remoteURL) {
+		return nil, nil
+	}
+
+	host, credentialConfig, ok := findCredentialConfig(configuredCredentials(), remoteURL)
+	if !ok {
+		return nil, nil
+	}
+
+	gitCredentialsMu.Lock()
+	defer gitCredentialsMu.Unlock()
+
+	if credential, ok := gitCredentials[host]; ok {
+		return credential, nil
+	}
+
+	credential, err := resolveGitCredential(ctx, host, credentialConfig)
+	if err != nil {
+		return nil, fmt.Errorf("credentials for %s: %w", host, err)
+	}
+	gitCredentials[host] = credential
+
+	return credential, nil
+}
+
+// findCredentialConfig returns the credentials for the host and port of the
+// remote, then for its host alone.
+func findCredentialConfig(credentials map[string]fconfig.CredentialConfig, remoteURL *url.URL) (string, fconfig.CredentialConfig, bool) {
+	for _, host := range []string{remoteURL.Host, remoteURL.Hostname()} {
+		host = strings.ToLower(host)
+		if credentialConfig, ok := credentials[host]; ok {
+			return host, credentialConfig, true
+		}
+	}
+
+	return "", fconfig.CredentialConfig{}, false
+}
+
+// resolveGitCredential reads the token from the first source that has one.
+// It returns nil when none has.
+func resolveGitCredential(ctx context.Context, host string, credentialConfig fconfig.CredentialConfig) (*gitCredential, error) {
+	username := cmp.Or(credentialConfig.Username, defaultCredentialUsername)
+
+	if credentialConfig.TokenEnv != "" {
+		if token := strings.TrimSpace(os.Getenv(credentialConfig.TokenEnv)); token != "" {
+			return &gitCredential{Username: username, Token: token}, nil
+		}
+	}
+
+	if credentialConfig.TokenFile != "" {
+		data, err := os.ReadFile(credentialConfig.TokenFile)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if token := strings.TrimSpace(string(data)); token != "" {
+			return &gitCredential{Username: username, Token: token}, nil
+		}
+	}
+
+	if credentialConfig.Helper {
+		helperUsername, token, err := gitCredentialFill(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			return &gitCredential{Username: cmp.Or(credentialConfig.Username, helperUsername, username), Token: token}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// setupGitCredentialHeaders passes the tokens read from an environment
+// variable or a file to the git commands run by fget, as an authorization
+// header for their host. Git asks the credential helpers itself.
+func setupGitCredentialHeaders(ctx context.Context) error {
+	credentials := make(map[string]gitCredential)
+	for host, credentialConfig := range configuredCredentials() {
+		credentialConfig.Helper = false
+		credential, err := resolveGitCredential(ctx, host, credentialConfig)
+		if err != nil {
+			return fmt.Errorf("credentials for %s: %w", host, err)
+		}
+		if credential != nil {
+			credentials[host] = *credential
+		}
+	}
+
+	setGitCredentialEnv(gitCredentialHeaderEnv(os.Getenv, credentials))
+
+	return nil
+}
+
+var (
+	gitCredentialEnvMu sync.RWMutex
+	// gitCredentialEnv holds the authorization headers as environment
+	// entries. They stay out of the process environment, so the commands of
+	// fget exec do not inherit the tokens.
+	gitCredentialEnv []string
+)
+
+func setGitCredentialEnv(env map[string]string) {
+	entries := make([]string, 0, len(env))
+	for key, value := range env {
+		entries = append(entries, key+"="+value)
+	}
+	slices.Sort(entries)
+
+	gitCredentialEnvMu.Lock()
+	defer gitCredentialEnvMu.Unlock()
+	gitCredentialEnv = entries
+}
+
+// gitCredentialHeaders returns the environment entries passing the
+// authorization headers of the configured credentials to a git command.
+func gitCredentialHeaders() []string {
+	gitCredentialEnvMu.RLock()
+	defer gitCredentialEnvMu.RUnlock()
+
+	return slices.Clone(gitCredentialEnv)
+}
+
+// gitCredentialHeaderEnv returns the environment adding an http.extraHeader
+// setting for the host of each credential to the git configuration, after
+// the settings the environment already adds.
+func gitCredentialHeaderEnv(getenv func(string) string, credentials map[string]gitCredential) map[string]string {
+	env := make(map[string]string)
+	if len(credentials) == 0 {
+		return env
+	}
+
+	count, _ := strconv.Atoi(getenv("GIT_CONFIG_COUNT"))
+
+	hosts := make([]string, 0, len(credentials))
+	for host := range credentials {
+		hosts = append(hosts, host)
+	}
+	slices.Sort(hosts)
+
+	for _, host := range hosts {
+		credential := credentials[host]
+		auth := base64.StdEncoding.EncodeToString([]byte(credential.Username + ":" + credential.Token))
+		env["GIT_CONFIG_KEY_"+strconv.Itoa(count)] = "http.https://" + host + "/.extraHeader"
+		env["GIT_CONFIG_VALUE_"+strconv.Itoa(count)] = "Authorization: Basic " + auth
+		count++
+	}
+	env["GIT_CONFIG_COUNT"] = strconv.Itoa(count)
+
+	return env
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/zbiljic/fget/pkg/fconfig"
+)
+
+func TestResolveGitCredentialSources(t *testing.T) {
+	t.Setenv("FGET_TEST_TOKEN", "")
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	writeTestFile(t, tokenFile, "from-file\n")
+	credentialConfig := fconfig.CredentialConfig{TokenEnv: "FGET_TEST_TOKEN", TokenFile: tokenFile}
+
+	credential, err := resolveGitCredential(context.Background(), "github.com", credentialConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (gitCredential{Username: defaultCredentialUsername, Token: "from-file"}); credential == nil || *credential != want {
+		t.Fatalf("resolveGitCredential() = %+v, want %+v", credential, want)
+	}
+
+	t.Setenv("FGET_TEST_TOKEN", "from-env")
+	credentialConfig.Username = "bot"
+	credential, err = resolveGitCredential(context.Background(), "github.com", credentialConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (gitCredential{Username: "bot", Token: "from-env"}); credential == nil || *credential != want {
+		t.Fatalf("resolveGitCredential() = %+v, want %+v", credential, want)
+	}
+
+	credentialConfig = fconfig.CredentialConfig{TokenFile: filepath.Join(t.TempDir(), "missing")}
+	if credential, err := resolveGitCredential(context.Background(), "github.com", credentialConfig); err != nil || credential != nil {
+		t.Fatalf("resolveGitCredential() without a token = %+v, %v, want nil", credential, err)
+	}
+}
+
+func TestFindCredentialConfigPrefersHostWithPort(t *testing.T) {
+	t.Parallel()
+
+	credentials := map[string]fconfig.CredentialConfig{
+		"git.example.com":      {TokenEnv: "DEFAULT_PORT"},
+		"git.example.com:8443": {TokenEnv: "OTHER_PORT"},
+	}
+	tests := map[string]string{
+		"https://git.example.com/acme/api.git":      "DEFAULT_PORT",
+		"https://Git.Example.com:8443/acme/api.git": "OTHER_PORT",
+		"https://git.example.com:9443/acme/api.git": "DEFAULT_PORT",
+	}
+	for remote, want := range tests {
+		remoteURL, err := url.Parse(remote)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, got, ok := findCredentialConfig(credentials, remoteURL); !ok || got.TokenEnv != want {
+			t.Fatalf("findCredentialConfig(%q) = %+v, %v, want %s", remote, got, ok, want)
+		}
+	}
+}
+
+func TestGitCredentialHeaderEnvIsSentByGit(t *testing.T) {
+	authorization := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization <- r.Header.Get("Authorization")
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	getenv := func(key string) string {
+		if key == "GIT_CONFIG_COUNT" {
+			return "1"
+		}
+		return ""
+	}
+	env := gitCredentialHeaderEnv(getenv, map[string]gitCredential{
+		serverURL.Host: {Username: "bot", Token: "secret"},
+	})
+	want := map[string]string{
+		"GIT_CONFIG_COUNT":   "2",
+		"GIT_CONFIG_KEY_1":   "http.https://" + serverURL.Host + "/.extraHeader",
+		"GIT_CONFIG_VALUE_1": "Authorization: Basic Ym90OnNlY3JldA==",
+	}
+	if !reflect.DeepEqual(env, want) {
+		t.Fatalf("gitCredentialHeaderEnv() = %v, want %v", env, want)
+	}
+
+	// the test server speaks plain HTTP
+	cmd := exec.Command("git", "ls-remote", server.URL+"/acme/api.git")
+	cmd.Env = append(os.Environ(),
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_CONFIG_COUNT=2",
+		"GIT_CONFIG_KEY_0=http.extraHeader",
+		"GIT_CONFIG_VALUE_0=X-Test: 1",
+		"GIT_CONFIG_KEY_1=http."+server.URL+"/.extraHeader",
+		"GIT_CONFIG_VALUE_1="+want["GIT_CONFIG_VALUE_1"],
+	)
+	_ = cmd.Run()
+
+	select {
+	case got := <-authorization:
+		if got != "Basic Ym90OnNlY3JldA==" {
+			t.Fatalf("Authorization = %q", got)
+		}
+	default:
+		t.Fatal("git sent no request")
+	}
+}
@@ -4,11 +4,20 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/tevino/abool/v2"
 )
 
 func gitRunFix(ctx context.Context, repoPath string) error {
+	if gitSkipInactive(ctx, repoPath) {
+		return nil
+	}
+
+	archived := abool.New()
+	ctx = context.WithValue(ctx, ctxKeyRemoteArchived{}, archived)
+
 	if err := gitFixReferences(ctx, repoPath); err != nil {
 		return err
 	}
@@ -22,6 +31,12 @@ func gitRunFix(ctx context.Context, repoPath string) error {
 	}
 
 	if err := gitUpdateDefaultBranch(ctx, repoPath); err != nil {
+		if ok, policyErr := gitRunInactivePolicy(ctx, repoPath, err); ok || policyErr != nil {
+			return policyErr
+		}
+		if errors.Is(err, ErrGitRepositoryNotReachable) {
+			return nil
+		}
 		return err
 	}
 
@@ -29,20 +44,32 @@ func gitRunFix(ctx context.Context, repoPath string) error {
 		return err
 	}
 
-	return nil
+	return gitRunUpstreamPolicy(ctx, repoPath, archived)
 }
 
 func gitRunUpdate(ctx context.Context, repoPath string) error {
+	if gitSkipInactive(ctx, repoPath) {
+		return nil
+	}
+
+	archived := abool.New()
+	ctx = context.WithValue(ctx, ctxKeyRemoteArchived{}, archived)
+
+	if err := gitRunFetchRemotes(ctx, repoPath); err != nil {
+		return err
+	}
+
 	if err := gitCheckAndPull(ctx, repoPath); err != nil {
 		switch {
 		case errors.Is(err, git.NoErrAlreadyUpToDate):
-			fallthrough
+			return gitRunUpstreamPolicy(ctx, repoPath, archived)
 		case errors.Is(err, ErrGitMissingRemoteHeadReference):
-			fallthrough
+			return nil
 		case errors.Is(err, ErrGitRepositoryNotReachable):
 			fallthrough
 		case errors.Is(err, ErrGitRepositoryDisabled):
-			return nil
+			_, err := gitRunInactivePolicy(ctx, repoPath, err)
+			return err
 		case errors.Is(err, ErrGitRepositoryProtected):
 			return nil
 		default:
@@ -65,6 +92,10 @@ func gitRunUpdate(ctx context.Context, repoPath string) error {
 		return err
 	}
 
+	if err := gitRunKeepCloneDepth(ctx, repoPath); err != nil {
+		return err
+	}
+
 	if err := gitMakeClean(ctx, repoPath); err != nil {
 		return err
 	}
@@ -73,7 +104,7 @@ func gitRunUpdate(ctx context.Context, repoPath string) error {
 		return err
 	}
 
-	return nil
+	return gitRunUpstreamPolicy(ctx, repoPath, archived)
 }
 
 func gitRunGc(ctx context.Context, repoPath string) error {
@@ -90,6 +121,70 @@ func gitRunGc(ctx context.Context, repoPath string) error {
 	return nil
 }
 
+// gitRunFetchRemotes fetches the remotes other than the primary one, which is
+// pulled.
+func gitRunFetchRemotes(ctx context.Context, repoPath string) error {
+	repo, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return err
+	}
+
+	remotes, err := gitRepoRemoteURLs(repo)
+	if err != nil {
+		return err
+	}
+
+	if len(remotes) < 2 {
+		return nil
+	}
+
+	primary, err := gitRepoPrimaryRemoteName(repo)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(remotes))
+	for name := range remotes {
+		if name != primary {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		if err := gitFetchRemote(ctx, repoPath, name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// gitRunKeepCloneDepth truncates the history of a shallow clone back to its
+// recorded depth, since a pull keeps every fetched commit.
+func gitRunKeepCloneDepth(ctx context.Context, repoPath string) error {
+	mode, err := lookupRepoCloneMode(repoPath)
+	if err != nil {
+		return err
+	}
+
+	if !mode.Shallow || mode.Depth <= 0 {
+		return nil
+	}
+
+	if count, err := gitRepoCommitCountContext(ctx, repoPath); err != nil {
+		return err
+	} else if count <= mode.Depth {
+		return nil
+	}
+
+	if err := gitFetchDepth(ctx, repoPath, mode.Depth); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func gitRunReclone(ctx context.Context, repoPath string) error {
 	if err := gitReclone(ctx, repoPath); err != nil {
 		return err
@@ -1,7 +1,6 @@
 package cmd
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"crypto/x509"
@@ -29,6 +28,7 @@ import (
 	giturls "github.com/whilp/git-urls"
 
 	"github.com/zbiljic/fget/pkg/fconfig"
+	"github.com/zbiljic/fget/pkg/forge"
 	"github.com/zbiljic/fget/pkg/fsfind"
 	"github.com/zbiljic/fget/pkg/rhttp"
 )
@@ -46,6 +46,9 @@ const (
 	newMode                        = "new mode"
 	deletedFileMode                = "deleted file mode"
 	couldNotReadUsername           = "could not read username"
+	couldNotReadFromRemoteString   = "could not read from remote repository"
+	couldNotResolveHostnameString  = "could not resolve hostname"
+	permissionDeniedString         = "permission denied"
 )
 
 var (
@@ -55,6 +58,11 @@ var (
 	ErrGitRepositoryNotReachable      = errors.New("repository not reachable")
 	ErrGitRepositoryDisabled          = errors.New("repository is disabled")
 	ErrGitRepositoryProtected         = errors.New("repository is protected")
+	ErrGitRepositoryArchived          = errors.New("repository is archived")
+	ErrGitHostNotReachable            = errors.New("host not reachable")
+	// ErrGitRepositoryNotFound marks the definite answers that the repository
+	// is gone, as opposed to failures that may be temporary.
+	ErrGitRepositoryNotFound = errors.New("repository not found")
 )
 
 // gitDefaultClient is used for performing requests without explicitly making
@@ -110,7 +118,12 @@ func gitRemoteConfigURL(repoPath string) (*url.URL, error) {
 }
 
 func gitRepoRemoteConfigURL(repo *git.Repository) (*url.URL, error) {
-	remote, err := repo.Remote(git.DefaultRemoteName)
+	remoteName, err := gitRepoPrimaryRemoteName(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := repo.Remote(remoteName)
 	if err != nil {
 		return nil, err
 	}
@@ -238,6 +251,10 @@ func gitFixObjectNotFound(ctx context.Context, repoPath string) error {
 	_, err = worktree.Status()
 	if err != nil {
 		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			// shallow and partial clones miss objects by design
+			if mode, err1 := gitDetectCloneMode(repoPath); err1 == nil && (mode.Shallow || mode.Filter != "") {
+				return nil
+			}
 			if err1 := gitRefetch(ctx, repoPath); err1 != nil {
 				return err
 			}
@@ -418,7 +435,7 @@ func gitUpdateDefaultBranch(ctx context.Context, repoPath string) error {
 
 		if errors.Is(err, ErrGitRepositoryNotReachable) {
 			prefixPrinter.WithMessageStyle(&pterm.ThemeDefault.ErrorMessageStyle).Println(err.Error())
-			return nil
+			return err
 		}
 
 		if errors.Is(err, ErrGitRepositoryDisabled) {
@@ -580,108 +597,127 @@ func gitResetDefaultBranch(ctx context.Context, repoPath string) error {
 	return nil
 }
 
-func gitCheckRemoteURL(ctx context.Context, repoPath string) (bool, error) {
-	remoteURL, err := gitRemoteConfigURL(repoPath)
+// gitCheckRemoteURL probes the remote URL. Only 404 and 410 answers say
+// that the repository is gone; other failures may be temporary.
+func gitCheckRemoteURL(ctx context.Context, remoteURL *url.URL) error {
+	req, err := retryablehttp.NewRequestWithContext(ctx, http.MethodHead, remoteURL.String(), nil)
 	if err != nil {
-		return false, err
+		return err
 	}
 
-	req, err := retryablehttp.NewRequestWithContext(ctx, http.MethodHead, remoteURL.String(), nil)
+	credential, err := lookupGitCredential(ctx, remoteURL)
 	if err != nil {
-		return false, err
+		return err
+	}
+	if credential != nil {
+		req.SetBasicAuth(credential.Username, credential.Token)
 	}
 
 	resp, err := gitDefaultClient.Do(req)
 	if err != nil {
-		return false, err
+		return err
 	}
+	defer resp.Body.Close()
 
-	ok := resp.StatusCode == http.StatusOK
-
-	return ok, nil
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound, http.StatusGone:
+		return fmt.Errorf("%w: %w", ErrGitRepositoryNotReachable, ErrGitRepositoryNotFound)
+	default:
+		return ErrGitRepositoryNotReachable
+	}
 }
 
 func gitFindRemoteHeadReference(ctx context.Context, repoPath string) (*plumbing.Reference, error) {
-	ok, err := gitCheckRemoteURL(ctx, repoPath)
+	repo, err := git.PlainOpen(repoPath)
 	if err != nil {
 		return nil, err
 	}
 
-	if !ok {
-		return nil, ErrGitRepositoryNotReachable
+	remoteName, err := gitRepoPrimaryRemoteName(repo)
+	if err != nil {
+		return nil, err
 	}
 
-	out, err := gitRepoLsRemote(repoPath)
+	remoteURL, err := gitRepoRemoteConfigURL(repo)
 	if err != nil {
-		outString := string(out)
-		outString = strings.ToLower(outString)
-		// check if repository is disabled
-		if strings.HasPrefix(outString, errorPrefix) && strings.Contains(outString, isDisabledString) {
-			return nil, ErrGitRepositoryDisabled
-		}
-		// check if auth required
-		if strings.HasPrefix(outString, fatalPrefix) && strings.Contains(outString, couldNotReadUsername) {
-			return nil, ErrGitRepositoryProtected
-		}
-
 		return nil, err
 	}
 
-	var ref *plumbing.Reference
-
-	buf := bytes.NewBuffer(out)
-	scanner := bufio.NewScanner(buf)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-
-		if strings.HasPrefix(line, symrefPrefix) && strings.Contains(line, string(plumbing.HEAD)) {
-			split := strings.Split(line, "\t")
-			ref = plumbing.NewReferenceFromStrings(split[1], split[0])
+	forgeRepo, err := gitLookupForgeRepository(ctx, remoteURL)
+	switch {
+	case err == nil:
+		if err := gitForgeRemoteError(remoteURL, forgeRepo); err != nil {
+			return nil, err
+		}
+		if archived, ok := ctx.Value(ctxKeyRemoteArchived{}).(*abool.AtomicBool); ok && forgeRepo.Archived {
+			archived.Set()
+		}
+	case errors.Is(err, forge.ErrDisabled):
+		return nil, ErrGitRepositoryDisabled
+	case errors.Is(err, ErrGitRepositoryNotFound):
+		return nil, fmt.Errorf("%w: %w", ErrGitRepositoryNotReachable, err)
+	case gitIsHTTPRemote(remoteURL):
+		// NOTE: without an answer of the forge API, such as for private
+		// repositories without a token, moves are detected from redirects
+		if err := gitCheckRemoteURL(ctx, remoteURL); err != nil {
+			return nil, err
+		}
+	default:
+		// NOTE: reachability of SSH remotes is checked by ls-remote below,
+		// which honors the SSH configuration
+		if err := gitCheckRemoteMoved(ctx, remoteURL); err != nil {
+			return nil, err
 		}
-	}
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("reading standard input: %w", err)
 	}
 
-	if ref == nil {
-		return nil, ErrGitMissingRemoteHeadReference
+	out, err := gitRepoLsRemoteContext(ctx, repoPath, remoteName)
+	if err != nil {
+		return nil, gitLsRemoteError(out, err)
 	}
 
-	repo, err := git.PlainOpen(repoPath)
+	return gitParseLsRemoteHead(out)
+}
+
+func gitReplaceDefaultBranch(ctx context.Context, repoPath string, from, to *plumbing.Reference) error {
+	mode, err := lookupRepoCloneMode(repoPath)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	remote, err := repo.Remote(git.DefaultRemoteName)
+	repo, err := git.PlainOpen(repoPath)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	refs, err := remote.List(&git.ListOptions{})
+	remoteName, err := gitRepoPrimaryRemoteName(repo)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	for _, r := range refs {
-		if r.Name() == ref.Target() {
-			ref = plumbing.NewHashReference(ref.Target(), r.Hash())
-			break
+	// single-branch clones have not fetched the new default branch
+	if mode.SingleBranch {
+		if out, err := gitRepoSetBranches(repoPath, remoteName, to.Name().Short()); err != nil {
+			return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
 		}
-	}
 
-	return ref, nil
-}
-
-func gitReplaceDefaultBranch(ctx context.Context, repoPath string, from, to *plumbing.Reference) error {
-	repo, err := git.PlainOpen(repoPath)
-	if err != nil {
-		return err
+		fetch := func(repoPath string) ([]byte, error) {
+			return gitRepoFetchRemote(repoPath, remoteName)
+		}
+		if depth := mode.cloneMode().Depth; depth > 0 {
+			fetch = func(repoPath string) ([]byte, error) {
+				return gitRepoFetchDepth(repoPath, depth)
+			}
+		}
+		if out, err := fetch(repoPath); err != nil {
+			return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+		}
 	}
 
 	err = repo.CreateBranch(&config.Branch{
 		Name:   to.Name().Short(),
-		Remote: git.DefaultRemoteName,
+		Remote: remoteName,
 		Merge:  to.Name(),
 	})
 	if err != nil {
@@ -765,7 +801,9 @@ func gitCheckAndPull(ctx context.Context, repoPath string) error {
 		case err == nil:
 			return nil
 		case errors.Is(err, transport.ErrAuthenticationRequired):
-			return nil
+			return ErrGitRepositoryProtected
+		case errors.Is(err, ErrGitRepositoryProtected):
+			return err
 		case errors.Is(err, plumbing.ErrObjectNotFound):
 			if err1 := gitRefetch(ctx, repoPath); err1 != nil {
 				return err
@@ -1012,6 +1050,10 @@ func gitPull(ctx context.Context, repoPath string) error {
 			if strings.HasPrefix(outString, fatalPrefix) && strings.Contains(outString, unableToAccessString) {
 				err = ErrGitRepositoryNotReachable
 			}
+			// check if auth required
+			if strings.HasPrefix(outString, fatalPrefix) && strings.Contains(outString, couldNotReadUsername) {
+				err = ErrGitRepositoryProtected
+			}
 			// check if there are local changes
 			if strings.HasPrefix(outString, errorPrefix) && strings.Contains(outString, filesWouldBeOverwrittenByMerge) {
 				err = git.ErrWorktreeNotClean
@@ -1143,6 +1185,107 @@ func gitFetch(ctx context.Context, repoPath string) error {
 	return nil
 }
 
+// gitFetchRemote fetches a secondary remote. Only new commits or a failure
+// are printed, since most runs fetch nothing.
+func gitFetchRemote(ctx context.Context, repoPath, remoteName string) error {
+	dryRun, _ := ctx.Value(ctxKeyDryRun{}).(bool)
+	if dryRun {
+		return nil
+	}
+
+	out, err := gitRepoFetchRemote(repoPath, remoteName)
+	if err == nil && len(bytes.TrimSpace(out)) == 0 {
+		return nil
+	}
+
+	// complicated update locking
+	if isUpdateMutexLocked, ok := ctx.Value(ctxKeyIsUpdateMutexLocked{}).(*abool.AtomicBool); ok {
+		if isUpdateMutexLocked.IsNotSet() {
+			updateMutex.Lock()
+			isUpdateMutexLocked.Set()
+		}
+	} else {
+		// simple
+		updateMutex.Lock()
+	}
+	if shouldUpdateMutexUnlock, ok := ctx.Value(ctxKeyShouldUpdateMutexUnlock{}).(bool); ok {
+		if shouldUpdateMutexUnlock {
+			defer updateMutex.Unlock()
+		}
+	} else {
+		// simple
+		defer updateMutex.Unlock()
+	}
+
+	printProjectInfoContext(ctx)
+
+	prefixPrinter := ptermInfoWithPrefixText("fetch")
+
+	prefixPrinter.Printf("'%s'", remoteName)
+	pterm.Print(": ")
+
+	if err != nil {
+		// NOTE: a failing secondary remote does not stop the update
+		ptermErrorMessageStyle.Println(strings.TrimSpace(string(out)))
+		return nil
+	}
+
+	ptermSuccessMessageStyle.Println("success")
+
+	pterm.Println()
+	pterm.Println(string(out))
+
+	return nil
+}
+
+func gitFetchDepth(ctx context.Context, repoPath string, depth int) error {
+	// complicated update locking
+	if isUpdateMutexLocked, ok := ctx.Value(ctxKeyIsUpdateMutexLocked{}).(*abool.AtomicBool); ok {
+		if isUpdateMutexLocked.IsNotSet() {
+			updateMutex.Lock()
+			isUpdateMutexLocked.Set()
+		}
+	} else {
+		// simple
+		updateMutex.Lock()
+	}
+	if shouldUpdateMutexUnlock, ok := ctx.Value(ctxKeyShouldUpdateMutexUnlock{}).(bool); ok {
+		if shouldUpdateMutexUnlock {
+			defer updateMutex.Unlock()
+		}
+	} else {
+		// simple
+		defer updateMutex.Unlock()
+	}
+
+	printProjectInfoContext(ctx)
+
+	dryRun, _ := ctx.Value(ctxKeyDryRun{}).(bool)
+
+	prefixPrinter := ptermInfoWithPrefixText("fetch")
+
+	prefixPrinter.Printf("depth %d", depth)
+	pterm.Print(": ")
+
+	if dryRun {
+		ptermSuccessMessageStyle.Println("dry-run")
+		return nil
+	}
+
+	out, err := gitRepoFetchDepth(repoPath, depth)
+	if err != nil {
+		if len(out) > 0 {
+			err = fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+		}
+		ptermErrorMessageStyle.Println(err.Error())
+		return err
+	}
+
+	ptermSuccessMessageStyle.Println("success")
+
+	return nil
+}
+
 func gitRefetch(ctx context.Context, repoPath string) error {
 	// complicated update locking
 	if isUpdateMutexLocked, ok := ctx.Value(ctxKeyIsUpdateMutexLocked{}).(*abool.AtomicBool); ok {
@@ -1273,7 +1416,22 @@ func gitIsDiffFileMode(ctx context.Context, repoPath string) (bool, error) {
 }
 
 func gitReclone(ctx context.Context, repoPath string) error {
-	remoteURL, err := gitRemoteConfigURL(repoPath)
+	repo, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return err
+	}
+
+	remoteURL, err := gitRepoRemoteConfigURL(repo)
+	if err != nil {
+		return err
+	}
+
+	remoteName, err := gitRepoPrimaryRemoteName(repo)
+	if err != nil {
+		return err
+	}
+
+	repoConfig, err := repo.Config()
 	if err != nil {
 		return err
 	}
@@ -1283,6 +1441,15 @@ func gitReclone(ctx context.Context, repoPath string) error {
 		return fmt.Errorf("unsafe repository path: %s", repoPath)
 	}
 
+	cloneMode, ok := ctx.Value(ctxKeyCloneMode{}).(fconfig.CloneMode)
+	if !ok {
+		mode, err := lookupRepoCloneMode(repoPath)
+		if err != nil {
+			return err
+		}
+		cloneMode = mode.cloneMode()
+	}
+
 	// complicated update locking
 	if isUpdateMutexLocked, ok := ctx.Value(ctxKeyIsUpdateMutexLocked{}).(*abool.AtomicBool); ok {
 		if isUpdateMutexLocked.IsNotSet() {
@@ -1316,7 +1483,7 @@ func gitReclone(ctx context.Context, repoPath string) error {
 		return nil
 	}
 
-	out, err := gitRepoLsRemote(repoPath)
+	out, err := gitRepoLsRemoteContext(ctx, repoPath, remoteName)
 	if err != nil {
 		if len(out) > 0 {
 			err = fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
@@ -1337,17 +1504,25 @@ func gitReclone(ctx context.Context, repoPath string) error {
 
 	buf := bytes.NewBuffer(nil)
 
-	_, err = git.PlainClone(repoPath, false, &git.CloneOptions{
-		URL:      remoteURL.String(),
-		Progress: buf,
-	})
+	err = gitClone(ctx, remoteURL.String(), repoPath, remoteName, cloneMode, buf)
 	if err != nil {
 		ptermErrorMessageStyle.Println(err.Error())
 		return err
 	}
 
+	if err := gitRestoreRemotes(repoPath, repoConfig.Remotes); err != nil {
+		ptermErrorMessageStyle.Println(err.Error())
+		return err
+	}
+
 	ptermSuccessMessageStyle.Println("success")
 
+	if projectID, err := gitRemoteURLProjectID(remoteURL.String()); err == nil {
+		if err := recordCatalogCloneMode(projectID, remoteURL.String(), repoPath, cloneMode); err != nil {
+			ptermWarningWithPrefixText("catalog").Println(err.Error())
+		}
+	}
+
 	if buf.Len() > 0 {
 		pterm.Println()
 		pterm.Println(buf.String())
@@ -1356,6 +1531,27 @@ func gitReclone(ctx context.Context, repoPath string) error {
 	return nil
 }
 
+// gitRestoreRemotes adds the remotes of the previous clone that the new clone
+// does not have.
+func gitRestoreRemotes(repoPath string, remotes map[string]*config.RemoteConfig) error {
+	repo, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return err
+	}
+
+	for name, remote := range remotes {
+		if _, err := repo.Remote(name); err == nil {
+			continue
+		}
+
+		if _, err := repo.CreateRemote(remote); err != nil {
+			return fmt.Errorf("restore remote %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
 func gitMove(ctx context.Context, repoPath, oldURL, newURL string) (*fconfig.RepoMove, error) {
 	// complicated update locking
 	if isUpdateMutexLocked, ok := ctx.Value(ctxKeyIsUpdateMutexLocked{}).(*abool.AtomicBool); ok {
@@ -1468,18 +1664,24 @@ func gitMove(ctx context.Context, repoPath, oldURL, newURL string) (*fconfig.Rep
 		return nil, err
 	}
 
-	remote, ok := config.Remotes[git.DefaultRemoteName]
-	if !ok {
-		err = fmt.Errorf("missing remote: %s", git.DefaultRemoteName)
+	// update every remote of the old URL, which includes the primary remote
+	moved := false
+	for _, remote := range config.Remotes {
+		for i, repoURL := range remote.URLs {
+			parsedURL, err := giturls.Parse(repoURL)
+			if err != nil || parsedURL.String() != oldURL {
+				continue
+			}
+			remote.URLs[i] = newURL
+			moved = true
+		}
+	}
+	if !moved {
+		err = fmt.Errorf("missing remote: %s", oldURL)
 		ptermErrorMessageStyle.Println(err.Error())
 		return nil, err
 	}
 
-	if repoURL := remote.URLs[0]; repoURL != "" {
-		// update to new URL
-		remote.URLs[0] = newURL
-	}
-
 	// save updated config
 	err = newRepo.SetConfig(config)
 	if err != nil {
@@ -0,0 +1,341 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/hashicorp/go-retryablehttp"
+
+	"github.com/zbiljic/fget/pkg/fconfig"
+	"github.com/zbiljic/fget/pkg/forge"
+	"github.com/zbiljic/fget/pkg/giturl"
+	"github.com/zbiljic/fget/pkg/rhttp"
+)
+
+// configuredPrimaryRemote is the remotes.primary setting of the current
+// configuration, loaded once.
+var configuredPrimaryRemote = sync.OnceValue(func() string {
+	runtimeCtx, err := loadConfigRuntimeContext()
+	if err != nil {
+		return ""
+	}
+
+	cfg, err := fconfig.LoadEffectiveConfig(runtimeCtx.HomeDir, runtimeCtx.Cwd, runtimeCtx.XDGConfigHome)
+	if err != nil {
+		return ""
+	}
+
+	return cfg.Remotes.Primary
+})
+
+// gitRepoPrimaryRemoteName returns the remote that defines the project ID and
+// the default branch of the repository.
+func gitRepoPrimaryRemoteName(repo *git.Repository) (string, error) {
+	return gitPrimaryRemoteName(repo, configuredPrimaryRemote())
+}
+
+// gitPrimaryRemoteName returns the preferred remote when the repository has
+// it, then origin, then the first remote by name.
+func gitPrimaryRemoteName(repo *git.Repository, preferred string) (string, error) {
+	cfg, err := repo.Config()
+	if err != nil {
+		return "", err
+	}
+
+	if len(cfg.Remotes) == 0 {
+		return "", git.ErrRemoteNotFound
+	}
+
+	for _, name := range []string{preferred, git.DefaultRemoteName} {
+		if _, ok := cfg.Remotes[name]; ok && name != "" {
+			return name, nil
+		}
+	}
+
+	names := make([]string, 0, len(cfg.Remotes))
+	for name := range cfg.Remotes {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names[0], nil
+}
+
+func gitRemoteURLs(repoPath string) (map[string]string, error) {
+	repo, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return gitRepoRemoteURLs(repo)
+}
+
+// gitRepoRemoteURLs returns the URL of every remote by name, in the same form
+// as the primary remote URL and without embedded credentials.
+func gitRepoRemoteURLs(repo *git.Repository) (map[string]string, error) {
+	cfg, err := repo.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	remotes := make(map[string]string, len(cfg.Remotes))
+	for name, remote := range cfg.Remotes {
+		if len(remote.URLs) == 0 || remote.URLs[0] == "" {
+			continue
+		}
+		if remoteURL := giturl.Sanitize(remote.URLs[0]); remoteURL != "" {
+			remotes[name] = remoteURL
+		}
+	}
+
+	return remotes, nil
+}
+
+// gitForgeHTTPClient performs forge API requests. Unlike gitDefaultClient it
+// follows the redirects of moved repositories, and it gives up early on rate
+// limits, since the API is only consulted before the other checks.
+var gitForgeHTTPClient = rhttp.NewClient(
+	rhttp.WithRetryMax(1),
+	rhttp.WithPassthroughErrorHandler(),
+	rhttp.WithLogger(nil),
+).StandardClient()
+
+// gitForgeTokenEnvs name the environment variables holding the API token of
+// each kind of forge, for hosts without configured credentials.
+var gitForgeTokenEnvs = map[forge.Kind]string{
+	forge.KindGitHub: "GITHUB_TOKEN",
+	forge.KindGitLab: "GITLAB_TOKEN",
+	forge.KindGitea:  "GITEA_TOKEN",
+}
+
+// errGitNoForge is returned for remotes on hosts without a known forge API.
+var errGitNoForge = errors.New("no forge API for remote host")
+
+// gitForgeClient returns a client for the forge API of host, authenticated
+// with its configured credentials.
+func gitForgeClient(ctx context.Context, host string) (forge.Client, error) {
+	client, _, err := gitForgeClientWithToken(ctx, host)
+	return client, err
+}
+
+// gitForgeClientWithToken is gitForgeClient, also reporting whether the
+// client has a token.
+func gitForgeClientWithToken(ctx context.Context, host string) (forge.Client, bool, error) {
+	host = strings.ToLower(host)
+	kind, ok := forge.HostKind(host)
+	if !ok {
+		return nil, false, errGitNoForge
+	}
+
+	token := os.Getenv(gitForgeTokenEnvs[kind])
+	credential, err := lookupGitCredential(ctx, &url.URL{Scheme: "https", Host: host})
+	if err != nil {
+		return nil, false, err
+	}
+	if credential != nil {
+		token = credential.Token
+	}
+
+	client, ok := forge.ForHost(host, forge.Options{
+		Token:      token,
+		HTTPClient: gitForgeHTTPClient,
+	})
+	if !ok {
+		return nil, false, errGitNoForge
+	}
+
+	return client, token != "", nil
+}
+
+// gitLookupForgeRepository asks the forge API of the remote host about the
+// repository of the remote. A repository the forge does not know although
+// asked with a token is gone and ErrGitRepositoryNotFound is returned;
+// without a token it may be private.
+func gitLookupForgeRepository(ctx context.Context, remoteURL *url.URL) (*forge.Repository, error) {
+	client, hasToken, err := gitForgeClientWithToken(ctx, remoteURL.Hostname())
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := client.Repository(ctx, gitRemoteRepoPath(remoteURL))
+	if errors.Is(err, forge.ErrNotFound) && hasToken {
+		return nil, ErrGitRepositoryNotFound
+	}
+
+	return repo, err
+}
+
+// gitForgeRemoteError maps what the forge reports about the repository of
+// the remote to the repository errors. A repository with another canonical
+// name moved; the error then matches rhttp.ErrHttpMovedPermanently and is a
+// *url.Error holding the new remote URL in the form of the old one.
+func gitForgeRemoteError(remoteURL *url.URL, repo *forge.Repository) error {
+	if repo.Disabled {
+		return ErrGitRepositoryDisabled
+	}
+
+	if repo.FullName != "" && !strings.EqualFold(repo.FullName, gitRemoteRepoPath(remoteURL)) {
+		return &url.Error{
+			Op:  "Get",
+			URL: gitMovedRemoteURL(remoteURL, repo.FullName),
+			Err: rhttp.ErrHttpMovedPermanently,
+		}
+	}
+
+	return nil
+}
+
+// gitRemoteRepoPath returns the owner/name path of the remote repository.
+func gitRemoteRepoPath(remoteURL *url.URL) string {
+	return strings.TrimSuffix(strings.Trim(remoteURL.Path, "/"), ".git")
+}
+
+func gitIsHTTPRemote(remoteURL *url.URL) bool {
+	switch strings.ToLower(remoteURL.Scheme) {
+	case "http", "https":
+		return true
+	default:
+		return false
+	}
+}
+
+// gitCheckRemoteMoved asks the web page of the forge of an SSH remote whether
+// the repository moved, for when the forge API gave no answer. The returned
+// error matches rhttp.ErrHttpMovedPermanently and is a *url.Error holding the
+// new remote URL in the SSH form of the old one. Any other outcome, such as a
+// private repository, is left to git ls-remote.
+func gitCheckRemoteMoved(ctx context.Context, remoteURL *url.URL) error {
+	host := strings.ToLower(remoteURL.Hostname())
+	if _, ok := forge.HostKind(host); !ok {
+		return nil
+	}
+
+	webURL := &url.URL{Scheme: "https", Host: host, Path: "/" + gitRemoteRepoPath(remoteURL)}
+
+	req, err := retryablehttp.NewRequestWithContext(ctx, http.MethodHead, webURL.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := gitDefaultClient.Do(req)
+	if err != nil {
+		var urlError *url.Error
+		if errors.Is(err, rhttp.ErrHttpMovedPermanently) && errors.As(err, &urlError) {
+			movedURL, parseErr := url.Parse(urlError.URL)
+			if parseErr != nil || !strings.EqualFold(movedURL.Hostname(), host) {
+				return nil
+			}
+			return &url.Error{
+				Op:  urlError.Op,
+				URL: gitMovedRemoteURL(remoteURL, movedURL.Path),
+				Err: rhttp.ErrHttpMovedPermanently,
+			}
+		}
+		// NOTE: the forge being unreachable is decided by git ls-remote
+		return nil
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// gitMovedRemoteURL returns the remote URL for another repository path on the
+// same host, keeping the scheme, user, port and .git suffix of remoteURL.
+func gitMovedRemoteURL(remoteURL *url.URL, repoPath string) string {
+	movedURL := *remoteURL
+
+	repoPath = path.Clean("/" + strings.TrimSuffix(repoPath, "/"))
+	if strings.HasSuffix(remoteURL.Path, ".git") && !strings.HasSuffix(repoPath, ".git") {
+		repoPath += ".git"
+	}
+	if !strings.HasPrefix(remoteURL.Path, "/") {
+		repoPath = strings.TrimPrefix(repoPath, "/")
+	}
+	movedURL.Path = repoPath
+
+	return movedURL.String()
+}
+
+// gitLsRemoteError maps the output of a failed git ls-remote to the
+// repository errors. SSH reports a missing or inaccessible repository only as
+// a failure to read from it.
+func gitLsRemoteError(out []byte, err error) error {
+	outString := string(out)
+	outString = strings.ToLower(outString)
+	// check if repository is disabled
+	if strings.HasPrefix(outString, errorPrefix) && strings.Contains(outString, isDisabledString) {
+		return ErrGitRepositoryDisabled
+	}
+	// check if auth required
+	if strings.HasPrefix(outString, fatalPrefix) && strings.Contains(outString, couldNotReadUsername) {
+		return ErrGitRepositoryProtected
+	}
+	// check if SSH key is rejected
+	if strings.Contains(outString, permissionDeniedString) {
+		return ErrGitRepositoryProtected
+	}
+	// check if the host is known at all
+	if strings.Contains(outString, couldNotResolveHostnameString) {
+		return fmt.Errorf("%w: %w", ErrGitRepositoryNotReachable, ErrGitHostNotReachable)
+	}
+	// check if accessible over SSH
+	if strings.Contains(outString, couldNotReadFromRemoteString) {
+		return ErrGitRepositoryNotReachable
+	}
+
+	return err
+}
+
+// gitParseLsRemoteHead returns the remote HEAD from git ls-remote --symref
+// output, as a hash reference to the default branch when the branch is
+// listed.
+func gitParseLsRemoteHead(out []byte) (*plumbing.Reference, error) {
+	var ref *plumbing.Reference
+	hashes := make(map[plumbing.ReferenceName]plumbing.Hash)
+
+	buf := bytes.NewBuffer(out)
+	scanner := bufio.NewScanner(buf)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		split := strings.Split(line, "\t")
+		if len(split) != 2 {
+			continue
+		}
+
+		if strings.HasPrefix(line, symrefPrefix) && split[1] == string(plumbing.HEAD) {
+			ref = plumbing.NewReferenceFromStrings(split[1], split[0])
+			continue
+		}
+
+		if plumbing.IsHash(split[0]) {
+			hashes[plumbing.ReferenceName(split[1])] = plumbing.NewHash(split[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading standard input: %w", err)
+	}
+
+	if ref == nil {
+		return nil, ErrGitMissingRemoteHeadReference
+	}
+
+	if hash, ok := hashes[ref.Target()]; ok {
+		ref = plumbing.NewHashReference(ref.Target(), hash)
+	}
+
+	return ref, nil
+}
@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	giturls "github.com/whilp/git-urls"
+
+	"github.com/zbiljic/fget/pkg/fconfig"
+	"github.com/zbiljic/fget/pkg/forge"
+	"github.com/zbiljic/fget/pkg/rhttp"
+)
+
+func TestGitMovedRemoteURL(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		remote string
+		path   string
+		want   string
+	}{
+		{remote: "git@github.com:old-owner/repo.git", path: "/new-owner/renamed", want: "ssh://git@github.com/new-owner/renamed.git"},
+		{remote: "ssh://git@gitlab.com:2222/old-owner/repo", path: "/new-owner/repo/", want: "ssh://git@gitlab.com:2222/new-owner/repo"},
+		{remote: "https://github.com/old-owner/repo.git", path: "new-owner/renamed", want: "https://github.com/new-owner/renamed.git"},
+	}
+
+	for _, test := range tests {
+		remoteURL, err := giturls.Parse(test.remote)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := gitMovedRemoteURL(remoteURL, test.path)
+		if got != test.want {
+			t.Fatalf("gitMovedRemoteURL(%q, %q) = %q, want %q", test.remote, test.path, got, test.want)
+		}
+		if _, err := giturls.Parse(got); err != nil {
+			t.Fatalf("gitMovedRemoteURL(%q, %q) is not a remote URL: %v", test.remote, test.path, err)
+		}
+	}
+}
+
+func TestGitForgeRemoteError(t *testing.T) {
+	t.Parallel()
+
+	remoteURL, err := giturls.Parse("git@github.com:acme/api.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := gitForgeRemoteError(remoteURL, &forge.Repository{FullName: "Acme/API", Archived: true}); err != nil {
+		t.Fatalf("gitForgeRemoteError() for the same name = %v, want nil", err)
+	}
+	if err := gitForgeRemoteError(remoteURL, &forge.Repository{FullName: "acme/api", Disabled: true}); !errors.Is(err, ErrGitRepositoryDisabled) {
+		t.Fatalf("gitForgeRemoteError() for disabled = %v, want %v", err, ErrGitRepositoryDisabled)
+	}
+
+	err = gitForgeRemoteError(remoteURL, &forge.Repository{FullName: "new-owner/api-server"})
+	var urlError *url.Error
+	if !errors.Is(err, rhttp.ErrHttpMovedPermanently) || !errors.As(err, &urlError) {
+		t.Fatalf("gitForgeRemoteError() for moved = %v, want %v", err, rhttp.ErrHttpMovedPermanently)
+	}
+	if want := "ssh://git@github.com/new-owner/api-server.git"; urlError.URL != want {
+		t.Fatalf("moved URL = %q, want %q", urlError.URL, want)
+	}
+}
+
+func TestGitLsRemoteError(t *testing.T) {
+	t.Parallel()
+
+	errExit := errors.New("exit status 128")
+	tests := []struct {
+		out  string
+		want error
+	}{
+		{out: "git@github.com: Permission denied (publickey).\r\nfatal: Could not read from remote repository.\n", want: ErrGitRepositoryProtected},
+		{out: "ERROR: Repository not found.\nfatal: Could not read from remote repository.\n", want: ErrGitRepositoryNotReachable},
+		{out: "ssh: Could not resolve hostname git.example.invalid: Name or service not known\n", want: ErrGitRepositoryNotReachable},
+		{out: "ssh: Could not resolve hostname git.example.invalid: Name or service not known\n", want: ErrGitHostNotReachable},
+		{out: "fatal: could not read Username for 'https://github.com': terminal prompts disabled\n", want: ErrGitRepositoryProtected},
+		{out: "error: access to repository is disabled\n", want: ErrGitRepositoryDisabled},
+		{out: "fatal: protocol error: bad line length\n", want: errExit},
+	}
+
+	for _, test := range tests {
+		if got := gitLsRemoteError([]byte(test.out), errExit); !errors.Is(got, test.want) {
+			t.Fatalf("gitLsRemoteError(%q) = %v, want %v", test.out, got, test.want)
+		}
+	}
+}
+
+func TestGitParseLsRemoteHead(t *testing.T) {
+	t.Parallel()
+
+	hash := "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"
+	out := "Warning: Permanently added 'github.com' to the list of known hosts.\n" +
+		"ref: refs/heads/main\tHEAD\n" +
+		hash + "\tHEAD\n" +
+		"1111111111111111111111111111111111111111\trefs/heads/dev\n" +
+		hash + "\trefs/heads/main\n"
+
+	ref, err := gitParseLsRemoteHead([]byte(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref.Name() != plumbing.NewBranchReferenceName("main") || ref.Hash().String() != hash {
+		t.Fatalf("gitParseLsRemoteHead() = %v", ref)
+	}
+
+	if _, err := gitParseLsRemoteHead([]byte(hash + "\trefs/heads/main\n")); !errors.Is(err, ErrGitMissingRemoteHeadReference) {
+		t.Fatalf("gitParseLsRemoteHead() without HEAD error = %v", err)
+	}
+}
+
+func TestGitFindRemoteHeadReferenceWithoutHTTP(t *testing.T) {
+	repo, remote := initCommittedRepo(t)
+	configureOrigin(t, repo, remote)
+	pushMain(t, repo)
+	gitRun(t, remote, "symbolic-ref", "HEAD", "refs/heads/main")
+
+	ref, err := gitFindRemoteHeadReference(context.Background(), repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.TrimSpace(gitOutput(t, repo, "rev-parse", "HEAD")); ref.Name() != plumbing.NewBranchReferenceName("main") || ref.Hash().String() != want {
+		t.Fatalf("gitFindRemoteHeadReference() = %v, want main at %s", ref, want)
+	}
+
+	gitRun(t, repo, "remote", "set-url", "origin", filepath.Join(t.TempDir(), "missing.git"))
+	if _, err := gitFindRemoteHeadReference(context.Background(), repo); !errors.Is(err, ErrGitRepositoryNotReachable) {
+		t.Fatalf("gitFindRemoteHeadReference() for missing remote error = %v, want %v", err, ErrGitRepositoryNotReachable)
+	}
+}
+
+func TestGitPrimaryRemoteName(t *testing.T) {
+	t.Parallel()
+
+	repoDir := t.TempDir()
+	repo, err := git.PlainInit(repoDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gitPrimaryRemoteName(repo, ""); !errors.Is(err, git.ErrRemoteNotFound) {
+		t.Fatalf("gitPrimaryRemoteName() without remotes error = %v", err)
+	}
+
+	for _, name := range []string{"upstream", "fork"} {
+		if _, err := repo.CreateRemote(&config.RemoteConfig{Name: name, URLs: []string{"https://github.com/acme/" + name}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, err := gitPrimaryRemoteName(repo, ""); err != nil || got != "fork" {
+		t.Fatalf("gitPrimaryRemoteName() without origin = %q, %v, want first remote by name", got, err)
+	}
+
+	if _, err := repo.CreateRemote(&config.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{"git@github.com:me/api.git"}}); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{"": "origin", "upstream": "upstream", "missing": "origin"}
+	for preferred, want := range tests {
+		if got, err := gitPrimaryRemoteName(repo, preferred); err != nil || got != want {
+			t.Fatalf("gitPrimaryRemoteName(%q) = %q, %v, want %q", preferred, got, err, want)
+		}
+	}
+
+	remotes, err := gitRepoRemoteURLs(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := remotes[git.DefaultRemoteName]; got != "ssh://git@github.com/me/api.git" || len(remotes) != 3 {
+		t.Fatalf("gitRepoRemoteURLs() = %v", remotes)
+	}
+}
+
+func TestGitRunFetchRemotesFetchesSecondaryRemotes(t *testing.T) {
+	repo, remote := initCommittedRepo(t)
+	configureOrigin(t, repo, remote)
+	pushMain(t, repo)
+	gitRun(t, remote, "symbolic-ref", "HEAD", "refs/heads/main")
+
+	upstreamRepo, upstream := initCommittedRepo(t)
+	configureOrigin(t, upstreamRepo, upstream)
+	pushMain(t, upstreamRepo)
+	gitRun(t, repo, "remote", "add", "upstream", upstream)
+
+	ctx := context.WithValue(context.Background(), ctxKeyPrintProjectInfoHeaderFn{}, func() {})
+	if err := gitRunFetchRemotes(ctx, repo); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := gitOutput(t, repo, "rev-parse", "refs/remotes/upstream/main"), gitOutput(t, upstreamRepo, "rev-parse", "HEAD"); got != want {
+		t.Fatalf("upstream/main = %s, want %s", got, want)
+	}
+
+	dir := filepath.Join(t.TempDir(), "clone")
+	if err := gitClone(context.Background(), remote, dir, git.DefaultRemoteName, fconfig.CloneMode{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	oldRepo, err := git.PlainOpen(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldConfig, err := oldRepo.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gitRestoreRemotes(dir, oldConfig.Remotes); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(gitOutput(t, dir, "remote", "get-url", "upstream")); got != upstream {
+		t.Fatalf("restored upstream URL = %q, want %q", got, upstream)
+	}
+	if got := strings.TrimSpace(gitOutput(t, dir, "remote", "get-url", "origin")); got != remote {
+		t.Fatalf("origin URL = %q, want %q", got, remote)
+	}
+}
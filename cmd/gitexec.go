@@ -2,18 +2,35 @@ package cmd
 
 import (
 	"context"
+	"os"
+	"os/exec"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/zbiljic/gitexec"
+
+	"github.com/zbiljic/fget/pkg/gitinspect"
 )
 
+// gitRemoteCommand runs a git command that talks to a remote, with the
+// credential headers added to its environment only.
+func gitRemoteCommand(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), gitCredentialHeaders()...)
+
+	return cmd.CombinedOutput()
+}
+
+// gitRemoteRunner returns the runner of inspection commands that talk to a
+// remote, with the credential headers added to their environment only.
+func gitRemoteRunner() gitinspect.CLIRunner {
+	return gitinspect.CLIRunner{Env: gitCredentialHeaders()}
+}
+
 func gitRepoPathPull(repoPath string) ([]byte, error) {
-	out, err := gitexec.Pull(&gitexec.PullOptions{
-		CmdDir: repoPath,
-		Prune:  true,
-	})
+	out, err := gitRemoteCommand(context.Background(), repoPath, "pull", "--prune")
 	if err != nil {
 		return out, err
 	}
@@ -22,10 +39,7 @@ func gitRepoPathPull(repoPath string) ([]byte, error) {
 }
 
 func gitRepoFetch(repoPath string) ([]byte, error) {
-	out, err := gitexec.Fetch(&gitexec.FetchOptions{
-		CmdDir: repoPath,
-		Prune:  true,
-	})
+	out, err := gitRemoteCommand(context.Background(), repoPath, "fetch", "--prune")
 	if err != nil {
 		return out, err
 	}
@@ -34,11 +48,36 @@ func gitRepoFetch(repoPath string) ([]byte, error) {
 }
 
 func gitRepoRefetch(repoPath string) ([]byte, error) {
-	out, err := gitexec.Fetch(&gitexec.FetchOptions{
-		CmdDir:  repoPath,
-		Prune:   true,
-		Refetch: true,
-	})
+	out, err := gitRemoteCommand(context.Background(), repoPath, "fetch", "--prune", "--refetch")
+	if err != nil {
+		return out, err
+	}
+
+	return out, nil
+}
+
+func gitRepoFetchDepth(repoPath string, depth int) ([]byte, error) {
+	out, err := gitRemoteCommand(context.Background(), repoPath, "fetch", "--prune", "--depth="+strconv.Itoa(depth))
+	if err != nil {
+		return out, err
+	}
+
+	return out, nil
+}
+
+func gitRepoClone(dir, repoURL, repoPath, remoteName string, args []string) ([]byte, error) {
+	args = append(append([]string{"clone", "--origin", remoteName}, args...), "--", repoURL, repoPath)
+
+	out, err := gitRemoteCommand(context.Background(), dir, args...)
+	if err != nil {
+		return out, err
+	}
+
+	return out, nil
+}
+
+func gitRepoSetBranches(repoPath, remoteName, branch string) ([]byte, error) {
+	out, err := gitexec.Command(repoPath, "remote", "set-branches", remoteName, branch)
 	if err != nil {
 		return out, err
 	}
@@ -144,14 +183,50 @@ func gitLastCommitDateContext(ctx context.Context, repoPath string) (time.Time,
 	return commitDate, nil
 }
 
-func gitRepoLsRemote(repoPath string) ([]byte, error) {
-	out, err := gitexec.LsRemote(&gitexec.LsRemoteOptions{
-		CmdDir: repoPath,
-		Symref: true,
-	})
+func gitRepoLsRemoteContext(ctx context.Context, repoPath, remoteName string) ([]byte, error) {
+	result, err := gitRemoteRunner().Run(ctx, repoPath, "ls-remote", "--symref", remoteName)
+	if err != nil {
+		return []byte(result.Stdout + result.Stderr), err
+	}
+
+	return []byte(result.Stdout), nil
+}
+
+func gitRepoFetchRemote(repoPath, remoteName string) ([]byte, error) {
+	out, err := gitRemoteCommand(context.Background(), repoPath, "fetch", "--prune", remoteName)
 	if err != nil {
 		return out, err
 	}
 
 	return out, nil
 }
+
+// gitCredentialFill asks the git credential helpers for the username and
+// password of an HTTPS host, without prompting.
+func gitCredentialFill(ctx context.Context, host string) (string, string, error) {
+	cmd := exec.CommandContext(ctx, "git", "credential", "fill")
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=", "SSH_ASKPASS=")
+	cmd.Stdin = strings.NewReader("protocol=https\nhost=" + host + "\n\n")
+
+	out, err := cmd.Output()
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", "", ctxErr
+		}
+		// NOTE: git fails when no helper knows the host
+		return "", "", nil
+	}
+
+	var username, password string
+	for _, line := range strings.Split(string(out), "\n") {
+		key, value, _ := strings.Cut(line, "=")
+		switch key {
+		case "username":
+			username = value
+		case "password":
+			password = value
+		}
+	}
+
+	return username, password, nil
+}
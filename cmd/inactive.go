@@ -0,0 +1,397 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pterm/pterm"
+	"github.com/tevino/abool/v2"
+
+	"github.com/zbiljic/fget/pkg/fconfig"
+	"github.com/zbiljic/fget/pkg/giturl"
+)
+
+const (
+	// inactiveArchiveDirname is the directory of the graveyard in the root of
+	// a repository, when no archive root is configured.
+	inactiveArchiveDirname = "archive"
+	// inactiveTagPrefix prefixes the state in the tag of inactive
+	// repositories, such as inactive:deleted.
+	inactiveTagPrefix = "inactive:"
+)
+
+// configuredInactive is the inactive setting of the current configuration,
+// loaded once.
+var configuredInactive = sync.OnceValue(func() fconfig.InactiveConfig {
+	runtimeCtx, err := loadConfigRuntimeContext()
+	if err != nil {
+		return fconfig.InactiveConfig{}
+	}
+
+	cfg, err := fconfig.LoadEffectiveConfig(runtimeCtx.HomeDir, runtimeCtx.Cwd, runtimeCtx.XDGConfigHome)
+	if err != nil {
+		return fconfig.InactiveConfig{}
+	}
+
+	return cfg.Inactive
+})
+
+// catalogInactiveStates maps catalog locations to the recorded inactive state
+// of their repository. It is loaded once, and is empty without a catalog.
+var catalogInactiveStates = sync.OnceValue(func() map[string]fconfig.InactiveState {
+	set, err := loadCatalogSetForCurrentRuntimeContext()
+	if err != nil {
+		return nil
+	}
+
+	return catalogInactiveStatesByLocation(set.View)
+})
+
+func catalogInactiveStatesByLocation(catalog *fconfig.Catalog) map[string]fconfig.InactiveState {
+	states := make(map[string]fconfig.InactiveState)
+	if catalog == nil {
+		return states
+	}
+
+	for _, repo := range catalog.Repos {
+		if repo.Inactive == nil {
+			continue
+		}
+		for _, location := range repo.Locations {
+			states[filepath.Clean(location.Path)] = *repo.Inactive
+		}
+	}
+
+	return states
+}
+
+// gitLockUpdateMutex takes the update mutex unless the task already holds it,
+// and returns the function that releases it when the caller has to.
+func gitLockUpdateMutex(ctx context.Context) func() {
+	// complicated update locking
+	if isUpdateMutexLocked, ok := ctx.Value(ctxKeyIsUpdateMutexLocked{}).(*abool.AtomicBool); ok {
+		if isUpdateMutexLocked.IsNotSet() {
+			updateMutex.Lock()
+			isUpdateMutexLocked.Set()
+		}
+	} else {
+		// simple
+		updateMutex.Lock()
+	}
+	if shouldUpdateMutexUnlock, ok := ctx.Value(ctxKeyShouldUpdateMutexUnlock{}).(bool); ok {
+		if shouldUpdateMutexUnlock {
+			return updateMutex.Unlock
+		}
+		return func() {}
+	}
+	// simple
+	return updateMutex.Unlock
+}
+
+// gitSkipInactive reports whether the repository is recorded as inactive in
+// the catalog and is not to be checked again.
+func gitSkipInactive(ctx context.Context, repoPath string) bool {
+	if recheck, _ := ctx.Value(ctxKeyRecheckInactive{}).(bool); recheck {
+		return false
+	}
+
+	state, ok := catalogInactiveStates()[filepath.Clean(repoPath)]
+	if !ok {
+		return false
+	}
+
+	if onlyUpdated, _ := ctx.Value(ctxKeyOnlyUpdated{}).(bool); !onlyUpdated {
+		defer gitLockUpdateMutex(ctx)()
+
+		printProjectInfoContext(ctx)
+		ptermDescriptionWithPrefixText("inactive").
+			Printfln("%s since %s", state.State, state.Since.Format(time.DateOnly))
+	}
+
+	return true
+}
+
+// gitInactiveState returns the inactive state that the remote check error
+// means, or an empty string when the upstream may still be there. Only a
+// definite answer means deleted; unreachable remotes, such as after network
+// or server failures, may come back.
+func gitInactiveState(err error) string {
+	switch {
+	case errors.Is(err, ErrGitRepositoryArchived):
+		return fconfig.InactiveArchived
+	case errors.Is(err, ErrGitRepositoryDisabled):
+		return fconfig.InactiveDisabled
+	case errors.Is(err, ErrGitRepositoryNotFound):
+		return fconfig.InactiveDeleted
+	default:
+		return ""
+	}
+}
+
+// gitRunInactivePolicy applies the configured inactive policy to the
+// repository when err means its upstream is archived, deleted or disabled. It
+// reports whether the policy was applied.
+func gitRunInactivePolicy(ctx context.Context, repoPath string, err error) (bool, error) {
+	state := gitInactiveState(err)
+	cfg := configuredInactive()
+	if state == "" || cfg.Policy == "" {
+		return false, nil
+	}
+
+	return true, gitRetireRepo(ctx, repoPath, state, cfg)
+}
+
+// gitRunUpstreamPolicy applies the inactive policy to a repository whose
+// upstream answered, which is still inactive when it is archived. Otherwise
+// an inactive state recorded before is cleared.
+func gitRunUpstreamPolicy(ctx context.Context, repoPath string, archived *abool.AtomicBool) error {
+	if archived.IsSet() {
+		_, err := gitRunInactivePolicy(ctx, repoPath, ErrGitRepositoryArchived)
+		return err
+	}
+
+	return gitClearInactive(ctx, repoPath)
+}
+
+// gitRetireRepo records the inactive state of the repository in the catalog,
+// tagging it and moving it to the graveyard as the policy says.
+func gitRetireRepo(ctx context.Context, repoPath, state string, cfg fconfig.InactiveConfig) error {
+	defer gitLockUpdateMutex(ctx)()
+
+	printProjectInfoContext(ctx)
+
+	dryRun, _ := ctx.Value(ctxKeyDryRun{}).(bool)
+
+	prefixPrinter := ptermWarningWithPrefixText("inactive")
+
+	remoteURL, err := gitRemoteConfigURL(repoPath)
+	if err != nil {
+		return err
+	}
+
+	id, err := gitRemoteURLProjectID(remoteURL.String())
+	if err != nil {
+		return err
+	}
+
+	newRepoPath := filepath.Clean(repoPath)
+	if cfg.Policy == fconfig.InactivePolicyMoveToGraveyard {
+		newRepoPath, err = gitGraveyardPath(repoPath, id, cfg.ArchiveRoot)
+		if err != nil {
+			prefixPrinter.WithMessageStyle(&pterm.ThemeDefault.ErrorMessageStyle).Println(err.Error())
+			return err
+		}
+	}
+
+	if newRepoPath != filepath.Clean(repoPath) {
+		prefixPrinter.Printf("%s, moving to '%s'", state, newRepoPath)
+	} else {
+		prefixPrinter.Printf("%s, %s", state, cfg.Policy)
+	}
+
+	pterm.Println()
+
+	prefixPrinter.Print()
+
+	if dryRun {
+		ptermSuccessMessageStyle.Println("dry-run")
+		return nil
+	}
+
+	if newRepoPath != filepath.Clean(repoPath) {
+		if _, err := os.Stat(newRepoPath); err == nil {
+			err = fmt.Errorf("already exists: %s", newRepoPath)
+			ptermErrorMessageStyle.Println(err.Error())
+			return err
+		}
+
+		if err := os.MkdirAll(filepath.Dir(newRepoPath), os.ModePerm); err != nil {
+			ptermErrorMessageStyle.Println(err.Error())
+			return err
+		}
+
+		if err := os.Rename(repoPath, newRepoPath); err != nil {
+			ptermErrorMessageStyle.Println(err.Error())
+			return err
+		}
+	}
+
+	inactive := &fconfig.InactiveState{State: state, Since: time.Now().UTC()}
+	tag := cfg.Policy != fconfig.InactivePolicySkip
+	if err := recordCatalogInactive(id, remoteURL.String(), repoPath, newRepoPath, inactive, tag); err != nil {
+		ptermErrorMessageStyle.Println(err.Error())
+		return err
+	}
+
+	ptermSuccessMessageStyle.Println("success")
+
+	return nil
+}
+
+// gitGraveyardPath returns the path of the repository in the graveyard, which
+// keeps the host/owner/repo layout under the archive root. Without a
+// configured archive root it is the archive directory in the root of the
+// repository, and repositories there are already in the graveyard.
+func gitGraveyardPath(repoPath, id, archiveRoot string) (string, error) {
+	repoPath = filepath.Clean(repoPath)
+	id = filepath.Clean(id)
+
+	if archiveRoot == "" {
+		if !strings.HasSuffix(repoPath, string(filepath.Separator)+id) {
+			return "", fmt.Errorf("repository not in the host/owner/repo layout, set inactive.archive_root: %s", repoPath)
+		}
+
+		root := strings.TrimSuffix(repoPath, string(filepath.Separator)+id)
+		if filepath.Base(root) == inactiveArchiveDirname {
+			return repoPath, nil
+		}
+		archiveRoot = filepath.Join(root, inactiveArchiveDirname)
+	}
+
+	if pathUnderAnyRoot(repoPath, []string{archiveRoot}) {
+		return repoPath, nil
+	}
+
+	return filepath.Join(archiveRoot, id), nil
+}
+
+// gitClearInactive clears the inactive state and tags that the catalog
+// records for a repository whose upstream is active again.
+func gitClearInactive(ctx context.Context, repoPath string) error {
+	state, ok := catalogInactiveStates()[filepath.Clean(repoPath)]
+	if !ok {
+		return nil
+	}
+
+	defer gitLockUpdateMutex(ctx)()
+
+	printProjectInfoContext(ctx)
+
+	dryRun, _ := ctx.Value(ctxKeyDryRun{}).(bool)
+
+	prefixPrinter := ptermInfoWithPrefixText("active")
+
+	prefixPrinter.Printf("no longer %s", state.State)
+
+	pterm.Println()
+
+	prefixPrinter.Print()
+
+	if dryRun {
+		ptermSuccessMessageStyle.Println("dry-run")
+		return nil
+	}
+
+	if err := recordCatalogInactive("", "", repoPath, repoPath, nil, false); err != nil {
+		ptermErrorMessageStyle.Println(err.Error())
+		return err
+	}
+
+	ptermSuccessMessageStyle.Println("success")
+
+	return nil
+}
+
+// recordCatalogInactive records the inactive state of a repository in the
+// catalogs of its scope, with its new location when it was moved. The owned
+// catalog gains the repository when none lists it. A nil state clears the
+// state and the inactive tags. Nothing is recorded without a catalog.
+func recordCatalogInactive(id, remoteURL, repoPath, newRepoPath string, state *fconfig.InactiveState, tag bool) error {
+	runtimeCtx, err := loadConfigRuntimeContext()
+	if err != nil {
+		return err
+	}
+
+	return recordCatalogInactiveInRuntimeContext(id, remoteURL, repoPath, newRepoPath, state, tag, runtimeCtx)
+}
+
+func recordCatalogInactiveInRuntimeContext(id, remoteURL, repoPath, newRepoPath string, state *fconfig.InactiveState, tag bool, runtimeCtx configRuntimeContext) error {
+	repoPath = filepath.Clean(repoPath)
+	newRepoPath = filepath.Clean(newRepoPath)
+
+	// NOTE: the repository may be gone from its old path already
+	runtimeCtx.Cwd = filepath.Dir(repoPath)
+
+	cfg, err := fconfig.LoadEffectiveConfig(runtimeCtx.HomeDir, runtimeCtx.Cwd, runtimeCtx.XDGConfigHome)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(cfg.Catalog.Path); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	set, err := loadCatalogSetForEffectiveConfig(cfg, runtimeCtx.HomeDir)
+	if err != nil {
+		return err
+	}
+
+	sources, err := set.resolveTagSources(repoPath)
+	if err != nil {
+		if state == nil {
+			return nil
+		}
+		// not cataloged yet
+		sources = []*catalogSource{&set.Sources[0]}
+		set.Sources[0].Catalog.Upsert(fconfig.RepoEntry{
+			ID:        id,
+			RemoteURL: giturl.Sanitize(remoteURL),
+			Locations: []fconfig.RepoLocation{{Path: repoPath}},
+		})
+	}
+
+	tags := []string{
+		inactiveTagPrefix + fconfig.InactiveArchived,
+		inactiveTagPrefix + fconfig.InactiveDeleted,
+		inactiveTagPrefix + fconfig.InactiveDisabled,
+	}
+
+	for _, source := range sources {
+		index, err := fconfig.ResolveRepoIndex(source.Catalog, repoPath)
+		if err != nil {
+			return err
+		}
+		repo := source.Catalog.Repos[index]
+
+		if newRepoPath != repoPath {
+			source.Catalog.ApplyRepoMove(fconfig.RepoMove{
+				OldID:   repo.ID,
+				NewID:   repo.ID,
+				OldPath: repoPath,
+				NewPath: newRepoPath,
+				MovedAt: time.Now().UTC(),
+			})
+		}
+
+		inactive := state
+		if inactive != nil && repo.Inactive != nil && repo.Inactive.State == inactive.State {
+			// known since the first time
+			inactive = repo.Inactive
+		}
+		source.Catalog.SetInactive(repo.ID, inactive)
+
+		if err := fconfig.RemoveTags(source.Catalog, repo.ID, tags); err != nil {
+			return err
+		}
+		if state != nil && tag {
+			if err := fconfig.AddTags(source.Catalog, repo.ID, []string{inactiveTagPrefix + state.State}); err != nil {
+				return err
+			}
+		}
+
+		if err := fconfig.SaveCatalog(source.CatalogPath, source.Catalog); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
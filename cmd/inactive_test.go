@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/zbiljic/fget/pkg/fconfig"
+	"github.com/zbiljic/fget/pkg/rhttp"
+)
+
+func TestGitInactiveState(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{err: ErrGitRepositoryArchived, want: fconfig.InactiveArchived},
+		{err: ErrGitRepositoryDisabled, want: fconfig.InactiveDisabled},
+		{err: fmt.Errorf("%w: %w", ErrGitRepositoryNotReachable, ErrGitRepositoryNotFound), want: fconfig.InactiveDeleted},
+		{err: ErrGitRepositoryNotReachable, want: ""},
+		{err: fmt.Errorf("%w: %w", ErrGitRepositoryNotReachable, ErrGitHostNotReachable), want: ""},
+		{err: ErrGitRepositoryProtected, want: ""},
+	}
+
+	for _, test := range tests {
+		if got := gitInactiveState(test.err); got != test.want {
+			t.Fatalf("gitInactiveState(%v) = %q, want %q", test.err, got, test.want)
+		}
+	}
+}
+
+func TestGitInactivePolicyKeepsRepositoryOnTemporaryFailure(t *testing.T) {
+	defaultClient, inactive := gitDefaultClient, configuredInactive
+	t.Cleanup(func() { gitDefaultClient, configuredInactive = defaultClient, inactive })
+	gitDefaultClient = rhttp.NewClient(rhttp.WithErrorIfMovedPermanently(), rhttp.WithLogger(nil), rhttp.WithRetryMax(0))
+	configuredInactive = func() fconfig.InactiveConfig {
+		return fconfig.InactiveConfig{Policy: fconfig.InactivePolicyMoveToGraveyard}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/acme/gone.git":
+			w.WriteHeader(http.StatusNotFound)
+		case "/acme/limited.git":
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	root := filepath.Join(t.TempDir(), "src")
+	for i, remote := range []string{server.URL + "/acme/api.git", server.URL + "/acme/limited.git", closed.URL + "/acme/api.git"} {
+		repoPath := filepath.Join(root, "127.0.0.1", fmt.Sprint(i))
+		initRepoAtPath(t, repoPath, filepath.Join(t.TempDir(), "remote.git"))
+		gitRun(t, repoPath, "remote", "add", "origin", remote)
+
+		_, err := gitFindRemoteHeadReference(context.Background(), repoPath)
+		if err == nil {
+			t.Fatalf("gitFindRemoteHeadReference(%s) error = nil", remote)
+		}
+		applied, err := gitRunInactivePolicy(context.Background(), repoPath, err)
+		if err != nil || applied {
+			t.Fatalf("gitRunInactivePolicy(%s) = %v, %v, want the repository left in place", remote, applied, err)
+		}
+		if _, err := os.Stat(repoPath); err != nil {
+			t.Fatalf("repository of %s: %v", remote, err)
+		}
+	}
+
+	repoPath := filepath.Join(root, "127.0.0.1", "gone")
+	initRepoAtPath(t, repoPath, filepath.Join(t.TempDir(), "remote.git"))
+	gitRun(t, repoPath, "remote", "add", "origin", server.URL+"/acme/gone.git")
+	_, err := gitFindRemoteHeadReference(context.Background(), repoPath)
+	if state := gitInactiveState(err); state != fconfig.InactiveDeleted {
+		t.Fatalf("gitInactiveState(%v) = %q, want %q", err, state, fconfig.InactiveDeleted)
+	}
+}
+
+func TestGitGraveyardPath(t *testing.T) {
+	t.Parallel()
+
+	root := filepath.Join(t.TempDir(), "src")
+	id := filepath.Join("github.com", "acme", "api")
+
+	tests := []struct {
+		repoPath    string
+		archiveRoot string
+		want        string
+	}{
+		{repoPath: filepath.Join(root, id), want: filepath.Join(root, "archive", id)},
+		{repoPath: filepath.Join(root, "archive", id), want: filepath.Join(root, "archive", id)},
+		{repoPath: filepath.Join(root, id), archiveRoot: filepath.Join(root, "..", "graveyard"), want: filepath.Join(root, "..", "graveyard", id)},
+		{repoPath: filepath.Join(root, "api"), archiveRoot: filepath.Join(root, "graveyard"), want: filepath.Join(root, "graveyard", id)},
+	}
+
+	for _, test := range tests {
+		got, err := gitGraveyardPath(test.repoPath, id, test.archiveRoot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != filepath.Clean(test.want) {
+			t.Fatalf("gitGraveyardPath(%q, %q) = %q, want %q", test.repoPath, test.archiveRoot, got, test.want)
+		}
+	}
+
+	if _, err := gitGraveyardPath(filepath.Join(root, "api"), id, ""); err == nil {
+		t.Fatal("gitGraveyardPath() outside the layout without archive root error = nil")
+	}
+}
+
+func TestRecordCatalogInactiveInRuntimeContext(t *testing.T) {
+	t.Parallel()
+
+	scopeRoot := t.TempDir()
+	homeDir := t.TempDir()
+	repoPath := filepath.Join(scopeRoot, "src", "github.com", "acme", "api")
+	graveyardPath := filepath.Join(scopeRoot, "src", "archive", "github.com", "acme", "api")
+	mustMkdirAll(t, repoPath)
+	runtimeCtx := configRuntimeContext{HomeDir: homeDir, Cwd: scopeRoot}
+
+	configContent := "version: \"2\"\n" +
+		"roots:\n" +
+		"  - ./src\n" +
+		"catalog:\n" +
+		"  path: ./fget.catalog.yaml\n"
+	writeTestFile(t, filepath.Join(scopeRoot, fconfigFilename), configContent)
+	catalogPath := filepath.Join(scopeRoot, "fget.catalog.yaml")
+	catalog := &fconfig.Catalog{Version: fconfig.CatalogVersionV1, ScopeRoot: scopeRoot}
+	catalog.Upsert(fconfig.RepoEntry{
+		ID:        "github.com/acme/api",
+		Tags:      []string{"work"},
+		Locations: []fconfig.RepoLocation{{Path: repoPath}},
+	})
+	if err := fconfig.SaveCatalog(catalogPath, catalog); err != nil {
+		t.Fatal(err)
+	}
+
+	loadEntry := func() fconfig.RepoEntry {
+		t.Helper()
+		saved, err := fconfig.LoadCatalogWithScope(catalogPath, scopeRoot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		index, err := fconfig.ResolveRepoIndex(saved, "github.com/acme/api")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return saved.Repos[index]
+	}
+
+	since := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	state := &fconfig.InactiveState{State: fconfig.InactiveDeleted, Since: since}
+	if err := recordCatalogInactiveInRuntimeContext("github.com/acme/api", "https://github.com/acme/api", repoPath, graveyardPath, state, true, runtimeCtx); err != nil {
+		t.Fatal(err)
+	}
+
+	entry := loadEntry()
+	if entry.Inactive == nil || *entry.Inactive != *state {
+		t.Fatalf("saved inactive = %+v, want %+v", entry.Inactive, state)
+	}
+	if len(entry.Locations) != 1 || entry.Locations[0].Path != graveyardPath {
+		t.Fatalf("saved locations = %+v, want %s", entry.Locations, graveyardPath)
+	}
+	if want := []string{"inactive:deleted", "work"}; !slices.Equal(entry.Tags, want) {
+		t.Fatalf("saved tags = %v, want %v", entry.Tags, want)
+	}
+	if states := catalogInactiveStatesByLocation(&fconfig.Catalog{Repos: []fconfig.RepoEntry{entry}}); states[graveyardPath] != *state {
+		t.Fatalf("catalogInactiveStatesByLocation() = %+v", states)
+	}
+
+	later := &fconfig.InactiveState{State: fconfig.InactiveDeleted, Since: since.Add(24 * time.Hour)}
+	if err := recordCatalogInactiveInRuntimeContext("github.com/acme/api", "", graveyardPath, graveyardPath, later, true, runtimeCtx); err != nil {
+		t.Fatal(err)
+	}
+	if entry := loadEntry(); entry.Inactive == nil || !entry.Inactive.Since.Equal(since) {
+		t.Fatalf("inactive after recording again = %+v, want since %s", entry.Inactive, since)
+	}
+
+	if err := recordCatalogInactiveInRuntimeContext("", "", graveyardPath, graveyardPath, nil, false, runtimeCtx); err != nil {
+		t.Fatal(err)
+	}
+	entry = loadEntry()
+	if entry.Inactive != nil || !slices.Equal(entry.Tags, []string{"work"}) {
+		t.Fatalf("cleared entry = %+v, want no inactive state or tag", entry)
+	}
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+
+	art "github.com/plar/go-adaptive-radix-tree/v2"
+	"github.com/samber/lo"
+
+	"github.com/zbiljic/fget/pkg/fsfind"
+)
+
+// repoSelection picks repositories from the catalog instead of scanning the
+// roots. Hosts and tags are matched like `catalog export` does.
+type repoSelection struct {
+	CatalogPath string
+	Tags        []string
+	Hosts       []string
+}
+
+func (s repoSelection) fromCatalog() bool {
+	return s.CatalogPath != "" || len(s.Tags) > 0 || len(s.Hosts) > 0
+}
+
+// selectRepositories lists repository paths, sorted. With a catalog
+// selection they are the catalog locations that still exist on disk, limited
+// to the roots when roots were given explicitly; otherwise the roots are
+// scanned.
+func selectRepositories(ctx context.Context, roots []string, explicitRoots bool, selection repoSelection) ([]string, error) {
+	if !selection.fromCatalog() {
+		repoPaths, err := fsfind.GitDirectoriesTreeContext(ctx, roots...)
+		if err != nil {
+			return nil, err
+		}
+
+		paths := make([]string, 0, repoPaths.Size())
+		repoPaths.ForEach(func(node art.Node) bool {
+			paths = append(paths, string(node.Key()))
+			return true
+		})
+		return paths, nil
+	}
+
+	flags := catalogExportFlags{
+		CatalogPath: selection.CatalogPath,
+		Hosts:       selection.Hosts,
+		Tags:        selection.Tags,
+		Sort:        "path",
+	}
+	if explicitRoots {
+		flags.LocationRoots = roots
+	}
+	catalog, digest, err := loadCatalogForExport(flags)
+	if err != nil {
+		return nil, err
+	}
+	records, err := buildCatalogExportRecords(catalog, digest, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(records))
+	for _, record := range records {
+		if _, err := os.Stat(filepath.Join(record.Location, ".git")); err != nil {
+			continue
+		}
+		paths = append(paths, record.Location)
+	}
+	paths = lo.Uniq(paths)
+	sort.Strings(paths)
+	return paths, nil
+}
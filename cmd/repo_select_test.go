@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestSelectRepositoriesFromCatalog(t *testing.T) {
+	root := t.TempDir()
+	tagged := filepath.Join(root, "src", "github.com", "acme", "tagged")
+	other := filepath.Join(root, "src", "gitlab.com", "acme", "other")
+	for _, repo := range []string{tagged, other} {
+		initRepoAtPath(t, repo, filepath.Join(t.TempDir(), "remote.git"))
+	}
+	catalogPath := filepath.Join(root, "fget.catalog.yaml")
+	catalog := fmt.Sprintf(`version: "1"
+updated_at: 2026-08-13T21:45:16Z
+repos:
+  - id: github.com/acme/tagged
+    remote_url: https://github.com/acme/tagged
+    tags: [work]
+    locations:
+      - path: %s
+        last_seen_at: 2026-08-13T21:45:16Z
+  - id: gitlab.com/acme/other
+    remote_url: https://gitlab.com/acme/other
+    tags: [home]
+    locations:
+      - path: %s
+        last_seen_at: 2026-08-13T21:45:16Z
+  - id: github.com/acme/missing
+    remote_url: https://github.com/acme/missing
+    tags: [work]
+    locations:
+      - path: %s
+        last_seen_at: 2026-08-13T21:45:16Z
+`, tagged, other, filepath.Join(root, "missing"))
+	writeTestFile(t, catalogPath, catalog)
+
+	paths, err := selectRepositories(context.Background(), []string{root}, false, repoSelection{CatalogPath: catalogPath, Tags: []string{"WORK"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || paths[0] != tagged {
+		t.Fatalf("selected = %v, want only %s", paths, tagged)
+	}
+
+	byHost := repoSelection{CatalogPath: catalogPath, Hosts: []string{"gitlab.com"}}
+	if paths, err := selectRepositories(context.Background(), []string{root}, false, byHost); err != nil || len(paths) != 1 || paths[0] != other {
+		t.Fatalf("selected by host = %v, %v, want only %s", paths, err, other)
+	}
+	if paths, err := selectRepositories(context.Background(), []string{filepath.Join(root, "src", "github.com")}, true, byHost); err != nil || len(paths) != 0 {
+		t.Fatalf("selected outside the roots = %v, %v", paths, err)
+	}
+}
@@ -2,8 +2,8 @@ package fbackup
 
 import (
 	"archive/tar"
-	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -14,20 +14,7 @@ import (
 	"github.com/zbiljic/fget/pkg/gitinspect"
 )
 
-func runGitToFile(ctx context.Context, runner gitinspect.StreamingRunner, repoPath, output string, args ...string) error {
-	f, err := os.OpenFile(output, os.O_WRONLY|os.O_TRUNC, 0o600)
-	if err != nil {
-		return err
-	}
-	_, err = runner.RunTo(ctx, repoPath, f, args...)
-	closeErr := f.Close()
-	if err != nil {
-		return err
-	}
-	return closeErr
-}
-
-func writeUntrackedTar(ctx context.Context, runner gitinspect.Runner, repoPath, output string) error {
+func writeUntrackedTar(ctx context.Context, runner gitinspect.Runner, repoPath string, output io.Writer, compression Compression) error {
 	out, err := runner.Run(ctx, repoPath, "ls-files", "--others", "--exclude-standard", "-z")
 	if err != nil {
 		return err
@@ -39,10 +26,10 @@ func writeUntrackedTar(ctx context.Context, runner gitinspect.Runner, repoPath,
 		}
 	}
 	sort.Strings(paths)
-	return writeTar(ctx, repoPath, output, paths)
+	return writeTarTo(ctx, repoPath, output, compression, paths)
 }
 
-func writeFullTar(ctx context.Context, repoPath, output string) error {
+func writeFullTar(ctx context.Context, repoPath string, output io.Writer, compression Compression) error {
 	var paths []string
 	err := filepath.WalkDir(repoPath, func(path string, d os.DirEntry, walkErr error) error {
 		if walkErr != nil {
@@ -64,19 +51,41 @@ func writeFullTar(ctx context.Context, repoPath, output string) error {
 		return err
 	}
 	sort.Strings(paths)
-	return writeTar(ctx, repoPath, output, paths)
+	return writeTarTo(ctx, repoPath, output, compression, paths)
 }
 
 func writeTar(ctx context.Context, root, output string, paths []string) error {
-	paths = append([]string(nil), paths...)
-	sort.Strings(paths)
 	f, err := os.OpenFile(output, os.O_WRONLY|os.O_TRUNC, 0o600)
 	if err != nil {
 		return err
 	}
 	defer func() { _ = f.Close() }()
-	gz := gzip.NewWriter(f)
-	tw := tar.NewWriter(gz)
+	if err := writeTarTo(ctx, root, f, Compression{Codec: CodecGzip}, paths); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func writeTarTo(ctx context.Context, root string, output io.Writer, compression Compression, paths []string) error {
+	compressor, err := newCompressor(output, compression)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(compressor)
+	if err := addTarPaths(ctx, tw, root, "", paths); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return compressor.Close()
+}
+
+// addTarPaths adds the files below root to tw in sorted order, naming each
+// member prefix followed by its relative path.
+func addTarPaths(ctx context.Context, tw *tar.Writer, root, prefix string, paths []string) error {
+	paths = append([]string(nil), paths...)
+	sort.Strings(paths)
 	for _, rel := range paths {
 		if err := ctx.Err(); err != nil {
 			return err
@@ -93,7 +102,7 @@ func writeTar(ctx context.Context, root, output string, paths []string) error {
 		if err != nil {
 			return err
 		}
-		hdr.Name = filepath.ToSlash(rel)
+		hdr.Name = prefix + filepath.ToSlash(rel)
 		if info.Mode()&os.ModeSymlink != 0 {
 			hdr.Linkname, err = os.Readlink(full)
 			if err != nil {
@@ -118,11 +127,72 @@ func writeTar(ctx context.Context, root, output string, paths []string) error {
 			}
 		}
 	}
-	if err := tw.Close(); err != nil {
+	return nil
+}
+
+// addTarFile adds a regular file holding data to tw.
+func addTarFile(tw *tar.Writer, name string, data []byte) error {
+	header := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(header); err != nil {
 		return err
 	}
-	if err := gz.Close(); err != nil {
-		return err
+	_, err := tw.Write(data)
+	return err
+}
+
+// extractTar unpacks the uncompressed tar stream of an archive written by
+// writeTar below root. Members are created exclusively and never followed
+// through symlinks.
+func extractTar(ctx context.Context, archive io.Reader, root string) error {
+	tarReader := tar.NewReader(archive)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("tar: %w", err)
+		}
+		name := filepath.ToSlash(header.Name)
+		if !safeRelativePath(name) {
+			return fmt.Errorf("unsafe tar member path %q", header.Name)
+		}
+		if header.Typeflag == tar.TypeDir {
+			if err := ensureSafeDirectory(root, name); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := ensureSafeDirectory(root, filepath.ToSlash(filepath.Dir(filepath.FromSlash(name)))); err != nil {
+			return err
+		}
+		target := filepath.Join(root, filepath.FromSlash(name))
+		switch header.Typeflag {
+		case tar.TypeReg:
+			out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, header.FileInfo().Mode().Perm()|0o200)
+			if err != nil {
+				return err
+			}
+			_, copyErr := io.Copy(out, tarReader)
+			closeErr := out.Close()
+			if copyErr != nil {
+				return copyErr
+			}
+			if closeErr != nil {
+				return closeErr
+			}
+			if err := os.Chmod(target, header.FileInfo().Mode().Perm()); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported tar member type %q for %q", header.Typeflag, header.Name)
+		}
 	}
-	return f.Sync()
 }
@@ -13,6 +13,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/zbiljic/fget/pkg/gitlfs"
 	"github.com/zbiljic/fget/pkg/giturl"
 )
 
@@ -28,17 +29,44 @@ type ArtifactRecord struct {
 	Path         string `json:"path"`
 	Size         int64  `json:"size"`
 	SHA256       string `json:"sha256"`
+	// Codec is the compression of the stored file: gzip, zstd or none. Records
+	// without it predate the field; their tar archives are gzip.
+	Codec string `json:"codec,omitempty"`
+	// InBase marks an artifact whose file is not stored in this backup but in
+	// the base backup, under the same repository and kind.
+	InBase bool `json:"in_base,omitempty"`
+	// Incremental marks a bundle that only contains commits missing from the
+	// base backup's bundle for the same repository. Such bundles omit refs
+	// that did not move, and encrypted bundles cannot be listed without the
+	// key, so Refs records the complete ref snapshot for both.
+	Incremental bool              `json:"incremental,omitempty"`
+	Refs        map[string]string `json:"refs,omitempty"`
+	// Chunks lists, in order, the chunk store objects whose concatenation is
+	// the artifact. Chunked artifacts have no file of their own below Path.
+	Chunks []ChunkRef `json:"chunks,omitempty"`
 }
 
 // BackupMetadata is both the resumable checkpoint and the final backup index.
 // It is rewritten atomically while Complete is false and immutable afterward.
 type BackupMetadata struct {
-	SchemaVersion   string           `json:"schema_version"`
-	SourceAuditHash string           `json:"source_audit_hash"`
-	CreatedAt       time.Time        `json:"created_at"`
-	Complete        bool             `json:"complete"`
-	Manifest        Manifest         `json:"manifest"`
-	Artifacts       []ArtifactRecord `json:"artifacts"`
+	SchemaVersion   string            `json:"schema_version"`
+	SourceAuditHash string            `json:"source_audit_hash"`
+	CreatedAt       time.Time         `json:"created_at"`
+	Complete        bool              `json:"complete"`
+	Base            *BackupBase       `json:"base,omitempty"`
+	Encryption      *BackupEncryption `json:"encryption,omitempty"`
+	// ChunkStore is the directory holding the chunks of chunked artifacts. It
+	// is shared by every backup created with the same store.
+	ChunkStore string           `json:"chunk_store,omitempty"`
+	Manifest   Manifest         `json:"manifest"`
+	Artifacts  []ArtifactRecord `json:"artifacts"`
+}
+
+// BackupBase identifies the complete backup an incremental backup builds on.
+// SHA256 pins the base backup.json so a replaced or modified base is detected.
+type BackupBase struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
 }
 
 func snapshotManifest(manifest Manifest) Manifest {
@@ -50,18 +78,31 @@ func snapshotManifest(manifest Manifest) Manifest {
 	}
 	snapshot.Repositories = make([]RepositoryEntry, len(manifest.Repositories))
 	for index, repository := range manifest.Repositories {
-		repository.RemoteURL = giturl.Sanitize(repository.RemoteURL)
-		repository.ReasonCodes = append([]string(nil), repository.ReasonCodes...)
-		repository.Errors = append([]RepositoryError(nil), repository.Errors...)
-		if repository.Git.Upstream != nil {
-			upstream := *repository.Git.Upstream
-			repository.Git.Upstream = &upstream
-		}
-		snapshot.Repositories[index] = repository
+		snapshot.Repositories[index] = snapshotRepository(repository)
 	}
 	return snapshot
 }
 
+func snapshotRepository(repository RepositoryEntry) RepositoryEntry {
+	repository.RemoteURL = giturl.Sanitize(repository.RemoteURL)
+	repository.ReasonCodes = append([]string(nil), repository.ReasonCodes...)
+	repository.Errors = append([]RepositoryError(nil), repository.Errors...)
+	repository.MissingLFSObjects = append([]gitlfs.Object(nil), repository.MissingLFSObjects...)
+	if repository.Git.Upstream != nil {
+		upstream := *repository.Git.Upstream
+		repository.Git.Upstream = &upstream
+	}
+	if repository.Submodules != nil {
+		submodules := make([]SubmoduleEntry, len(repository.Submodules))
+		for index, submodule := range repository.Submodules {
+			submodule.Repository = snapshotRepository(submodule.Repository)
+			submodules[index] = submodule
+		}
+		repository.Submodules = submodules
+	}
+	return repository
+}
+
 func manifestHash(manifest Manifest) (string, error) {
 	data, err := json.Marshal(manifest)
 	if err != nil {
@@ -70,12 +111,16 @@ func manifestHash(manifest Manifest) (string, error) {
 	return hashBytes(data), nil
 }
 
-func expectedArtifactKinds(classification Classification) []string {
-	switch classification {
+func expectedArtifactKinds(repository RepositoryEntry) []string {
+	switch repository.Classification {
 	case ClassificationRecloneable:
 		return nil
 	case ClassificationDelta:
-		return []string{"bundle", "index-patch", "patch", "untracked"}
+		kinds := []string{"bundle", "index-patch", "patch", "untracked", "stash", "worktrees", "local-config"}
+		if len(repository.MissingLFSObjects) > 0 {
+			kinds = append(kinds, "lfs")
+		}
+		return kinds
 	case ClassificationFull:
 		return []string{"full"}
 	default:
@@ -91,6 +136,10 @@ func writeJSONAtomic(path string, value any, mode os.FileMode) error {
 		return err
 	}
 	data = append(data, '\n')
+	return writeFileAtomic(path, data, mode)
+}
+
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return err
 	}
@@ -131,6 +180,11 @@ func readBackupMetadata(path string) (BackupMetadata, error) {
 	if err != nil {
 		return metadata, err
 	}
+	return decodeBackupMetadata(data)
+}
+
+func decodeBackupMetadata(data []byte) (BackupMetadata, error) {
+	var metadata BackupMetadata
 	if err := json.Unmarshal(data, &metadata); err != nil {
 		return metadata, fmt.Errorf("read backup metadata: %w", err)
 	}
@@ -165,8 +219,12 @@ func hashFile(path string) (size int64, digest string, err error) {
 		return 0, "", err
 	}
 	defer func() { _ = file.Close() }()
+	return hashReader(file)
+}
+
+func hashReader(r io.Reader) (size int64, digest string, err error) {
 	hash := sha256.New()
-	size, err = io.Copy(hash, file)
+	size, err = io.Copy(hash, r)
 	if err != nil {
 		return 0, "", err
 	}
@@ -1,6 +1,9 @@
 package fbackup
 
-import "github.com/zbiljic/fget/pkg/giturl"
+import (
+	"github.com/zbiljic/fget/pkg/gitlfs"
+	"github.com/zbiljic/fget/pkg/giturl"
+)
 
 func BuildRepositoryEntry(probe RepositoryProbe) RepositoryEntry {
 	reasons := classifyReasonCodes(probe)
@@ -24,7 +27,12 @@ func BuildRepositoryEntry(probe RepositoryProbe) RepositoryEntry {
 		RemoteReason:         probe.RemoteReason,
 		HasLFSAttributes:     probe.HasLFSAttributes,
 		HasLocalLFSObjects:   probe.HasLocalLFSObjects,
+		LFSState:             probe.LFSState,
+		LFSReason:            probe.LFSReason,
+		LocalLFSObjectCount:  probe.LocalLFSObjectCount,
+		MissingLFSObjects:    append([]gitlfs.Object(nil), probe.MissingLFSObjects...),
 		HasSubmodules:        probe.HasSubmodules,
+		Submodules:           append([]SubmoduleEntry(nil), probe.Submodules...),
 		EstimatedSourceBytes: probe.EstimatedSourceBytes,
 		Errors:               append([]RepositoryError(nil), probe.Errors...),
 	}
@@ -35,14 +43,18 @@ func Classify(probe RepositoryProbe) Classification {
 		return ClassificationProblem
 	}
 
-	if probe.HasLocalLFSObjects {
+	if probe.HasLocalLFSObjects && !lfsObjectsPreservable(probe) {
 		return ClassificationFull
 	}
 
-	if probe.HasSubmodules {
+	if probe.HasSubmodules && !probe.SubmodulesInspected {
 		return ClassificationProblem
 	}
 
+	return classifyWithSubmodules(classifyRemote(probe), probe.Submodules)
+}
+
+func classifyRemote(probe RepositoryProbe) Classification {
 	if probe.RemoteState == "" {
 		probe.RemoteState = RemoteStateUnchecked
 	}
@@ -53,7 +65,7 @@ func Classify(probe RepositoryProbe) Classification {
 
 	switch probe.RemoteState {
 	case RemoteStateReachable:
-		if probe.LocalOnlyCommitCount > 0 || probe.TrackedDirtyCount > 0 || probe.UntrackedCount > 0 {
+		if probe.LocalOnlyCommitCount > 0 || probe.TrackedDirtyCount > 0 || probe.UntrackedCount > 0 || len(probe.MissingLFSObjects) > 0 {
 			return ClassificationDelta
 		}
 		return ClassificationRecloneable
@@ -66,6 +78,42 @@ func Classify(probe RepositoryProbe) Classification {
 	}
 }
 
+// lfsObjectsPreservable reports whether a delta backup can keep the local LFS
+// objects of probe: the LFS server was asked which ones it lacks, and there
+// are no tracked changes whose LFS content may only exist in the worktree.
+func lfsObjectsPreservable(probe RepositoryProbe) bool {
+	return probe.LFSState == LFSStateVerified && probe.TrackedDirtyCount == 0
+}
+
+// classifyWithSubmodules combines the parent classification with its
+// submodules. A full archive of the parent already contains the submodule
+// worktrees and their Git directories, so any submodule that cannot be cloned
+// again at the commit the parent records forces a full backup.
+func classifyWithSubmodules(parent Classification, submodules []SubmoduleEntry) Classification {
+	result := parent
+	for _, submodule := range submodules {
+		if result == ClassificationProblem {
+			break
+		}
+		switch {
+		case submodule.Repository.Classification == ClassificationProblem:
+			result = ClassificationProblem
+		case result == ClassificationFull || result == ClassificationUnknown:
+		case submodule.Repository.Classification == ClassificationUnknown:
+			result = ClassificationUnknown
+		case !submoduleRecloneable(submodule):
+			result = ClassificationFull
+		}
+	}
+	return result
+}
+
+func submoduleRecloneable(submodule SubmoduleEntry) bool {
+	return submodule.Repository.Classification == ClassificationRecloneable &&
+		submodule.RecordedCommit != "" &&
+		submodule.Repository.Git.Head.Commit == submodule.RecordedCommit
+}
+
 func classifyReasonCodes(probe RepositoryProbe) []string {
 	reasons := make([]string, 0, 8)
 	if len(probe.Errors) > 0 {
@@ -94,11 +142,17 @@ func classifyReasonCodes(probe RepositoryProbe) []string {
 	if probe.HasSubmodules {
 		reasons = append(reasons, "submodules-present")
 	}
+	reasons = append(reasons, submoduleReasonCodes(probe.Submodules)...)
 	if probe.HasLFSAttributes {
 		reasons = append(reasons, "lfs-configured")
 	}
 	if probe.HasLocalLFSObjects {
 		reasons = append(reasons, "local-lfs-objects")
+		if probe.LFSState != LFSStateVerified {
+			reasons = append(reasons, "lfs-unverified")
+		} else if len(probe.MissingLFSObjects) > 0 {
+			reasons = append(reasons, "lfs-objects-missing-upstream")
+		}
 	}
 	if probe.LocalOnlyCommitCount > 0 {
 		reasons = append(reasons, "local-only-commits")
@@ -112,3 +166,29 @@ func classifyReasonCodes(probe RepositoryProbe) []string {
 
 	return reasons
 }
+
+func submoduleReasonCodes(submodules []SubmoduleEntry) []string {
+	var problem, unknown, notRecloneable bool
+	for _, submodule := range submodules {
+		switch {
+		case submodule.Repository.Classification == ClassificationProblem:
+			problem = true
+		case submodule.Repository.Classification == ClassificationUnknown:
+			unknown = true
+		case !submoduleRecloneable(submodule):
+			notRecloneable = true
+		}
+	}
+
+	var reasons []string
+	if problem {
+		reasons = append(reasons, "submodule-problem")
+	}
+	if unknown {
+		reasons = append(reasons, "submodule-unknown")
+	}
+	if notRecloneable {
+		reasons = append(reasons, "submodule-not-recloneable")
+	}
+	return reasons
+}
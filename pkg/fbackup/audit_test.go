@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/zbiljic/fget/pkg/gitinspect"
+	"github.com/zbiljic/fget/pkg/gitlfs"
 )
 
 func TestClassify(t *testing.T) {
@@ -61,6 +62,35 @@ func TestClassify(t *testing.T) {
 			},
 			want: ClassificationFull,
 		},
+		{
+			name: "delta with local lfs objects missing upstream",
+			probe: RepositoryProbe{
+				HasLocalLFSObjects: true,
+				LFSState:           LFSStateVerified,
+				MissingLFSObjects:  []gitlfs.Object{{OID: "abc", Size: 1}},
+				RemoteState:        RemoteStateReachable,
+			},
+			want: ClassificationDelta,
+		},
+		{
+			name: "full with verified lfs objects and tracked changes",
+			probe: RepositoryProbe{
+				HasLocalLFSObjects: true,
+				LFSState:           LFSStateVerified,
+				TrackedDirtyCount:  1,
+				RemoteState:        RemoteStateReachable,
+			},
+			want: ClassificationFull,
+		},
+		{
+			name: "full when lfs verification failed",
+			probe: RepositoryProbe{
+				HasLocalLFSObjects: true,
+				LFSState:           LFSStateFailed,
+				RemoteState:        RemoteStateReachable,
+			},
+			want: ClassificationFull,
+		},
 		{
 			name: "full when remote not found",
 			probe: RepositoryProbe{
@@ -101,6 +131,63 @@ func TestClassify(t *testing.T) {
 			},
 			want: ClassificationProblem,
 		},
+		{
+			name: "recloneable with submodules recloneable at recorded commit",
+			probe: RepositoryProbe{
+				RemoteState:         RemoteStateReachable,
+				HasSubmodules:       true,
+				SubmodulesInspected: true,
+				Submodules:          []SubmoduleEntry{testSubmodule(ClassificationRecloneable, "abc", "abc")},
+			},
+			want: ClassificationRecloneable,
+		},
+		{
+			name: "full when submodule moved from recorded commit",
+			probe: RepositoryProbe{
+				RemoteState:         RemoteStateReachable,
+				HasSubmodules:       true,
+				SubmodulesInspected: true,
+				Submodules:          []SubmoduleEntry{testSubmodule(ClassificationRecloneable, "abc", "def")},
+			},
+			want: ClassificationFull,
+		},
+		{
+			name: "full when submodule has local state",
+			probe: RepositoryProbe{
+				RemoteState:         RemoteStateReachable,
+				TrackedDirtyCount:   1,
+				HasSubmodules:       true,
+				SubmodulesInspected: true,
+				Submodules:          []SubmoduleEntry{testSubmodule(ClassificationDelta, "abc", "abc")},
+			},
+			want: ClassificationFull,
+		},
+		{
+			name: "unknown when submodule remote unchecked",
+			probe: RepositoryProbe{
+				RemoteState:         RemoteStateReachable,
+				HasSubmodules:       true,
+				SubmodulesInspected: true,
+				Submodules: []SubmoduleEntry{
+					testSubmodule(ClassificationUnknown, "abc", "abc"),
+					testSubmodule(ClassificationDelta, "abc", "abc"),
+				},
+			},
+			want: ClassificationUnknown,
+		},
+		{
+			name: "problem when any submodule is a problem",
+			probe: RepositoryProbe{
+				RemoteState:         RemoteStateNotFound,
+				HasSubmodules:       true,
+				SubmodulesInspected: true,
+				Submodules: []SubmoduleEntry{
+					testSubmodule(ClassificationRecloneable, "abc", "abc"),
+					testSubmodule(ClassificationProblem, "abc", "abc"),
+				},
+			},
+			want: ClassificationProblem,
+		},
 	}
 
 	for _, tt := range tests {
@@ -200,3 +287,14 @@ func TestClassifyUncheckedRemoteWithLocalLFSObjectsIsFull(t *testing.T) {
 		t.Fatalf("Classify() = %q, want %q", got, ClassificationFull)
 	}
 }
+
+func testSubmodule(classification Classification, recordedCommit, headCommit string) SubmoduleEntry {
+	return SubmoduleEntry{
+		Path:           "deps/sub",
+		RecordedCommit: recordedCommit,
+		Repository: RepositoryEntry{
+			Classification: classification,
+			Git:            gitinspect.State{Head: gitinspect.Reference{Commit: headCommit}},
+		},
+	}
+}
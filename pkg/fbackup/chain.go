@@ -0,0 +1,314 @@
+package fbackup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"filippo.io/age"
+
+	"github.com/zbiljic/fget/pkg/fbackup/storage"
+	"github.com/zbiljic/fget/pkg/gitinspect"
+)
+
+// backupLink is one complete backup in an incremental chain.
+type backupLink struct {
+	Destination string
+	Metadata    BackupMetadata
+	// store holds the files of a backup in object storage. Local backups leave
+	// it nil and are read from Destination.
+	store storage.Backend
+	// sizeOnly limits verifyRecord to sizes while a remote backup is created;
+	// its artifacts were hashed before they were uploaded.
+	sizeOnly   bool
+	identities []age.Identity
+}
+
+// backupChain lists a backup followed by its bases, newest first. Index 0 is
+// the backup being created, verified, or restored.
+type backupChain []backupLink
+
+// loadBackupChain follows Base references from the metadata of head. Every
+// base must be complete and its backup.json must still hash to the recorded
+// digest.
+func loadBackupChain(head backupLink) (backupChain, error) {
+	if head.store != nil && head.Metadata.Base != nil {
+		return nil, errors.New("remote backups cannot have a base backup")
+	}
+	chain := backupChain{head}
+	visited := map[string]bool{filepath.Clean(head.Destination): true}
+	for base := head.Metadata.Base; base != nil; base = chain[len(chain)-1].Metadata.Base {
+		link, err := openBaseBackup(base.Path)
+		if err != nil {
+			return nil, err
+		}
+		if visited[link.Destination] {
+			return nil, fmt.Errorf("base backup %q forms a cycle", base.Path)
+		}
+		visited[link.Destination] = true
+		digest, err := backupMetadataDigest(link.Destination)
+		if err != nil {
+			return nil, err
+		}
+		if digest != base.SHA256 {
+			return nil, fmt.Errorf("base backup %q changed since it was referenced", base.Path)
+		}
+		chain = append(chain, link)
+	}
+	return chain, nil
+}
+
+func openBaseBackup(path string) (backupLink, error) {
+	destination, err := filepath.Abs(path)
+	if err != nil {
+		return backupLink{}, err
+	}
+	if err := rejectSymlinkRoot(destination); err != nil {
+		return backupLink{}, err
+	}
+	metadata, err := readBackupMetadata(filepath.Join(destination, "backup.json"))
+	if err != nil {
+		return backupLink{}, fmt.Errorf("base backup %q: %w", path, err)
+	}
+	if !metadata.Complete {
+		return backupLink{}, fmt.Errorf("base backup %q is incomplete", path)
+	}
+	return backupLink{Destination: destination, Metadata: metadata}, nil
+}
+
+func backupMetadataDigest(destination string) (string, error) {
+	path := filepath.Join(destination, "backup.json")
+	if err := rejectSymlinkOrNonRegular(path); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return hashBytes(data), nil
+}
+
+// resolve follows InBase records down the chain to the record that stores the
+// file, returning that record, the index of the backup holding it, and its
+// local path. Remote backups and chunked artifacts have no local path.
+func (c backupChain) resolve(record ArtifactRecord) (ArtifactRecord, int, string, error) {
+	for level := range c {
+		if !record.InBase && (c[level].store != nil || len(record.Chunks) > 0) {
+			if err := validateArtifactPath(record.Path); err != nil {
+				return record, level, "", fmt.Errorf("artifact %q: %w", record.RepositoryID, err)
+			}
+			return record, level, "", nil
+		}
+		if !record.InBase {
+			path, err := ensureSafeArtifactPath(c[level].Destination, record.Path)
+			if err != nil {
+				return record, level, "", fmt.Errorf("artifact %q: %w", record.RepositoryID, err)
+			}
+			return record, level, path, nil
+		}
+		if level+1 >= len(c) {
+			break
+		}
+		base, ok := findArtifact(c[level+1].Metadata.Artifacts, record.RepositoryID, record.Kind)
+		if !ok || base.Size != record.Size || !strings.EqualFold(base.SHA256, record.SHA256) {
+			return record, level, "", fmt.Errorf("artifact %q %s does not match its base backup", record.RepositoryID, record.Kind)
+		}
+		record = base
+	}
+	return record, 0, "", fmt.Errorf("artifact %q %s refers to a missing base backup", record.RepositoryID, record.Kind)
+}
+
+// openStored opens the file that stores a resolved record as it was written,
+// still encrypted and compressed.
+func (c backupChain) openStored(ctx context.Context, level int, stored ArtifactRecord, path string) (io.ReadCloser, error) {
+	if len(stored.Chunks) > 0 {
+		if c[level].Metadata.ChunkStore == "" {
+			return nil, fmt.Errorf("artifact %q is chunked but the backup has no chunk store", stored.RepositoryID)
+		}
+		return openChunks(c[level].Metadata.ChunkStore, stored.Chunks), nil
+	}
+	if store := c[level].store; store != nil {
+		return store.Get(ctx, filepath.ToSlash(stored.Path))
+	}
+	return os.Open(path)
+}
+
+// newestArtifact returns the record of a repository artifact of the newest
+// backup in the chain.
+func (c backupChain) newestArtifact(repositoryID, kind string) (ArtifactRecord, error) {
+	record, ok := findArtifact(c[0].Metadata.Artifacts, repositoryID, kind)
+	if !ok {
+		return record, fmt.Errorf("missing artifact kind %q", kind)
+	}
+	return record, nil
+}
+
+// bundleFiles returns plaintext bundle files needed to rebuild record, oldest
+// first, and the record that stores the newest one. Only that record carries
+// the complete ref snapshot of an incremental chain. cleanup removes any
+// decrypted copies.
+func (c backupChain) bundleFiles(ctx context.Context, record ArtifactRecord) (files []string, stored ArtifactRecord, cleanup func(), err error) {
+	var cleanups []func()
+	release := func() {
+		for _, fn := range cleanups {
+			fn()
+		}
+	}
+	defer func() {
+		if err != nil {
+			release()
+		}
+	}()
+
+	stored, level, _, err := c.resolve(record)
+	if err != nil {
+		return nil, stored, nil, err
+	}
+	if stored.Incremental {
+		below := c[level+1:]
+		var previous ArtifactRecord
+		ok := false
+		if len(below) > 0 {
+			previous, ok = findArtifact(below[0].Metadata.Artifacts, record.RepositoryID, "bundle")
+		}
+		if !ok {
+			return nil, stored, nil, fmt.Errorf("incremental bundle for %q has no base bundle", record.RepositoryID)
+		}
+		var belowCleanup func()
+		files, _, belowCleanup, err = below.bundleFiles(ctx, previous)
+		if err != nil {
+			return nil, stored, nil, err
+		}
+		cleanups = append(cleanups, belowCleanup)
+	}
+	path, materializeCleanup, err := c[level:].materialize(ctx, stored)
+	if err != nil {
+		return nil, stored, nil, err
+	}
+	cleanups = append(cleanups, materializeCleanup)
+	return append(files, path), stored, release, nil
+}
+
+// bundleHeads returns the ref snapshot of a stored bundle record. Bundles
+// that carry Refs are never read, so encrypted bases need no key.
+func bundleHeads(ctx context.Context, runner gitinspect.Runner, record ArtifactRecord, path string) (map[string]string, error) {
+	if record.Refs != nil {
+		return record.Refs, nil
+	}
+	out, err := runner.Run(ctx, "", "bundle", "list-heads", path)
+	if err != nil {
+		return nil, err
+	}
+	return parseBundleHeads(out.Stdout), nil
+}
+
+// parseBundleHeads parses `git bundle list-heads` output, skipping HEAD.
+func parseBundleHeads(output string) map[string]string {
+	refs := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		object, name, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if ok && name != "HEAD" {
+			refs[name] = object
+		}
+	}
+	return refs
+}
+
+// snapshotRefs lists every ref of a repository, including remote-tracking
+// refs, which `git bundle create --all` also records.
+func snapshotRefs(ctx context.Context, runner gitinspect.Runner, repositoryPath string) (map[string]string, error) {
+	out, err := runner.Run(ctx, repositoryPath, "for-each-ref", "--format=%(refname)%00%(objectname)")
+	if err != nil {
+		return nil, err
+	}
+	refs := make(map[string]string)
+	for _, line := range strings.Split(out.Stdout, "\n") {
+		if name, object, ok := strings.Cut(strings.TrimSpace(line), "\x00"); ok {
+			refs[name] = object
+		}
+	}
+	return refs, nil
+}
+
+// reconcileRefs makes the refs of repositoryPath match refs exactly, after
+// every bundle in a chain has been fetched into a scratch namespace.
+func reconcileRefs(ctx context.Context, runner gitinspect.Runner, repositoryPath string, refs map[string]string) error {
+	current, err := snapshotRefs(ctx, runner, repositoryPath)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(current))
+	for name := range current {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, keep := refs[name]; keep {
+			continue
+		}
+		if _, err := runner.Run(ctx, repositoryPath, "update-ref", "-d", name); err != nil {
+			return err
+		}
+	}
+	names = names[:0]
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if current[name] == refs[name] {
+			continue
+		}
+		if _, err := runner.Run(ctx, repositoryPath, "update-ref", name, refs[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchBundleChain fetches every bundle into repositoryPath. A single complete
+// bundle is fetched straight into refs/*; a chain is fetched into scratch
+// namespaces and the final ref snapshot is applied afterward.
+func fetchBundleChain(
+	ctx context.Context,
+	runner gitinspect.Runner,
+	repositoryPath string,
+	files []string,
+	stored ArtifactRecord,
+) error {
+	if !stored.Incremental {
+		_, err := runner.Run(ctx, repositoryPath, "fetch", "-q", "--update-head-ok", files[0], "refs/*:refs/*")
+		return err
+	}
+	for index, file := range files {
+		refspec := fmt.Sprintf("+refs/*:refs/fbackup-chain/%d/*", index)
+		if _, err := runner.Run(ctx, repositoryPath, "fetch", "-q", file, refspec); err != nil {
+			return err
+		}
+	}
+	return reconcileRefs(ctx, runner, repositoryPath, stored.Refs)
+}
+
+func verifyBundleChain(ctx context.Context, runner gitinspect.Runner, files []string, stored ArtifactRecord) error {
+	if len(files) == 1 {
+		_, err := runner.Run(ctx, "", "bundle", "verify", files[0])
+		return err
+	}
+	if len(stored.Refs) == 0 {
+		return errors.New("incremental bundle has no refs")
+	}
+	scratch, err := os.MkdirTemp("", "fbackup-verify-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(scratch) }()
+	if _, err := runner.Run(ctx, scratch, "init", "-q", "--bare"); err != nil {
+		return err
+	}
+	return fetchBundleChain(ctx, runner, scratch, files, stored)
+}
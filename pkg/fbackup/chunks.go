@@ -0,0 +1,275 @@
+package fbackup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// ChunkRef names one content-addressed chunk of a chunked artifact.
+type ChunkRef struct {
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// Chunk boundaries are content-defined, so an insertion only changes the
+// chunks around it and identical data shared by several artifacts is split
+// the same way. Changing these values or the gear table changes boundaries,
+// which only costs deduplication against older chunks. Tests lower them.
+var (
+	chunkMinSize     = 512 << 10
+	chunkMaxSize     = 8 << 20
+	chunkAverageBits = 20
+)
+
+// gearTable maps every byte to a pseudo-random value for the gear rolling
+// hash. It is derived from a fixed seed so boundaries are stable across runs.
+var gearTable = func() (table [256]uint64) {
+	state := uint64(0x6667657463686e6b)
+	for index := range table {
+		// splitmix64
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[index] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// chunker splits a stream at positions where the gear hash of the preceding
+// 64 bytes has its top chunkAverageBits bits clear.
+type chunker struct {
+	reader io.Reader
+	buffer []byte
+	start  int
+	end    int
+	eof    bool
+}
+
+func newChunker(reader io.Reader) *chunker {
+	return &chunker{reader: reader, buffer: make([]byte, chunkMaxSize)}
+}
+
+// next returns the next chunk, which is only valid until the following call,
+// or io.EOF after the last one.
+func (c *chunker) next() ([]byte, error) {
+	c.end = copy(c.buffer, c.buffer[c.start:c.end])
+	c.start = 0
+	for !c.eof && c.end < len(c.buffer) {
+		n, err := c.reader.Read(c.buffer[c.end:])
+		c.end += n
+		if errors.Is(err, io.EOF) {
+			c.eof = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if c.end == 0 {
+		return nil, io.EOF
+	}
+	c.start = chunkBoundary(c.buffer[:c.end])
+	return c.buffer[:c.start], nil
+}
+
+func chunkBoundary(data []byte) int {
+	if len(data) <= chunkMinSize {
+		return len(data)
+	}
+	limit := min(len(data), chunkMaxSize)
+	shift := 64 - chunkAverageBits
+	var rolling uint64
+	// The hash only depends on the last 64 bytes, so start just early enough
+	// for it to be warm at the minimum chunk size.
+	for index := max(chunkMinSize-64, 0); index < limit; index++ {
+		rolling = rolling<<1 + gearTable[data[index]]
+		if index >= chunkMinSize && rolling>>shift == 0 {
+			return index + 1
+		}
+	}
+	return limit
+}
+
+// storeArtifactChunks splits the file at path into the chunk store below
+// root. Chunks that already exist are not written again. An empty file is
+// stored as one empty chunk so that every chunked record has chunks.
+func storeArtifactChunks(ctx context.Context, root, path string) ([]ChunkRef, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+	var chunks []ChunkRef
+	chunker := newChunker(file)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		data, err := chunker.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		chunk, err := storeChunk(root, data)
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, chunk)
+	}
+	if len(chunks) == 0 {
+		chunk, err := storeChunk(root, nil)
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks, nil
+}
+
+// storeChunk writes data under its digest unless a chunk of that size is
+// already stored. Stored chunks are never rewritten; verify finds corrupt ones.
+func storeChunk(root string, data []byte) (ChunkRef, error) {
+	sum := sha256.Sum256(data)
+	chunk := ChunkRef{SHA256: hex.EncodeToString(sum[:]), Size: int64(len(data))}
+	relative := chunkRelativePath(chunk.SHA256)
+	if err := ensureSafeDirectory(root, path.Dir(relative)); err != nil {
+		return chunk, err
+	}
+	chunkPath, err := ensureSafeArtifactPath(root, relative)
+	if err != nil {
+		return chunk, err
+	}
+	if info, err := os.Lstat(chunkPath); err == nil && info.Mode().IsRegular() && info.Size() == chunk.Size {
+		return chunk, nil
+	}
+	return chunk, writeFileAtomic(chunkPath, data, 0o644)
+}
+
+func chunkRelativePath(digest string) string {
+	return path.Join("chunks", digest[:2], digest)
+}
+
+// chunkPath returns the file of a chunk named by backup metadata, rejecting
+// names that are not digests and symlinked directories.
+func chunkPath(root string, chunk ChunkRef) (string, error) {
+	if len(chunk.SHA256) != sha256.Size*2 || chunk.Size < 0 {
+		return "", fmt.Errorf("invalid chunk %q", chunk.SHA256)
+	}
+	if _, err := hex.DecodeString(chunk.SHA256); err != nil {
+		return "", fmt.Errorf("invalid chunk %q", chunk.SHA256)
+	}
+	return ensureSafeArtifactPath(root, chunkRelativePath(chunk.SHA256))
+}
+
+// verifyChunkedRecord checks that every chunk of record is stored with its
+// size and digest and that together they hash to the artifact checksum.
+func verifyChunkedRecord(root string, record ArtifactRecord) error {
+	if root == "" {
+		return fmt.Errorf("artifact %q is chunked but the backup has no chunk store", record.RepositoryID)
+	}
+	var total int64
+	for _, chunk := range record.Chunks {
+		path, err := chunkPath(root, chunk)
+		if err != nil {
+			return fmt.Errorf("artifact %q: %w", record.RepositoryID, err)
+		}
+		info, err := os.Lstat(path)
+		if err != nil {
+			return fmt.Errorf("artifact %q chunk %s: %w", record.RepositoryID, chunk.SHA256, err)
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("artifact %q chunk %s is not a regular file", record.RepositoryID, chunk.SHA256)
+		}
+		if info.Size() != chunk.Size {
+			return fmt.Errorf("artifact %q chunk %s size mismatch", record.RepositoryID, chunk.SHA256)
+		}
+		total += chunk.Size
+	}
+	if total != record.Size {
+		return fmt.Errorf("artifact %q size mismatch", record.RepositoryID)
+	}
+	reader := openChunks(root, record.Chunks)
+	defer func() { _ = reader.Close() }()
+	_, digest, err := hashReader(reader)
+	if err != nil {
+		return fmt.Errorf("artifact %q: %w", record.RepositoryID, err)
+	}
+	if !strings.EqualFold(digest, record.SHA256) {
+		return fmt.Errorf("artifact %q checksum mismatch", record.RepositoryID)
+	}
+	return nil
+}
+
+// chunkReader reads the concatenation of chunks and fails at the end of any
+// chunk whose size or digest does not match its name.
+type chunkReader struct {
+	root    string
+	chunks  []ChunkRef
+	current ChunkRef
+	file    *os.File
+	hash    hash.Hash
+	read    int64
+}
+
+func openChunks(root string, chunks []ChunkRef) io.ReadCloser {
+	return &chunkReader{root: root, chunks: chunks, hash: sha256.New()}
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.file == nil {
+			if len(r.chunks) == 0 {
+				return 0, io.EOF
+			}
+			r.current, r.chunks = r.chunks[0], r.chunks[1:]
+			path, err := chunkPath(r.root, r.current)
+			if err != nil {
+				return 0, err
+			}
+			if r.file, err = os.Open(path); err != nil {
+				return 0, err
+			}
+			r.hash.Reset()
+			r.read = 0
+		}
+		n, err := r.file.Read(p)
+		r.hash.Write(p[:n])
+		r.read += int64(n)
+		if r.read > r.current.Size {
+			return n, fmt.Errorf("chunk %s size mismatch", r.current.SHA256)
+		}
+		if errors.Is(err, io.EOF) {
+			_ = r.file.Close()
+			r.file = nil
+			if r.read != r.current.Size {
+				return n, fmt.Errorf("chunk %s size mismatch", r.current.SHA256)
+			}
+			if hex.EncodeToString(r.hash.Sum(nil)) != r.current.SHA256 {
+				return n, fmt.Errorf("chunk %s checksum mismatch", r.current.SHA256)
+			}
+			if n == 0 {
+				continue
+			}
+			return n, nil
+		}
+		return n, err
+	}
+}
+
+func (r *chunkReader) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
@@ -0,0 +1,169 @@
+package fbackup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func useSmallChunks(t *testing.T) {
+	t.Helper()
+	minSize, maxSize, averageBits := chunkMinSize, chunkMaxSize, chunkAverageBits
+	chunkMinSize, chunkMaxSize, chunkAverageBits = 2<<10, 32<<10, 13
+	t.Cleanup(func() { chunkMinSize, chunkMaxSize, chunkAverageBits = minSize, maxSize, averageBits })
+}
+
+func splitChunks(t *testing.T, data []byte) []string {
+	t.Helper()
+	var chunks []string
+	chunker := newChunker(bytes.NewReader(data))
+	for {
+		chunk, err := chunker.next()
+		if errors.Is(err, io.EOF) {
+			return chunks
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, string(chunk))
+	}
+}
+
+func TestChunkerBoundariesFollowContent(t *testing.T) {
+	useSmallChunks(t)
+	data := make([]byte, 512<<10)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	original := splitChunks(t, data)
+	if strings.Join(original, "") != string(data) {
+		t.Fatal("chunks do not concatenate to the input")
+	}
+	for _, chunk := range original[:len(original)-1] {
+		if len(chunk) <= chunkMinSize || len(chunk) > chunkMaxSize {
+			t.Fatalf("chunk size %d outside (%d, %d]", len(chunk), chunkMinSize, chunkMaxSize)
+		}
+	}
+
+	shifted := splitChunks(t, append([]byte("a few inserted bytes"), data...))
+	seen := make(map[string]bool, len(original))
+	for _, chunk := range original {
+		seen[chunk] = true
+	}
+	shared := 0
+	for _, chunk := range shifted {
+		if seen[chunk] {
+			shared++
+		}
+	}
+	if shared < len(original)-2 {
+		t.Fatalf("%d of %d chunks survived an insertion at the start", shared, len(original))
+	}
+}
+
+func TestCreateChunkedDeduplicatesAcrossRepositoriesAndRuns(t *testing.T) {
+	useSmallChunks(t)
+	root := t.TempDir()
+	shared := make([]byte, 256<<10)
+	rand.New(rand.NewSource(2)).Read(shared)
+	var repositories []RepositoryEntry
+	for _, name := range []string{"one", "two"} {
+		path := filepath.Join(root, name)
+		mustGitTest(t, root, "init", "-q", path)
+		if err := os.WriteFile(filepath.Join(path, "shared.bin"), shared, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(path, "own.txt"), []byte(name+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		entry := RepositoryEntry{ID: "example/" + name, Path: path, Classification: ClassificationFull}
+		inspectEntryState(t, &entry)
+		repositories = append(repositories, entry)
+	}
+	manifest := Manifest{Version: ManifestVersion, Repositories: repositories}
+	store := filepath.Join(root, "chunks")
+	options := CreateOptions{
+		Destination: filepath.Join(root, "first"),
+		Manifest:    manifest,
+		Compression: Compression{Codec: CodecNone},
+		ChunkStore:  store,
+	}
+	if err := Create(context.Background(), options); err != nil {
+		t.Fatal(err)
+	}
+	metadata, err := readBackupMetadata(filepath.Join(options.Destination, "backup.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var artifactBytes int64
+	for _, record := range metadata.Artifacts {
+		if len(record.Chunks) == 0 {
+			t.Fatalf("artifact %+v has no chunks", record)
+		}
+		if _, err := os.Lstat(filepath.Join(options.Destination, filepath.FromSlash(record.Path))); !os.IsNotExist(err) {
+			t.Fatalf("chunked artifact %s also exists as a file: %v", record.Path, err)
+		}
+		artifactBytes += record.Size
+	}
+	storeBytes := func() (total int64, count int) {
+		_ = filepath.WalkDir(store, func(path string, entry os.DirEntry, err error) error {
+			if err == nil && entry.Type().IsRegular() {
+				info, _ := entry.Info()
+				total += info.Size()
+				count++
+			}
+			return err
+		})
+		return total, count
+	}
+	stored, chunks := storeBytes()
+	if stored > artifactBytes-int64(len(shared))/2 {
+		t.Fatalf("chunk store holds %d bytes for %d artifact bytes; shared data was not deduplicated", stored, artifactBytes)
+	}
+
+	options.Destination = filepath.Join(root, "second")
+	if err := Create(context.Background(), options); err != nil {
+		t.Fatal(err)
+	}
+	if _, again := storeBytes(); again != chunks {
+		t.Fatalf("second run of unchanged repositories grew the chunk store from %d to %d chunks", chunks, again)
+	}
+	if err := Verify(context.Background(), options.Destination, true); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(root, "restore")
+	if err := Restore(context.Background(), RestoreOptions{Backup: options.Destination, Target: target}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(filepath.Join(target, "example", "two", "shared.bin")); err != nil || !bytes.Equal(got, shared) {
+		t.Fatalf("restored shared.bin differs: %v", err)
+	}
+
+	chunk := metadata.Artifacts[0].Chunks[len(metadata.Artifacts[0].Chunks)/2]
+	path, err := chunkPath(store, chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[0] ^= 0xff
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(context.Background(), options.Destination, true); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("Verify() with a corrupt chunk error = %v, want checksum mismatch", err)
+	}
+
+	options.Encryption = Encryption{Passphrase: "secret"}
+	options.Destination = filepath.Join(root, "encrypted")
+	if err := Create(context.Background(), options); err == nil || !strings.Contains(err.Error(), "cannot be encrypted") {
+		t.Fatalf("Create() with a chunk store and encryption error = %v", err)
+	}
+}
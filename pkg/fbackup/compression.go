@@ -0,0 +1,152 @@
+package fbackup
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	CodecGzip = "gzip"
+	CodecZstd = "zstd"
+	CodecNone = "none"
+)
+
+// Compression selects how Create compresses tar archives. The zero value is
+// gzip at its default level. Level 0 selects the codec's default; gzip accepts
+// 1-9 and zstd 1-22, which maps onto the encoder's speed presets.
+type Compression struct {
+	Codec string
+	Level int
+}
+
+func (c Compression) normalize() (Compression, error) {
+	if c.Codec == "" {
+		c.Codec = CodecGzip
+	}
+	switch c.Codec {
+	case CodecGzip:
+		if c.Level < 0 || c.Level > gzip.BestCompression {
+			return c, fmt.Errorf("gzip compression level must be between 1 and %d", gzip.BestCompression)
+		}
+	case CodecZstd:
+		if c.Level < 0 || c.Level > 22 {
+			return c, errors.New("zstd compression level must be between 1 and 22")
+		}
+	case CodecNone:
+		if c.Level != 0 {
+			return c, errors.New("compression level requires a compression codec")
+		}
+	default:
+		return c, fmt.Errorf("unsupported compression codec %q", c.Codec)
+	}
+	return c, nil
+}
+
+// tarName returns the artifact file name of a tar archive with this codec.
+func (c Compression) tarName(stem string) string {
+	switch c.Codec {
+	case CodecZstd:
+		return stem + ".tar.zst"
+	case CodecNone:
+		return stem + ".tar"
+	default:
+		return stem + ".tar.gz"
+	}
+}
+
+// newCompressor wraps output with the codec. Closing the returned writer
+// flushes the codec but does not close output.
+func newCompressor(output io.Writer, c Compression) (io.WriteCloser, error) {
+	switch c.Codec {
+	case CodecGzip:
+		level := c.Level
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return gzip.NewWriterLevel(output, level)
+	case CodecZstd:
+		options := []zstd.EOption{}
+		if c.Level != 0 {
+			options = append(options, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(c.Level)))
+		}
+		return zstd.NewWriter(output, options...)
+	case CodecNone:
+		return nopWriteCloser{output}, nil
+	}
+	return nil, fmt.Errorf("unsupported compression codec %q", c.Codec)
+}
+
+// newDecompressor returns a reader of the uncompressed content of input.
+func newDecompressor(input io.Reader, codec string) (io.ReadCloser, error) {
+	switch codec {
+	case CodecGzip:
+		reader, err := gzip.NewReader(input)
+		if err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+		return reader, nil
+	case CodecZstd:
+		decoder, err := zstd.NewReader(input)
+		if err != nil {
+			return nil, fmt.Errorf("zstd: %w", err)
+		}
+		return decoder.IOReadCloser(), nil
+	case CodecNone:
+		return io.NopCloser(input), nil
+	}
+	return nil, fmt.Errorf("unsupported compression codec %q", codec)
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// codec returns the compression of a stored artifact. Backups written before
+// codecs were recorded compressed tar archives with gzip and nothing else.
+func (r ArtifactRecord) codec() string {
+	if r.Codec != "" {
+		return r.Codec
+	}
+	if r.Kind == "full" || r.Kind == "untracked" {
+		return CodecGzip
+	}
+	return CodecNone
+}
+
+type archiveReadCloser struct {
+	io.Reader
+	decompressor io.Closer
+	file         io.Closer
+}
+
+func (r archiveReadCloser) Close() error {
+	err := r.decompressor.Close()
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// openArchive returns a reader of the uncompressed tar stream of record,
+// decrypting and decompressing on the fly.
+func (c backupChain) openArchive(ctx context.Context, record ArtifactRecord) (io.ReadCloser, error) {
+	stored, _, _, err := c.resolve(record)
+	if err != nil {
+		return nil, err
+	}
+	file, err := c.open(ctx, record)
+	if err != nil {
+		return nil, err
+	}
+	decompressor, err := newDecompressor(file, stored.codec())
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return archiveReadCloser{Reader: decompressor, decompressor: decompressor, file: file}, nil
+}
@@ -0,0 +1,77 @@
+package fbackup
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCreateRecordsCompressionCodecPerArtifact(t *testing.T) {
+	root := t.TempDir()
+	full := filepath.Join(root, "full")
+	mustGitTest(t, root, "init", "-q", full)
+	mustGitTest(t, full, "config", "user.email", "test@example.com")
+	mustGitTest(t, full, "config", "user.name", "Test")
+	if err := os.WriteFile(filepath.Join(full, "tracked"), []byte("tracked\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	mustGitTest(t, full, "add", "tracked")
+	mustGitTest(t, full, "commit", "-qm", "initial")
+	fullEntry := RepositoryEntry{ID: "example/full", Path: full, Classification: ClassificationFull}
+	inspectEntryState(t, &fullEntry)
+	manifest := Manifest{Version: ManifestVersion, Repositories: []RepositoryEntry{fullEntry}}
+
+	for _, compression := range []Compression{{Codec: CodecZstd, Level: 19}, {Codec: CodecNone}} {
+		destination := filepath.Join(root, "backup-"+compression.Codec)
+		options := CreateOptions{Destination: destination, Manifest: manifest, Compression: compression}
+		if err := Create(context.Background(), options); err != nil {
+			t.Fatal(err)
+		}
+		metadata, err := readBackupMetadata(filepath.Join(destination, "backup.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		record, ok := findArtifact(metadata.Artifacts, fullEntry.ID, "full")
+		if !ok || record.Codec != compression.Codec || filepath.Base(record.Path) != compression.tarName("full") {
+			t.Fatalf("%s full artifact = %+v", compression.Codec, record)
+		}
+		data, err := os.ReadFile(filepath.Join(destination, filepath.FromSlash(record.Path)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if compression.Codec == CodecZstd && !bytes.HasPrefix(data, []byte{0x28, 0xb5, 0x2f, 0xfd}) {
+			t.Fatal("zstd artifact does not start with the zstd frame magic")
+		}
+		if compression.Codec == CodecNone && (len(data) < 262 || string(data[257:262]) != "ustar") {
+			t.Fatal("uncompressed artifact is not a plain tar archive")
+		}
+		if err := Verify(context.Background(), destination, true); err != nil {
+			t.Fatal(err)
+		}
+		target := filepath.Join(root, "restore-"+compression.Codec)
+		if err := Restore(context.Background(), RestoreOptions{Backup: destination, Target: target}); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := os.ReadFile(filepath.Join(target, "example", "full", "tracked")); err != nil || string(got) != "tracked\n" {
+			t.Fatalf("%s restore = %q, %v", compression.Codec, got, err)
+		}
+	}
+}
+
+func TestCompressionNormalizeRejectsInvalidSettings(t *testing.T) {
+	if got, err := (Compression{}).normalize(); err != nil || got.Codec != CodecGzip {
+		t.Fatalf("zero Compression = %+v, %v; want gzip", got, err)
+	}
+	for _, compression := range []Compression{
+		{Codec: "brotli"},
+		{Codec: CodecGzip, Level: 10},
+		{Codec: CodecZstd, Level: 23},
+		{Codec: CodecNone, Level: 3},
+	} {
+		if _, err := compression.normalize(); err == nil {
+			t.Fatalf("normalize(%+v) succeeded", compression)
+		}
+	}
+}
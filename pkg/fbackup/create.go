@@ -6,35 +6,113 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
 	"time"
 
+	"filippo.io/age"
+
+	"github.com/zbiljic/fget/pkg/fbackup/storage"
 	"github.com/zbiljic/fget/pkg/gitinspect"
 )
 
 type CreateOptions struct {
+	// Destination is a local directory or an s3://bucket/prefix location.
 	Destination string
-	Manifest    Manifest
-	Progress    func(repositoryID, status string)
-	GitRunner   gitinspect.StreamingRunner
+	// Staging is the local directory that holds the checkpoint and temporary
+	// artifacts of a remote backup until they are uploaded. It defaults to a
+	// directory in the user cache derived from Destination.
+	Staging  string
+	Manifest Manifest
+	// Base optionally names a complete earlier backup. Unchanged artifacts are
+	// hard-linked from it, or referenced when linking is not possible, and
+	// bundles only hold commits missing from its bundles.
+	Base string
+	// Compression selects the codec of tar archives; the zero value is gzip.
+	Compression Compression
+	// Encryption optionally encrypts every artifact with age.
+	Encryption Encryption
+	// ChunkStore optionally names a directory, shared between backups, that
+	// stores artifacts as deduplicated content-addressed chunks. It cannot be
+	// combined with Base, Encryption, or a remote destination.
+	ChunkStore string
+	// Workers bounds how many repositories are archived concurrently. Values
+	// below one are treated as one.
+	Workers   int
+	Progress  func(repositoryID, status string)
+	GitRunner gitinspect.StreamingRunner
+}
+
+// createCheckpoint serializes every change to the in-memory metadata and its
+// publication as backup.json, so each written checkpoint contains all records
+// published before it regardless of which worker produced them.
+type createCheckpoint struct {
+	mu          sync.Mutex
+	path        string
+	metadata    *BackupMetadata
+	chain       backupChain
+	recipient   age.Recipient
+	compression Compression
+	progress    func(string, string)
+	// store receives artifacts as they are finished when the backup is remote.
+	store storage.Backend
+}
+
+func (c *createCheckpoint) artifact(repositoryID, kind string) (ArtifactRecord, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return findArtifact(c.metadata.Artifacts, repositoryID, kind)
+}
+
+func (c *createCheckpoint) publish(record ArtifactRecord) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	upsertArtifact(c.metadata, record)
+	return writeJSONAtomic(c.path, c.metadata, 0o644)
+}
+
+func (c *createCheckpoint) report(repositoryID, status string) {
+	if c.progress == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.progress(repositoryID, status)
 }
 
 func Create(ctx context.Context, options CreateOptions) error {
-	options, destination, auditHash, err := prepareCreateOptions(options)
+	options, destination, auditHash, base, err := prepareCreateOptions(options)
 	if err != nil {
 		return err
 	}
 
+	// A remote backup is assembled in a local staging destination and each
+	// artifact is uploaded once it is finished. backup.json is uploaded last,
+	// so the remote backup only exists once it is complete.
+	var store storage.Backend
+	if storage.IsRemote(options.Destination) {
+		store, err = storage.Open(options.Destination)
+		if err != nil {
+			return err
+		}
+		if _, err := store.Stat(ctx, "backup.json"); err == nil {
+			return verifyWithRunner(ctx, options.Destination, false, Keys{}, options.GitRunner)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
 	metadataPath := filepath.Join(destination, "backup.json")
-	metadata, err := openOrInitialize(destination, options.Manifest, auditHash)
+	metadata, recipient, err := openOrInitialize(destination, options.Manifest, auditHash, base, options.Encryption, options.ChunkStore)
 	if err != nil {
 		return err
 	}
 	if metadata.Complete {
-		return verifyWithRunner(ctx, destination, false, options.GitRunner)
+		return verifyWithRunner(ctx, destination, false, Keys{}, options.GitRunner)
 	}
 
 	// Publish the initial checkpoint before any artifact work. A failure on the
@@ -46,106 +124,308 @@ func Create(ctx context.Context, options CreateOptions) error {
 		return err
 	}
 
-	for _, repository := range options.Manifest.Repositories {
-		if err := ctx.Err(); err != nil {
-			return err
-		}
-		if options.Progress != nil {
-			options.Progress(repository.ID, "starting")
-		}
-		if err := validateMetadataOnlyRepository(ctx, repository, options.GitRunner); err != nil {
-			return err
-		}
-		if err := createRepository(ctx, destination, repository, &metadata, options.GitRunner, options.Progress); err != nil {
-			return err
-		}
+	head := backupLink{Destination: destination, Metadata: metadata}
+	if store != nil {
+		head = backupLink{Destination: store.String(), Metadata: metadata, store: store, sizeOnly: true}
+	}
+	chain, err := loadBackupChain(head)
+	if err != nil {
+		return err
+	}
+	checkpoint := &createCheckpoint{
+		path:        metadataPath,
+		metadata:    &metadata,
+		chain:       chain,
+		recipient:   recipient,
+		compression: options.Compression,
+		progress:    options.Progress,
+		store:       store,
+	}
+	if err := createRepositories(ctx, destination, options, checkpoint); err != nil {
+		return err
 	}
 
-	if err := verifyArtifacts(ctx, destination, metadata, false, options.GitRunner); err != nil {
+	head.Metadata = metadata
+	if err := verifyArtifacts(ctx, head, false, Keys{}, options.GitRunner); err != nil {
 		return err
 	}
 	metadata.Complete = true
+	if store != nil {
+		return commitRemoteBackup(ctx, store, destination, metadata)
+	}
 	return writeJSONAtomic(metadataPath, metadata, 0o644)
 }
 
-func prepareCreateOptions(options CreateOptions) (CreateOptions, string, string, error) {
+func prepareCreateOptions(options CreateOptions) (CreateOptions, string, string, *BackupBase, error) {
 	if options.Destination == "" {
-		return options, "", "", errors.New("backup destination is required")
+		return options, "", "", nil, errors.New("backup destination is required")
 	}
 	if options.GitRunner == nil {
 		options.GitRunner = gitinspect.CLIRunner{}
 	}
 	if options.Manifest.Version != ManifestVersion {
-		return options, "", "", fmt.Errorf("unsupported manifest version %q", options.Manifest.Version)
+		return options, "", "", nil, fmt.Errorf("unsupported manifest version %q", options.Manifest.Version)
+	}
+	compression, err := options.Compression.normalize()
+	if err != nil {
+		return options, "", "", nil, err
 	}
+	options.Compression = compression
 	options.Manifest = snapshotManifest(options.Manifest)
 	auditHash, err := manifestHash(options.Manifest)
 	if err != nil {
-		return options, "", "", err
+		return options, "", "", nil, err
 	}
-	destination, err := filepath.Abs(options.Destination)
+	location := options.Destination
+	if storage.IsRemote(location) {
+		if options.Base != "" {
+			return options, "", "", nil, errors.New("remote backups cannot have a base backup")
+		}
+		location = options.Staging
+		if location == "" {
+			location = defaultStagingDirectory(options.Destination)
+		}
+	}
+	destination, err := filepath.Abs(location)
 	if err != nil {
-		return options, "", "", err
+		return options, "", "", nil, err
 	}
 	if err := validateSourceDestinationOverlap(destination, options.Manifest.Repositories); err != nil {
-		return options, "", "", err
+		return options, "", "", nil, err
 	}
 	if err := rejectSymlinkRoot(destination); err != nil {
-		return options, "", "", err
+		return options, "", "", nil, err
 	}
 	if err := os.MkdirAll(destination, 0o755); err != nil {
-		return options, "", "", err
+		return options, "", "", nil, err
 	}
 	seenRepositories := make(map[string]bool)
 	for _, repository := range options.Manifest.Repositories {
 		if repository.ID == "" || seenRepositories[repository.ID] {
-			return options, "", "", fmt.Errorf("manifest contains duplicate or empty repository ID %q", repository.ID)
+			return options, "", "", nil, fmt.Errorf("manifest contains duplicate or empty repository ID %q", repository.ID)
 		}
 		seenRepositories[repository.ID] = true
 		switch repository.Classification {
 		case ClassificationRecloneable:
 			if repository.RemoteState != RemoteStateReachable {
-				return options, "", "", fmt.Errorf("recloneable repository %q does not have a verified remote", repository.ID)
+				return options, "", "", nil, fmt.Errorf("recloneable repository %q does not have a verified remote", repository.ID)
+			}
+		case ClassificationDelta:
+			if err := validateLFSObjects(repository); err != nil {
+				return options, "", "", nil, err
 			}
-		case ClassificationDelta, ClassificationFull:
+		case ClassificationFull:
 		default:
-			return options, "", "", fmt.Errorf("repository %q has unsupported classification %q", repository.ID, repository.Classification)
+			return options, "", "", nil, fmt.Errorf("repository %q has unsupported classification %q", repository.ID, repository.Classification)
 		}
 	}
-	return options, destination, auditHash, nil
+	if options.ChunkStore != "" {
+		chunkStore, err := prepareChunkStore(options)
+		if err != nil {
+			return options, "", "", nil, err
+		}
+		options.ChunkStore = chunkStore
+	}
+	base, err := prepareCreateBase(destination, options.Base)
+	if err != nil {
+		return options, "", "", nil, err
+	}
+	return options, destination, auditHash, base, nil
+}
+
+func prepareChunkStore(options CreateOptions) (string, error) {
+	switch {
+	case storage.IsRemote(options.Destination):
+		return "", errors.New("remote backups cannot use a chunk store")
+	case options.Base != "":
+		return "", errors.New("chunked backups cannot have a base backup")
+	case options.Encryption.enabled():
+		return "", errors.New("chunked backups cannot be encrypted")
+	}
+	chunkStore, err := filepath.Abs(options.ChunkStore)
+	if err != nil {
+		return "", err
+	}
+	if err := validateSourceDestinationOverlap(chunkStore, options.Manifest.Repositories); err != nil {
+		return "", err
+	}
+	if err := rejectSymlinkRoot(chunkStore); err != nil {
+		return "", err
+	}
+	return chunkStore, os.MkdirAll(chunkStore, 0o755)
+}
+
+func prepareCreateBase(destination, path string) (*BackupBase, error) {
+	if path == "" {
+		return nil, nil
+	}
+	link, err := openBaseBackup(path)
+	if err != nil {
+		return nil, err
+	}
+	baseCanonical, err := canonicalPath(link.Destination)
+	if err != nil {
+		return nil, err
+	}
+	destinationCanonical, err := canonicalPath(destination)
+	if err != nil {
+		return nil, err
+	}
+	if baseCanonical == destinationCanonical {
+		return nil, errors.New("backup destination cannot be its own base")
+	}
+	digest, err := backupMetadataDigest(link.Destination)
+	if err != nil {
+		return nil, err
+	}
+	return &BackupBase{Path: link.Destination, SHA256: digest}, nil
 }
 
-func openOrInitialize(destination string, manifest Manifest, auditHash string) (BackupMetadata, error) {
+// openOrInitialize resumes the backup in destination or starts a new one. A
+// passphrase backup keeps the key of the backup it resumes or, when it can be
+// unlocked, of its base, so every backup in a chain shares one key.
+func openOrInitialize(
+	destination string,
+	manifest Manifest,
+	auditHash string,
+	base *BackupBase,
+	encryption Encryption,
+	chunkStore string,
+) (BackupMetadata, age.Recipient, error) {
 	metadataPath := filepath.Join(destination, "backup.json")
 	metadata, metadataErr := readBackupMetadata(metadataPath)
 	if metadataErr == nil {
 		if metadata.SourceAuditHash != auditHash {
-			return metadata, errors.New("backup destination belongs to a different audit manifest")
+			return metadata, nil, errors.New("backup destination belongs to a different audit manifest")
+		}
+		if !reflect.DeepEqual(metadata.Base, base) {
+			return metadata, nil, errors.New("backup destination was started with a different base backup")
+		}
+		if metadata.ChunkStore != chunkStore {
+			return metadata, nil, errors.New("backup destination was started with a different chunk store")
 		}
-		return metadata, nil
+		settings, recipient, err := prepareEncryption(encryption, metadata.Encryption)
+		if err != nil {
+			return metadata, nil, err
+		}
+		if !sameEncryption(metadata.Encryption, settings) {
+			return metadata, nil, errors.New("backup destination was started with different encryption")
+		}
+		return metadata, recipient, nil
 	}
 	if !errors.Is(metadataErr, os.ErrNotExist) {
-		return metadata, metadataErr
+		return metadata, nil, metadataErr
 	}
 	entries, err := os.ReadDir(destination)
 	if err != nil {
-		return metadata, err
+		return metadata, nil, err
 	}
 	for _, entry := range entries {
 		if entry.Type().IsRegular() && strings.HasPrefix(entry.Name(), ".fbackup-") && strings.HasSuffix(entry.Name(), ".tmp") {
 			if err := os.Remove(filepath.Join(destination, entry.Name())); err != nil {
-				return metadata, err
+				return metadata, nil, err
 			}
 			continue
 		}
-		return metadata, errors.New("backup destination is not empty")
+		return metadata, nil, errors.New("backup destination is not empty")
+	}
+
+	var baseEncryption *BackupEncryption
+	if base != nil {
+		link, err := openBaseBackup(base.Path)
+		if err != nil {
+			return metadata, nil, err
+		}
+		baseEncryption = link.Metadata.Encryption
+	}
+	settings, recipient, err := prepareEncryption(encryption, baseEncryption)
+	if err != nil {
+		return metadata, nil, err
+	}
+	if base != nil && !sameEncryption(baseEncryption, settings) {
+		return metadata, nil, errors.New("base backup uses different encryption")
 	}
 	return BackupMetadata{
 		SchemaVersion:   BackupSchemaVersion,
 		SourceAuditHash: auditHash,
 		CreatedAt:       time.Now().UTC(),
+		Base:            base,
+		Encryption:      settings,
+		ChunkStore:      chunkStore,
 		Manifest:        manifest,
-	}, nil
+	}, recipient, nil
+}
+
+func createRepositories(ctx context.Context, destination string, options CreateOptions, checkpoint *createCheckpoint) error {
+	repositories := options.Manifest.Repositories
+	workers := min(max(options.Workers, 1), len(repositories))
+	if workers <= 1 {
+		for _, repository := range repositories {
+			if err := createOneRepository(ctx, destination, repository, options.GitRunner, checkpoint); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errMu    sync.Mutex
+		firstErr error
+	)
+	jobs := make(chan RepositoryEntry)
+	wg.Add(workers)
+	for range workers {
+		go func() {
+			defer wg.Done()
+			for repository := range jobs {
+				if err := createOneRepository(ctx, destination, repository, options.GitRunner, checkpoint); err != nil {
+					errMu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					errMu.Unlock()
+					cancel()
+				}
+			}
+		}()
+	}
+
+dispatch:
+	for _, repository := range repositories {
+		select {
+		case <-ctx.Done():
+			break dispatch
+		case jobs <- repository:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+func createOneRepository(
+	ctx context.Context,
+	destination string,
+	repository RepositoryEntry,
+	runner gitinspect.StreamingRunner,
+	checkpoint *createCheckpoint,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	checkpoint.report(repository.ID, "starting")
+	if err := validateMetadataOnlyRepository(ctx, repository, runner); err != nil {
+		return err
+	}
+	return createRepository(ctx, destination, repository, checkpoint, runner)
 }
 
 func repositoryDirName(id string) string {
@@ -157,14 +437,11 @@ func createRepository(
 	ctx context.Context,
 	destination string,
 	repository RepositoryEntry,
-	metadata *BackupMetadata,
+	checkpoint *createCheckpoint,
 	runner gitinspect.StreamingRunner,
-	progress func(string, string),
 ) error {
 	if repository.Classification == ClassificationRecloneable {
-		if progress != nil {
-			progress(repository.ID, "complete")
-		}
+		checkpoint.report(repository.ID, "complete")
 		return nil
 	}
 
@@ -179,22 +456,53 @@ func createRepository(
 			struct{ kind, name string }{"bundle", "repository.bundle"},
 			struct{ kind, name string }{"index-patch", "index.patch"},
 			struct{ kind, name string }{"patch", "tracked.patch"},
-			struct{ kind, name string }{"untracked", "untracked.tar.gz"},
+			struct{ kind, name string }{"untracked", checkpoint.compression.tarName("untracked")},
+		)
+		if len(repository.MissingLFSObjects) > 0 {
+			specifications = append(specifications, struct{ kind, name string }{"lfs", checkpoint.compression.tarName("lfs")})
+		}
+		specifications = append(specifications,
+			struct{ kind, name string }{"stash", "stash.json"},
+			struct{ kind, name string }{"worktrees", checkpoint.compression.tarName("worktrees")},
+			struct{ kind, name string }{"local-config", checkpoint.compression.tarName("local-config")},
 		)
 	case ClassificationFull:
-		specifications = append(specifications, struct{ kind, name string }{"full", "full.tar.gz"})
+		specifications = append(specifications, struct{ kind, name string }{"full", checkpoint.compression.tarName("full")})
+	}
+	var local localState
+	if repository.Classification == ClassificationDelta {
+		var err error
+		if local, err = inspectLocalState(ctx, runner, repository.Path); err != nil {
+			return fmt.Errorf("inspect %q: %w", repository.ID, err)
+		}
 	}
 
 	for _, specification := range specifications {
 		if err := ctx.Err(); err != nil {
 			return err
 		}
-		if previous, ok := findArtifact(metadata.Artifacts, repository.ID, specification.kind); ok && verifyRecord(destination, previous) == nil {
+		if previous, ok := checkpoint.artifact(repository.ID, specification.kind); ok && checkpoint.chain.verifyRecord(ctx, previous) == nil {
 			continue
 		}
 
 		relativePath := filepath.ToSlash(filepath.Join(base, specification.name))
 		destinationPath := filepath.Join(destination, filepath.FromSlash(relativePath))
+		// Stash entries below the newest are not refs, so a base bundle that
+		// matches the refs may still lack them.
+		if specification.kind == "bundle" && len(local.stashes) <= 1 && checkpoint.chain.unchangedSinceBase(repository) {
+			record, ok, err := checkpoint.chain.reuseBaseArtifact(ctx, repository.ID, specification.kind, relativePath, destinationPath)
+			if err != nil {
+				return err
+			}
+			if ok {
+				if err := checkpoint.publish(record); err != nil {
+					return err
+				}
+				checkpoint.report(repository.ID, specification.kind)
+				continue
+			}
+		}
+
 		temporary, err := os.CreateTemp(filepath.Dir(destinationPath), ".artifact-*.tmp")
 		if err != nil {
 			return err
@@ -202,18 +510,37 @@ func createRepository(
 		temporaryPath := temporary.Name()
 		_ = temporary.Close()
 
-		var writeErr error
-		switch specification.kind {
-		case "bundle":
-			_, writeErr = runner.Run(ctx, repository.Path, "bundle", "create", temporaryPath, "--all")
-		case "index-patch":
-			writeErr = runGitToFile(ctx, runner, repository.Path, temporaryPath, "diff", "--cached", "--binary", "HEAD")
-		case "patch":
-			writeErr = runGitToFile(ctx, runner, repository.Path, temporaryPath, "diff", "--binary")
-		case "untracked":
-			writeErr = writeUntrackedTar(ctx, runner, repository.Path, temporaryPath)
-		case "full":
-			writeErr = writeFullTar(ctx, repository.Path, temporaryPath)
+		record := ArtifactRecord{RepositoryID: repository.ID, Kind: specification.kind, Path: relativePath, Codec: CodecNone}
+		output, writeErr := createArtifactFile(temporaryPath, checkpoint.recipient)
+		if writeErr == nil {
+			switch specification.kind {
+			case "bundle":
+				record.Incremental, record.Refs, writeErr = writeBundle(ctx, runner, checkpoint.chain, repository, local.revisions(), output, checkpoint.recipient != nil)
+			case "index-patch":
+				_, writeErr = runner.RunTo(ctx, repository.Path, output, "diff", "--cached", "--binary", "HEAD")
+			case "patch":
+				_, writeErr = runner.RunTo(ctx, repository.Path, output, "diff", "--binary")
+			case "untracked":
+				record.Codec = checkpoint.compression.Codec
+				writeErr = writeUntrackedTar(ctx, runner, repository.Path, output, checkpoint.compression)
+			case "full":
+				record.Codec = checkpoint.compression.Codec
+				writeErr = writeFullTar(ctx, repository.Path, output, checkpoint.compression)
+			case "lfs":
+				record.Codec = checkpoint.compression.Codec
+				writeErr = writeLFSTar(ctx, runner, repository, output, checkpoint.compression)
+			case "stash":
+				writeErr = writeStashList(local, output)
+			case "worktrees":
+				record.Codec = checkpoint.compression.Codec
+				writeErr = writeWorktreesTar(ctx, runner, local, output, checkpoint.compression)
+			case "local-config":
+				record.Codec = checkpoint.compression.Codec
+				writeErr = writeLocalConfigTar(ctx, runner, repository.Path, output, checkpoint.compression)
+			}
+			if closeErr := output.Close(); writeErr == nil {
+				writeErr = closeErr
+			}
 		}
 		if writeErr != nil {
 			if ctx.Err() == nil {
@@ -221,33 +548,42 @@ func createRepository(
 			}
 			return fmt.Errorf("create %s for %q: %w", specification.kind, repository.ID, writeErr)
 		}
-		size, digest, err := hashFile(temporaryPath)
+		record.Size, record.SHA256, err = hashFile(temporaryPath)
 		if err != nil {
 			_ = os.Remove(temporaryPath)
 			return err
 		}
-		if err := os.Rename(temporaryPath, destinationPath); err != nil {
+		// Chunked artifacts move into the chunk store and remote artifacts are
+		// uploaded as soon as they are finished. Otherwise identical content
+		// already stored by the base is linked instead of being kept twice.
+		if chunkStore := checkpoint.chain[0].Metadata.ChunkStore; chunkStore != "" {
+			record.Chunks, err = storeArtifactChunks(ctx, chunkStore, temporaryPath)
+			_ = os.Remove(temporaryPath)
+			if err != nil {
+				return fmt.Errorf("store %s chunks for %q: %w", specification.kind, repository.ID, err)
+			}
+		} else if checkpoint.store != nil {
+			if err := uploadArtifact(ctx, checkpoint.store, temporaryPath, relativePath); err != nil {
+				if ctx.Err() == nil {
+					_ = os.Remove(temporaryPath)
+				}
+				return fmt.Errorf("upload %s for %q: %w", specification.kind, repository.ID, err)
+			}
+		} else if linked, err := checkpoint.chain.linkIdenticalBaseArtifact(ctx, record, destinationPath); err != nil {
 			_ = os.Remove(temporaryPath)
 			return err
-		}
-		record := ArtifactRecord{
-			RepositoryID: repository.ID,
-			Kind:         specification.kind,
-			Path:         relativePath,
-			Size:         size,
-			SHA256:       digest,
-		}
-		upsertArtifact(metadata, record)
-		if err := writeJSONAtomic(filepath.Join(destination, "backup.json"), metadata, 0o644); err != nil {
+		} else if linked {
+			_ = os.Remove(temporaryPath)
+		} else if err := os.Rename(temporaryPath, destinationPath); err != nil {
+			_ = os.Remove(temporaryPath)
 			return err
 		}
-		if progress != nil {
-			progress(repository.ID, specification.kind)
+		if err := checkpoint.publish(record); err != nil {
+			return err
 		}
+		checkpoint.report(repository.ID, specification.kind)
 	}
-	if progress != nil {
-		progress(repository.ID, "complete")
-	}
+	checkpoint.report(repository.ID, "complete")
 	return nil
 }
 
@@ -9,8 +9,11 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestCreateFullIncludesGitAndLFSData(t *testing.T) {
@@ -167,3 +170,104 @@ func TestCreateCheckpointsBeforeFirstArtifact(t *testing.T) {
 		t.Fatalf("Create() could not resume initial checkpoint: %v", err)
 	}
 }
+
+func TestCreateWithWorkersCheckpointsEveryRepository(t *testing.T) {
+	root := t.TempDir()
+	repositories := make([]RepositoryEntry, 0, 6)
+	for index := range 6 {
+		repo := filepath.Join(root, "src", strconv.Itoa(index))
+		mustGitTest(t, root, "init", "-q", repo)
+		if err := os.WriteFile(filepath.Join(repo, "file"), []byte(strconv.Itoa(index)), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		repositories = append(repositories, RepositoryEntry{ID: "full/" + strconv.Itoa(index), Path: repo, Classification: ClassificationFull})
+	}
+	manifest := Manifest{Version: ManifestVersion, Repositories: repositories}
+	destination := filepath.Join(root, "backup")
+	var mu sync.Mutex
+	completed := make(map[string]bool)
+	options := CreateOptions{Destination: destination, Manifest: manifest, Workers: 4, Progress: func(id, status string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if status == "complete" {
+			completed[id] = true
+		}
+	}}
+	if err := Create(context.Background(), options); err != nil {
+		t.Fatal(err)
+	}
+	if len(completed) != len(repositories) {
+		t.Fatalf("completed repositories = %v", completed)
+	}
+	metadata, err := readBackupMetadata(filepath.Join(destination, "backup.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !metadata.Complete || len(metadata.Artifacts) != len(repositories) {
+		t.Fatalf("metadata complete = %v, artifacts = %d", metadata.Complete, len(metadata.Artifacts))
+	}
+	if err := Verify(context.Background(), destination, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// An interrupted parallel run resumes from whatever subset reached the
+	// checkpoint, without rewriting artifacts that were already published.
+	second := filepath.Join(root, "second")
+	ctx, cancel := context.WithCancel(context.Background())
+	published := 0
+	options = CreateOptions{Destination: second, Manifest: manifest, Workers: 3, Progress: func(_, status string) {
+		if status == "full" {
+			published++
+			if published == 2 {
+				cancel()
+			}
+		}
+	}}
+	if err := Create(ctx, options); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Create() after cancel error = %v", err)
+	}
+	metadata, err = readBackupMetadata(filepath.Join(second, "backup.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Complete || len(metadata.Artifacts) < 2 {
+		t.Fatalf("interrupted checkpoint complete = %v, artifacts = %d", metadata.Complete, len(metadata.Artifacts))
+	}
+	type publishedArtifact struct {
+		modTime time.Time
+		digest  string
+	}
+	before := make(map[string]publishedArtifact, len(metadata.Artifacts))
+	for _, record := range metadata.Artifacts {
+		path := filepath.Join(second, record.Path)
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, digest, err := hashFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		before[record.Path] = publishedArtifact{modTime: info.ModTime(), digest: digest}
+	}
+	options.Progress = nil
+	if err := Create(context.Background(), options); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(context.Background(), second, true); err != nil {
+		t.Fatal(err)
+	}
+	for path, artifact := range before {
+		info, err := os.Stat(filepath.Join(second, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, digest, err := hashFile(filepath.Join(second, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(artifact.modTime) || digest != artifact.digest {
+			t.Fatalf("resume rewrote published artifact %s", path)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package fbackup
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/zbiljic/fget/pkg/gitinspect"
+)
+
+// Repository states reported by DiffManifests.
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// ManifestDiff lists the repositories that differ between two manifests,
+// sorted by ID. Unchanged repositories are omitted.
+type ManifestDiff struct {
+	From         string           `json:"from"`
+	To           string           `json:"to"`
+	Repositories []RepositoryDiff `json:"repositories"`
+}
+
+// RepositoryDiff describes one repository. Classification is the newest known
+// classification: the new one, or the old one for removed repositories.
+type RepositoryDiff struct {
+	ID             string         `json:"id"`
+	Status         string         `json:"status"`
+	Classification Classification `json:"classification"`
+	Changes        []FieldChange  `json:"changes,omitempty"`
+}
+
+// FieldChange is one changed manifest field, with values formatted as text.
+// Counts and sizes also carry their signed difference.
+type FieldChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Delta *int64 `json:"delta,omitempty"`
+}
+
+// ReadManifest reads an audit manifest from a manifest JSON file, a
+// backup.json file, or a backup directory.
+func ReadManifest(path string) (Manifest, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Manifest{}, err
+	}
+	if info.IsDir() {
+		path = filepath.Join(path, "backup.json")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Manifest{}, err
+	}
+	var probe struct {
+		SchemaVersion string `json:"schema_version"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return Manifest{}, fmt.Errorf("decode %s: %w", path, err)
+	}
+	var manifest Manifest
+	if probe.SchemaVersion != "" {
+		metadata, err := decodeBackupMetadata(data)
+		if err != nil {
+			return Manifest{}, err
+		}
+		manifest = metadata.Manifest
+	} else if err := json.Unmarshal(data, &manifest); err != nil {
+		return Manifest{}, fmt.Errorf("decode manifest: %w", err)
+	}
+	if manifest.Version != ManifestVersion {
+		return Manifest{}, fmt.Errorf("unsupported manifest version %q in %s", manifest.Version, path)
+	}
+	return manifest, nil
+}
+
+// DiffManifests compares two audit manifests by repository ID.
+func DiffManifests(from, to Manifest) ManifestDiff {
+	before := make(map[string]RepositoryEntry, len(from.Repositories))
+	for _, repository := range from.Repositories {
+		before[repository.ID] = repository
+	}
+	after := make(map[string]RepositoryEntry, len(to.Repositories))
+	for _, repository := range to.Repositories {
+		after[repository.ID] = repository
+	}
+
+	diff := ManifestDiff{Repositories: []RepositoryDiff{}}
+	for id, repository := range after {
+		previous, ok := before[id]
+		if !ok {
+			diff.Repositories = append(diff.Repositories, RepositoryDiff{
+				ID:             id,
+				Status:         DiffAdded,
+				Classification: repository.Classification,
+			})
+			continue
+		}
+		if changes := diffRepository(previous, repository); len(changes) > 0 {
+			diff.Repositories = append(diff.Repositories, RepositoryDiff{
+				ID:             id,
+				Status:         DiffChanged,
+				Classification: repository.Classification,
+				Changes:        changes,
+			})
+		}
+	}
+	for id, repository := range before {
+		if _, ok := after[id]; !ok {
+			diff.Repositories = append(diff.Repositories, RepositoryDiff{
+				ID:             id,
+				Status:         DiffRemoved,
+				Classification: repository.Classification,
+			})
+		}
+	}
+	sort.Slice(diff.Repositories, func(i, j int) bool {
+		return diff.Repositories[i].ID < diff.Repositories[j].ID
+	})
+	return diff
+}
+
+func diffRepository(from, to RepositoryEntry) []FieldChange {
+	var changes []FieldChange
+	text := func(field, a, b string) {
+		if a != b {
+			changes = append(changes, FieldChange{Field: field, From: a, To: b})
+		}
+	}
+	count := func(field string, a, b int64) {
+		if a != b {
+			delta := b - a
+			changes = append(changes, FieldChange{
+				Field: field,
+				From:  strconv.FormatInt(a, 10),
+				To:    strconv.FormatInt(b, 10),
+				Delta: &delta,
+			})
+		}
+	}
+
+	text("classification", string(from.Classification), string(to.Classification))
+	text("remote_state", string(from.RemoteState), string(to.RemoteState))
+	text("head.ref", from.Git.Head.Ref, to.Git.Head.Ref)
+	text("head.commit", from.Git.Head.Commit, to.Git.Head.Commit)
+	fromUpstream, toUpstream := upstreamOrEmpty(from.Git.Upstream), upstreamOrEmpty(to.Git.Upstream)
+	text("upstream.ref", fromUpstream.Ref, toUpstream.Ref)
+	text("upstream.commit", fromUpstream.Commit, toUpstream.Commit)
+	count("local_only_commit_count", int64(from.LocalOnlyCommitCount), int64(to.LocalOnlyCommitCount))
+	count("untracked_bytes", from.UntrackedBytes, to.UntrackedBytes)
+	return changes
+}
+
+func upstreamOrEmpty(upstream *gitinspect.Reference) gitinspect.Reference {
+	if upstream == nil {
+		return gitinspect.Reference{}
+	}
+	return *upstream
+}
@@ -0,0 +1,100 @@
+package fbackup
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/zbiljic/fget/pkg/gitinspect"
+)
+
+func TestDiffManifestsReportsRepositoryChanges(t *testing.T) {
+	from := Manifest{Version: ManifestVersion, Repositories: []RepositoryEntry{
+		{ID: "github.com/acme/gone", Classification: ClassificationDelta},
+		{ID: "github.com/acme/same", Classification: ClassificationRecloneable, RemoteState: RemoteStateReachable},
+		{
+			ID:                   "github.com/acme/work",
+			Classification:       ClassificationRecloneable,
+			RemoteState:          RemoteStateReachable,
+			Git:                  gitinspect.State{Head: gitinspect.Reference{Ref: "refs/heads/main", Commit: "aaa"}},
+			UntrackedBytes:       100,
+			LocalOnlyCommitCount: 0,
+		},
+	}}
+	to := Manifest{Version: ManifestVersion, Repositories: []RepositoryEntry{
+		{ID: "github.com/acme/new", Classification: ClassificationFull},
+		{ID: "github.com/acme/same", Classification: ClassificationRecloneable, RemoteState: RemoteStateReachable},
+		{
+			ID:             "github.com/acme/work",
+			Classification: ClassificationDelta,
+			RemoteState:    RemoteStateReachable,
+			Git: gitinspect.State{
+				Head:     gitinspect.Reference{Ref: "refs/heads/main", Commit: "bbb"},
+				Upstream: &gitinspect.Reference{Ref: "refs/remotes/origin/main", Commit: "aaa"},
+			},
+			UntrackedBytes:       40,
+			LocalOnlyCommitCount: 2,
+		},
+	}}
+
+	diff := DiffManifests(from, to)
+	var statuses []string
+	for _, repository := range diff.Repositories {
+		statuses = append(statuses, repository.ID+" "+repository.Status)
+	}
+	want := []string{"github.com/acme/gone removed", "github.com/acme/new added", "github.com/acme/work changed"}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Fatalf("DiffManifests() = %v, want %v", statuses, want)
+	}
+	changes := make(map[string]FieldChange)
+	for _, change := range diff.Repositories[2].Changes {
+		changes[change.Field] = change
+	}
+	if change := changes["classification"]; change.From != "recloneable" || change.To != "delta" {
+		t.Fatalf("classification change = %+v", change)
+	}
+	if change := changes["upstream.commit"]; change.From != "" || change.To != "aaa" {
+		t.Fatalf("upstream change = %+v", change)
+	}
+	if change := changes["untracked_bytes"]; change.Delta == nil || *change.Delta != -60 {
+		t.Fatalf("untracked bytes change = %+v", change)
+	}
+	if change := changes["local_only_commit_count"]; change.Delta == nil || *change.Delta != 2 {
+		t.Fatalf("local-only commit change = %+v", change)
+	}
+	if _, ok := changes["remote_state"]; ok || len(changes) != 6 {
+		t.Fatalf("changes = %+v, want six changed fields", changes)
+	}
+}
+
+func TestReadManifestAcceptsManifestsAndBackups(t *testing.T) {
+	root := t.TempDir()
+	manifest := Manifest{Version: ManifestVersion, Repositories: []RepositoryEntry{{ID: "github.com/acme/work"}}}
+	manifestPath := filepath.Join(root, "audit.json")
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(manifestPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	backup := writePruneBackup(t, root, "backup", manifest.GeneratedAt, true, "", "github.com/acme/work")
+
+	for _, path := range []string{manifestPath, backup, filepath.Join(backup, "backup.json")} {
+		got, err := ReadManifest(path)
+		if err != nil {
+			t.Fatalf("ReadManifest(%s) error = %v", path, err)
+		}
+		if len(got.Repositories) != 1 || got.Repositories[0].ID != "github.com/acme/work" {
+			t.Fatalf("ReadManifest(%s) = %+v", path, got)
+		}
+	}
+	if err := os.WriteFile(manifestPath, []byte(`{"version":"0"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadManifest(manifestPath); err == nil {
+		t.Fatal("ReadManifest() accepted an unsupported manifest version")
+	}
+}
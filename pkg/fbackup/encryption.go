@@ -0,0 +1,287 @@
+package fbackup
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+)
+
+const encryptionFormatAge = "age"
+
+// passphraseWorkFactor is the scrypt work factor protecting the key of a
+// passphrase-encrypted backup, the default of the age command line tool.
+// Tests lower it.
+var passphraseWorkFactor = 18
+
+var errBackupLocked = errors.New("backup is encrypted; an identity or passphrase is required")
+
+// Encryption selects how Create encrypts artifacts. Set at most one field.
+// A passphrase protects a key generated for the backup, so it is stretched
+// once per run rather than once per artifact.
+type Encryption struct {
+	// Recipient is an age X25519 public key ("age1...").
+	Recipient  string
+	Passphrase string
+}
+
+// Keys unlock an encrypted backup for deep verification and restore.
+type Keys struct {
+	Identities []age.Identity
+	Passphrase string
+}
+
+// BackupEncryption records how artifacts were encrypted. Every artifact is an
+// age file encrypted to Recipient, and ArtifactRecord checksums cover the
+// ciphertext so shallow verification needs no key.
+type BackupEncryption struct {
+	Format      string `json:"format"`
+	Recipient   string `json:"recipient"`
+	Fingerprint string `json:"fingerprint"`
+	// PassphraseIdentity is the backup's age secret key, itself encrypted with
+	// the passphrase, when the backup was created with a passphrase.
+	PassphraseIdentity string `json:"passphrase_identity,omitempty"`
+}
+
+func (e Encryption) enabled() bool { return e.Recipient != "" || e.Passphrase != "" }
+
+func recipientFingerprint(recipient string) string {
+	return "sha256:" + hashBytes([]byte(recipient))
+}
+
+// prepareEncryption resolves the encryption settings of a new or resumed
+// backup. A resumed passphrase backup keeps its existing key.
+func prepareEncryption(options Encryption, existing *BackupEncryption) (*BackupEncryption, age.Recipient, error) {
+	switch {
+	case !options.enabled():
+		return nil, nil, nil
+	case options.Recipient != "" && options.Passphrase != "":
+		return nil, nil, errors.New("set either an encryption recipient or a passphrase, not both")
+	case options.Recipient != "":
+		recipient, err := age.ParseX25519Recipient(strings.TrimSpace(options.Recipient))
+		if err != nil {
+			return nil, nil, err
+		}
+		return &BackupEncryption{
+			Format:      encryptionFormatAge,
+			Recipient:   recipient.String(),
+			Fingerprint: recipientFingerprint(recipient.String()),
+		}, recipient, nil
+	}
+
+	if existing != nil && existing.PassphraseIdentity != "" {
+		identity, err := unlockPassphraseIdentity(existing, options.Passphrase)
+		if err != nil {
+			return nil, nil, err
+		}
+		return existing, identity.Recipient(), nil
+	}
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		return nil, nil, err
+	}
+	wrapper, err := age.NewScryptRecipient(options.Passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+	wrapper.SetWorkFactor(passphraseWorkFactor)
+	var wrapped bytes.Buffer
+	writer, err := age.Encrypt(&wrapped, wrapper)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := io.WriteString(writer, identity.String()); err != nil {
+		return nil, nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, nil, err
+	}
+	recipient := identity.Recipient().String()
+	return &BackupEncryption{
+		Format:             encryptionFormatAge,
+		Recipient:          recipient,
+		Fingerprint:        recipientFingerprint(recipient),
+		PassphraseIdentity: base64.StdEncoding.EncodeToString(wrapped.Bytes()),
+	}, identity.Recipient(), nil
+}
+
+func unlockPassphraseIdentity(encryption *BackupEncryption, passphrase string) (*age.X25519Identity, error) {
+	wrapped, err := base64.StdEncoding.DecodeString(encryption.PassphraseIdentity)
+	if err != nil {
+		return nil, fmt.Errorf("decode passphrase-protected key: %w", err)
+	}
+	unwrapper, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := age.Decrypt(bytes.NewReader(wrapped), unwrapper)
+	if errors.Is(err, age.ErrIncorrectIdentity) {
+		return nil, errors.New("passphrase does not unlock this backup")
+	}
+	if err != nil {
+		return nil, err
+	}
+	secret, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := age.ParseX25519Identity(string(secret))
+	if err != nil {
+		return nil, err
+	}
+	if identity.Recipient().String() != encryption.Recipient {
+		return nil, errors.New("passphrase-protected key does not match the backup recipient")
+	}
+	return identity, nil
+}
+
+func sameEncryption(a, b *BackupEncryption) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Fingerprint == b.Fingerprint
+}
+
+// unlock selects, for every encrypted backup in the chain, the keys that
+// match its recipient. Keys that match nothing are an error; a chain without
+// keys stays locked and only fails when an artifact is opened.
+func (c backupChain) unlock(keys Keys) error {
+	if len(keys.Identities) == 0 && keys.Passphrase == "" {
+		return nil
+	}
+	for index := range c {
+		encryption := c[index].Metadata.Encryption
+		if encryption == nil {
+			continue
+		}
+		var identities []age.Identity
+		for _, identity := range keys.Identities {
+			if x25519, ok := identity.(*age.X25519Identity); ok && x25519.Recipient().String() == encryption.Recipient {
+				identities = append(identities, identity)
+			}
+		}
+		if keys.Passphrase != "" && encryption.PassphraseIdentity != "" {
+			identity, err := unlockPassphraseIdentity(encryption, keys.Passphrase)
+			if err != nil {
+				return err
+			}
+			identities = append(identities, identity)
+		}
+		if len(identities) == 0 {
+			return fmt.Errorf("no key matches backup encryption fingerprint %s", encryption.Fingerprint)
+		}
+		c[index].identities = identities
+	}
+	return nil
+}
+
+type artifactReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// open returns a reader of the plaintext of record, decrypting on the fly.
+func (c backupChain) open(ctx context.Context, record ArtifactRecord) (io.ReadCloser, error) {
+	stored, level, path, err := c.resolve(record)
+	if err != nil {
+		return nil, err
+	}
+	file, err := c.openStored(ctx, level, stored, path)
+	if err != nil {
+		return nil, err
+	}
+	if c[level].Metadata.Encryption == nil {
+		return file, nil
+	}
+	if len(c[level].identities) == 0 {
+		_ = file.Close()
+		return nil, errBackupLocked
+	}
+	plaintext, err := age.Decrypt(file, c[level].identities...)
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("decrypt artifact %q %s: %w", record.RepositoryID, record.Kind, err)
+	}
+	return artifactReadCloser{Reader: plaintext, Closer: file}, nil
+}
+
+// materialize returns a plaintext file for Git commands that need a path.
+// Encrypted, remote, and chunked artifacts are copied into a temporary file
+// outside the backup, which cleanup removes.
+func (c backupChain) materialize(ctx context.Context, record ArtifactRecord) (string, func(), error) {
+	stored, level, path, err := c.resolve(record)
+	if err != nil {
+		return "", nil, err
+	}
+	if c[level].Metadata.Encryption == nil && c[level].store == nil && len(stored.Chunks) == 0 {
+		return path, func() {}, nil
+	}
+	reader, err := c.open(ctx, record)
+	if err != nil {
+		return "", nil, err
+	}
+	defer func() { _ = reader.Close() }()
+	file, err := os.CreateTemp("", "fbackup-"+filepath.Base(record.Path)+"-*")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { _ = os.Remove(file.Name()) }
+	_, copyErr := io.Copy(file, reader)
+	closeErr := file.Close()
+	if copyErr == nil {
+		copyErr = closeErr
+	}
+	if copyErr != nil {
+		cleanup()
+		return "", nil, copyErr
+	}
+	return file.Name(), cleanup, nil
+}
+
+// artifactFile is a temporary artifact file being written. Close flushes any
+// encryption, syncs, and closes the file.
+type artifactFile struct {
+	file      *os.File
+	writer    io.Writer
+	encrypter io.WriteCloser
+}
+
+func createArtifactFile(path string, recipient age.Recipient) (*artifactFile, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	artifact := &artifactFile{file: file, writer: file}
+	if recipient != nil {
+		artifact.encrypter, err = age.Encrypt(file, recipient)
+		if err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+		artifact.writer = artifact.encrypter
+	}
+	return artifact, nil
+}
+
+func (a *artifactFile) Write(p []byte) (int, error) { return a.writer.Write(p) }
+
+func (a *artifactFile) Close() error {
+	var err error
+	if a.encrypter != nil {
+		err = a.encrypter.Close()
+	}
+	if err == nil {
+		err = a.file.Sync()
+	}
+	if closeErr := a.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,166 @@
+package fbackup
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func newEncryptedDeltaManifest(t *testing.T) (Manifest, string) {
+	t.Helper()
+	entry := newRecloneableRepository(t, "example/secret")
+	repo := entry.Path
+	if err := os.WriteFile(filepath.Join(repo, "secret.txt"), []byte("committed\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	mustGitTest(t, repo, "add", "secret.txt")
+	mustGitTest(t, repo, "commit", "-qm", "local-only")
+	if err := os.WriteFile(filepath.Join(repo, "secret.txt"), []byte("staged\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	mustGitTest(t, repo, "add", "secret.txt")
+	if err := os.WriteFile(filepath.Join(repo, "secret.txt"), []byte("worktree\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "untracked.txt"), []byte("untracked\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	entry.Classification = ClassificationDelta
+	inspectEntryState(t, &entry)
+	return Manifest{Version: ManifestVersion, Repositories: []RepositoryEntry{entry}}, repo
+}
+
+func TestCreateEncryptedWithRecipient(t *testing.T) {
+	root := t.TempDir()
+	manifest, repo := newEncryptedDeltaManifest(t)
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient := identity.Recipient().String()
+
+	destination := filepath.Join(root, "backup")
+	options := CreateOptions{Destination: destination, Manifest: manifest, Encryption: Encryption{Recipient: recipient}}
+	if err := Create(context.Background(), options); err != nil {
+		t.Fatal(err)
+	}
+	metadata, err := readBackupMetadata(filepath.Join(destination, "backup.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Encryption == nil || metadata.Encryption.Recipient != recipient || metadata.Encryption.Fingerprint != recipientFingerprint(recipient) {
+		t.Fatalf("Encryption = %+v, want recipient %s", metadata.Encryption, recipient)
+	}
+	for _, record := range metadata.Artifacts {
+		data, err := os.ReadFile(filepath.Join(destination, filepath.FromSlash(record.Path)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(data, []byte("age-encryption.org/v1\n")) || bytes.Contains(data, []byte("worktree")) {
+			t.Fatalf("artifact %s is not an age file", record.Kind)
+		}
+		if record.Kind == "bundle" && len(record.Refs) == 0 {
+			t.Fatal("encrypted bundle does not record its refs")
+		}
+	}
+
+	if err := Verify(context.Background(), destination, false); err != nil {
+		t.Fatalf("shallow Verify() without keys error = %v", err)
+	}
+	if err := Verify(context.Background(), destination, true); err == nil || !strings.Contains(err.Error(), "encrypted") {
+		t.Fatalf("deep Verify() without keys error = %v, want locked backup", err)
+	}
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyWithKeys(context.Background(), destination, true, Keys{Identities: []age.Identity{other}}); err == nil {
+		t.Fatal("deep Verify() with an unrelated identity succeeded")
+	}
+	keys := Keys{Identities: []age.Identity{other, identity}}
+	if err := VerifyWithKeys(context.Background(), destination, true, keys); err != nil {
+		t.Fatal(err)
+	}
+
+	target := filepath.Join(root, "restore")
+	if err := Restore(context.Background(), RestoreOptions{Backup: destination, Target: target, Keys: keys}); err != nil {
+		t.Fatal(err)
+	}
+	restored := filepath.Join(target, "example", "secret")
+	if got, want := gitOutputTest(t, restored, "status", "--porcelain"), gitOutputTest(t, repo, "status", "--porcelain"); got != want {
+		t.Fatalf("restored status = %q, want %q", got, want)
+	}
+	if got := gitOutputTest(t, restored, "show", ":secret.txt"); got != "staged\n" {
+		t.Fatalf("restored index = %q, want staged", got)
+	}
+
+	options.Encryption = Encryption{}
+	options.Destination = filepath.Join(root, "plain")
+	options.Base = destination
+	if err := Create(context.Background(), options); err == nil || !strings.Contains(err.Error(), "different encryption") {
+		t.Fatalf("Create() with an encrypted base and no encryption error = %v", err)
+	}
+}
+
+func TestCreateEncryptedWithPassphraseSharesKeyWithBase(t *testing.T) {
+	previous := passphraseWorkFactor
+	passphraseWorkFactor = 10
+	t.Cleanup(func() { passphraseWorkFactor = previous })
+
+	root := t.TempDir()
+	manifest, repo := newEncryptedDeltaManifest(t)
+	encryption := Encryption{Passphrase: "correct horse"}
+	first := filepath.Join(root, "first")
+	if err := Create(context.Background(), CreateOptions{Destination: first, Manifest: manifest, Encryption: encryption}); err != nil {
+		t.Fatal(err)
+	}
+
+	mustGitTest(t, repo, "commit", "-qm", "after-base")
+	inspectEntryState(t, &manifest.Repositories[0])
+	second := filepath.Join(root, "second")
+	options := CreateOptions{Destination: second, Manifest: manifest, Base: first, Encryption: encryption}
+	if err := Create(context.Background(), options); err != nil {
+		t.Fatal(err)
+	}
+	firstMetadata, err := readBackupMetadata(filepath.Join(first, "backup.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondMetadata, err := readBackupMetadata(filepath.Join(second, "backup.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secondMetadata.Encryption == nil || secondMetadata.Encryption.Fingerprint != firstMetadata.Encryption.Fingerprint {
+		t.Fatalf("incremental encryption = %+v, want the base key %+v", secondMetadata.Encryption, firstMetadata.Encryption)
+	}
+	if bundle, ok := findArtifact(secondMetadata.Artifacts, manifest.Repositories[0].ID, "bundle"); !ok || !bundle.Incremental {
+		t.Fatalf("second bundle = %+v, want an incremental bundle", bundle)
+	}
+
+	if err := VerifyWithKeys(context.Background(), second, true, Keys{Passphrase: "wrong"}); err == nil {
+		t.Fatal("deep Verify() with a wrong passphrase succeeded")
+	}
+	keys := Keys{Passphrase: encryption.Passphrase}
+	if err := VerifyWithKeys(context.Background(), second, true, keys); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(root, "restore")
+	if err := Restore(context.Background(), RestoreOptions{Backup: second, Target: target, Keys: keys}); err != nil {
+		t.Fatal(err)
+	}
+	restored := filepath.Join(target, "example", "secret")
+	if got, want := gitOutputTest(t, restored, "rev-parse", "HEAD"), gitOutputTest(t, repo, "rev-parse", "HEAD"); got != want {
+		t.Fatalf("restored HEAD = %q, want %q", got, want)
+	}
+
+	options.Encryption = Encryption{Passphrase: "another"}
+	options.Destination = filepath.Join(root, "third")
+	if err := Create(context.Background(), options); err == nil {
+		t.Fatal("Create() with a base locked by another passphrase succeeded")
+	}
+}
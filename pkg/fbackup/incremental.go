@@ -0,0 +1,217 @@
+package fbackup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/zbiljic/fget/pkg/gitinspect"
+)
+
+// baseArtifact returns the record the base backup holds for repositoryID and
+// kind, if the chain has a base.
+func (c backupChain) baseArtifact(repositoryID, kind string) (ArtifactRecord, bool) {
+	if len(c) < 2 {
+		return ArtifactRecord{}, false
+	}
+	return findArtifact(c[1].Metadata.Artifacts, repositoryID, kind)
+}
+
+// unchangedSinceBase reports whether the base backup audited the repository
+// with the same HEAD and local refs, so its bundle can be reused as-is.
+func (c backupChain) unchangedSinceBase(repository RepositoryEntry) bool {
+	if len(c) < 2 {
+		return false
+	}
+	for _, previous := range c[1].Metadata.Manifest.Repositories {
+		if previous.ID == repository.ID {
+			return previous.Git.Head == repository.Git.Head &&
+				previous.Git.LocalRefsDigest == repository.Git.LocalRefsDigest &&
+				previous.Git.LocalRefCount == repository.Git.LocalRefCount
+		}
+	}
+	return false
+}
+
+// reuseBaseArtifact publishes the base backup's artifact for this backup
+// without recreating it. Complete artifacts are hard-linked so this backup
+// stays self-contained; incremental bundles, and files on another device, are
+// referenced with InBase instead.
+func (c backupChain) reuseBaseArtifact(ctx context.Context, repositoryID, kind, relativePath, destinationPath string) (ArtifactRecord, bool, error) {
+	previous, ok := c.baseArtifact(repositoryID, kind)
+	if !ok {
+		return ArtifactRecord{}, false, nil
+	}
+	base := c[1:]
+	if err := base.verifyRecord(ctx, previous); err != nil {
+		return ArtifactRecord{}, false, nil
+	}
+	stored, _, path, err := base.resolve(previous)
+	if err != nil {
+		return ArtifactRecord{}, false, err
+	}
+	if !stored.Incremental {
+		_ = os.Remove(destinationPath)
+		if err := os.Link(path, destinationPath); err == nil {
+			record := stored
+			record.Path = relativePath
+			return record, true, nil
+		}
+	}
+	return ArtifactRecord{
+		RepositoryID: repositoryID,
+		Kind:         kind,
+		Path:         relativePath,
+		Size:         previous.Size,
+		SHA256:       previous.SHA256,
+		InBase:       true,
+	}, true, nil
+}
+
+// linkIdenticalBaseArtifact hard-links the base backup's file into place when
+// it has exactly the content of record. It reports false when there is
+// nothing to link or linking fails, leaving the caller to publish its own copy.
+func (c backupChain) linkIdenticalBaseArtifact(ctx context.Context, record ArtifactRecord, destinationPath string) (bool, error) {
+	previous, ok := c.baseArtifact(record.RepositoryID, record.Kind)
+	if !ok || record.Incremental || previous.Size != record.Size || !strings.EqualFold(previous.SHA256, record.SHA256) {
+		return false, nil
+	}
+	base := c[1:]
+	stored, _, path, err := base.resolve(previous)
+	if err != nil || stored.Incremental || base.verifyRecord(ctx, previous) != nil {
+		return false, nil
+	}
+	if err := os.Remove(destinationPath); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	return os.Link(path, destinationPath) == nil, nil
+}
+
+// writeBundle streams the repository bundle to output. When the base backup
+// has a bundle for the repository, only commits missing from it are written
+// and the returned refs hold the complete snapshot the bundle omits. Without
+// new commits there is nothing to write incrementally, so a complete bundle is
+// created instead. Complete bundles return their heads when recordRefs is set,
+// because encrypted bundles cannot be listed without the key. Extra revisions,
+// such as older stash entries, are packed without becoming bundle refs.
+func writeBundle(
+	ctx context.Context,
+	runner gitinspect.StreamingRunner,
+	chain backupChain,
+	repository RepositoryEntry,
+	extra []string,
+	output io.Writer,
+	recordRefs bool,
+) (bool, map[string]string, error) {
+	if previous, ok := chain.baseArtifact(repository.ID, "bundle"); ok {
+		stored, _, path, err := chain[1:].resolve(previous)
+		if err != nil {
+			return false, nil, err
+		}
+		heads, err := bundleHeads(ctx, runner, stored, path)
+		if err != nil {
+			return false, nil, fmt.Errorf("read base bundle: %w", err)
+		}
+		exclusions := bundleExclusions(heads)
+		refs, err := snapshotRefs(ctx, runner, repository.Path)
+		if err != nil {
+			return false, nil, err
+		}
+		revisions := append(append([]string{"--all", "--ignore-missing"}, extra...), exclusions...)
+		count, err := runner.Run(ctx, repository.Path, append([]string{"rev-list", "--count"}, revisions...)...)
+		if err != nil {
+			return false, nil, err
+		}
+		if len(refs) > 0 && strings.TrimSpace(count.Stdout) != "0" {
+			written, err := streamBundle(ctx, runner, repository.Path, output, revisions...)
+			if err != nil {
+				return false, nil, err
+			}
+			for name, object := range written {
+				if refs[name] != object {
+					return false, nil, fmt.Errorf("ref %q changed while the bundle was written", name)
+				}
+			}
+			return true, refs, nil
+		}
+	}
+	written, err := streamBundle(ctx, runner, repository.Path, output, append([]string{"--all"}, extra...)...)
+	if err != nil || !recordRefs {
+		return false, nil, err
+	}
+	return false, written, nil
+}
+
+// streamBundle runs `git bundle create -` into output and returns the heads
+// listed in the bundle header.
+func streamBundle(ctx context.Context, runner gitinspect.StreamingRunner, repositoryPath string, output io.Writer, revisions ...string) (map[string]string, error) {
+	header := &bundleHeaderWriter{}
+	args := append([]string{"bundle", "create", "-"}, revisions...)
+	if _, err := runner.RunTo(ctx, repositoryPath, io.MultiWriter(output, header), args...); err != nil {
+		return nil, err
+	}
+	if !header.complete {
+		return nil, errors.New("bundle header is incomplete")
+	}
+	return parseBundleHeader(header.buffer.String()), nil
+}
+
+// maxBundleHeader bounds how much of a bundle is kept to read its heads.
+const maxBundleHeader = 64 << 20
+
+// bundleHeaderWriter keeps the bundle header, which ends at the first empty
+// line, and discards the pack data after it.
+type bundleHeaderWriter struct {
+	buffer   bytes.Buffer
+	complete bool
+}
+
+func (w *bundleHeaderWriter) Write(p []byte) (int, error) {
+	if w.complete {
+		return len(p), nil
+	}
+	start := max(w.buffer.Len()-1, 0)
+	w.buffer.Write(p)
+	if end := bytes.Index(w.buffer.Bytes()[start:], []byte("\n\n")); end >= 0 {
+		w.buffer.Truncate(start + end + 1)
+		w.complete = true
+	} else if w.buffer.Len() > maxBundleHeader {
+		return 0, errors.New("bundle header is too large")
+	}
+	return len(p), nil
+}
+
+// parseBundleHeader returns the refs of a bundle header, skipping the
+// signature, capabilities, prerequisites and HEAD.
+func parseBundleHeader(header string) map[string]string {
+	lines := strings.Split(header, "\n")
+	refs := make(map[string]string)
+	for _, line := range lines[1:] {
+		if strings.HasPrefix(line, "-") || strings.HasPrefix(line, "@") {
+			continue
+		}
+		object, name, ok := strings.Cut(line, " ")
+		if ok && name != "HEAD" {
+			refs[name] = object
+		}
+	}
+	return refs
+}
+
+func bundleExclusions(heads map[string]string) []string {
+	seen := make(map[string]bool, len(heads))
+	exclusions := make([]string, 0, len(heads))
+	for _, object := range heads {
+		if !seen[object] {
+			seen[object] = true
+			exclusions = append(exclusions, "^"+object)
+		}
+	}
+	sort.Strings(exclusions)
+	return exclusions
+}
@@ -0,0 +1,116 @@
+package fbackup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateWithBaseReusesAndChainsBundles(t *testing.T) {
+	root := t.TempDir()
+	entry := newRecloneableRepository(t, "example/delta")
+	repo := entry.Path
+	mustGitTest(t, repo, "commit", "--allow-empty", "-qm", "local-only")
+	mustGitTest(t, repo, "tag", "-a", "-m", "release", "v1")
+	mustGitTest(t, repo, "branch", "keep")
+	entry.Classification = ClassificationDelta
+	inspectEntryState(t, &entry)
+	manifest := Manifest{Version: ManifestVersion, Repositories: []RepositoryEntry{entry}}
+
+	first := filepath.Join(root, "first")
+	if err := Create(context.Background(), CreateOptions{Destination: first, Manifest: manifest}); err != nil {
+		t.Fatal(err)
+	}
+	second := filepath.Join(root, "second")
+	if err := Create(context.Background(), CreateOptions{Destination: second, Manifest: manifest, Base: first}); err != nil {
+		t.Fatal(err)
+	}
+	bundlePath := func(destination string) string {
+		return filepath.Join(destination, "repos", repositoryDirName(entry.ID), "repository.bundle")
+	}
+	firstInfo, err := os.Stat(bundlePath(first))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondInfo, err := os.Stat(bundlePath(second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(firstInfo, secondInfo) {
+		t.Fatal("unchanged bundle was not hard-linked from the base backup")
+	}
+
+	// Move master on, drop one branch, and add one at an old commit. The
+	// incremental bundle omits refs that still point into the base.
+	mustGitTest(t, repo, "commit", "--allow-empty", "-qm", "after-base")
+	mustGitTest(t, repo, "branch", "-D", "keep")
+	mustGitTest(t, repo, "branch", "old", "HEAD~2")
+	inspectEntryState(t, &entry)
+	manifest.Repositories = []RepositoryEntry{entry}
+	third := filepath.Join(root, "third")
+	if err := Create(context.Background(), CreateOptions{Destination: third, Manifest: manifest, Base: second}); err != nil {
+		t.Fatal(err)
+	}
+	metadata, err := readBackupMetadata(filepath.Join(third, "backup.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle, ok := findArtifact(metadata.Artifacts, entry.ID, "bundle")
+	if !ok || !bundle.Incremental || metadata.Base == nil || metadata.Base.Path != second {
+		t.Fatalf("third backup bundle = %+v, base = %+v", bundle, metadata.Base)
+	}
+	if err := Verify(context.Background(), third, true); err != nil {
+		t.Fatal(err)
+	}
+
+	target := filepath.Join(root, "restore")
+	if err := Restore(context.Background(), RestoreOptions{Backup: third, Target: target}); err != nil {
+		t.Fatal(err)
+	}
+	restored := filepath.Join(target, "example", "delta")
+	if got, want := gitOutputTest(t, restored, "for-each-ref", "refs/heads", "refs/tags"), gitOutputTest(t, repo, "for-each-ref", "refs/heads", "refs/tags"); got != want {
+		t.Fatalf("restored refs = %q, want %q", got, want)
+	}
+
+	secondMetadata, err := readBackupMetadata(filepath.Join(second, "backup.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondMetadata.CreatedAt = secondMetadata.CreatedAt.Add(time.Second)
+	if err := writeJSONAtomic(filepath.Join(second, "backup.json"), secondMetadata, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(context.Background(), third, false); err == nil || !strings.Contains(err.Error(), "changed") {
+		t.Fatalf("Verify() with modified base error = %v", err)
+	}
+}
+
+func TestCreateRejectsIncompleteOrSelfBase(t *testing.T) {
+	root := t.TempDir()
+	repo := filepath.Join(root, "repo")
+	mustGitTest(t, root, "init", "-q", repo)
+	manifest := Manifest{Version: ManifestVersion, Repositories: []RepositoryEntry{{ID: "full/repo", Path: repo, Classification: ClassificationFull}}}
+	base := filepath.Join(root, "base")
+	if err := Create(context.Background(), CreateOptions{Destination: base, Manifest: manifest}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Create(context.Background(), CreateOptions{Destination: base, Manifest: manifest, Base: base}); err == nil || !strings.Contains(err.Error(), "own base") {
+		t.Fatalf("Create() with itself as base error = %v", err)
+	}
+
+	metadata, err := readBackupMetadata(filepath.Join(base, "backup.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata.Complete = false
+	if err := writeJSONAtomic(filepath.Join(base, "backup.json"), metadata, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err = Create(context.Background(), CreateOptions{Destination: filepath.Join(root, "next"), Manifest: manifest, Base: base})
+	if err == nil || !strings.Contains(err.Error(), "incomplete") {
+		t.Fatalf("Create() with incomplete base error = %v", err)
+	}
+}
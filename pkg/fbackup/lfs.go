@@ -0,0 +1,100 @@
+package fbackup
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/zbiljic/fget/pkg/gitinspect"
+	"github.com/zbiljic/fget/pkg/gitlfs"
+)
+
+// validateLFSObjects rejects LFS object names that are not digests, since
+// they become paths inside the lfs artifact and the restored Git directory.
+func validateLFSObjects(repository RepositoryEntry) error {
+	for _, object := range repository.MissingLFSObjects {
+		if !gitlfs.ValidOID(object.OID) || object.Size < 0 {
+			return fmt.Errorf("repository %q lists invalid LFS object %q", repository.ID, object.OID)
+		}
+	}
+	return nil
+}
+
+// writeLFSTar archives the local LFS objects the LFS server did not have at
+// audit time. Each object is checked against its digest first, so a corrupt
+// local copy fails the backup instead of being preserved.
+func writeLFSTar(
+	ctx context.Context,
+	runner gitinspect.Runner,
+	repository RepositoryEntry,
+	output io.Writer,
+	compression Compression,
+) error {
+	gitDir, err := gitinspect.GitDirPath(ctx, repository.Path, runner)
+	if err != nil {
+		return err
+	}
+	root := filepath.Join(gitDir, "lfs", "objects")
+	paths := make([]string, 0, len(repository.MissingLFSObjects))
+	for _, object := range repository.MissingLFSObjects {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		relative := gitlfs.ObjectPath(object.OID)
+		path := filepath.Join(root, filepath.FromSlash(relative))
+		info, err := os.Lstat(path)
+		if err != nil {
+			return fmt.Errorf("LFS object %s: %w", object.OID, err)
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("LFS object %s is not a regular file", object.OID)
+		}
+		if err := gitlfs.VerifyFile(path, object); err != nil {
+			return err
+		}
+		paths = append(paths, relative)
+	}
+	return writeTarTo(ctx, root, output, compression, paths)
+}
+
+// verifyLFSArchive checks that every member of an lfs artifact is a regular
+// file stored under its own digest.
+func verifyLFSArchive(ctx context.Context, archive io.Reader) error {
+	tarReader := tar.NewReader(archive)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("tar: %w", err)
+		}
+		oid := filepath.Base(header.Name)
+		if header.Typeflag != tar.TypeReg || !gitlfs.ValidOID(oid) || header.Name != gitlfs.ObjectPath(oid) {
+			return fmt.Errorf("unexpected LFS archive member %q", header.Name)
+		}
+		if err := gitlfs.Verify(tarReader, gitlfs.Object{OID: oid, Size: header.Size}); err != nil {
+			return err
+		}
+	}
+}
+
+// restoreLFSObjects extracts the lfs artifact into the Git directory of a
+// freshly initialized repository, before its worktree is checked out.
+func restoreLFSObjects(ctx context.Context, chain backupChain, repositoryPath string, repository RepositoryEntry) error {
+	root := filepath.Join(repositoryPath, ".git")
+	if err := ensureSafeDirectory(root, "lfs/objects"); err != nil {
+		return err
+	}
+	if err := extractArtifact(ctx, chain, repository.ID, "lfs", filepath.Join(root, "lfs", "objects")); err != nil {
+		return fmt.Errorf("extract LFS objects: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package fbackup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zbiljic/fget/pkg/gitlfs"
+)
+
+func writeLFSObjectTest(t *testing.T, repository, content string) (gitlfs.Object, string) {
+	t.Helper()
+	sum := sha256.Sum256([]byte(content))
+	object := gitlfs.Object{OID: hex.EncodeToString(sum[:]), Size: int64(len(content))}
+	path := filepath.Join(repository, ".git", "lfs", "objects", filepath.FromSlash(gitlfs.ObjectPath(object.OID)))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return object, path
+}
+
+func TestCreateDeltaKeepsOnlyMissingLFSObjects(t *testing.T) {
+	root := t.TempDir()
+	repository := newRecloneableRepository(t, "example/lfs")
+	uploaded, _ := writeLFSObjectTest(t, repository.Path, "uploaded\n")
+	missing, missingPath := writeLFSObjectTest(t, repository.Path, "local only\n")
+	repository.Classification = ClassificationDelta
+	repository.HasLocalLFSObjects = true
+	repository.LFSState = LFSStateVerified
+	repository.LocalLFSObjectCount = 2
+	repository.MissingLFSObjects = []gitlfs.Object{missing}
+
+	destination := filepath.Join(root, "backup")
+	manifest := Manifest{Version: ManifestVersion, Repositories: []RepositoryEntry{repository}}
+	if err := Create(context.Background(), CreateOptions{Destination: destination, Manifest: manifest}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(context.Background(), destination, true); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(root, "restore")
+	if err := Restore(context.Background(), RestoreOptions{Backup: destination, Target: target}); err != nil {
+		t.Fatal(err)
+	}
+	objects, err := gitlfs.LocalObjects(filepath.Join(target, "example", "lfs", ".git"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 || objects[0] != missing {
+		t.Fatalf("restored LFS objects = %v, want only %v and not %v", objects, missing, uploaded)
+	}
+
+	if err := os.WriteFile(missingPath, []byte("local onlx\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err = Create(context.Background(), CreateOptions{Destination: filepath.Join(root, "corrupt"), Manifest: manifest})
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("Create() with a corrupt LFS object error = %v, want checksum mismatch", err)
+	}
+
+	manifest.Repositories[0].MissingLFSObjects = []gitlfs.Object{{OID: "../../../escape", Size: 1}}
+	err = Create(context.Background(), CreateOptions{Destination: filepath.Join(root, "invalid"), Manifest: manifest})
+	if err == nil || !strings.Contains(err.Error(), "invalid LFS object") {
+		t.Fatalf("Create() with an invalid LFS object error = %v", err)
+	}
+}
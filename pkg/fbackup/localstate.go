@@ -0,0 +1,546 @@
+package fbackup
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/zbiljic/fget/pkg/gitinspect"
+	"github.com/zbiljic/fget/pkg/giturl"
+)
+
+// Bundles only carry objects reachable from refs, so delta backups keep the
+// rest of the local state in three more artifacts: the stash reflog, linked
+// worktrees with their uncommitted changes, and repository-local
+// configuration and hooks.
+
+// stashEntry is one entry of the stash reflog.
+type stashEntry struct {
+	Commit  string `json:"commit"`
+	Message string `json:"message"`
+}
+
+// worktreeEntry describes a linked worktree. Name is its directory below
+// .git/worktrees and names its files in the worktrees artifact.
+type worktreeEntry struct {
+	Name   string               `json:"name"`
+	Path   string               `json:"path"`
+	Head   gitinspect.Reference `json:"head"`
+	Locked bool                 `json:"locked,omitempty"`
+}
+
+// localState is read once per repository so that the bundle carries every
+// commit the stash and worktree artifacts refer to.
+type localState struct {
+	stashes   []stashEntry
+	worktrees []worktreeEntry
+}
+
+// localConfigFiles are the files below the Git directory kept by the
+// local-config artifact as they are, next to the sanitized configuration and
+// every hook that is not a sample.
+var localConfigFiles = []string{"info/exclude", "info/attributes"}
+
+func inspectLocalState(ctx context.Context, runner gitinspect.Runner, repositoryPath string) (localState, error) {
+	stashes, err := listStashes(ctx, runner, repositoryPath)
+	if err != nil {
+		return localState{}, fmt.Errorf("list stashes: %w", err)
+	}
+	worktrees, err := listWorktrees(ctx, runner, repositoryPath)
+	if err != nil {
+		return localState{}, fmt.Errorf("list worktrees: %w", err)
+	}
+	return localState{stashes: stashes, worktrees: worktrees}, nil
+}
+
+// revisions returns the commits the bundle must contain in addition to refs:
+// older stash entries and detached worktree heads.
+func (s localState) revisions() []string {
+	var revisions []string
+	for _, stash := range s.stashes {
+		revisions = append(revisions, stash.Commit)
+	}
+	for _, worktree := range s.worktrees {
+		if worktree.Head.Commit != "" {
+			revisions = append(revisions, worktree.Head.Commit)
+		}
+	}
+	return revisions
+}
+
+// listStashes returns the stash reflog from the oldest entry to the newest.
+func listStashes(ctx context.Context, runner gitinspect.Runner, repositoryPath string) ([]stashEntry, error) {
+	top, err := runner.Run(ctx, repositoryPath, "for-each-ref", "--format=%(objectname)", "refs/stash")
+	if err != nil {
+		return nil, err
+	}
+	topCommit := strings.TrimSpace(top.Stdout)
+	if topCommit == "" {
+		return nil, nil
+	}
+	out, err := runner.Run(ctx, repositoryPath, "log", "-g", "--format=%H%x00%gs", "refs/stash", "--")
+	if err != nil {
+		return nil, err
+	}
+	var stashes []stashEntry
+	for _, line := range strings.Split(out.Stdout, "\n") {
+		commit, message, ok := strings.Cut(line, "\x00")
+		if !ok {
+			continue
+		}
+		stashes = append([]stashEntry{{Commit: commit, Message: message}}, stashes...)
+	}
+	if len(stashes) == 0 || stashes[len(stashes)-1].Commit != topCommit {
+		// refs/stash without a matching reflog still holds one stash.
+		stashes = append(stashes, stashEntry{Commit: topCommit})
+	}
+	return stashes, nil
+}
+
+// listWorktrees returns the linked worktrees of a repository. Worktrees whose
+// directory no longer exists are skipped, since Git would prune them.
+func listWorktrees(ctx context.Context, runner gitinspect.Runner, repositoryPath string) ([]worktreeEntry, error) {
+	out, err := runner.Run(ctx, repositoryPath, "worktree", "list", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+	var worktrees []worktreeEntry
+	blocks := strings.Split(strings.TrimSpace(out.Stdout), "\n\n")
+	// The first block is the main worktree.
+	for _, block := range blocks[min(1, len(blocks)):] {
+		var worktree worktreeEntry
+		prunable, bare := false, false
+		scanner := bufio.NewScanner(strings.NewReader(block))
+		for scanner.Scan() {
+			key, value, _ := strings.Cut(scanner.Text(), " ")
+			switch key {
+			case "worktree":
+				worktree.Path = value
+			case "HEAD":
+				worktree.Head.Commit = value
+			case "branch":
+				worktree.Head.Ref = value
+			case "locked":
+				worktree.Locked = true
+			case "prunable":
+				prunable = true
+			case "bare":
+				bare = true
+			}
+		}
+		if prunable || bare || worktree.Path == "" {
+			continue
+		}
+		if _, err := os.Stat(worktree.Path); err != nil {
+			continue
+		}
+		name, err := worktreeName(worktree.Path)
+		if err != nil {
+			return nil, err
+		}
+		worktree.Name = name
+		worktrees = append(worktrees, worktree)
+	}
+	return worktrees, nil
+}
+
+// worktreeName reads the administrative directory name from the .git file of
+// a linked worktree.
+func worktreeName(worktreePath string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(worktreePath, ".git"))
+	if err != nil {
+		return "", err
+	}
+	gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+	if !ok {
+		return "", fmt.Errorf("worktree %q has no gitdir file", worktreePath)
+	}
+	name := filepath.Base(gitDir)
+	if !safeRelativePath(name) || strings.Contains(name, "/") {
+		return "", fmt.Errorf("worktree %q has an invalid name", worktreePath)
+	}
+	return name, nil
+}
+
+func writeStashList(state localState, output io.Writer) error {
+	stashes := state.stashes
+	if stashes == nil {
+		stashes = []stashEntry{}
+	}
+	data, err := json.MarshalIndent(stashes, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = output.Write(append(data, '\n'))
+	return err
+}
+
+// writeWorktreesTar archives worktrees.json and, for each linked worktree,
+// its index and worktree patches and its untracked files.
+func writeWorktreesTar(ctx context.Context, runner gitinspect.Runner, state localState, output io.Writer, compression Compression) error {
+	compressor, err := newCompressor(output, compression)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(compressor)
+	worktrees := state.worktrees
+	if worktrees == nil {
+		worktrees = []worktreeEntry{}
+	}
+	data, err := json.MarshalIndent(worktrees, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := addTarFile(tw, "worktrees.json", append(data, '\n')); err != nil {
+		return err
+	}
+	for _, worktree := range worktrees {
+		patches := []struct {
+			name string
+			args []string
+		}{
+			{"index.patch", []string{"diff", "--cached", "--binary", "HEAD"}},
+			{"tracked.patch", []string{"diff", "--binary"}},
+		}
+		for _, patch := range patches {
+			out, err := runner.Run(ctx, worktree.Path, patch.args...)
+			if err != nil {
+				return fmt.Errorf("worktree %q: %w", worktree.Name, err)
+			}
+			if err := addTarFile(tw, path.Join(worktree.Name, patch.name), []byte(out.Stdout)); err != nil {
+				return err
+			}
+		}
+		out, err := runner.Run(ctx, worktree.Path, "ls-files", "--others", "--exclude-standard", "-z")
+		if err != nil {
+			return fmt.Errorf("worktree %q: %w", worktree.Name, err)
+		}
+		var untracked []string
+		for _, name := range strings.Split(out.Stdout, "\x00") {
+			if name != "" {
+				untracked = append(untracked, name)
+			}
+		}
+		if err := addTarPaths(ctx, tw, worktree.Path, worktree.Name+"/untracked/", untracked); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return compressor.Close()
+}
+
+// writeLocalConfigTar archives the repository configuration, local exclude
+// and attribute files, and every hook that is not one of Git's samples.
+// Remote URLs are sanitized and HTTP extra headers dropped from the
+// configuration, as manifests never hold credentials either.
+func writeLocalConfigTar(ctx context.Context, runner gitinspect.Runner, repositoryPath string, output io.Writer, compression Compression) error {
+	gitDir, err := gitinspect.GitDirPath(ctx, repositoryPath, runner)
+	if err != nil {
+		return err
+	}
+	config, err := sanitizedConfig(ctx, runner, repositoryPath, filepath.Join(gitDir, "config"))
+	if err != nil {
+		return fmt.Errorf("sanitize config: %w", err)
+	}
+	var paths []string
+	for _, name := range localConfigFiles {
+		info, err := os.Lstat(filepath.Join(gitDir, filepath.FromSlash(name)))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			paths = append(paths, name)
+		}
+	}
+	err = filepath.WalkDir(filepath.Join(gitDir, "hooks"), func(current string, entry fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			if errors.Is(walkErr, fs.ErrNotExist) {
+				return filepath.SkipAll
+			}
+			return walkErr
+		}
+		if entry.IsDir() || strings.HasSuffix(entry.Name(), ".sample") {
+			return nil
+		}
+		relative, err := filepath.Rel(gitDir, current)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, filepath.ToSlash(relative))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	compressor, err := newCompressor(output, compression)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(compressor)
+	if err := addTarFile(tw, "config", config); err != nil {
+		return err
+	}
+	if err := addTarPaths(ctx, tw, gitDir, "", paths); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return compressor.Close()
+}
+
+// sanitizedConfig returns a copy of the configuration file at path without
+// credentials in remote URLs and without HTTP extra headers.
+func sanitizedConfig(ctx context.Context, runner gitinspect.Runner, repositoryPath, path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	copyFile, err := os.CreateTemp("", "fbackup-config-*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = os.Remove(copyFile.Name()) }()
+	_, err = copyFile.Write(data)
+	if closeErr := copyFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	configure := func(args ...string) (string, error) {
+		out, err := runner.Run(ctx, repositoryPath, append([]string{"config", "--file", copyFile.Name()}, args...)...)
+		var gitErr *gitinspect.CommandError
+		if errors.As(err, &gitErr) && gitErr.ExitCode == 1 {
+			// No matching keys.
+			return "", nil
+		}
+		return out.Stdout, err
+	}
+	urls, err := configure("--null", "--get-regexp", `^remote\..*\.(url|pushurl)$`)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range strings.Split(urls, "\x00") {
+		key, value, ok := strings.Cut(entry, "\n")
+		if !ok {
+			continue
+		}
+		sanitized := giturl.Sanitize(value)
+		if sanitized == value {
+			continue
+		}
+		pattern := "^" + regexp.QuoteMeta(value) + "$"
+		if sanitized == "" {
+			_, err = configure("--unset-all", key, pattern)
+		} else {
+			_, err = configure("--replace-all", key, sanitized, pattern)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	headers, err := configure("--null", "--name-only", "--get-regexp", `^http\..*extraheader$`)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range strings.Split(headers, "\x00") {
+		if key == "" {
+			continue
+		}
+		if _, err := configure("--unset-all", key); err != nil {
+			return nil, err
+		}
+	}
+	return os.ReadFile(copyFile.Name())
+}
+
+// restoreStashes recreates the stash reflog. The bundle already restored
+// refs/stash, which is replaced by storing every entry from the oldest.
+func restoreStashes(ctx context.Context, chain backupChain, repositoryPath string, repository RepositoryEntry, runner gitinspect.Runner) error {
+	record, err := chain.newestArtifact(repository.ID, "stash")
+	if err != nil {
+		return err
+	}
+	reader, err := chain.open(ctx, record)
+	if err != nil {
+		return err
+	}
+	var stashes []stashEntry
+	err = json.NewDecoder(reader).Decode(&stashes)
+	_ = reader.Close()
+	if err != nil {
+		return fmt.Errorf("read stash list: %w", err)
+	}
+	if len(stashes) == 0 {
+		return nil
+	}
+	if _, err := runner.Run(ctx, repositoryPath, "update-ref", "-d", "refs/stash"); err != nil {
+		return fmt.Errorf("restore stash: %w", err)
+	}
+	for _, stash := range stashes {
+		args := []string{"stash", "store", "-q"}
+		if stash.Message != "" {
+			args = append(args, "-m", stash.Message)
+		}
+		if _, err := runner.Run(ctx, repositoryPath, append(args, stash.Commit)...); err != nil {
+			return fmt.Errorf("restore stash: %w", err)
+		}
+	}
+	return nil
+}
+
+// restoreWorktrees recreates linked worktrees next to the restored
+// repository, in <repository>.worktrees/<name>, and reapplies their changes.
+// repositoryPath is the temporary location the repository is restored in
+// before it is renamed to finalPath, so each worktree is pointed at finalPath
+// once it is complete. The returned cleanup removes the worktrees again if
+// the restore fails.
+func restoreWorktrees(
+	ctx context.Context,
+	chain backupChain,
+	repositoryPath, finalPath string,
+	repository RepositoryEntry,
+	runner gitinspect.Runner,
+) (func(), error) {
+	root := finalPath + ".worktrees"
+	var created []string
+	cleanup := func() {
+		for _, worktree := range created {
+			_ = os.RemoveAll(worktree)
+		}
+		_ = os.Remove(root)
+	}
+	scratch, err := os.MkdirTemp(filepath.Dir(repositoryPath), ".fbackup-worktrees-*")
+	if err != nil {
+		return cleanup, err
+	}
+	defer func() { _ = os.RemoveAll(scratch) }()
+	if err := extractArtifact(ctx, chain, repository.ID, "worktrees", scratch); err != nil {
+		return cleanup, fmt.Errorf("extract worktrees: %w", err)
+	}
+	data, err := os.ReadFile(filepath.Join(scratch, "worktrees.json"))
+	if err != nil {
+		return cleanup, err
+	}
+	var worktrees []worktreeEntry
+	if err := json.Unmarshal(data, &worktrees); err != nil {
+		return cleanup, fmt.Errorf("read worktrees: %w", err)
+	}
+	if len(worktrees) == 0 {
+		return cleanup, nil
+	}
+
+	for _, worktree := range worktrees {
+		if !safeRelativePath(worktree.Name) || strings.Contains(worktree.Name, "/") {
+			return cleanup, fmt.Errorf("invalid worktree name %q", worktree.Name)
+		}
+		if err := ensureSafeDirectory(filepath.Dir(root), filepath.Base(root)); err != nil {
+			return cleanup, err
+		}
+		target := filepath.Join(root, worktree.Name)
+		if _, err := os.Lstat(target); err == nil {
+			return cleanup, fmt.Errorf("worktree target %q already exists", target)
+		}
+		args := []string{"worktree", "add", "-q"}
+		if branch, ok := strings.CutPrefix(worktree.Head.Ref, "refs/heads/"); ok {
+			args = append(args, target, branch)
+		} else {
+			args = append(args, "--detach", target, worktree.Head.Commit)
+		}
+		if _, err := runner.Run(ctx, repositoryPath, args...); err != nil {
+			return cleanup, fmt.Errorf("add worktree %q: %w", worktree.Name, err)
+		}
+		created = append(created, target)
+
+		layers := []struct {
+			name string
+			args []string
+		}{
+			{"index.patch", []string{"apply", "--index", "--binary"}},
+			{"tracked.patch", []string{"apply", "--binary"}},
+		}
+		for _, layer := range layers {
+			patch := filepath.Join(scratch, worktree.Name, layer.name)
+			if info, err := os.Stat(patch); err != nil || info.Size() == 0 {
+				continue
+			}
+			if _, err := runner.Run(ctx, target, append(layer.args, patch)...); err != nil {
+				return cleanup, fmt.Errorf("worktree %q apply %s: %w", worktree.Name, layer.name, err)
+			}
+		}
+		if err := moveTree(filepath.Join(scratch, worktree.Name, "untracked"), target); err != nil {
+			return cleanup, fmt.Errorf("worktree %q untracked files: %w", worktree.Name, err)
+		}
+		if worktree.Locked {
+			if _, err := runner.Run(ctx, repositoryPath, "worktree", "lock", target); err != nil {
+				return cleanup, fmt.Errorf("lock worktree %q: %w", worktree.Name, err)
+			}
+		}
+		gitFile := "gitdir: " + filepath.Join(finalPath, ".git", "worktrees", worktree.Name) + "\n"
+		if err := os.WriteFile(filepath.Join(target, ".git"), []byte(gitFile), 0o644); err != nil {
+			return cleanup, err
+		}
+	}
+	return cleanup, nil
+}
+
+// moveTree renames every file below source to the same place below target.
+func moveTree(source, target string) error {
+	return filepath.WalkDir(source, func(current string, entry fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			if current == source && errors.Is(walkErr, fs.ErrNotExist) {
+				return filepath.SkipAll
+			}
+			return walkErr
+		}
+		relative, err := filepath.Rel(source, current)
+		if err != nil || relative == "." {
+			return err
+		}
+		if entry.IsDir() {
+			return ensureSafeDirectory(target, filepath.ToSlash(relative))
+		}
+		destination := filepath.Join(target, relative)
+		if _, err := os.Lstat(destination); err == nil {
+			return fmt.Errorf("untracked file %q already exists", relative)
+		}
+		return os.Rename(current, destination)
+	})
+}
+
+// restoreLocalConfig replaces the configuration of a restored repository
+// and installs its hooks. It runs last so that no restored hook or
+// configured program runs during the restore itself.
+func restoreLocalConfig(ctx context.Context, chain backupChain, repositoryPath string, repository RepositoryEntry) error {
+	gitDir := filepath.Join(repositoryPath, ".git")
+	if err := os.Remove(filepath.Join(gitDir, "config")); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for _, name := range localConfigFiles {
+		if err := os.Remove(filepath.Join(gitDir, filepath.FromSlash(name))); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	if err := extractArtifact(ctx, chain, repository.ID, "local-config", gitDir); err != nil {
+		return fmt.Errorf("extract local config: %w", err)
+	}
+	return nil
+}
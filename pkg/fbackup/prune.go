@@ -0,0 +1,277 @@
+package fbackup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PruneOptions selects which backup directories directly below Root are kept.
+// Retention counts periods, not backups: KeepDaily 7 keeps the newest complete
+// backup of each of the seven most recent days that have one. Periods are
+// calendar days, ISO weeks and months in UTC.
+type PruneOptions struct {
+	Root        string
+	KeepDaily   int
+	KeepWeekly  int
+	KeepMonthly int
+	// DryRun reports the decisions without deleting anything.
+	DryRun   bool
+	Progress func(path, status string)
+}
+
+// PruneResult lists every backup directory found below the root, newest
+// first, with the decision taken for it.
+type PruneResult struct {
+	Root    string       `json:"root"`
+	DryRun  bool         `json:"dry_run"`
+	Backups []PruneEntry `json:"backups"`
+}
+
+type PruneEntry struct {
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"created_at,omitzero"`
+	Complete  bool      `json:"complete"`
+	Keep      bool      `json:"keep"`
+	// Reasons explains why a backup is kept.
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+const pruneTemporaryPrefix = ".fbackup-prune-"
+
+type pruneCandidate struct {
+	entry *PruneEntry
+	// digest is the SHA-256 of backup.json, which Base references record.
+	digest   string
+	metadata BackupMetadata
+	readable bool
+}
+
+// Prune applies the retention policy to the backups below Root. Incomplete or
+// unreadable backups are never removed, the newest complete backup of every
+// repository ID is always kept, and so is every base a kept backup depends
+// on. Nothing is removed when such a base cannot be found. Removal renames a
+// backup out of the way before deleting it, so an interrupted prune never
+// leaves a partial backup that looks complete.
+func Prune(ctx context.Context, options PruneOptions) (PruneResult, error) {
+	if options.Root == "" {
+		return PruneResult{}, errors.New("backup root is required")
+	}
+	if options.KeepDaily < 0 || options.KeepWeekly < 0 || options.KeepMonthly < 0 {
+		return PruneResult{}, errors.New("retention counts cannot be negative")
+	}
+	if options.KeepDaily == 0 && options.KeepWeekly == 0 && options.KeepMonthly == 0 {
+		return PruneResult{}, errors.New("at least one retention count is required")
+	}
+	root, err := filepath.Abs(options.Root)
+	if err != nil {
+		return PruneResult{}, err
+	}
+	if err := rejectSymlinkRoot(root); err != nil {
+		return PruneResult{}, err
+	}
+	candidates, err := pruneCandidates(root, options.DryRun)
+	if err != nil {
+		return PruneResult{}, err
+	}
+
+	applyRetention(candidates, options)
+	protectNewestPerRepository(candidates)
+	if err := protectBases(candidates); err != nil {
+		return PruneResult{}, err
+	}
+
+	result := PruneResult{Root: root, DryRun: options.DryRun, Backups: make([]PruneEntry, 0, len(candidates))}
+	for _, candidate := range candidates {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		entry := candidate.entry
+		if !entry.Keep && !options.DryRun {
+			if err := removeBackup(root, entry.Path); err != nil {
+				return result, fmt.Errorf("remove backup %q: %w", entry.Path, err)
+			}
+		}
+		if options.Progress != nil {
+			status := "keep"
+			if !entry.Keep {
+				status = "delete"
+			}
+			options.Progress(entry.Path, status)
+		}
+		result.Backups = append(result.Backups, *entry)
+	}
+	return result, nil
+}
+
+func pruneCandidates(root string, dryRun bool) ([]*pruneCandidate, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []*pruneCandidate
+	for _, directory := range entries {
+		if !directory.IsDir() {
+			continue
+		}
+		path := filepath.Join(root, directory.Name())
+		if strings.HasPrefix(directory.Name(), pruneTemporaryPrefix) {
+			// Left behind by an interrupted prune after it was renamed away. A
+			// dry run leaves it for the next real prune.
+			if dryRun {
+				continue
+			}
+			if err := os.RemoveAll(path); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		metadataPath := filepath.Join(path, "backup.json")
+		if _, err := os.Lstat(metadataPath); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		candidate := &pruneCandidate{entry: &PruneEntry{Path: path, Keep: true}}
+		metadata, err := readBackupMetadata(metadataPath)
+		switch {
+		case err != nil:
+			candidate.entry.Reasons = []string{"unreadable backup.json"}
+		case !metadata.Complete:
+			candidate.entry.CreatedAt = metadata.CreatedAt
+			candidate.entry.Reasons = []string{"incomplete"}
+			candidate.metadata, candidate.readable = metadata, true
+		default:
+			candidate.entry.CreatedAt = metadata.CreatedAt
+			candidate.entry.Complete = true
+			candidate.entry.Keep = false
+			candidate.metadata, candidate.readable = metadata, true
+		}
+		if candidate.readable {
+			if candidate.digest, err = backupMetadataDigest(path); err != nil {
+				return nil, err
+			}
+		}
+		candidates = append(candidates, candidate)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i].entry, candidates[j].entry
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.Path > b.Path
+	})
+	return candidates, nil
+}
+
+func applyRetention(candidates []*pruneCandidate, options PruneOptions) {
+	rules := []struct {
+		reason string
+		count  int
+		period func(time.Time) string
+	}{
+		{"daily", options.KeepDaily, func(t time.Time) string { return t.Format(time.DateOnly) }},
+		{"weekly", options.KeepWeekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{"monthly", options.KeepMonthly, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+	for _, rule := range rules {
+		seen := make(map[string]bool)
+		for _, candidate := range candidates {
+			if len(seen) == rule.count {
+				break
+			}
+			if !candidate.entry.Complete {
+				continue
+			}
+			period := rule.period(candidate.entry.CreatedAt.UTC())
+			if seen[period] {
+				continue
+			}
+			seen[period] = true
+			candidate.keep(rule.reason)
+		}
+	}
+}
+
+func protectNewestPerRepository(candidates []*pruneCandidate) {
+	protected := make(map[string]bool)
+	for _, candidate := range candidates {
+		if !candidate.entry.Complete {
+			continue
+		}
+		newest := 0
+		for _, repository := range candidate.metadata.Manifest.Repositories {
+			if !protected[repository.ID] {
+				protected[repository.ID] = true
+				newest++
+			}
+		}
+		switch {
+		case newest == 1:
+			candidate.keep("newest backup of 1 repository")
+		case newest > 1:
+			candidate.keep(fmt.Sprintf("newest backup of %d repositories", newest))
+		}
+	}
+}
+
+// protectBases keeps every base that a kept backup, complete or not, builds
+// on, following chains through bases that are themselves incremental. Bases
+// are matched by the digest of their backup.json rather than by the recorded
+// path, which no longer holds once the backups were moved. A base that is
+// neither below the root nor still at its recorded path is an error.
+func protectBases(candidates []*pruneCandidate) error {
+	byDigest := make(map[string][]*pruneCandidate, len(candidates))
+	for _, candidate := range candidates {
+		if candidate.digest != "" {
+			byDigest[candidate.digest] = append(byDigest[candidate.digest], candidate)
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, candidate := range candidates {
+			if !candidate.entry.Keep || !candidate.readable || candidate.metadata.Base == nil {
+				continue
+			}
+			base := candidate.metadata.Base
+			bases, ok := byDigest[base.SHA256]
+			if !ok {
+				if digest, err := backupMetadataDigest(base.Path); err != nil || digest != base.SHA256 {
+					return fmt.Errorf("base backup %q of %q not found", base.Path, candidate.entry.Path)
+				}
+				continue
+			}
+			for _, base := range bases {
+				if !base.entry.Keep {
+					base.keep("base of " + filepath.Base(candidate.entry.Path))
+					changed = true
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (c *pruneCandidate) keep(reason string) {
+	c.entry.Keep = true
+	c.entry.Reasons = append(c.entry.Reasons, reason)
+}
+
+func removeBackup(root, path string) error {
+	temporary, err := os.MkdirTemp(root, pruneTemporaryPrefix+"*")
+	if err != nil {
+		return err
+	}
+	moved := filepath.Join(temporary, filepath.Base(path))
+	if err := os.Rename(path, moved); err != nil {
+		_ = os.Remove(temporary)
+		return err
+	}
+	return os.RemoveAll(temporary)
+}
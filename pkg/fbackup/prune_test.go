@@ -0,0 +1,144 @@
+package fbackup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writePruneBackup(t *testing.T, root, name string, createdAt time.Time, complete bool, base string, ids ...string) string {
+	t.Helper()
+	destination := filepath.Join(root, name)
+	if err := os.MkdirAll(destination, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	metadata := BackupMetadata{
+		SchemaVersion: BackupSchemaVersion,
+		CreatedAt:     createdAt,
+		Complete:      complete,
+		Manifest:      Manifest{Version: ManifestVersion},
+	}
+	for _, id := range ids {
+		metadata.Manifest.Repositories = append(metadata.Manifest.Repositories, RepositoryEntry{ID: id})
+	}
+	if base != "" {
+		digest, err := backupMetadataDigest(filepath.Join(root, base))
+		if err != nil {
+			t.Fatal(err)
+		}
+		metadata.Base = &BackupBase{Path: filepath.Join(root, base), SHA256: digest}
+	}
+	if err := writeJSONAtomic(filepath.Join(destination, "backup.json"), metadata, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return destination
+}
+
+func TestPruneKeepsRetainedNewestAndBaseBackups(t *testing.T) {
+	root := t.TempDir()
+	day := func(month time.Month, day int) time.Time { return time.Date(2026, month, day, 12, 0, 0, 0, time.UTC) }
+	oldest := writePruneBackup(t, root, "2026-07-15", day(7, 15), true, "", "a")
+	base := writePruneBackup(t, root, "2026-08-31", day(8, 31), true, "", "a")
+	onlyB := writePruneBackup(t, root, "2026-09-29", day(9, 29), true, "", "a", "b")
+	writePruneBackup(t, root, "2026-10-01", day(10, 1), true, "", "a")
+	writePruneBackup(t, root, "2026-10-02", day(10, 2), true, "2026-08-31", "a")
+	writePruneBackup(t, root, "2026-10-03", day(10, 3), false, "", "a")
+	if err := os.Mkdir(filepath.Join(root, "notes"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	leftover := filepath.Join(root, pruneTemporaryPrefix+"interrupted")
+	if err := os.Mkdir(leftover, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	options := PruneOptions{Root: root, KeepDaily: 2, DryRun: true}
+	result, err := Prune(context.Background(), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Backups) != 6 || result.Backups[0].Path != filepath.Join(root, "2026-10-03") {
+		t.Fatalf("Prune() backups = %+v, want six backups newest first", result.Backups)
+	}
+	decisions := make(map[string]PruneEntry)
+	for _, entry := range result.Backups {
+		decisions[entry.Path] = entry
+	}
+	for path, keep := range map[string]bool{oldest: false, base: true, onlyB: true} {
+		if decisions[path].Keep != keep {
+			t.Fatalf("%s keep = %v, want %v (%v)", filepath.Base(path), decisions[path].Keep, keep, decisions[path].Reasons)
+		}
+	}
+	if reasons := strings.Join(decisions[base].Reasons, ","); reasons != "base of 2026-10-02" {
+		t.Fatalf("base reasons = %q", reasons)
+	}
+	if _, err := os.Stat(oldest); err != nil {
+		t.Fatalf("dry run removed a backup: %v", err)
+	}
+	if _, err := os.Stat(leftover); err != nil {
+		t.Fatalf("dry run removed an interrupted prune: %v", err)
+	}
+
+	options.DryRun = false
+	if _, err := Prune(context.Background(), options); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if got := strings.Join(names, ","); got != "2026-08-31,2026-09-29,2026-10-01,2026-10-02,2026-10-03,notes" {
+		t.Fatalf("remaining directories = %s", got)
+	}
+}
+
+func TestPruneKeepsBasesOfRelocatedBackups(t *testing.T) {
+	oldRoot := filepath.Join(t.TempDir(), "backups")
+	day := func(d int) time.Time { return time.Date(2026, 10, d, 12, 0, 0, 0, time.UTC) }
+	writePruneBackup(t, oldRoot, "2026-10-01", day(1), true, "", "a")
+	writePruneBackup(t, oldRoot, "2026-10-02", day(2), true, "2026-10-01", "a")
+
+	root := filepath.Join(t.TempDir(), "moved")
+	if err := os.Rename(oldRoot, root); err != nil {
+		t.Fatal(err)
+	}
+	result, err := Prune(context.Background(), PruneOptions{Root: root, KeepDaily: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range result.Backups {
+		if !entry.Keep {
+			t.Fatalf("%s keep = false (%v), want the base of the kept backup", filepath.Base(entry.Path), entry.Reasons)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "2026-10-01")); err != nil {
+		t.Fatalf("base removed: %v", err)
+	}
+
+	// without its base the kept backup cannot be restored; refuse to prune
+	stale := writePruneBackup(t, root, "2026-09-30", time.Date(2026, 9, 30, 12, 0, 0, 0, time.UTC), true, "", "a")
+	if err := os.RemoveAll(filepath.Join(root, "2026-10-01")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Prune(context.Background(), PruneOptions{Root: root, KeepDaily: 1}); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("Prune() with a missing base error = %v", err)
+	}
+	if _, err := os.Stat(stale); err != nil {
+		t.Fatalf("prune removed a backup after refusing: %v", err)
+	}
+}
+
+func TestPruneRequiresRetentionPolicy(t *testing.T) {
+	if _, err := Prune(context.Background(), PruneOptions{Root: t.TempDir()}); err == nil {
+		t.Fatal("Prune() without retention counts succeeded")
+	}
+	if _, err := Prune(context.Background(), PruneOptions{Root: t.TempDir(), KeepDaily: -1, KeepWeekly: 1}); err == nil {
+		t.Fatal("Prune() with a negative retention count succeeded")
+	}
+}
@@ -0,0 +1,113 @@
+package fbackup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zbiljic/fget/pkg/fbackup/storage"
+)
+
+// maxBackupMetadataSize bounds how much of a remote backup.json is read.
+const maxBackupMetadataSize = 256 << 20
+
+// openBackupLocation reads the backup.json of a local backup directory or of
+// an s3:// location.
+func openBackupLocation(ctx context.Context, location string) (backupLink, error) {
+	if storage.IsRemote(location) {
+		store, err := storage.Open(location)
+		if err != nil {
+			return backupLink{}, err
+		}
+		metadata, err := readRemoteBackupMetadata(ctx, store)
+		if err != nil {
+			return backupLink{}, err
+		}
+		return backupLink{Destination: store.String(), Metadata: metadata, store: store}, nil
+	}
+	destination, err := filepath.Abs(location)
+	if err != nil {
+		return backupLink{}, err
+	}
+	if err := rejectSymlinkRoot(destination); err != nil {
+		return backupLink{}, err
+	}
+	metadata, err := readBackupMetadata(filepath.Join(destination, "backup.json"))
+	if err != nil {
+		return backupLink{}, err
+	}
+	return backupLink{Destination: destination, Metadata: metadata}, nil
+}
+
+func readRemoteBackupMetadata(ctx context.Context, store storage.Backend) (BackupMetadata, error) {
+	reader, err := store.Get(ctx, "backup.json")
+	if err != nil {
+		return BackupMetadata{}, err
+	}
+	defer func() { _ = reader.Close() }()
+	data, err := io.ReadAll(io.LimitReader(reader, maxBackupMetadataSize+1))
+	if err != nil {
+		return BackupMetadata{}, err
+	}
+	if len(data) > maxBackupMetadataSize {
+		return BackupMetadata{}, errors.New("backup metadata is too large")
+	}
+	return decodeBackupMetadata(data)
+}
+
+// defaultStagingDirectory returns where Create keeps the checkpoint and
+// temporary artifacts of a remote backup, so an interrupted upload can resume.
+func defaultStagingDirectory(location string) string {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		cache = os.TempDir()
+	}
+	hash := sha256.Sum256([]byte(strings.TrimRight(location, "/")))
+	return filepath.Join(cache, "fget", "backup-staging", hex.EncodeToString(hash[:8]))
+}
+
+// uploadArtifact moves a finished temporary artifact into object storage.
+func uploadArtifact(ctx context.Context, store storage.Backend, temporaryPath, key string) error {
+	file, err := os.Open(temporaryPath)
+	if err != nil {
+		return err
+	}
+	err = store.Put(ctx, key, file)
+	_ = file.Close()
+	if err != nil {
+		return err
+	}
+	return os.Remove(temporaryPath)
+}
+
+// commitRemoteBackup uploads backup.json, which makes the remote backup
+// complete, and then removes the local checkpoint and staged artifacts.
+func commitRemoteBackup(ctx context.Context, store storage.Backend, staging string, metadata BackupMetadata) error {
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if err := store.Put(ctx, "backup.json", bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("commit %s: %w", store, err)
+	}
+	if err := os.RemoveAll(filepath.Join(staging, "repos")); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(staging, "backup.json")); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	// The staging directory may be shared or user-provided; only remove it
+	// once it is empty.
+	_ = os.Remove(staging)
+	return nil
+}
@@ -0,0 +1,110 @@
+package fbackup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zbiljic/fget/pkg/fbackup/storage"
+	"github.com/zbiljic/fget/pkg/fbackup/storage/storagetest"
+)
+
+func newRemoteDestination(t *testing.T) (*storagetest.Proxy, string) {
+	t.Helper()
+	store := storagetest.NewS3(t)
+	proxy := store.NewProxy(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", store.AccessKeyID)
+	t.Setenv("AWS_SECRET_ACCESS_KEY", store.SecretAccessKey)
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	return proxy, "s3://" + store.Bucket + "/" + store.Prefix + "?endpoint=" + proxy.URL + "&region=" + store.Region
+}
+
+func TestCreateRemoteUploadsBackupJSONLast(t *testing.T) {
+	root := t.TempDir()
+	manifest, repo := newEncryptedDeltaManifest(t)
+	proxy, destination := newRemoteDestination(t)
+	staging := filepath.Join(root, "staging")
+	options := CreateOptions{Destination: destination, Staging: staging, Manifest: manifest}
+	store, err := storage.Open(destination)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	proxy.FailUploads(true)
+	if err := Create(ctx, options); err == nil {
+		t.Fatal("Create() succeeded although every upload failed")
+	}
+	proxy.FailUploads(false)
+	if _, err := store.Stat(ctx, "backup.json"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Create() uploaded backup.json before the artifacts: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(staging, "backup.json")); err != nil {
+		t.Fatalf("staging checkpoint missing after a failed upload: %v", err)
+	}
+
+	if err := Create(ctx, options); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(staging); !os.IsNotExist(err) {
+		t.Fatalf("staging directory was not removed: %v", err)
+	}
+	objects, err := store.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 8 || objects[0].Key != "backup.json" {
+		t.Fatalf("stored objects = %v, want backup.json and seven artifacts", objects)
+	}
+	if err := Verify(ctx, destination, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := Create(ctx, options); err != nil {
+		t.Fatalf("Create() of a complete remote backup error = %v", err)
+	}
+
+	target := filepath.Join(root, "restore")
+	if err := Restore(ctx, RestoreOptions{Backup: destination, Target: target}); err != nil {
+		t.Fatal(err)
+	}
+	restored := filepath.Join(target, "example", "secret")
+	if got, want := gitOutputTest(t, restored, "status", "--porcelain"), gitOutputTest(t, repo, "status", "--porcelain"); got != want {
+		t.Fatalf("restored status = %q, want %q", got, want)
+	}
+
+	for _, object := range objects[1:] {
+		if !strings.HasSuffix(object.Key, "tracked.patch") {
+			continue
+		}
+		reader, err := store.Get(ctx, object.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(reader)
+		_ = reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Put(ctx, object.Key, bytes.NewReader(append([]byte("x"), data[1:]...))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Verify(ctx, destination, false); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("Verify() of a tampered object error = %v, want checksum mismatch", err)
+	}
+}
+
+func TestCreateRemoteRejectsBase(t *testing.T) {
+	manifest, _ := newEncryptedDeltaManifest(t)
+	_, destination := newRemoteDestination(t)
+	options := CreateOptions{Destination: destination, Staging: t.TempDir(), Manifest: manifest, Base: t.TempDir()}
+	if err := Create(context.Background(), options); err == nil || !strings.Contains(err.Error(), "base backup") {
+		t.Fatalf("Create() with a remote destination and a base error = %v", err)
+	}
+}
@@ -0,0 +1,503 @@
+package fbackup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/zbiljic/fget/pkg/gitinspect"
+)
+
+type RestoreOptions struct {
+	Backup string
+	Target string
+	// Repositories selects repository IDs by exact match or path.Match
+	// pattern. An empty list selects every repository in the backup.
+	Repositories []string
+	// Filter further narrows the selection, for example by catalog tags.
+	Filter func(RepositoryEntry) bool
+	// Keys decrypt the artifacts of an encrypted backup.
+	Keys      Keys
+	Progress  func(repositoryID, status string)
+	GitRunner gitinspect.Runner
+}
+
+// RestorePlan describes what Restore would do without touching the target.
+type RestorePlan struct {
+	Backup       string             `json:"backup"`
+	Target       string             `json:"target"`
+	Repositories []RestorePlanEntry `json:"repositories"`
+}
+
+type RestorePlanEntry struct {
+	ID             string           `json:"id"`
+	Classification Classification   `json:"classification"`
+	RemoteURL      string           `json:"remote_url,omitempty"`
+	Target         string           `json:"target"`
+	TargetExists   bool             `json:"target_exists"`
+	Artifacts      []ArtifactRecord `json:"artifacts"`
+}
+
+// PlanRestore validates the backup and the selection and reports, for each
+// selected repository, the artifacts used and where it would be restored.
+func PlanRestore(ctx context.Context, options RestoreOptions) (RestorePlan, error) {
+	plan, _, err := planRestore(ctx, options)
+	return plan, err
+}
+
+// Restore rebuilds the selected repositories of a complete backup below
+// Target using their repository IDs as relative paths. Each repository is
+// assembled in a temporary sibling directory and renamed into place only after
+// its Git state matches the manifest, so an interrupted restore can simply be
+// run again.
+func Restore(ctx context.Context, options RestoreOptions) error {
+	if options.GitRunner == nil {
+		options.GitRunner = gitinspect.CLIRunner{}
+	}
+	plan, head, err := planRestore(ctx, options)
+	if err != nil {
+		return err
+	}
+	metadata := head.Metadata
+	chain, err := loadBackupChain(head)
+	if err != nil {
+		return err
+	}
+	if err := chain.unlock(options.Keys); err != nil {
+		return err
+	}
+	if err := rejectSymlinkRoot(plan.Target); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(plan.Target, 0o755); err != nil {
+		return err
+	}
+
+	repositories := make(map[string]RepositoryEntry, len(metadata.Manifest.Repositories))
+	for _, repository := range metadata.Manifest.Repositories {
+		repositories[repository.ID] = repository
+	}
+	for _, entry := range plan.Repositories {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if options.Progress != nil {
+			options.Progress(entry.ID, "starting")
+		}
+		status, err := restoreRepository(ctx, chain, plan.Target, repositories[entry.ID], options.GitRunner)
+		if err != nil {
+			return fmt.Errorf("restore %q: %w", entry.ID, err)
+		}
+		if options.Progress != nil {
+			options.Progress(entry.ID, status)
+		}
+	}
+	return nil
+}
+
+func planRestore(ctx context.Context, options RestoreOptions) (RestorePlan, backupLink, error) {
+	var head backupLink
+	if options.Backup == "" {
+		return RestorePlan{}, head, errors.New("backup directory is required")
+	}
+	if options.Target == "" {
+		return RestorePlan{}, head, errors.New("restore target is required")
+	}
+	if options.GitRunner == nil {
+		options.GitRunner = gitinspect.CLIRunner{}
+	}
+	target, err := filepath.Abs(options.Target)
+	if err != nil {
+		return RestorePlan{}, head, err
+	}
+	head, err = openBackupLocation(ctx, options.Backup)
+	if err != nil {
+		return RestorePlan{}, head, err
+	}
+	metadata := head.Metadata
+	if !metadata.Complete {
+		return RestorePlan{}, head, errors.New("backup is incomplete")
+	}
+	if err := verifyArtifacts(ctx, head, false, Keys{}, options.GitRunner); err != nil {
+		return RestorePlan{}, head, err
+	}
+
+	selected, err := selectRestoreRepositories(metadata.Manifest.Repositories, options.Repositories, options.Filter)
+	if err != nil {
+		return RestorePlan{}, head, err
+	}
+	plan := RestorePlan{Backup: head.Destination, Target: target, Repositories: make([]RestorePlanEntry, 0, len(selected))}
+	targets := make([]RepositoryEntry, 0, len(selected))
+	for _, repository := range selected {
+		if err := validateArtifactPath(repository.ID); err != nil {
+			return RestorePlan{}, head, fmt.Errorf("repository %q cannot be restored below the target: %w", repository.ID, err)
+		}
+		entry := RestorePlanEntry{
+			ID:             repository.ID,
+			Classification: repository.Classification,
+			Target:         restorePath(target, repository.ID),
+			Artifacts:      []ArtifactRecord{},
+		}
+		if repository.Classification == ClassificationRecloneable {
+			entry.RemoteURL = repository.RemoteURL
+		}
+		if _, err := os.Lstat(entry.Target); err == nil {
+			entry.TargetExists = true
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return RestorePlan{}, head, err
+		}
+		for _, kind := range expectedArtifactKinds(repository) {
+			if record, ok := findArtifact(metadata.Artifacts, repository.ID, kind); ok {
+				entry.Artifacts = append(entry.Artifacts, record)
+			}
+		}
+		plan.Repositories = append(plan.Repositories, entry)
+		targets = append(targets, RepositoryEntry{ID: repository.ID, Path: entry.Target})
+	}
+	if head.store == nil {
+		if err := validateSourceDestinationOverlap(head.Destination, targets); err != nil {
+			return RestorePlan{}, head, err
+		}
+	}
+	return plan, head, nil
+}
+
+func selectRestoreRepositories(repositories []RepositoryEntry, patterns []string, filter func(RepositoryEntry) bool) ([]RepositoryEntry, error) {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid repository pattern %q: %w", pattern, err)
+		}
+	}
+	matchedPatterns := make(map[string]bool, len(patterns))
+	selected := make([]RepositoryEntry, 0, len(repositories))
+	for _, repository := range repositories {
+		if len(patterns) > 0 {
+			matched := false
+			for _, pattern := range patterns {
+				if ok, _ := path.Match(pattern, repository.ID); ok || pattern == repository.ID {
+					matchedPatterns[pattern] = true
+					matched = true
+				}
+			}
+			if !matched {
+				continue
+			}
+		}
+		if filter != nil && !filter(repository) {
+			continue
+		}
+		selected = append(selected, repository)
+	}
+	for _, pattern := range patterns {
+		if !matchedPatterns[pattern] {
+			return nil, fmt.Errorf("no repository in the backup matches %q", pattern)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, errors.New("no repositories selected for restore")
+	}
+	return selected, nil
+}
+
+func restorePath(target, repositoryID string) string {
+	return filepath.Join(target, filepath.FromSlash(repositoryID))
+}
+
+func restoreRepository(
+	ctx context.Context,
+	chain backupChain,
+	target string,
+	repository RepositoryEntry,
+	runner gitinspect.Runner,
+) (string, error) {
+	repositoryPath := restorePath(target, repository.ID)
+	if _, err := os.Lstat(repositoryPath); err == nil {
+		// A previous run may already have published this repository.
+		if _, err := os.Lstat(filepath.Join(repositoryPath, ".git")); err != nil {
+			return "", fmt.Errorf("target %q already exists and is not a Git repository", repositoryPath)
+		}
+		if err := verifyRestoredState(ctx, repositoryPath, repository, runner); err != nil {
+			return "", fmt.Errorf("target %q already exists: %w", repositoryPath, err)
+		}
+		return "exists", nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	relativeParent, err := filepath.Rel(target, filepath.Dir(repositoryPath))
+	if err != nil {
+		return "", err
+	}
+	if err := ensureSafeDirectory(target, filepath.ToSlash(relativeParent)); err != nil {
+		return "", err
+	}
+	temporaryPath, err := os.MkdirTemp(filepath.Dir(repositoryPath), ".fbackup-restore-*")
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = os.RemoveAll(temporaryPath) }()
+
+	switch repository.Classification {
+	case ClassificationRecloneable:
+		err = restoreRecloneable(ctx, temporaryPath, repository, runner)
+	case ClassificationDelta:
+		err = restoreDelta(ctx, temporaryPath, repository, chain, runner)
+	case ClassificationFull:
+		err = extractArtifact(ctx, chain, repository.ID, "full", temporaryPath)
+	default:
+		err = fmt.Errorf("unsupported classification %q", repository.Classification)
+	}
+	if err == nil && repository.Classification != ClassificationFull && len(repository.Submodules) > 0 {
+		err = restoreSubmodules(ctx, temporaryPath, runner)
+	}
+	if err == nil && repository.Classification == ClassificationDelta {
+		var cleanup func()
+		cleanup, err = restoreWorktrees(ctx, chain, temporaryPath, repositoryPath, repository, runner)
+		defer func() {
+			if err != nil {
+				cleanup()
+			}
+		}()
+	}
+	if err != nil {
+		return "", err
+	}
+	if err = verifyRestoredState(ctx, temporaryPath, repository, runner); err != nil {
+		return "", err
+	}
+	if repository.Classification == ClassificationDelta {
+		if err = restoreLocalConfig(ctx, chain, temporaryPath, repository); err != nil {
+			return "", err
+		}
+	}
+	if err = os.Rename(temporaryPath, repositoryPath); err != nil {
+		return "", err
+	}
+	return "complete", nil
+}
+
+func restoreRecloneable(ctx context.Context, repositoryPath string, repository RepositoryEntry, runner gitinspect.Runner) error {
+	if repository.RemoteURL == "" {
+		return errors.New("recloneable repository has no remote URL")
+	}
+	if _, err := runner.Run(ctx, filepath.Dir(repositoryPath), "clone", "-q", "--no-checkout", repository.RemoteURL, repositoryPath); err != nil {
+		return fmt.Errorf("clone: %w", err)
+	}
+	head := repository.Git.Head
+	if head.Commit == "" {
+		return nil
+	}
+	if branch, ok := strings.CutPrefix(head.Ref, "refs/heads/"); ok {
+		if _, err := runner.Run(ctx, repositoryPath, "checkout", "-q", "-B", branch, head.Commit); err != nil {
+			return fmt.Errorf("checkout: %w", err)
+		}
+		return restoreUpstream(ctx, repositoryPath, branch, repository, runner)
+	}
+	if _, err := runner.Run(ctx, repositoryPath, "checkout", "-q", "--detach", head.Commit); err != nil {
+		return fmt.Errorf("checkout: %w", err)
+	}
+	return nil
+}
+
+// restoreSubmodules clones the submodules of a repository that was not
+// archived in full at the commits its tree records. The audit only allows
+// this when every submodule was recloneable at exactly those commits.
+func restoreSubmodules(ctx context.Context, repositoryPath string, runner gitinspect.Runner) error {
+	if _, err := runner.Run(ctx, repositoryPath, "submodule", "update", "-q", "--init", "--recursive"); err != nil {
+		return fmt.Errorf("submodule update: %w", err)
+	}
+	return nil
+}
+
+func restoreDelta(
+	ctx context.Context,
+	repositoryPath string,
+	repository RepositoryEntry,
+	chain backupChain,
+	runner gitinspect.Runner,
+) error {
+	bundle, ok := findArtifact(chain[0].Metadata.Artifacts, repository.ID, "bundle")
+	if !ok {
+		return errors.New(`missing artifact kind "bundle"`)
+	}
+	bundles, stored, cleanup, err := chain.bundleFiles(ctx, bundle)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	if _, err := runner.Run(ctx, repositoryPath, "init", "-q"); err != nil {
+		return fmt.Errorf("init: %w", err)
+	}
+	if err := fetchBundleChain(ctx, runner, repositoryPath, bundles, stored); err != nil {
+		return fmt.Errorf("fetch bundle: %w", err)
+	}
+	if len(repository.MissingLFSObjects) > 0 {
+		if err := restoreLFSObjects(ctx, chain, repositoryPath, repository); err != nil {
+			return err
+		}
+	}
+	if repository.RemoteURL != "" {
+		if _, err := runner.Run(ctx, repositoryPath, "remote", "add", "origin", repository.RemoteURL); err != nil {
+			return fmt.Errorf("configure origin: %w", err)
+		}
+	}
+
+	head := repository.Git.Head
+	if head.Ref != "" {
+		if _, err := runner.Run(ctx, repositoryPath, "symbolic-ref", "HEAD", head.Ref); err != nil {
+			return fmt.Errorf("set HEAD: %w", err)
+		}
+	} else if head.Commit != "" {
+		if _, err := runner.Run(ctx, repositoryPath, "update-ref", "--no-deref", "HEAD", head.Commit); err != nil {
+			return fmt.Errorf("set HEAD: %w", err)
+		}
+	}
+	if _, err := runner.Run(ctx, repositoryPath, "reset", "-q", "--hard", "HEAD"); err != nil {
+		return fmt.Errorf("checkout: %w", err)
+	}
+	if branch, ok := strings.CutPrefix(head.Ref, "refs/heads/"); ok {
+		if err := restoreUpstream(ctx, repositoryPath, branch, repository, runner); err != nil {
+			return err
+		}
+	}
+
+	// index.patch holds HEAD to index and is applied to both layers before
+	// tracked.patch moves only the worktree on from the index.
+	layers := []struct {
+		kind string
+		args []string
+	}{
+		{"index-patch", []string{"apply", "--index", "--binary"}},
+		{"patch", []string{"apply", "--binary"}},
+	}
+	for _, layer := range layers {
+		if err := applyPatchArtifact(ctx, chain, repositoryPath, repository.ID, layer.kind, layer.args, runner); err != nil {
+			return err
+		}
+	}
+
+	if err := extractArtifact(ctx, chain, repository.ID, "untracked", repositoryPath); err != nil {
+		return fmt.Errorf("extract untracked: %w", err)
+	}
+	return restoreStashes(ctx, chain, repositoryPath, repository, runner)
+}
+
+// applyPatchArtifact applies a patch artifact, decrypted to a temporary file
+// when needed. Git rejects empty patches, so they are skipped.
+func applyPatchArtifact(
+	ctx context.Context,
+	chain backupChain,
+	repositoryPath, repositoryID, kind string,
+	args []string,
+	runner gitinspect.Runner,
+) error {
+	record, err := chain.newestArtifact(repositoryID, kind)
+	if err != nil {
+		return err
+	}
+	patch, cleanup, err := chain.materialize(ctx, record)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	info, err := os.Stat(patch)
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return nil
+	}
+	if _, err := runner.Run(ctx, repositoryPath, append(args, patch)...); err != nil {
+		return fmt.Errorf("apply %s: %w", kind, err)
+	}
+	return nil
+}
+
+// extractArtifact extracts a tar artifact into root, decrypting and
+// decompressing on the fly.
+func extractArtifact(ctx context.Context, chain backupChain, repositoryID, kind, root string) error {
+	record, err := chain.newestArtifact(repositoryID, kind)
+	if err != nil {
+		return err
+	}
+	archive, err := chain.openArchive(ctx, record)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = archive.Close() }()
+	return extractTar(ctx, archive, root)
+}
+
+// restoreUpstream recreates the branch tracking configuration recorded by the
+// audit. Remote tracking refs themselves come from the clone or the bundle.
+func restoreUpstream(ctx context.Context, repositoryPath, branch string, repository RepositoryEntry, runner gitinspect.Runner) error {
+	upstream := repository.Git.Upstream
+	if upstream == nil || upstream.Ref == "" {
+		return nil
+	}
+	remote, merge := ".", upstream.Ref
+	if remoteBranch, ok := strings.CutPrefix(upstream.Ref, "refs/remotes/"); ok {
+		name, remoteBranchName, found := strings.Cut(remoteBranch, "/")
+		if !found {
+			return fmt.Errorf("malformed upstream ref %q", upstream.Ref)
+		}
+		remote, merge = name, "refs/heads/"+remoteBranchName
+		if _, err := runner.Run(ctx, repositoryPath, "config", "--get", "remote."+remote+".fetch"); err != nil {
+			refspec := "+refs/heads/*:refs/remotes/" + remote + "/*"
+			if _, err := runner.Run(ctx, repositoryPath, "config", "remote."+remote+".fetch", refspec); err != nil {
+				return fmt.Errorf("configure remote %q: %w", remote, err)
+			}
+		}
+	}
+	if _, err := runner.Run(ctx, repositoryPath, "config", "branch."+branch+".remote", remote); err != nil {
+		return fmt.Errorf("configure upstream: %w", err)
+	}
+	if _, err := runner.Run(ctx, repositoryPath, "config", "branch."+branch+".merge", merge); err != nil {
+		return fmt.Errorf("configure upstream: %w", err)
+	}
+	return nil
+}
+
+// verifyRestoredState compares a restored repository with the audited Git
+// state. A reclone only reproduces HEAD and the upstream ref name because the
+// remote may have moved on and other local refs are not part of the backup.
+func verifyRestoredState(ctx context.Context, repositoryPath string, repository RepositoryEntry, runner gitinspect.Runner) error {
+	state, err := gitinspect.InspectState(ctx, repositoryPath, runner)
+	if err != nil {
+		return fmt.Errorf("inspect restored state: %w", err)
+	}
+	expected := repository.Git
+	if state.Head != expected.Head {
+		return fmt.Errorf("restored HEAD %s does not match manifest %s", describeReference(state.Head), describeReference(expected.Head))
+	}
+	if (state.Upstream == nil) != (expected.Upstream == nil) {
+		return errors.New("restored upstream does not match manifest")
+	}
+	if expected.Upstream != nil && state.Upstream.Ref != expected.Upstream.Ref {
+		return fmt.Errorf("restored upstream %q does not match manifest %q", state.Upstream.Ref, expected.Upstream.Ref)
+	}
+	if repository.Classification == ClassificationRecloneable {
+		return nil
+	}
+	if expected.Upstream != nil && state.Upstream.Commit != expected.Upstream.Commit {
+		return fmt.Errorf("restored upstream commit %s does not match manifest %s", state.Upstream.Commit, expected.Upstream.Commit)
+	}
+	if state.LocalRefsDigest != expected.LocalRefsDigest || state.LocalRefCount != expected.LocalRefCount {
+		return errors.New("restored local refs do not match manifest")
+	}
+	return nil
+}
+
+func describeReference(reference gitinspect.Reference) string {
+	if reference.Commit == "" {
+		return "(unborn)"
+	}
+	if reference.Ref == "" {
+		return reference.Commit
+	}
+	return reference.Ref + "@" + reference.Commit
+}
@@ -0,0 +1,280 @@
+package fbackup
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zbiljic/fget/pkg/gitinspect"
+	"github.com/zbiljic/fget/pkg/giturl"
+)
+
+func gitOutputTest(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v (%s)", args, err, output)
+	}
+	return string(output)
+}
+
+func inspectEntryState(t *testing.T, entry *RepositoryEntry) {
+	t.Helper()
+	state, err := gitinspect.InspectState(context.Background(), entry.Path, gitinspect.CLIRunner{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry.Git = state
+}
+
+func TestRestoreDeltaReproducesLayersAndRefs(t *testing.T) {
+	root := t.TempDir()
+	recloneable := newRecloneableRepository(t, "example/clean")
+	repo := recloneable.Path
+	if err := os.WriteFile(filepath.Join(repo, "layer.txt"), []byte("A\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	mustGitTest(t, repo, "add", "layer.txt")
+	mustGitTest(t, repo, "commit", "-qm", "local-only")
+	mustGitTest(t, repo, "branch", "feature")
+	mustGitTest(t, repo, "tag", "local-tag")
+	if err := os.WriteFile(filepath.Join(repo, "layer.txt"), []byte("B\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	mustGitTest(t, repo, "add", "layer.txt")
+	if err := os.WriteFile(filepath.Join(repo, "layer.txt"), []byte("C\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(repo, "scratch"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "scratch", "notes"), []byte("notes\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	entry := RepositoryEntry{ID: "example/delta", Path: repo, RemoteURL: recloneable.RemoteURL, Classification: ClassificationDelta}
+	inspectEntryState(t, &entry)
+
+	destination := filepath.Join(root, "backup")
+	manifest := Manifest{Version: ManifestVersion, Repositories: []RepositoryEntry{entry}}
+	if err := Create(context.Background(), CreateOptions{Destination: destination, Manifest: manifest}); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(root, "restore")
+	var statuses []string
+	options := RestoreOptions{Backup: destination, Target: target, Progress: func(_, status string) {
+		statuses = append(statuses, status)
+	}}
+	if err := Restore(context.Background(), options); err != nil {
+		t.Fatal(err)
+	}
+	restored := filepath.Join(target, "example", "delta")
+	if got, want := gitOutputTest(t, restored, "status", "--porcelain"), gitOutputTest(t, repo, "status", "--porcelain"); got != want {
+		t.Fatalf("restored status = %q, want %q", got, want)
+	}
+	if got := gitOutputTest(t, restored, "show", ":layer.txt"); got != "B\n" {
+		t.Fatalf("restored index layer = %q, want B", got)
+	}
+	for name, want := range map[string]string{"layer.txt": "C\n", "scratch/notes": "notes\n"} {
+		data, err := os.ReadFile(filepath.Join(restored, filepath.FromSlash(name)))
+		if err != nil || string(data) != want {
+			t.Fatalf("restored %s = %q, %v; want %q", name, data, err, want)
+		}
+	}
+	if got, want := strings.TrimSpace(gitOutputTest(t, restored, "remote", "get-url", "origin")), giturl.Sanitize(recloneable.RemoteURL); got != want {
+		t.Fatalf("restored origin = %q, want %q", got, want)
+	}
+
+	statuses = nil
+	if err := Restore(context.Background(), options); err != nil {
+		t.Fatalf("second Restore() error = %v", err)
+	}
+	if len(statuses) != 2 || statuses[1] != "exists" {
+		t.Fatalf("second Restore() statuses = %v, want existing repository to be skipped", statuses)
+	}
+}
+
+func TestRestoreFullAndRecloneable(t *testing.T) {
+	root := t.TempDir()
+	full := filepath.Join(root, "full")
+	mustGitTest(t, root, "init", "-q", full)
+	mustGitTest(t, full, "config", "user.email", "test@example.com")
+	mustGitTest(t, full, "config", "user.name", "Test")
+	if err := os.WriteFile(filepath.Join(full, "tracked"), []byte("tracked\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	mustGitTest(t, full, "add", "tracked")
+	mustGitTest(t, full, "commit", "-qm", "initial")
+	if err := os.Symlink("tracked", filepath.Join(full, "link")); err != nil {
+		t.Fatal(err)
+	}
+	fullEntry := RepositoryEntry{ID: "example/full", Path: full, Classification: ClassificationFull}
+	inspectEntryState(t, &fullEntry)
+	recloneable := newRecloneableRepository(t, "example/clean")
+
+	destination := filepath.Join(root, "backup")
+	manifest := Manifest{Version: ManifestVersion, Repositories: []RepositoryEntry{recloneable, fullEntry}}
+	if err := Create(context.Background(), CreateOptions{Destination: destination, Manifest: manifest}); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(root, "restore")
+	if err := Restore(context.Background(), RestoreOptions{Backup: destination, Target: target}); err != nil {
+		t.Fatal(err)
+	}
+	if link, err := os.Readlink(filepath.Join(target, "example", "full", "link")); err != nil || link != "tracked" {
+		t.Fatalf("restored symlink = %q, %v", link, err)
+	}
+	clean := filepath.Join(target, "example", "clean")
+	if got := gitOutputTest(t, clean, "status", "--porcelain"); got != "" {
+		t.Fatalf("recloned repository is dirty: %q", got)
+	}
+	entries, err := os.ReadDir(filepath.Join(target, "example"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".fbackup-restore-") {
+			t.Fatalf("temporary restore directory left behind: %s", entry.Name())
+		}
+	}
+}
+
+func TestRestoreRecloneableInitializesSubmodules(t *testing.T) {
+	t.Setenv("GIT_ALLOW_PROTOCOL", "file")
+	root := t.TempDir()
+	submodule := newRecloneableRepository(t, "example/sub")
+	parent := newRecloneableRepository(t, "example/parent")
+	mustGitTest(t, parent.Path, "submodule", "add", "-q", submodule.RemoteURL, "deps/sub")
+	mustGitTest(t, parent.Path, "commit", "-qm", "add submodule")
+	mustGitTest(t, parent.Path, "push", "-q", "origin", "HEAD")
+	inspectEntryState(t, &parent)
+	parent.HasSubmodules = true
+	parent.Submodules = []SubmoduleEntry{{
+		Path:           "deps/sub",
+		RecordedCommit: submodule.Git.Head.Commit,
+		Repository:     submodule,
+	}}
+
+	destination := filepath.Join(root, "backup")
+	manifest := Manifest{Version: ManifestVersion, Repositories: []RepositoryEntry{parent}}
+	if err := Create(context.Background(), CreateOptions{Destination: destination, Manifest: manifest}); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(root, "restore")
+	if err := Restore(context.Background(), RestoreOptions{Backup: destination, Target: target}); err != nil {
+		t.Fatal(err)
+	}
+	restored := filepath.Join(target, "example", "parent")
+	if got := strings.TrimSpace(gitOutputTest(t, filepath.Join(restored, "deps", "sub"), "rev-parse", "HEAD")); got != submodule.Git.Head.Commit {
+		t.Fatalf("restored submodule HEAD = %q, want %q", got, submodule.Git.Head.Commit)
+	}
+	if got := gitOutputTest(t, restored, "status", "--porcelain"); got != "" {
+		t.Fatalf("restored repository is dirty: %q", got)
+	}
+}
+
+func TestRestoreRejectsIncompleteBackupAndForeignTarget(t *testing.T) {
+	root := t.TempDir()
+	repo := filepath.Join(root, "repo")
+	mustGitTest(t, root, "init", "-q", repo)
+	mustGitTest(t, repo, "config", "user.email", "test@example.com")
+	mustGitTest(t, repo, "config", "user.name", "Test")
+	mustGitTest(t, repo, "commit", "--allow-empty", "-qm", "initial")
+	entry := RepositoryEntry{ID: "example/full", Path: repo, Classification: ClassificationFull}
+	inspectEntryState(t, &entry)
+	destination := filepath.Join(root, "backup")
+	if err := Create(context.Background(), CreateOptions{Destination: destination, Manifest: Manifest{Version: ManifestVersion, Repositories: []RepositoryEntry{entry}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	target := filepath.Join(root, "restore")
+	if err := os.MkdirAll(filepath.Join(target, "example", "full"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := Restore(context.Background(), RestoreOptions{Backup: destination, Target: target}); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("Restore() into occupied target error = %v", err)
+	}
+
+	metadata, err := readBackupMetadata(filepath.Join(destination, "backup.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata.Complete = false
+	if err := writeJSONAtomic(filepath.Join(destination, "backup.json"), metadata, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Restore(context.Background(), RestoreOptions{Backup: destination, Target: filepath.Join(root, "other")}); err == nil || !strings.Contains(err.Error(), "incomplete") {
+		t.Fatalf("Restore() from incomplete backup error = %v", err)
+	}
+}
+
+func TestPlanRestoreSelectsRepositoriesWithoutTouchingTarget(t *testing.T) {
+	root := t.TempDir()
+	repositories := make([]RepositoryEntry, 0, 3)
+	for _, id := range []string{"example/a", "example/b", "other/c"} {
+		repo := filepath.Join(root, "src", filepath.FromSlash(id))
+		if err := os.MkdirAll(filepath.Dir(repo), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		mustGitTest(t, root, "init", "-q", repo)
+		mustGitTest(t, repo, "config", "user.email", "test@example.com")
+		mustGitTest(t, repo, "config", "user.name", "Test")
+		mustGitTest(t, repo, "commit", "--allow-empty", "-qm", "initial")
+		entry := RepositoryEntry{ID: id, Path: repo, Classification: ClassificationFull}
+		inspectEntryState(t, &entry)
+		repositories = append(repositories, entry)
+	}
+	destination := filepath.Join(root, "backup")
+	if err := Create(context.Background(), CreateOptions{Destination: destination, Manifest: Manifest{Version: ManifestVersion, Repositories: repositories}}); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(root, "restore")
+	if err := os.MkdirAll(filepath.Join(target, "example", "b"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	options := RestoreOptions{
+		Backup:       destination,
+		Target:       target,
+		Repositories: []string{"example/*"},
+		Filter:       func(entry RepositoryEntry) bool { return entry.ID != "example/a" },
+	}
+	plan, err := PlanRestore(context.Background(), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Repositories) != 1 || plan.Repositories[0].ID != "example/b" {
+		t.Fatalf("plan repositories = %+v, want example/b", plan.Repositories)
+	}
+	entry := plan.Repositories[0]
+	if !entry.TargetExists || entry.Target != filepath.Join(target, "example", "b") {
+		t.Fatalf("plan entry = %+v", entry)
+	}
+	if len(entry.Artifacts) != 1 || entry.Artifacts[0].Kind != "full" {
+		t.Fatalf("plan artifacts = %+v", entry.Artifacts)
+	}
+	if _, err := os.Stat(filepath.Join(target, "example", "a")); !os.IsNotExist(err) {
+		t.Fatalf("PlanRestore() touched the target: %v", err)
+	}
+
+	options.Repositories = []string{"missing/*"}
+	if _, err := PlanRestore(context.Background(), options); err == nil || !strings.Contains(err.Error(), "missing/*") {
+		t.Fatalf("PlanRestore() with unmatched pattern error = %v", err)
+	}
+
+	options.Repositories = []string{"other/c"}
+	options.Filter = nil
+	if err := Restore(context.Background(), options); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(target, "other", "c", ".git")); err != nil {
+		t.Fatalf("selected repository was not restored: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(target, "example", "a")); !os.IsNotExist(err) {
+		t.Fatalf("unselected repository was restored: %v", err)
+	}
+}
@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const (
+	// DefaultPartSize is the multipart upload part size. S3 requires at least
+	// 5 MiB for every part but the last.
+	DefaultPartSize = 16 << 20
+	minPartSize     = 5 << 20
+	defaultEndpoint = "https://s3.amazonaws.com"
+	defaultRegion   = "us-east-1"
+)
+
+// S3Config configures an S3-compatible backend.
+type S3Config struct {
+	// Endpoint is the service URL, for example http://localhost:9000 for
+	// MinIO. Custom endpoints use path-style requests.
+	Endpoint        string
+	Region          string
+	Bucket          string
+	Prefix          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	PartSize        int64
+	Transport       http.RoundTripper
+}
+
+// S3 stores objects in an S3-compatible bucket below a key prefix. Objects
+// are written with multipart uploads, so they only appear once complete, and
+// every part carries a Content-MD5 checksum.
+type S3 struct {
+	config S3Config
+	client *minio.Client
+}
+
+// ParseS3URL parses s3://bucket/prefix. The endpoint and region may be given
+// as query parameters ("endpoint", "region") or with the AWS_ENDPOINT_URL_S3,
+// AWS_ENDPOINT_URL, AWS_REGION, and AWS_DEFAULT_REGION environment variables.
+// Credentials come from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and
+// AWS_SESSION_TOKEN.
+func ParseS3URL(raw string) (S3Config, error) {
+	location, err := url.Parse(raw)
+	if err != nil {
+		return S3Config{}, err
+	}
+	if location.Scheme != "s3" || location.Host == "" {
+		return S3Config{}, fmt.Errorf("invalid S3 location %q: want s3://bucket/prefix", raw)
+	}
+	query := location.Query()
+	return S3Config{
+		Endpoint:        firstNonEmpty(query.Get("endpoint"), os.Getenv("AWS_ENDPOINT_URL_S3"), os.Getenv("AWS_ENDPOINT_URL")),
+		Region:          firstNonEmpty(query.Get("region"), os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION")),
+		Bucket:          location.Host,
+		Prefix:          strings.Trim(location.Path, "/"),
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}, nil
+}
+
+func NewS3(config S3Config) (*S3, error) {
+	if config.Bucket == "" {
+		return nil, errors.New("S3 bucket is required")
+	}
+	if config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return nil, errors.New("S3 credentials are required (AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY)")
+	}
+	lookup := minio.BucketLookupPath
+	if config.Endpoint == "" {
+		config.Endpoint = defaultEndpoint
+		lookup = minio.BucketLookupAuto
+	}
+	if config.Region == "" {
+		config.Region = defaultRegion
+	}
+	if config.PartSize == 0 {
+		config.PartSize = DefaultPartSize
+	}
+	if config.PartSize < minPartSize {
+		return nil, fmt.Errorf("S3 part size must be at least %d bytes", minPartSize)
+	}
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint: %w", err)
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", config.Endpoint)
+	}
+	client, err := minio.New(endpoint.Host, &minio.Options{
+		Creds:        credentials.NewStaticV4(config.AccessKeyID, config.SecretAccessKey, config.SessionToken),
+		Secure:       endpoint.Scheme == "https",
+		Transport:    config.Transport,
+		Region:       config.Region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint %q: %w", config.Endpoint, err)
+	}
+	config.Prefix = strings.Trim(config.Prefix, "/")
+	return &S3{config: config, client: client}, nil
+}
+
+func (s *S3) String() string {
+	location := "s3://" + s.config.Bucket
+	if s.config.Prefix != "" {
+		location += "/" + s.config.Prefix
+	}
+	return location
+}
+
+func (s *S3) objectKey(key string) string {
+	if s.config.Prefix == "" {
+		return key
+	}
+	return s.config.Prefix + "/" + key
+}
+
+func (s *S3) Put(ctx context.Context, key string, r io.Reader) error {
+	if err := ValidateKey(key); err != nil {
+		return err
+	}
+	_, err := s.client.PutObject(ctx, s.config.Bucket, s.objectKey(key), r, -1, minio.PutObjectOptions{
+		PartSize:       uint64(s.config.PartSize),
+		SendContentMd5: true,
+	})
+	if err != nil {
+		return fmt.Errorf("upload %s: %w", key, s3Error(err))
+	}
+	return nil
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := ValidateKey(key); err != nil {
+		return nil, err
+	}
+	object, err := s.client.GetObject(ctx, s.config.Bucket, s.objectKey(key), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", key, s3Error(err))
+	}
+	// GetObject is lazy; report a missing object here rather than on the
+	// first read.
+	if _, err := object.Stat(); err != nil {
+		_ = object.Close()
+		return nil, fmt.Errorf("get %s: %w", key, s3Error(err))
+	}
+	return object, nil
+}
+
+func (s *S3) Stat(ctx context.Context, key string) (Info, error) {
+	if err := ValidateKey(key); err != nil {
+		return Info{}, err
+	}
+	object, err := s.client.StatObject(ctx, s.config.Bucket, s.objectKey(key), minio.StatObjectOptions{})
+	if err != nil {
+		return Info{}, fmt.Errorf("stat %s: %w", key, s3Error(err))
+	}
+	return Info{Key: key, Size: object.Size}, nil
+}
+
+func (s *S3) List(ctx context.Context, prefix string) ([]Info, error) {
+	listPrefix := prefix
+	if s.config.Prefix != "" {
+		listPrefix = s.objectKey(prefix)
+	}
+	var objects []Info
+	for object := range s.client.ListObjects(ctx, s.config.Bucket, minio.ListObjectsOptions{Prefix: listPrefix, Recursive: true}) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("list %s: %w", prefix, s3Error(object.Err))
+		}
+		key := object.Key
+		if s.config.Prefix != "" {
+			key = strings.TrimPrefix(key, s.config.Prefix+"/")
+		}
+		objects = append(objects, Info{Key: key, Size: object.Size})
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if err := ValidateKey(key); err != nil {
+		return err
+	}
+	if err := s.client.RemoveObject(ctx, s.config.Bucket, s.objectKey(key), minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("delete %s: %w", key, s3Error(err))
+	}
+	return nil
+}
+
+// s3Error maps the not found answers of S3 to fs.ErrNotExist.
+func s3Error(err error) error {
+	response := minio.ToErrorResponse(err)
+	if response.StatusCode == http.StatusNotFound || response.Code == "NoSuchKey" {
+		return fmt.Errorf("%w: %v", fs.ErrNotExist, err)
+	}
+	return err
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,65 @@
+// Package storage abstracts where backup files live. Keys are slash-separated
+// relative paths such as "backup.json" or "repos/<id>/full.tar.gz".
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Info describes a stored object.
+type Info struct {
+	Key  string
+	Size int64
+}
+
+// Backend stores backup files. Missing objects are reported with errors that
+// match fs.ErrNotExist.
+type Backend interface {
+	// Put stores r under key, replacing any existing object. The object only
+	// becomes visible once it is complete.
+	Put(ctx context.Context, key string, r io.Reader) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Stat(ctx context.Context, key string) (Info, error)
+	// List returns every object whose key starts with prefix, sorted by key.
+	List(ctx context.Context, prefix string) ([]Info, error)
+	Delete(ctx context.Context, key string) error
+	// String returns the location of the backend, suitable for messages.
+	String() string
+}
+
+// IsRemote reports whether location names an object store rather than a
+// local directory.
+func IsRemote(location string) bool {
+	return strings.HasPrefix(location, "s3://")
+}
+
+// Open returns the backend for an s3:// URL or a local directory.
+func Open(location string) (Backend, error) {
+	if IsRemote(location) {
+		config, err := ParseS3URL(location)
+		if err != nil {
+			return nil, err
+		}
+		return NewS3(config)
+	}
+	return NewLocal(location)
+}
+
+// ValidateKey rejects keys that could escape the backend root.
+func ValidateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return fmt.Errorf("invalid storage key %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("invalid storage key %q", key)
+		}
+	}
+	return nil
+}
+
+var errNotRegular = errors.New("not a regular file")
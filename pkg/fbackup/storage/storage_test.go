@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zbiljic/fget/pkg/fbackup/storage/storagetest"
+)
+
+func newTestS3(t *testing.T, store storagetest.S3, endpoint string) *S3 {
+	t.Helper()
+	backend, err := NewS3(S3Config{
+		Endpoint:        endpoint,
+		Region:          store.Region,
+		Bucket:          store.Bucket,
+		Prefix:          store.Prefix,
+		AccessKeyID:     store.AccessKeyID,
+		SecretAccessKey: store.SecretAccessKey,
+		PartSize:        minPartSize,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return backend
+}
+
+func TestS3RoundTrip(t *testing.T) {
+	store := storagetest.NewS3(t)
+	backend := newTestS3(t, store, store.Endpoint)
+	ctx := context.Background()
+
+	objects := map[string]string{
+		"backup.json":                        `{"complete":true}`,
+		"repos/abc/full.tar.gz":              "0123456789",
+		"repos/abc/untracked.tar.gz":         "",
+		"repos/with space/local-only.bundle": "bundle",
+		// larger than a part, so it is uploaded in several
+		"repos/abc/large.bundle": strings.Repeat("x", minPartSize+1),
+	}
+	for key, content := range objects {
+		if err := backend.Put(ctx, key, strings.NewReader(content)); err != nil {
+			t.Fatalf("Put(%s) error = %v", key, err)
+		}
+	}
+
+	for key, content := range objects {
+		info, err := backend.Stat(ctx, key)
+		if err != nil || info.Size != int64(len(content)) {
+			t.Fatalf("Stat(%s) = %+v, %v", key, info, err)
+		}
+		reader, err := backend.Get(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(reader)
+		_ = reader.Close()
+		if err != nil || string(data) != content {
+			t.Fatalf("Get(%s) = %d bytes, %v", key, len(data), err)
+		}
+	}
+
+	listed, err := backend.List(ctx, "repos/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, info := range listed {
+		keys = append(keys, info.Key)
+	}
+	want := []string{"repos/abc/full.tar.gz", "repos/abc/large.bundle", "repos/abc/untracked.tar.gz", "repos/with space/local-only.bundle"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Fatalf("List() = %v, want %v", keys, want)
+	}
+
+	if err := backend.Delete(ctx, "backup.json"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.Stat(ctx, "backup.json"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Stat() after Delete error = %v, want fs.ErrNotExist", err)
+	}
+	if _, err := backend.Get(ctx, "missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Get() missing error = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestS3FailedUploadLeavesNoObject(t *testing.T) {
+	store := storagetest.NewS3(t)
+	proxy := store.NewProxy(t)
+	backend := newTestS3(t, store, proxy.URL)
+
+	proxy.FailUploads(true)
+	err := backend.Put(context.Background(), "backup.json", strings.NewReader(strings.Repeat("x", minPartSize+1)))
+	if err == nil || !strings.Contains(err.Error(), "injected upload failure") {
+		t.Fatalf("Put() error = %v, want injected failure", err)
+	}
+	proxy.FailUploads(false)
+	if _, err := backend.Stat(context.Background(), "backup.json"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Stat() after a failed Put error = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestParseS3URL(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "id")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	t.Setenv("AWS_ENDPOINT_URL_S3", "")
+	t.Setenv("AWS_ENDPOINT_URL", "http://env:9000")
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "eu-west-1")
+
+	config, err := ParseS3URL("s3://bucket/nightly/2026/?region=eu-central-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := S3Config{
+		Endpoint:        "http://env:9000",
+		Region:          "eu-central-1",
+		Bucket:          "bucket",
+		Prefix:          "nightly/2026",
+		AccessKeyID:     "id",
+		SecretAccessKey: "secret",
+	}
+	if !reflect.DeepEqual(config, want) {
+		t.Fatalf("ParseS3URL() = %+v, want %+v", config, want)
+	}
+	for _, location := range []string{"s3:///prefix", "https://bucket/prefix"} {
+		if _, err := ParseS3URL(location); err == nil {
+			t.Fatalf("ParseS3URL(%q) accepted an invalid location", location)
+		}
+	}
+}
+
+func TestLocalRejectsUnsafeKeysAndSymlinks(t *testing.T) {
+	root := t.TempDir()
+	backend, err := NewLocal(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := backend.Put(ctx, "repos/abc/full.tar.gz", bytes.NewReader([]byte("archive"))); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := backend.Stat(ctx, "repos/abc/full.tar.gz"); err != nil || info.Size != 7 {
+		t.Fatalf("Stat() = %+v, %v", info, err)
+	}
+	for _, key := range []string{"", "/etc/passwd", "../outside", "repos/../../outside", "repos//x", `repos\x`} {
+		if err := backend.Put(ctx, key, strings.NewReader("x")); err == nil {
+			t.Fatalf("Put(%q) accepted an unsafe key", key)
+		}
+	}
+
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(root, "linked")); err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.Put(ctx, "linked/file", strings.NewReader("x")); err == nil {
+		t.Fatal("Put() wrote through a symlinked directory")
+	}
+	if err := os.Symlink(filepath.Join(root, "repos/abc/full.tar.gz"), filepath.Join(root, "alias")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.Get(ctx, "alias"); err == nil || !strings.Contains(err.Error(), "not a regular file") {
+		t.Fatalf("Get() symlink error = %v, want not a regular file", err)
+	}
+	if _, err := backend.Stat(ctx, "missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Stat() missing error = %v, want fs.ErrNotExist", err)
+	}
+}
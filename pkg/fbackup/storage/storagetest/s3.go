@@ -0,0 +1,128 @@
+// Package storagetest provides an S3-compatible object store for tests. By
+// default it is an in-memory stand-in; setting FGET_TEST_S3_ENDPOINT together
+// with FGET_TEST_S3_BUCKET, AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and,
+// optionally, FGET_TEST_S3_REGION runs the same tests against a real store,
+// such as a local MinIO server.
+package storagetest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3 is a bucket of the configured object store. Every test gets its own
+// prefix, whose objects are removed when the test ends.
+type S3 struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	Prefix          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// NewS3 returns the configured object store, or starts an in-memory one when
+// FGET_TEST_S3_ENDPOINT is not set.
+func NewS3(t testing.TB) S3 {
+	t.Helper()
+	store := S3{
+		Endpoint:        os.Getenv("FGET_TEST_S3_ENDPOINT"),
+		Region:          os.Getenv("FGET_TEST_S3_REGION"),
+		Bucket:          os.Getenv("FGET_TEST_S3_BUCKET"),
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+	}
+	switch {
+	case store.Endpoint == "":
+		store = newServer(t)
+	case store.Bucket == "" || store.AccessKeyID == "" || store.SecretAccessKey == "":
+		t.Fatal("FGET_TEST_S3_ENDPOINT requires FGET_TEST_S3_BUCKET, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	if store.Region == "" {
+		store.Region = "us-east-1"
+	}
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		t.Fatal(err)
+	}
+	name := strings.NewReplacer("/", "-", " ", "-").Replace(t.Name())
+	store.Prefix = "fget-test/" + name + "-" + hex.EncodeToString(suffix)
+
+	client := store.client(t)
+	t.Cleanup(func() {
+		ctx := context.Background()
+		for object := range client.ListObjects(ctx, store.Bucket, minio.ListObjectsOptions{Prefix: store.Prefix + "/", Recursive: true}) {
+			if object.Err == nil {
+				_ = client.RemoveObject(ctx, store.Bucket, object.Key, minio.RemoveObjectOptions{})
+			}
+		}
+	})
+	return store
+}
+
+func (s S3) client(t testing.TB) *minio.Client {
+	t.Helper()
+	endpoint, err := url.Parse(s.Endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := minio.New(endpoint.Host, &minio.Options{
+		Creds:        credentials.NewStaticV4(s.AccessKeyID, s.SecretAccessKey, ""),
+		Secure:       endpoint.Scheme == "https",
+		Region:       s.Region,
+		BucketLookup: minio.BucketLookupPath,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// Proxy forwards requests to the object store, failing uploads on demand.
+type Proxy struct {
+	*httptest.Server
+
+	failUploads atomic.Bool
+}
+
+// NewProxy starts a proxy in front of the object store that is closed when
+// the test ends. Requests keep the Host header of the proxy, which they were
+// signed for.
+func (s S3) NewProxy(t testing.TB) *Proxy {
+	t.Helper()
+	target, err := url.Parse(s.Endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := &Proxy{}
+	forward := httputil.NewSingleHostReverseProxy(target)
+	proxy.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && proxy.failUploads.Load() {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><Error><Code>AccessDenied</Code><Message>injected upload failure</Message></Error>`))
+			return
+		}
+		forward.ServeHTTP(w, r)
+	}))
+	t.Cleanup(proxy.Close)
+	return proxy
+}
+
+// FailUploads makes the proxy reject object and part uploads while fail is
+// set.
+func (p *Proxy) FailUploads(fail bool) {
+	p.failUploads.Store(fail)
+}
@@ -0,0 +1,313 @@
+package storagetest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5" //nolint:gosec // Content-MD5 is part of the S3 API
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	serverAccessKeyID     = "storagetest"
+	serverSecretAccessKey = "storagetest-secret"
+	serverRegion          = "us-east-1"
+	serverBucket          = "backups"
+)
+
+// server holds a single bucket in memory. It answers the path-style requests
+// minio-go sends for the storage package: multipart uploads, PUT, GET, HEAD,
+// DELETE, and ListObjectsV2. Requests must name its access key, but their
+// signatures are not checked.
+type server struct {
+	mu      sync.Mutex
+	objects map[string]object
+	uploads map[string]*upload
+	nextID  int
+}
+
+type object struct {
+	data     []byte
+	modified time.Time
+}
+
+type upload struct {
+	key   string
+	parts map[int][]byte
+}
+
+// newServer starts an in-memory object store that is closed when the test
+// ends.
+func newServer(t testing.TB) S3 {
+	t.Helper()
+	s := &server{
+		objects: make(map[string]object),
+		uploads: make(map[string]*upload),
+	}
+	httpServer := httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(httpServer.Close)
+	return S3{
+		Endpoint:        httpServer.URL,
+		Region:          serverRegion,
+		Bucket:          serverBucket,
+		AccessKeyID:     serverAccessKeyID,
+		SecretAccessKey: serverSecretAccessKey,
+	}
+}
+
+func (s *server) serve(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential="+serverAccessKeyID+"/") {
+		writeError(w, http.StatusForbidden, "AccessDenied", "missing or unknown credentials")
+		return
+	}
+	body, err := readBody(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	if checksum := r.Header.Get("Content-Md5"); checksum != "" {
+		sum := md5.Sum(body) //nolint:gosec // part of the S3 API
+		if checksum != base64.StdEncoding.EncodeToString(sum[:]) {
+			writeError(w, http.StatusBadRequest, "BadDigest", "Content-MD5 does not match")
+			return
+		}
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != serverBucket {
+		writeError(w, http.StatusNotFound, "NoSuchBucket", "bucket does not exist")
+		return
+	}
+	query := r.URL.Query()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		s.list(w, query)
+	case key == "":
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		s.nextID++
+		id := "upload-" + strconv.Itoa(s.nextID)
+		s.uploads[id] = &upload{key: key, parts: make(map[int][]byte)}
+		writeXML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string   `xml:"Bucket"`
+			Key      string   `xml:"Key"`
+			UploadID string   `xml:"UploadId"`
+		}{Bucket: bucket, Key: key, UploadID: id})
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		s.uploadPart(w, key, query, body)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		s.complete(w, bucket, key, query.Get("uploadId"), body)
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(s.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		s.objects[key] = object{data: body, modified: time.Now().UTC()}
+		w.Header().Set("ETag", etag(body))
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		stored, ok := s.objects[key]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey", "key does not exist")
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(stored.data)))
+		w.Header().Set("ETag", etag(stored.data))
+		w.Header().Set("Last-Modified", stored.modified.Format(http.TimeFormat))
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(stored.data)
+		}
+	case r.Method == http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	}
+}
+
+// readBody returns the payload of a request. Streaming uploads frame it in
+// aws-chunked encoding; other requests carry its SHA-256 unless it is
+// unsigned.
+func readBody(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch hash := r.Header.Get("X-Amz-Content-Sha256"); {
+	case strings.HasPrefix(hash, "STREAMING-"):
+		return decodeChunked(body)
+	case hash == "UNSIGNED-PAYLOAD":
+		return body, nil
+	default:
+		digest := sha256.Sum256(body)
+		if hash != hex.EncodeToString(digest[:]) {
+			return nil, errors.New("payload hash does not match")
+		}
+		return body, nil
+	}
+}
+
+// decodeChunked strips the aws-chunked framing of "size;chunk-signature=..."
+// lines. Trailers after the final empty chunk are ignored.
+func decodeChunked(body []byte) ([]byte, error) {
+	reader := bufio.NewReader(bytes.NewReader(body))
+	var payload []byte
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("read chunk header: %w", err)
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chunk size %q", sizeHex)
+		}
+		if size == 0 {
+			return payload, nil
+		}
+		chunk := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, chunk); err != nil {
+			return nil, fmt.Errorf("read chunk: %w", err)
+		}
+		payload = append(payload, chunk[:size]...)
+	}
+}
+
+func (s *server) uploadPart(w http.ResponseWriter, key string, query url.Values, body []byte) {
+	pending, ok := s.uploads[query.Get("uploadId")]
+	if !ok || pending.key != key {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", "upload does not exist")
+		return
+	}
+	number, err := strconv.Atoi(query.Get("partNumber"))
+	if err != nil || number < 1 {
+		writeError(w, http.StatusBadRequest, "InvalidArgument", "invalid part number")
+		return
+	}
+	pending.parts[number] = body
+	w.Header().Set("ETag", etag(body))
+}
+
+func (s *server) complete(w http.ResponseWriter, bucket, key, id string, body []byte) {
+	pending, ok := s.uploads[id]
+	if !ok || pending.key != key {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", "upload does not exist")
+		return
+	}
+	var request struct {
+		Parts []struct {
+			PartNumber int    `xml:"PartNumber"`
+			ETag       string `xml:"ETag"`
+		} `xml:"Part"`
+	}
+	if err := xml.Unmarshal(body, &request); err != nil || len(request.Parts) == 0 {
+		writeError(w, http.StatusBadRequest, "MalformedXML", "invalid completion request")
+		return
+	}
+	var data []byte
+	for i, part := range request.Parts {
+		content, ok := pending.parts[part.PartNumber]
+		if !ok || part.PartNumber != i+1 || strings.Trim(part.ETag, `"`) != strings.Trim(etag(content), `"`) {
+			writeError(w, http.StatusBadRequest, "InvalidPart", fmt.Sprintf("part %d does not match", part.PartNumber))
+			return
+		}
+		data = append(data, content...)
+	}
+	delete(s.uploads, id)
+	s.objects[key] = object{data: data, modified: time.Now().UTC()}
+	writeXML(w, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Bucket  string   `xml:"Bucket"`
+		Key     string   `xml:"Key"`
+		ETag    string   `xml:"ETag"`
+	}{Bucket: bucket, Key: key, ETag: etag(data)})
+}
+
+func (s *server) list(w http.ResponseWriter, query url.Values) {
+	if query.Get("list-type") != "2" {
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "only ListObjectsV2 is supported")
+		return
+	}
+	prefix := query.Get("prefix")
+	after := query.Get("continuation-token")
+	limit := 1000
+	if value, err := strconv.Atoi(query.Get("max-keys")); err == nil && value > 0 && value < limit {
+		limit = value
+	}
+	var keys []string
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	type entry struct {
+		Key          string `xml:"Key"`
+		LastModified string `xml:"LastModified"`
+		ETag         string `xml:"ETag"`
+		Size         int    `xml:"Size"`
+	}
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Name                  string   `xml:"Name"`
+		Prefix                string   `xml:"Prefix"`
+		KeyCount              int      `xml:"KeyCount"`
+		MaxKeys               int      `xml:"MaxKeys"`
+		IsTruncated           bool     `xml:"IsTruncated"`
+		Contents              []entry  `xml:"Contents"`
+		NextContinuationToken string   `xml:"NextContinuationToken,omitempty"`
+	}{Name: serverBucket, Prefix: prefix, MaxKeys: limit}
+	if len(keys) > limit {
+		keys = keys[:limit]
+		result.IsTruncated = true
+		result.NextContinuationToken = keys[len(keys)-1]
+	}
+	for _, key := range keys {
+		stored := s.objects[key]
+		result.Contents = append(result.Contents, entry{
+			Key:          key,
+			LastModified: stored.modified.Format(time.RFC3339),
+			ETag:         etag(stored.data),
+			Size:         len(stored.data),
+		})
+	}
+	result.KeyCount = len(result.Contents)
+	writeXML(w, result)
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data) //nolint:gosec // part of the S3 API
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func writeXML(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/xml")
+	_, _ = io.WriteString(w, xml.Header)
+	_ = xml.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_ = xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string   `xml:"Code"`
+		Message string   `xml:"Message"`
+	}{Code: code, Message: message})
+}
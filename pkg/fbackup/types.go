@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/zbiljic/fget/pkg/gitinspect"
+	"github.com/zbiljic/fget/pkg/gitlfs"
 )
 
 const ManifestVersion = "1"
@@ -30,6 +31,16 @@ const (
 	RemoteStateMissing      RemoteState = "missing"
 )
 
+// LFSState records whether the LFS server was asked which local LFS objects
+// it already stores.
+type LFSState string
+
+const (
+	LFSStateUnchecked LFSState = "unchecked"
+	LFSStateVerified  LFSState = "verified"
+	LFSStateFailed    LFSState = "failed"
+)
+
 type Manifest struct {
 	Version      string            `json:"version"`
 	GeneratedAt  time.Time         `json:"generated_at"`
@@ -64,11 +75,25 @@ type RepositoryEntry struct {
 	RemoteReason         string            `json:"remote_reason,omitempty"`
 	HasLFSAttributes     bool              `json:"has_lfs_attributes"`
 	HasLocalLFSObjects   bool              `json:"has_local_lfs_objects"`
+	LFSState             LFSState          `json:"lfs_state,omitempty"`
+	LFSReason            string            `json:"lfs_reason,omitempty"`
+	LocalLFSObjectCount  int               `json:"local_lfs_object_count,omitempty"`
+	MissingLFSObjects    []gitlfs.Object   `json:"missing_lfs_objects,omitempty"`
 	HasSubmodules        bool              `json:"has_submodules"`
+	Submodules           []SubmoduleEntry  `json:"submodules,omitempty"`
 	EstimatedSourceBytes int64             `json:"estimated_source_bytes"`
 	Errors               []RepositoryError `json:"errors,omitempty"`
 }
 
+// SubmoduleEntry is an initialized submodule inspected below its parent.
+// Path is relative to the parent worktree and RecordedCommit is the gitlink
+// the parent records for it.
+type SubmoduleEntry struct {
+	Path           string          `json:"path"`
+	RecordedCommit string          `json:"recorded_commit"`
+	Repository     RepositoryEntry `json:"repository"`
+}
+
 type RepositoryProbe struct {
 	ID                   string
 	Path                 string
@@ -82,7 +107,15 @@ type RepositoryProbe struct {
 	RemoteReason         string
 	HasLFSAttributes     bool
 	HasLocalLFSObjects   bool
+	LFSState             LFSState
+	LFSReason            string
+	LocalLFSObjectCount  int
+	MissingLFSObjects    []gitlfs.Object
 	HasSubmodules        bool
+	// SubmodulesInspected reports that Submodules lists every initialized
+	// submodule, so they no longer make the parent a problem on their own.
+	SubmodulesInspected  bool
+	Submodules           []SubmoduleEntry
 	EstimatedSourceBytes int64
 	Errors               []RepositoryError
 }
@@ -2,7 +2,6 @@ package fbackup
 
 import (
 	"archive/tar"
-	"compress/gzip"
 	"context"
 	"errors"
 	"fmt"
@@ -15,28 +14,28 @@ import (
 )
 
 func Verify(ctx context.Context, destination string, deep bool) error {
-	return verifyWithRunner(ctx, destination, deep, gitinspect.CLIRunner{})
+	return VerifyWithKeys(ctx, destination, deep, Keys{})
 }
 
-func verifyWithRunner(ctx context.Context, destination string, deep bool, runner gitinspect.Runner) error {
-	destination, err := filepath.Abs(destination)
-	if err != nil {
-		return err
-	}
-	if err := rejectSymlinkRoot(destination); err != nil {
-		return err
-	}
-	metadata, err := readBackupMetadata(filepath.Join(destination, "backup.json"))
+// VerifyWithKeys verifies a backup, decrypting encrypted artifacts with keys
+// during deep verification. Shallow verification never needs keys.
+func VerifyWithKeys(ctx context.Context, destination string, deep bool, keys Keys) error {
+	return verifyWithRunner(ctx, destination, deep, keys, gitinspect.CLIRunner{})
+}
+
+func verifyWithRunner(ctx context.Context, destination string, deep bool, keys Keys, runner gitinspect.Runner) error {
+	head, err := openBackupLocation(ctx, destination)
 	if err != nil {
 		return err
 	}
-	if !metadata.Complete {
+	if !head.Metadata.Complete {
 		return errors.New("backup is incomplete")
 	}
-	return verifyArtifacts(ctx, destination, metadata, deep, runner)
+	return verifyArtifacts(ctx, head, deep, keys, runner)
 }
 
-func verifyArtifacts(ctx context.Context, destination string, metadata BackupMetadata, deep bool, runner gitinspect.Runner) error {
+func verifyArtifacts(ctx context.Context, head backupLink, deep bool, keys Keys, runner gitinspect.Runner) error {
+	metadata := head.Metadata
 	if metadata.Manifest.Version != ManifestVersion {
 		return fmt.Errorf("unsupported embedded manifest version %q", metadata.Manifest.Version)
 	}
@@ -52,6 +51,15 @@ func verifyArtifacts(ctx context.Context, destination string, metadata BackupMet
 	if err != nil {
 		return err
 	}
+	chain, err := loadBackupChain(head)
+	if err != nil {
+		return err
+	}
+	if deep {
+		if err := chain.unlock(keys); err != nil {
+			return err
+		}
+	}
 	seenKeys := make(map[string]bool, len(metadata.Artifacts))
 	seenPaths := make(map[string]bool, len(metadata.Artifacts))
 	for _, record := range metadata.Artifacts {
@@ -80,11 +88,14 @@ func verifyArtifacts(ctx context.Context, destination string, metadata BackupMet
 			return fmt.Errorf("duplicate artifact path %q", record.Path)
 		}
 		seenPaths[pathKey] = true
-		if err := verifyRecord(destination, record); err != nil {
+		if record.Incremental && record.Kind != "bundle" {
+			return fmt.Errorf("artifact %q kind %q cannot be incremental", record.RepositoryID, record.Kind)
+		}
+		if err := chain.verifyRecord(ctx, record); err != nil {
 			return err
 		}
 		if deep {
-			if err := verifyDeepArtifact(ctx, runner, destination, record); err != nil {
+			if err := verifyDeepArtifact(ctx, runner, chain, record); err != nil {
 				return err
 			}
 		}
@@ -114,7 +125,7 @@ func expectedRepositoryArtifacts(entries []RepositoryEntry) (map[string]map[stri
 			return nil, fmt.Errorf("unsupported repository classification %q", entry.Classification)
 		}
 		kinds := make(map[string]bool)
-		for _, kind := range expectedArtifactKinds(entry.Classification) {
+		for _, kind := range expectedArtifactKinds(entry) {
 			kinds[kind] = true
 		}
 		result[entry.ID] = kinds
@@ -122,25 +133,48 @@ func expectedRepositoryArtifacts(entries []RepositoryEntry) (map[string]map[stri
 	return result, nil
 }
 
-func verifyRecord(destination string, record ArtifactRecord) error {
+// verifyRecord checks the size and checksum of the file that stores record,
+// following InBase records into the base backups.
+func (c backupChain) verifyRecord(ctx context.Context, record ArtifactRecord) error {
 	if err := validateArtifactPath(record.Path); err != nil {
 		return err
 	}
-	path, err := ensureSafeArtifactPath(destination, record.Path)
+	stored, level, path, err := c.resolve(record)
 	if err != nil {
-		return fmt.Errorf("artifact %q: %w", record.RepositoryID, err)
+		return err
 	}
-	info, err := os.Lstat(path)
-	if err != nil {
-		return fmt.Errorf("artifact %q: %w", record.RepositoryID, err)
+	if len(stored.Chunks) > 0 {
+		return verifyChunkedRecord(c[level].Metadata.ChunkStore, stored)
 	}
-	if !info.Mode().IsRegular() {
-		return fmt.Errorf("artifact %q is not a regular file", record.RepositoryID)
+	if store := c[level].store; store != nil {
+		info, err := store.Stat(ctx, filepath.ToSlash(stored.Path))
+		if err != nil {
+			return fmt.Errorf("artifact %q: %w", record.RepositoryID, err)
+		}
+		if info.Size != record.Size {
+			return fmt.Errorf("artifact %q size mismatch", record.RepositoryID)
+		}
+		if c[level].sizeOnly {
+			return nil
+		}
+	} else {
+		info, err := os.Lstat(path)
+		if err != nil {
+			return fmt.Errorf("artifact %q: %w", record.RepositoryID, err)
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("artifact %q is not a regular file", record.RepositoryID)
+		}
+		if info.Size() != record.Size {
+			return fmt.Errorf("artifact %q size mismatch", record.RepositoryID)
+		}
 	}
-	if info.Size() != record.Size {
-		return fmt.Errorf("artifact %q size mismatch", record.RepositoryID)
+	reader, err := c.openStored(ctx, level, stored, path)
+	if err != nil {
+		return fmt.Errorf("artifact %q: %w", record.RepositoryID, err)
 	}
-	_, digest, err := hashFile(path)
+	defer func() { _ = reader.Close() }()
+	_, digest, err := hashReader(reader)
 	if err != nil {
 		return fmt.Errorf("artifact %q: %w", record.RepositoryID, err)
 	}
@@ -150,33 +184,53 @@ func verifyRecord(destination string, record ArtifactRecord) error {
 	return nil
 }
 
-func verifyDeepArtifact(ctx context.Context, runner gitinspect.Runner, destination string, record ArtifactRecord) error {
-	path := filepath.Join(destination, filepath.FromSlash(record.Path))
+// verifyDeepArtifact checks that an artifact can be read back. Encrypted
+// artifacts are decrypted on the fly, which also authenticates patches.
+func verifyDeepArtifact(ctx context.Context, runner gitinspect.Runner, chain backupChain, record ArtifactRecord) error {
 	switch record.Kind {
 	case "bundle":
-		if _, err := runner.Run(ctx, "", "bundle", "verify", path); err != nil {
+		files, stored, cleanup, err := chain.bundleFiles(ctx, record)
+		if err == nil {
+			err = verifyBundleChain(ctx, runner, files, stored)
+			cleanup()
+		}
+		if err != nil {
 			return fmt.Errorf("artifact %q bundle verification failed: %w", record.RepositoryID, err)
 		}
-	case "full", "untracked":
-		if err := verifyTar(ctx, path); err != nil {
+	case "lfs":
+		archive, err := chain.openArchive(ctx, record)
+		if err == nil {
+			err = verifyLFSArchive(ctx, archive)
+			_ = archive.Close()
+		}
+		if err != nil {
+			return fmt.Errorf("artifact %q LFS verification failed: %w", record.RepositoryID, err)
+		}
+	case "full", "untracked", "worktrees", "local-config":
+		archive, err := chain.openArchive(ctx, record)
+		if err == nil {
+			err = verifyTar(ctx, archive)
+			_ = archive.Close()
+		}
+		if err != nil {
 			return fmt.Errorf("artifact %q tar verification failed: %w", record.RepositoryID, err)
 		}
+	default:
+		reader, err := chain.open(ctx, record)
+		if err != nil {
+			return fmt.Errorf("artifact %q %s: %w", record.RepositoryID, record.Kind, err)
+		}
+		_, err = io.Copy(io.Discard, reader)
+		_ = reader.Close()
+		if err != nil {
+			return fmt.Errorf("artifact %q %s verification failed: %w", record.RepositoryID, record.Kind, err)
+		}
 	}
 	return ctx.Err()
 }
 
-func verifyTar(ctx context.Context, path string) error {
-	file, err := os.Open(path)
-	if err != nil {
-		return err
-	}
-	defer func() { _ = file.Close() }()
-	gzipReader, err := gzip.NewReader(file)
-	if err != nil {
-		return fmt.Errorf("gzip: %w", err)
-	}
-	defer func() { _ = gzipReader.Close() }()
-	tarReader := tar.NewReader(gzipReader)
+func verifyTar(ctx context.Context, archive io.Reader) error {
+	tarReader := tar.NewReader(archive)
 	for {
 		if err := ctx.Err(); err != nil {
 			return err
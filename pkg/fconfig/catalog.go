@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/zbiljic/fget/pkg/vconfig"
@@ -33,6 +34,40 @@ type RepoEntry struct {
 	RemoteURL string         `yaml:"remote_url" json:"remote_url"`
 	Tags      []string       `yaml:"tags" json:"tags"`
 	Locations []RepoLocation `yaml:"locations" json:"locations"`
+	Clone     *CloneMode     `yaml:"clone,omitempty" json:"clone,omitempty"`
+	// Remotes maps every configured remote name to its URL.
+	Remotes map[string]string `yaml:"remotes,omitempty" json:"remotes,omitempty"`
+	// Inactive is set once the upstream was found archived, deleted or
+	// disabled.
+	Inactive *InactiveState `yaml:"inactive,omitempty" json:"inactive,omitempty"`
+}
+
+// Inactive upstream states.
+const (
+	InactiveArchived = "archived"
+	InactiveDeleted  = "deleted"
+	InactiveDisabled = "disabled"
+)
+
+// InactiveState records the state of an inactive upstream and since when it
+// is known.
+type InactiveState struct {
+	State string    `yaml:"state" json:"state"`
+	Since time.Time `yaml:"since" json:"since"`
+}
+
+// CloneMode records how a repository was cloned, so that later updates keep
+// shallow and partial clones as they are.
+type CloneMode struct {
+	Depth        int    `yaml:"depth,omitempty" json:"depth,omitempty"`
+	Filter       string `yaml:"filter,omitempty" json:"filter,omitempty"`
+	SingleBranch bool   `yaml:"single_branch,omitempty" json:"single_branch,omitempty"`
+	NoTags       bool   `yaml:"no_tags,omitempty" json:"no_tags,omitempty"`
+}
+
+// IsZero reports whether the mode is a regular full clone.
+func (m CloneMode) IsZero() bool {
+	return m == CloneMode{}
 }
 
 type RepoLocation struct {
@@ -73,6 +108,15 @@ func (c *Catalog) Upsert(entry RepoEntry) {
 		if len(entry.Tags) > 0 {
 			updated.Tags = append([]string{}, entry.Tags...)
 		}
+		if entry.Clone != nil {
+			updated.Clone = entry.Clone
+		}
+		if len(entry.Remotes) > 0 {
+			updated.Remotes = entry.Remotes
+		}
+		if entry.Inactive != nil {
+			updated.Inactive = entry.Inactive
+		}
 		updated.Locations = mergeLocations(updated.Locations, entry.Locations)
 		c.Repos[i] = normalizeRepoEntry(updated)
 		return
@@ -87,6 +131,18 @@ func (c *Catalog) Upsert(entry RepoEntry) {
 	})
 }
 
+// SetInactive records the inactive state of a repository, or clears it when
+// state is nil. It reports whether the catalog lists the repository.
+func (c *Catalog) SetInactive(selector string, state *InactiveState) bool {
+	index, err := ResolveRepoIndex(c, selector)
+	if err != nil {
+		return false
+	}
+
+	c.Repos[index].Inactive = normalizeInactiveState(state)
+	return true
+}
+
 func (c *Catalog) ApplyRepoMove(move RepoMove) bool {
 	if c == nil || move.NewID == "" {
 		return false
@@ -139,6 +195,12 @@ func (c *Catalog) ApplyRepoMove(move RepoMove) bool {
 		if merged.RemoteURL == "" && repo.RemoteURL != "" {
 			merged.RemoteURL = repo.RemoteURL
 		}
+		if merged.Clone == nil {
+			merged.Clone = repo.Clone
+		}
+		if merged.Remotes == nil {
+			merged.Remotes = moveRemoteURLs(repo.Remotes, move.OldURL, move.NewURL)
+		}
 		merged.Tags = append(merged.Tags, repo.Tags...)
 
 		locations := make([]RepoLocation, 0, len(repo.Locations))
@@ -361,6 +423,9 @@ func normalizeRepoEntry(repo RepoEntry) RepoEntry {
 	if repo.Tags == nil {
 		repo.Tags = []string{}
 	}
+	repo.Clone = normalizeCloneMode(repo.Clone)
+	repo.Remotes = normalizeRemotes(repo.Remotes)
+	repo.Inactive = normalizeInactiveState(repo.Inactive)
 	repo.Locations = mergeLocations(nil, repo.Locations)
 	return repo
 }
@@ -369,10 +434,64 @@ func normalizeLoadedRepoEntry(scopeRoot string, repo RepoEntry) RepoEntry {
 	if repo.Tags == nil {
 		repo.Tags = []string{}
 	}
+	repo.Clone = normalizeCloneMode(repo.Clone)
+	repo.Remotes = normalizeRemotes(repo.Remotes)
+	repo.Inactive = normalizeInactiveState(repo.Inactive)
 	repo.Locations = mergeLoadedLocations(scopeRoot, nil, repo.Locations)
 	return repo
 }
 
+func normalizeCloneMode(mode *CloneMode) *CloneMode {
+	if mode == nil || mode.IsZero() {
+		return nil
+	}
+
+	normalized := *mode
+	return &normalized
+}
+
+func normalizeInactiveState(state *InactiveState) *InactiveState {
+	if state == nil || strings.TrimSpace(state.State) == "" {
+		return nil
+	}
+
+	normalized := *state
+	normalized.State = strings.TrimSpace(normalized.State)
+	return &normalized
+}
+
+func normalizeRemotes(remotes map[string]string) map[string]string {
+	normalized := make(map[string]string, len(remotes))
+	for name, remoteURL := range remotes {
+		name = strings.TrimSpace(name)
+		remoteURL = strings.TrimSpace(remoteURL)
+		if name == "" || remoteURL == "" {
+			continue
+		}
+		normalized[name] = remoteURL
+	}
+	if len(normalized) == 0 {
+		return nil
+	}
+
+	return normalized
+}
+
+// moveRemoteURLs returns the remotes with the moved URL replaced.
+func moveRemoteURLs(remotes map[string]string, oldURL, newURL string) map[string]string {
+	moved := normalizeRemotes(remotes)
+	if oldURL == "" || newURL == "" {
+		return moved
+	}
+	for name, remoteURL := range moved {
+		if remoteURL == oldURL {
+			moved[name] = newURL
+		}
+	}
+
+	return moved
+}
+
 func mergeLocations(existing, incoming []RepoLocation) []RepoLocation {
 	locMap := make(map[string]RepoLocation, len(existing)+len(incoming))
 
@@ -467,6 +586,9 @@ func snapshotCatalogForSave(catalog *Catalog) *Catalog {
 			RemoteURL: repo.RemoteURL,
 			Tags:      append([]string{}, repo.Tags...),
 			Locations: make([]RepoLocation, 0, len(repo.Locations)),
+			Clone:     repo.Clone,
+			Remotes:   repo.Remotes,
+			Inactive:  repo.Inactive,
 		}
 		for _, location := range repo.Locations {
 			serialized.Locations = append(serialized.Locations, RepoLocation{
@@ -561,6 +683,15 @@ func mergeCatalogRepo(catalog *Catalog, repoIndex map[string]int, repo RepoEntry
 			updated.RemoteURL = repo.RemoteURL
 		}
 		updated.Tags = normalizeTags(append(updated.Tags, repo.Tags...))
+		if updated.Clone == nil {
+			updated.Clone = repo.Clone
+		}
+		if updated.Remotes == nil {
+			updated.Remotes = repo.Remotes
+		}
+		if updated.Inactive == nil {
+			updated.Inactive = repo.Inactive
+		}
 		updated.Locations = mergeLocations(updated.Locations, repo.Locations)
 		catalog.Repos[i] = normalizeRepoEntry(updated)
 		return
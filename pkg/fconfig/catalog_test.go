@@ -54,6 +54,140 @@ func TestCatalogUpsert_PreservesExistingTagsAndLocations(t *testing.T) {
 	}
 }
 
+func TestCatalogCloneMode_SurvivesUpsertAndRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "fget.catalog.yaml")
+	catalog, err := LoadCatalog(path)
+	if err != nil {
+		t.Fatalf("LoadCatalog() error = %v", err)
+	}
+
+	mode := CloneMode{Depth: 1, Filter: "blob:none", SingleBranch: true}
+	catalog.Upsert(RepoEntry{
+		ID:        "github.com/acme/reference",
+		RemoteURL: "https://github.com/acme/reference",
+		Clone:     &mode,
+	})
+	catalog.Upsert(RepoEntry{
+		ID:        "github.com/acme/reference",
+		Locations: []RepoLocation{{Path: "/repos/reference"}},
+	})
+	catalog.Upsert(RepoEntry{ID: "github.com/acme/full", Clone: &CloneMode{}})
+
+	if err := SaveCatalog(path, catalog); err != nil {
+		t.Fatalf("SaveCatalog() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if strings.Count(string(data), "clone:") != 1 {
+		t.Fatalf("saved catalog should record only the non-default clone mode:\n%s", data)
+	}
+
+	loaded, err := LoadCatalog(path)
+	if err != nil {
+		t.Fatalf("LoadCatalog() error = %v", err)
+	}
+	index, err := ResolveRepoIndex(loaded, "github.com/acme/reference")
+	if err != nil {
+		t.Fatalf("ResolveRepoIndex() error = %v", err)
+	}
+	if got := loaded.Repos[index].Clone; got == nil || *got != mode {
+		t.Fatalf("clone mode = %+v, want %+v", got, mode)
+	}
+}
+
+func TestCatalogInactive_SurvivesUpsertAndRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "fget.catalog.yaml")
+	catalog, err := LoadCatalog(path)
+	if err != nil {
+		t.Fatalf("LoadCatalog() error = %v", err)
+	}
+
+	catalog.Upsert(RepoEntry{
+		ID:        "github.com/acme/gone",
+		Locations: []RepoLocation{{Path: "/repos/gone"}},
+	})
+	since := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	if !catalog.SetInactive("/repos/gone", &InactiveState{State: InactiveDeleted, Since: since}) {
+		t.Fatal("SetInactive() by location = false")
+	}
+	if catalog.SetInactive("github.com/acme/unknown", &InactiveState{State: InactiveDeleted}) {
+		t.Fatal("SetInactive() of unknown repository = true")
+	}
+	catalog.Upsert(RepoEntry{ID: "github.com/acme/gone", RemoteURL: "https://github.com/acme/gone"})
+
+	if err := SaveCatalog(path, catalog); err != nil {
+		t.Fatalf("SaveCatalog() error = %v", err)
+	}
+	loaded, err := LoadCatalog(path)
+	if err != nil {
+		t.Fatalf("LoadCatalog() error = %v", err)
+	}
+	want := InactiveState{State: InactiveDeleted, Since: since}
+	if got := loaded.Repos[0].Inactive; got == nil || *got != want {
+		t.Fatalf("inactive = %+v, want %+v", got, want)
+	}
+
+	loaded.SetInactive("github.com/acme/gone", nil)
+	if got := loaded.Repos[0].Inactive; got != nil {
+		t.Fatalf("inactive after clearing = %+v, want nil", got)
+	}
+}
+
+func TestCatalogRemotes_SurviveUpsertAndFollowMoves(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "fget.catalog.yaml")
+	catalog, err := LoadCatalog(path)
+	if err != nil {
+		t.Fatalf("LoadCatalog() error = %v", err)
+	}
+
+	remotes := map[string]string{
+		"origin":   "https://github.com/me/models",
+		"upstream": "https://github.com/old-owner/models",
+	}
+	catalog.Upsert(RepoEntry{
+		ID:        "github.com/old-owner/models",
+		RemoteURL: "https://github.com/old-owner/models",
+		Remotes:   remotes,
+	})
+	catalog.Upsert(RepoEntry{
+		ID:        "github.com/old-owner/models",
+		Locations: []RepoLocation{{Path: "/repos/github.com/old-owner/models"}},
+	})
+
+	if err := SaveCatalog(path, catalog); err != nil {
+		t.Fatalf("SaveCatalog() error = %v", err)
+	}
+	loaded, err := LoadCatalog(path)
+	if err != nil {
+		t.Fatalf("LoadCatalog() error = %v", err)
+	}
+	if got := loaded.Repos[0].Remotes; !reflect.DeepEqual(got, remotes) {
+		t.Fatalf("remotes = %v, want %v", got, remotes)
+	}
+
+	loaded.ApplyRepoMove(RepoMove{
+		OldID:  "github.com/old-owner/models",
+		NewID:  "github.com/new-owner/models",
+		OldURL: "https://github.com/old-owner/models",
+		NewURL: "https://github.com/new-owner/models",
+	})
+	want := map[string]string{
+		"origin":   "https://github.com/me/models",
+		"upstream": "https://github.com/new-owner/models",
+	}
+	if got := loaded.Repos[0].Remotes; !reflect.DeepEqual(got, want) {
+		t.Fatalf("remotes after move = %v, want %v", got, want)
+	}
+}
+
 func TestCatalogApplyRepoMove_PreservesTagsAndRewritesLocation(t *testing.T) {
 	t.Parallel()
 
@@ -42,6 +42,16 @@ func LoadConfigFile(path, homeDir string) (*Config, error) {
 	}
 	resolved.Catalog.Imports = resolveCatalogImports(cfg.Catalog.Imports, homeDir, baseDir)
 	resolved.Link = resolveLinkConfig(cfg.Link, homeDir, baseDir)
+	credentials, err := resolveCredentials(cfg.Credentials, homeDir, baseDir)
+	if err != nil {
+		return nil, err
+	}
+	resolved.Credentials = credentials
+	inactive, err := resolveInactiveConfig(cfg.Inactive, homeDir, baseDir)
+	if err != nil {
+		return nil, err
+	}
+	resolved.Inactive = inactive
 
 	return &resolved, nil
 }
@@ -91,6 +101,24 @@ func LoadEffectiveConfig(homeDir, cwd, xdgConfigHome string) (*EffectiveConfig,
 			seenImports[importPath] = struct{}{}
 		}
 
+		if cfg.Remotes.Primary != "" {
+			effective.Remotes.Primary = cfg.Remotes.Primary
+		}
+
+		for host, credential := range cfg.Credentials {
+			if effective.Credentials == nil {
+				effective.Credentials = make(map[string]CredentialConfig)
+			}
+			effective.Credentials[host] = credential
+		}
+
+		if cfg.Inactive.Policy != "" {
+			effective.Inactive.Policy = cfg.Inactive.Policy
+		}
+		if cfg.Inactive.ArchiveRoot != "" {
+			effective.Inactive.ArchiveRoot = cfg.Inactive.ArchiveRoot
+		}
+
 		if cfg.Link != nil {
 			effective.Link = copyLinkConfig(cfg.Link)
 			effective.LinkSource = state.Path
@@ -158,6 +186,43 @@ func resolveLinkConfig(cfg *LinkConfig, homeDir, baseDir string) *LinkConfig {
 	return &resolved
 }
 
+func resolveCredentials(credentials map[string]CredentialConfig, homeDir, baseDir string) (map[string]CredentialConfig, error) {
+	if len(credentials) == 0 {
+		return nil, nil
+	}
+
+	out := make(map[string]CredentialConfig, len(credentials))
+	for host, credential := range credentials {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if host == "" || strings.ContainsAny(host, "/@") {
+			return nil, fmt.Errorf("invalid credentials host %q", host)
+		}
+		if credential.TokenEnv == "" && credential.TokenFile == "" && !credential.Helper {
+			return nil, fmt.Errorf("credentials for %s need token_env, token_file or helper", host)
+		}
+		if credential.TokenFile != "" {
+			credential.TokenFile = filepath.Clean(expandPathFromBase(credential.TokenFile, homeDir, baseDir))
+		}
+		out[host] = credential
+	}
+
+	return out, nil
+}
+
+func resolveInactiveConfig(cfg InactiveConfig, homeDir, baseDir string) (InactiveConfig, error) {
+	switch cfg.Policy {
+	case "", InactivePolicySkip, InactivePolicyTag, InactivePolicyMoveToGraveyard:
+	default:
+		return cfg, fmt.Errorf("invalid inactive policy %q (allowed: %s|%s|%s)",
+			cfg.Policy, InactivePolicySkip, InactivePolicyTag, InactivePolicyMoveToGraveyard)
+	}
+	if cfg.ArchiveRoot != "" {
+		cfg.ArchiveRoot = filepath.Clean(expandPathFromBase(cfg.ArchiveRoot, homeDir, baseDir))
+	}
+
+	return cfg, nil
+}
+
 func validateConfigVersion(version string) error {
 	switch version {
 	case "", ConfigVersionV1, ConfigVersionV2:
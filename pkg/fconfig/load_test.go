@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -58,6 +59,104 @@ func TestLoadEffectiveConfig_MergesHomeToCwd(t *testing.T) {
 	}
 }
 
+func TestLoadEffectiveConfig_NearestPrimaryRemoteWins(t *testing.T) {
+	t.Parallel()
+
+	homeDir := t.TempDir()
+	cwd := filepath.Join(homeDir, "dev", "forks")
+
+	if err := os.MkdirAll(cwd, 0o755); err != nil {
+		t.Fatalf("MkdirAll(cwd) error = %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(homeDir, "fget.yaml"), []byte("version: \"1\"\nremotes:\n  primary: origin\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile(homeOverlayPath) error = %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(cwd, "fget.yaml"), []byte("version: \"1\"\nremotes:\n  primary: upstream\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile(forksOverlayPath) error = %v", err)
+	}
+
+	eff, err := LoadEffectiveConfig(homeDir, cwd, "")
+	if err != nil {
+		t.Fatalf("LoadEffectiveConfig() error = %v", err)
+	}
+	if eff.Remotes.Primary != "upstream" {
+		t.Fatalf("primary remote = %q, want %q", eff.Remotes.Primary, "upstream")
+	}
+}
+
+func TestLoadEffectiveConfig_MergesInactivePolicy(t *testing.T) {
+	t.Parallel()
+
+	homeDir := t.TempDir()
+	cwd := filepath.Join(homeDir, "dev")
+
+	if err := os.MkdirAll(cwd, 0o755); err != nil {
+		t.Fatalf("MkdirAll(cwd) error = %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(homeDir, "fget.yaml"), []byte("version: \"1\"\ninactive:\n  policy: skip\n  archive_root: ./graveyard\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile(homeOverlayPath) error = %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(cwd, "fget.yaml"), []byte("version: \"1\"\ninactive:\n  policy: move-to-graveyard\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile(devOverlayPath) error = %v", err)
+	}
+
+	eff, err := LoadEffectiveConfig(homeDir, cwd, "")
+	if err != nil {
+		t.Fatalf("LoadEffectiveConfig() error = %v", err)
+	}
+	want := InactiveConfig{Policy: InactivePolicyMoveToGraveyard, ArchiveRoot: filepath.Join(homeDir, "graveyard")}
+	if eff.Inactive != want {
+		t.Fatalf("inactive = %+v, want %+v", eff.Inactive, want)
+	}
+
+	if err := os.WriteFile(filepath.Join(cwd, "fget.yaml"), []byte("version: \"1\"\ninactive:\n  policy: delete\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile(devOverlayPath) error = %v", err)
+	}
+	if _, err := LoadEffectiveConfig(homeDir, cwd, ""); err == nil || !strings.Contains(err.Error(), "invalid inactive policy") {
+		t.Fatalf("LoadEffectiveConfig() with unknown policy error = %v", err)
+	}
+}
+
+func TestLoadEffectiveConfig_MergesCredentialsByHost(t *testing.T) {
+	t.Parallel()
+
+	homeDir := t.TempDir()
+	cwd := filepath.Join(homeDir, "work")
+
+	if err := os.MkdirAll(cwd, 0o755); err != nil {
+		t.Fatalf("MkdirAll(cwd) error = %v", err)
+	}
+	homeConfig := "version: \"1\"\ncredentials:\n  GitHub.com:\n    token_env: GITHUB_TOKEN\n  gitlab.com:\n    helper: true\n"
+	if err := os.WriteFile(filepath.Join(homeDir, "fget.yaml"), []byte(homeConfig), 0o644); err != nil {
+		t.Fatalf("WriteFile(homeOverlayPath) error = %v", err)
+	}
+	workConfig := "version: \"1\"\ncredentials:\n  github.com:\n    username: bot\n    token_file: ./secrets/github-token\n"
+	if err := os.WriteFile(filepath.Join(cwd, "fget.yaml"), []byte(workConfig), 0o644); err != nil {
+		t.Fatalf("WriteFile(workOverlayPath) error = %v", err)
+	}
+
+	eff, err := LoadEffectiveConfig(homeDir, cwd, "")
+	if err != nil {
+		t.Fatalf("LoadEffectiveConfig() error = %v", err)
+	}
+
+	want := map[string]CredentialConfig{
+		"github.com": {Username: "bot", TokenFile: filepath.Join(cwd, "secrets", "github-token")},
+		"gitlab.com": {Helper: true},
+	}
+	if !reflect.DeepEqual(eff.Credentials, want) {
+		t.Fatalf("effective credentials = %+v, want %+v", eff.Credentials, want)
+	}
+
+	invalidPath := filepath.Join(t.TempDir(), "fget.yaml")
+	if err := os.WriteFile(invalidPath, []byte("version: \"1\"\ncredentials:\n  github.com:\n    username: bot\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile(invalidPath) error = %v", err)
+	}
+	if _, err := LoadConfigFile(invalidPath, homeDir); err == nil {
+		t.Fatal("LoadConfigFile() without a token source succeeded")
+	}
+}
+
 func TestLoadEffectiveConfig_DefaultCatalogPath(t *testing.T) {
 	t.Parallel()
 
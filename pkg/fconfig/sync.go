@@ -23,6 +23,7 @@ type RepoMetadata struct {
 	ID        string
 	Path      string
 	RemoteURL string
+	Remotes   map[string]string
 }
 
 type (
@@ -86,6 +87,7 @@ func SyncCatalog(
 		upsertRepoEntry(catalog, repoIndex, RepoEntry{
 			ID:        repoMetadata.ID,
 			RemoteURL: repoMetadata.RemoteURL,
+			Remotes:   repoMetadata.Remotes,
 			Locations: []RepoLocation{
 				{
 					Path:       repoPath,
@@ -282,6 +284,11 @@ func upsertRepoEntry(catalog *Catalog, repoIndex map[string]int, entry RepoEntry
 		if len(entry.Tags) > 0 {
 			updated.Tags = append([]string{}, entry.Tags...)
 		}
+		if entry.Clone != nil {
+			updated.Clone = entry.Clone
+		}
+		// a scan sees every remote, so removed remotes are dropped
+		updated.Remotes = entry.Remotes
 		updated.Locations = mergeLocations(updated.Locations, entry.Locations)
 		catalog.Repos[i] = normalizeRepoEntry(updated)
 		return
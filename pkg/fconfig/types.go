@@ -22,9 +22,51 @@ type LinkConfig struct {
 	SourceRoot string   `yaml:"source_root" json:"source_root"`
 }
 
+// RemotesConfig selects the remote that defines the project ID and the
+// default branch of repositories with several remotes.
+type RemotesConfig struct {
+	Primary string `yaml:"primary,omitempty" json:"primary,omitempty"`
+}
+
+// CredentialConfig names the sources of the token for one host. They are
+// tried in order: the environment variable, the file, and the git credential
+// helpers.
+type CredentialConfig struct {
+	// Username is sent with the token. Forges accept any username with a
+	// token, so it defaults to x-access-token.
+	Username  string `yaml:"username,omitempty" json:"username,omitempty"`
+	TokenEnv  string `yaml:"token_env,omitempty" json:"token_env,omitempty"`
+	TokenFile string `yaml:"token_file,omitempty" json:"token_file,omitempty"`
+	Helper    bool   `yaml:"helper,omitempty" json:"helper,omitempty"`
+}
+
+// Policies for repositories whose upstream is archived, deleted or disabled.
+// Each records the state in the catalog so that later runs skip the
+// repository; tag also tags it, and move-to-graveyard also tags it and moves
+// it under the archive root.
+const (
+	InactivePolicySkip            = "skip"
+	InactivePolicyTag             = "tag"
+	InactivePolicyMoveToGraveyard = "move-to-graveyard"
+)
+
+// InactiveConfig selects what update and fix do with repositories whose
+// upstream is archived, deleted or disabled. Without a policy they are checked
+// again on every run.
+type InactiveConfig struct {
+	Policy string `yaml:"policy,omitempty" json:"policy,omitempty"`
+	// ArchiveRoot receives the repositories moved to the graveyard. It defaults
+	// to an archive directory in the root of each repository.
+	ArchiveRoot string `yaml:"archive_root,omitempty" json:"archive_root,omitempty"`
+}
+
 type Config struct {
 	Version string        `yaml:"version" json:"version"`
 	Roots   []string      `yaml:"roots" json:"roots"`
 	Catalog CatalogConfig `yaml:"catalog" json:"catalog"`
 	Link    *LinkConfig   `yaml:"link,omitempty" json:"link,omitempty"`
+	Remotes RemotesConfig `yaml:"remotes,omitempty" json:"remotes,omitempty"`
+	// Credentials are keyed by host, with the port when it is not the default.
+	Credentials map[string]CredentialConfig `yaml:"credentials,omitempty" json:"credentials,omitempty"`
+	Inactive    InactiveConfig              `yaml:"inactive,omitempty" json:"inactive,omitempty"`
 }
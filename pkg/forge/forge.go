@@ -0,0 +1,234 @@
+// Package forge looks up repositories through the REST APIs of GitHub, GitLab
+// and Gitea. The forges know the current name of a renamed or transferred
+// repository even after its web redirect expired, whether it is archived, and
+// which repositories an organization or user owns.
+package forge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrNotFound is returned when the forge does not know the repository.
+	// Forges also answer so for private repositories the token cannot read.
+	ErrNotFound = errors.New("repository not found")
+	// ErrDisabled is returned when the forge blocks access to the repository.
+	ErrDisabled = errors.New("repository is disabled")
+)
+
+// Kind names a forge API.
+type Kind string
+
+const (
+	KindGitHub Kind = "github"
+	KindGitLab Kind = "gitlab"
+	KindGitea  Kind = "gitea"
+)
+
+// Repository is what a forge reports about a repository.
+type Repository struct {
+	// FullName is the canonical owner/name path of the repository, which
+	// differs from the requested one after a rename or transfer.
+	FullName      string
+	DefaultBranch string
+	Archived      bool
+	Disabled      bool
+	Fork          bool
+	Private       bool
+	Topics        []string
+	// Parent is the full name of the repository this one is a fork of. Lists
+	// of repositories do not report it.
+	Parent string
+	// CloneURL is the HTTPS URL to clone the repository from.
+	CloneURL string
+}
+
+// Client looks up repositories on one forge.
+type Client interface {
+	// Repository returns the repository with the owner/name path fullName.
+	Repository(ctx context.Context, fullName string) (*Repository, error)
+	// Repositories returns the repositories of an organization, user or
+	// group, including those of its subgroups on GitLab.
+	Repositories(ctx context.Context, owner string) ([]Repository, error)
+}
+
+// Options configure a forge client.
+type Options struct {
+	// BaseURL is the root of the REST API, such as https://api.github.com.
+	// The public instance of the forge is used when it is empty.
+	BaseURL string
+	// Token, when set, authenticates the requests.
+	Token      string
+	HTTPClient *http.Client
+}
+
+// StatusError is returned when the forge answers with an unexpected status.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("forge returned HTTP %d", e.StatusCode)
+}
+
+// hostKinds are the public forges recognized by host name.
+var hostKinds = map[string]Kind{
+	"github.com":   KindGitHub,
+	"gitlab.com":   KindGitLab,
+	"codeberg.org": KindGitea,
+	"gitea.com":    KindGitea,
+}
+
+// HostKind returns the kind of the public forge at host.
+func HostKind(host string) (Kind, bool) {
+	kind, ok := hostKinds[strings.ToLower(host)]
+	return kind, ok
+}
+
+// New returns a client for the kind of forge. Without a base URL, Gitea
+// clients need the host of the instance.
+func New(kind Kind, host string, opts Options) (Client, error) {
+	switch kind {
+	case KindGitHub:
+		if opts.BaseURL == "" {
+			opts.BaseURL = "https://api.github.com"
+		}
+		return &githubClient{opts: opts}, nil
+	case KindGitLab:
+		if opts.BaseURL == "" {
+			opts.BaseURL = "https://" + orDefault(host, "gitlab.com") + "/api/v4"
+		}
+		return &gitlabClient{opts: opts}, nil
+	case KindGitea:
+		if opts.BaseURL == "" {
+			if host == "" {
+				return nil, errors.New("gitea client needs a host or base URL")
+			}
+			opts.BaseURL = "https://" + host + "/api/v1"
+		}
+		return &giteaClient{opts: opts}, nil
+	default:
+		return nil, fmt.Errorf("unknown forge kind %q", kind)
+	}
+}
+
+// ForHost returns a client for the public forge at host.
+func ForHost(host string, opts Options) (Client, bool) {
+	kind, ok := HostKind(host)
+	if !ok {
+		return nil, false
+	}
+	client, err := New(kind, strings.ToLower(host), opts)
+	if err != nil {
+		return nil, false
+	}
+	return client, true
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// splitFullName splits an owner/name path. GitLab groups may nest, so only
+// the last element is the name.
+func splitFullName(fullName string) (string, string, error) {
+	fullName = strings.Trim(strings.TrimSuffix(fullName, ".git"), "/")
+	i := strings.LastIndex(fullName, "/")
+	if i <= 0 || i == len(fullName)-1 {
+		return "", "", fmt.Errorf("invalid repository name %q", fullName)
+	}
+	return fullName[:i], fullName[i+1:], nil
+}
+
+// perPage is the page size of list requests, the maximum of every forge.
+const perPage = 50
+
+// listPages requests the pages of a list until a short one, with pageURL
+// returning the URL of the 1-based page.
+func listPages[T any](ctx context.Context, opts Options, header http.Header, pageURL func(page int) string) ([]T, error) {
+	var items []T
+	for page := 1; ; page++ {
+		var decoded []T
+		if err := getJSON(ctx, opts, pageURL(page), header, &decoded); err != nil {
+			return nil, err
+		}
+		items = append(items, decoded...)
+		if len(decoded) < perPage {
+			return items, nil
+		}
+	}
+}
+
+// listOwnerPages lists the pages of the first path that knows the owner,
+// since organizations and users are listed by different endpoints. The query
+// must set the page size.
+func listOwnerPages[T any](ctx context.Context, opts Options, header http.Header, paths []string, query url.Values) ([]T, error) {
+	for i, path := range paths {
+		items, err := listPages[T](ctx, opts, header, func(page int) string {
+			query.Set("page", strconv.Itoa(page))
+			return strings.TrimSuffix(opts.BaseURL, "/") + path + "?" + query.Encode()
+		})
+		if errors.Is(err, ErrNotFound) && i < len(paths)-1 {
+			continue
+		}
+		return items, err
+	}
+	return nil, ErrNotFound
+}
+
+// getJSON requests rawURL and decodes the JSON answer into v.
+func getJSON(ctx context.Context, opts Options, rawURL string, header http.Header, v any) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	for key, values := range header {
+		request.Header[key] = values
+	}
+
+	httpClient := opts.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		// The error of a failed request repeats the URL, so only the cause is
+		// kept, as for the other network errors.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+	defer func() { _ = response.Body.Close() }()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 1<<20))
+		return ErrNotFound
+	case http.StatusUnavailableForLegalReasons:
+		_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 1<<20))
+		return ErrDisabled
+	default:
+		_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 1<<20))
+		return &StatusError{StatusCode: response.StatusCode}
+	}
+
+	if err := json.NewDecoder(io.LimitReader(response.Body, 16<<20)).Decode(v); err != nil {
+		return fmt.Errorf("decode forge response: %w", err)
+	}
+	return nil
+}
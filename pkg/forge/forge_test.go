@@ -0,0 +1,146 @@
+package forge_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/zbiljic/fget/pkg/forge"
+	"github.com/zbiljic/fget/pkg/forge/forgetest"
+)
+
+func newClient(t *testing.T, server *forgetest.Server, kind forge.Kind, token string) forge.Client {
+	t.Helper()
+	client, err := forge.New(kind, "", forge.Options{BaseURL: server.BaseURL(kind), Token: token, HTTPClient: server.Client()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestRepositoryResolvesMovedRepositories(t *testing.T) {
+	server := forgetest.NewServer(t,
+		forge.Repository{FullName: "acme/api", DefaultBranch: "main", Parent: "upstream/api"},
+		forge.Repository{FullName: "acme/old", DefaultBranch: "master", Archived: true},
+		forge.Repository{FullName: "group/sub/tool", DefaultBranch: "trunk"},
+	)
+	server.Move("acme/api", "NewOwner/api-server")
+
+	for _, kind := range []forge.Kind{forge.KindGitHub, forge.KindGitLab, forge.KindGitea} {
+		client := newClient(t, server, kind, "")
+
+		repo, err := client.Repository(context.Background(), "acme/api.git")
+		if err != nil {
+			t.Fatalf("%s: Repository() error = %v", kind, err)
+		}
+		want := forge.Repository{FullName: "NewOwner/api-server", DefaultBranch: "main", Fork: true, Parent: "upstream/api"}
+		if !reflect.DeepEqual(*repo, want) {
+			t.Fatalf("%s: Repository() = %+v, want %+v", kind, *repo, want)
+		}
+
+		repo, err = client.Repository(context.Background(), "acme/old")
+		if err != nil || !repo.Archived || repo.DefaultBranch != "master" {
+			t.Fatalf("%s: Repository() for archived = %+v, %v", kind, repo, err)
+		}
+
+		if _, err := client.Repository(context.Background(), "acme/missing"); !errors.Is(err, forge.ErrNotFound) {
+			t.Fatalf("%s: Repository() for missing error = %v, want %v", kind, err, forge.ErrNotFound)
+		}
+	}
+
+	gitlab := newClient(t, server, forge.KindGitLab, "")
+	if repo, err := gitlab.Repository(context.Background(), "group/sub/tool"); err != nil || repo.FullName != "group/sub/tool" {
+		t.Fatalf("Repository() for nested group = %+v, %v", repo, err)
+	}
+	if _, err := gitlab.Repository(context.Background(), "tool"); err == nil {
+		t.Fatal("Repository() without owner succeeded")
+	}
+}
+
+func TestRepositoriesListsEveryPage(t *testing.T) {
+	server := forgetest.NewServer(t,
+		forge.Repository{FullName: "acme/archived", Archived: true},
+		forge.Repository{FullName: "acme/fork", Fork: true, Parent: "other/fork"},
+		forge.Repository{FullName: "acme/private", Private: true, Topics: []string{"go", "cli"}, CloneURL: "https://forge.example/acme/private.git"},
+		forge.Repository{FullName: "acme/team/tool"},
+		forge.Repository{FullName: "jane/dotfiles"},
+	)
+	for i := range 60 {
+		server.Add(forge.Repository{FullName: fmt.Sprintf("acme/repo-%02d", i)})
+	}
+	server.AddUser("jane")
+
+	for _, kind := range []forge.Kind{forge.KindGitHub, forge.KindGitLab, forge.KindGitea} {
+		client := newClient(t, server, kind, "")
+
+		repos, err := client.Repositories(context.Background(), "acme")
+		if err != nil {
+			t.Fatalf("%s: Repositories() error = %v", kind, err)
+		}
+		byName := make(map[string]forge.Repository, len(repos))
+		for _, repo := range repos {
+			byName[repo.FullName] = repo
+		}
+		wantCount := 63
+		if kind == forge.KindGitLab {
+			// the projects of subgroups are included
+			wantCount++
+		}
+		if len(byName) != wantCount || len(repos) != wantCount {
+			t.Fatalf("%s: Repositories() returned %d repositories, want %d", kind, len(repos), wantCount)
+		}
+		if !byName["acme/archived"].Archived || !byName["acme/fork"].Fork {
+			t.Fatalf("%s: Repositories() lost the archived or fork flag: %+v", kind, repos)
+		}
+		want := forge.Repository{FullName: "acme/private", Private: true, Topics: []string{"go", "cli"}, CloneURL: "https://forge.example/acme/private.git"}
+		if got := byName["acme/private"]; !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: private repository = %+v, want %+v", kind, got, want)
+		}
+
+		repos, err = client.Repositories(context.Background(), "jane")
+		if err != nil || len(repos) != 1 || repos[0].FullName != "jane/dotfiles" {
+			t.Fatalf("%s: Repositories() of a user = %+v, %v", kind, repos, err)
+		}
+
+		if _, err := client.Repositories(context.Background(), "nobody"); !errors.Is(err, forge.ErrNotFound) {
+			t.Fatalf("%s: Repositories() of an unknown owner error = %v, want %v", kind, err, forge.ErrNotFound)
+		}
+	}
+}
+
+func TestRepositorySendsToken(t *testing.T) {
+	server := forgetest.NewServer(t, forge.Repository{FullName: "acme/api", DefaultBranch: "main", Disabled: true})
+	server.Token = "secret"
+
+	for _, kind := range []forge.Kind{forge.KindGitHub, forge.KindGitLab, forge.KindGitea} {
+		var statusErr *forge.StatusError
+		if _, err := newClient(t, server, kind, "").Repository(context.Background(), "acme/api"); !errors.As(err, &statusErr) || statusErr.StatusCode != 401 {
+			t.Fatalf("%s: Repository() without token error = %v, want HTTP 401", kind, err)
+		}
+		repo, err := newClient(t, server, kind, "secret").Repository(context.Background(), "acme/api")
+		if err != nil {
+			t.Fatalf("%s: Repository() with token error = %v", kind, err)
+		}
+		if want := kind == forge.KindGitHub; repo.Disabled != want {
+			t.Fatalf("%s: Disabled = %v, want %v", kind, repo.Disabled, want)
+		}
+	}
+}
+
+func TestForHost(t *testing.T) {
+	t.Parallel()
+
+	for _, host := range []string{"github.com", "GitLab.com", "codeberg.org"} {
+		if _, ok := forge.ForHost(host, forge.Options{}); !ok {
+			t.Fatalf("ForHost(%q) found no forge", host)
+		}
+	}
+	if _, ok := forge.ForHost("git.example.com", forge.Options{}); ok {
+		t.Fatal("ForHost() found a forge for an unknown host")
+	}
+	if _, err := forge.New(forge.KindGitea, "", forge.Options{}); err == nil {
+		t.Fatal("New() for Gitea without host succeeded")
+	}
+}
@@ -0,0 +1,282 @@
+// Package forgetest provides an in-memory stand-in for the REST APIs of
+// GitHub, GitLab and Gitea that looks up and lists repositories, for tests.
+package forgetest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/zbiljic/fget/pkg/forge"
+)
+
+const (
+	githubPrefix = "/github"
+	gitlabPrefix = "/gitlab/api/v4"
+	giteaPrefix  = "/gitea/api/v1"
+)
+
+// Server knows a set of repositories and answers every forge API for them.
+// Moved repositories are found by their old name: GitHub and Gitea redirect
+// to the new one, and GitLab answers with the new one directly, as the real
+// forges do. Owners are organizations or groups unless added as users.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	repos    map[string]forge.Repository
+	moved    map[string]string
+	users    map[string]bool
+	requests int
+	// Token, when set, is required in the authentication header of each API.
+	Token string
+}
+
+// NewServer starts a server that is closed when the test ends.
+func NewServer(t testing.TB, repos ...forge.Repository) *Server {
+	t.Helper()
+	server := &Server{
+		repos: make(map[string]forge.Repository),
+		moved: make(map[string]string),
+		users: make(map[string]bool),
+	}
+	for _, repo := range repos {
+		server.Add(repo)
+	}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.serve))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// BaseURL returns the API root to use as forge.Options.BaseURL for the kind
+// of forge.
+func (s *Server) BaseURL(kind forge.Kind) string {
+	switch kind {
+	case forge.KindGitHub:
+		return s.URL + githubPrefix
+	case forge.KindGitLab:
+		return s.URL + gitlabPrefix
+	default:
+		return s.URL + giteaPrefix
+	}
+}
+
+// Add makes the server know repo.
+func (s *Server) Add(repo forge.Repository) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.repos[strings.ToLower(repo.FullName)] = repo
+}
+
+// AddUser makes the repositories of owner listed as those of a user.
+func (s *Server) AddUser(owner string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[strings.ToLower(owner)] = true
+}
+
+// Remove deletes the repository with fullName.
+func (s *Server) Remove(fullName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.repos, strings.ToLower(fullName))
+}
+
+// Move renames the repository from to the full name to.
+func (s *Server) Move(from, to string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	repo, ok := s.repos[strings.ToLower(from)]
+	if !ok {
+		return
+	}
+	delete(s.repos, strings.ToLower(from))
+	repo.FullName = to
+	s.repos[strings.ToLower(to)] = repo
+	s.moved[strings.ToLower(from)] = to
+}
+
+// Requests returns the number of API requests served.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// lookup returns the repository with fullName and whether it was found by
+// an old name.
+func (s *Server) lookup(fullName string) (forge.Repository, bool, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	key := strings.ToLower(fullName)
+	if to, ok := s.moved[key]; ok {
+		key = strings.ToLower(to)
+		repo, found := s.repos[key]
+		return repo, true, found
+	}
+	repo, found := s.repos[key]
+	return repo, false, found
+}
+
+// list returns the repositories of owner by full name, and whether the owner
+// is known as a user or as an organization.
+func (s *Server) list(owner string, user, subgroups bool) ([]forge.Repository, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	owner = strings.ToLower(owner)
+	if s.users[owner] != user {
+		return nil, false
+	}
+	var repos []forge.Repository
+	for key, repo := range s.repos {
+		repoOwner := key[:max(strings.LastIndex(key, "/"), 0)]
+		if repoOwner == owner || (subgroups && strings.HasPrefix(repoOwner, owner+"/")) {
+			repos = append(repos, repo)
+		}
+	}
+	sort.Slice(repos, func(i, j int) bool { return repos[i].FullName < repos[j].FullName })
+	return repos, len(repos) > 0
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var kind forge.Kind
+	var rest string
+	switch {
+	case strings.HasPrefix(r.URL.Path, githubPrefix+"/"):
+		kind, rest = forge.KindGitHub, strings.TrimPrefix(r.URL.Path, githubPrefix+"/")
+	case strings.HasPrefix(r.URL.Path, gitlabPrefix+"/"):
+		kind, rest = forge.KindGitLab, strings.TrimPrefix(r.URL.Path, gitlabPrefix+"/")
+	case strings.HasPrefix(r.URL.Path, giteaPrefix+"/"):
+		kind, rest = forge.KindGitea, strings.TrimPrefix(r.URL.Path, giteaPrefix+"/")
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if s.Token != "" && !s.authorized(kind, r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	collection, fullName, _ := strings.Cut(rest, "/")
+	switch collection {
+	case "repos", "projects":
+		s.serveRepository(w, r, kind, fullName)
+	case "orgs", "groups", "users":
+		suffix := "/repos"
+		if kind == forge.KindGitLab {
+			suffix = "/projects"
+		}
+		owner, ok := strings.CutSuffix(fullName, suffix)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		repos, found := s.list(owner, collection == "users", collection == "groups")
+		if !found {
+			http.NotFound(w, r)
+			return
+		}
+		s.serveList(w, r, kind, repos)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) serveList(w http.ResponseWriter, r *http.Request, kind forge.Kind, repos []forge.Repository) {
+	size, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if kind == forge.KindGitea {
+		size, _ = strconv.Atoi(r.URL.Query().Get("limit"))
+	}
+	if size <= 0 {
+		size = 30
+	}
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	page = max(page, 1)
+
+	encoded := make([]map[string]any, 0, size)
+	for _, repo := range repos[min((page-1)*size, len(repos)):min(page*size, len(repos))] {
+		// lists do not report the parent of forks
+		repo.Parent = ""
+		encoded = append(encoded, encodeRepository(kind, repo))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(encoded)
+}
+
+func (s *Server) serveRepository(w http.ResponseWriter, r *http.Request, kind forge.Kind, fullName string) {
+	repo, moved, found := s.lookup(fullName)
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	if moved && kind != forge.KindGitLab {
+		http.Redirect(w, r, strings.TrimSuffix(r.URL.Path, fullName)+repo.FullName, http.StatusMovedPermanently)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(encodeRepository(kind, repo))
+}
+
+func (s *Server) authorized(kind forge.Kind, r *http.Request) bool {
+	switch kind {
+	case forge.KindGitHub:
+		return r.Header.Get("Authorization") == "Bearer "+s.Token
+	case forge.KindGitLab:
+		return r.Header.Get("PRIVATE-TOKEN") == s.Token
+	default:
+		return r.Header.Get("Authorization") == "token "+s.Token
+	}
+}
+
+func encodeRepository(kind forge.Kind, repo forge.Repository) map[string]any {
+	if kind == forge.KindGitLab {
+		visibility := "public"
+		if repo.Private {
+			visibility = "private"
+		}
+		project := map[string]any{
+			"path_with_namespace": repo.FullName,
+			"default_branch":      repo.DefaultBranch,
+			"archived":            repo.Archived,
+			"visibility":          visibility,
+			"topics":              repo.Topics,
+			"http_url_to_repo":    repo.CloneURL,
+		}
+		if repo.Fork || repo.Parent != "" {
+			project["forked_from_project"] = map[string]any{"path_with_namespace": repo.Parent}
+		}
+		return project
+	}
+
+	encoded := map[string]any{
+		"full_name":      repo.FullName,
+		"default_branch": repo.DefaultBranch,
+		"archived":       repo.Archived,
+		"fork":           repo.Fork || repo.Parent != "",
+		"private":        repo.Private,
+		"topics":         repo.Topics,
+		"clone_url":      repo.CloneURL,
+	}
+	if kind == forge.KindGitHub {
+		encoded["disabled"] = repo.Disabled
+	}
+	if repo.Parent != "" {
+		encoded["parent"] = map[string]any{"full_name": repo.Parent}
+	}
+	return encoded
+}
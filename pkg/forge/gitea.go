@@ -0,0 +1,92 @@
+package forge
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type giteaClient struct {
+	opts Options
+}
+
+type giteaRepository struct {
+	FullName      string   `json:"full_name"`
+	DefaultBranch string   `json:"default_branch"`
+	Archived      bool     `json:"archived"`
+	Fork          bool     `json:"fork"`
+	Private       bool     `json:"private"`
+	Topics        []string `json:"topics"`
+	CloneURL      string   `json:"clone_url"`
+	Parent        *struct {
+		FullName string `json:"full_name"`
+	} `json:"parent"`
+}
+
+func (c *giteaClient) header() http.Header {
+	header := http.Header{}
+	if c.opts.Token != "" {
+		header.Set("Authorization", "token "+c.opts.Token)
+	}
+	return header
+}
+
+func (decoded giteaRepository) repository() Repository {
+	repo := Repository{
+		FullName:      decoded.FullName,
+		DefaultBranch: decoded.DefaultBranch,
+		Archived:      decoded.Archived,
+		Fork:          decoded.Fork,
+		Private:       decoded.Private,
+		Topics:        decoded.Topics,
+		CloneURL:      decoded.CloneURL,
+	}
+	if decoded.Parent != nil {
+		repo.Parent = decoded.Parent.FullName
+	}
+	return repo
+}
+
+// Repository follows the redirect Gitea answers for renamed and transferred
+// repositories, so the canonical name is returned.
+func (c *giteaClient) Repository(ctx context.Context, fullName string) (*Repository, error) {
+	owner, name, err := splitFullName(fullName)
+	if err != nil {
+		return nil, err
+	}
+	if strings.Contains(owner, "/") {
+		return nil, ErrNotFound
+	}
+
+	var decoded giteaRepository
+	rawURL := strings.TrimSuffix(c.opts.BaseURL, "/") + "/repos/" + url.PathEscape(owner) + "/" + url.PathEscape(name)
+	if err := getJSON(ctx, c.opts, rawURL, c.header(), &decoded); err != nil {
+		return nil, err
+	}
+
+	repo := decoded.repository()
+	return &repo, nil
+}
+
+// Repositories lists the repositories of an organization, then those of a
+// user.
+func (c *giteaClient) Repositories(ctx context.Context, owner string) ([]Repository, error) {
+	paths := []string{
+		"/orgs/" + url.PathEscape(owner) + "/repos",
+		"/users/" + url.PathEscape(owner) + "/repos",
+	}
+	decoded, err := listOwnerPages[giteaRepository](ctx, c.opts, c.header(), paths, url.Values{
+		"limit": {strconv.Itoa(perPage)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	repos := make([]Repository, 0, len(decoded))
+	for _, repo := range decoded {
+		repos = append(repos, repo.repository())
+	}
+	return repos, nil
+}
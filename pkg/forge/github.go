@@ -0,0 +1,97 @@
+package forge
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type githubClient struct {
+	opts Options
+}
+
+type githubRepository struct {
+	FullName      string   `json:"full_name"`
+	DefaultBranch string   `json:"default_branch"`
+	Archived      bool     `json:"archived"`
+	Disabled      bool     `json:"disabled"`
+	Fork          bool     `json:"fork"`
+	Private       bool     `json:"private"`
+	Topics        []string `json:"topics"`
+	CloneURL      string   `json:"clone_url"`
+	Parent        *struct {
+		FullName string `json:"full_name"`
+	} `json:"parent"`
+}
+
+func (c *githubClient) header() http.Header {
+	header := http.Header{}
+	header.Set("Accept", "application/vnd.github+json")
+	header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if c.opts.Token != "" {
+		header.Set("Authorization", "Bearer "+c.opts.Token)
+	}
+	return header
+}
+
+func (decoded githubRepository) repository() Repository {
+	repo := Repository{
+		FullName:      decoded.FullName,
+		DefaultBranch: decoded.DefaultBranch,
+		Archived:      decoded.Archived,
+		Disabled:      decoded.Disabled,
+		Fork:          decoded.Fork,
+		Private:       decoded.Private,
+		Topics:        decoded.Topics,
+		CloneURL:      decoded.CloneURL,
+	}
+	if decoded.Parent != nil {
+		repo.Parent = decoded.Parent.FullName
+	}
+	return repo
+}
+
+// Repository follows the redirect GitHub answers for renamed and transferred
+// repositories, so the canonical name is returned.
+func (c *githubClient) Repository(ctx context.Context, fullName string) (*Repository, error) {
+	owner, name, err := splitFullName(fullName)
+	if err != nil {
+		return nil, err
+	}
+	if strings.Contains(owner, "/") {
+		return nil, ErrNotFound
+	}
+
+	var decoded githubRepository
+	rawURL := strings.TrimSuffix(c.opts.BaseURL, "/") + "/repos/" + url.PathEscape(owner) + "/" + url.PathEscape(name)
+	if err := getJSON(ctx, c.opts, rawURL, c.header(), &decoded); err != nil {
+		return nil, err
+	}
+
+	repo := decoded.repository()
+	return &repo, nil
+}
+
+// Repositories lists the repositories of an organization, then those a user
+// owns.
+func (c *githubClient) Repositories(ctx context.Context, owner string) ([]Repository, error) {
+	paths := []string{
+		"/orgs/" + url.PathEscape(owner) + "/repos",
+		"/users/" + url.PathEscape(owner) + "/repos",
+	}
+	decoded, err := listOwnerPages[githubRepository](ctx, c.opts, c.header(), paths, url.Values{
+		"type":     {"all"},
+		"per_page": {strconv.Itoa(perPage)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	repos := make([]Repository, 0, len(decoded))
+	for _, repo := range decoded {
+		repos = append(repos, repo.repository())
+	}
+	return repos, nil
+}
@@ -0,0 +1,94 @@
+package forge
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type gitlabClient struct {
+	opts Options
+}
+
+type gitlabProject struct {
+	PathWithNamespace string   `json:"path_with_namespace"`
+	DefaultBranch     string   `json:"default_branch"`
+	Archived          bool     `json:"archived"`
+	Visibility        string   `json:"visibility"`
+	Topics            []string `json:"topics"`
+	HTTPURLToRepo     string   `json:"http_url_to_repo"`
+	ForkedFromProject *struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+	} `json:"forked_from_project"`
+}
+
+func (c *gitlabClient) header() http.Header {
+	header := http.Header{}
+	if c.opts.Token != "" {
+		header.Set("PRIVATE-TOKEN", c.opts.Token)
+	}
+	return header
+}
+
+func (decoded gitlabProject) repository() Repository {
+	repo := Repository{
+		FullName:      decoded.PathWithNamespace,
+		DefaultBranch: decoded.DefaultBranch,
+		Archived:      decoded.Archived,
+		Fork:          decoded.ForkedFromProject != nil,
+		Private:       decoded.Visibility != "" && decoded.Visibility != "public",
+		Topics:        decoded.Topics,
+		CloneURL:      decoded.HTTPURLToRepo,
+	}
+	if decoded.ForkedFromProject != nil {
+		repo.Parent = decoded.ForkedFromProject.PathWithNamespace
+	}
+	return repo
+}
+
+func gitlabPathID(fullName string) string {
+	return strings.ReplaceAll(url.PathEscape(fullName), "/", "%2F")
+}
+
+// Repository looks the project up by its URL-encoded path. GitLab resolves
+// the old paths of moved projects itself, so the canonical path is returned.
+func (c *gitlabClient) Repository(ctx context.Context, fullName string) (*Repository, error) {
+	owner, name, err := splitFullName(fullName)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded gitlabProject
+	rawURL := strings.TrimSuffix(c.opts.BaseURL, "/") + "/projects/" + gitlabPathID(owner+"/"+name)
+	if err := getJSON(ctx, c.opts, rawURL, c.header(), &decoded); err != nil {
+		return nil, err
+	}
+
+	repo := decoded.repository()
+	return &repo, nil
+}
+
+// Repositories lists the projects of a group and its subgroups, then those a
+// user owns. Internal projects count as private.
+func (c *gitlabClient) Repositories(ctx context.Context, owner string) ([]Repository, error) {
+	owner = strings.Trim(owner, "/")
+	paths := []string{
+		"/groups/" + gitlabPathID(owner) + "/projects",
+		"/users/" + gitlabPathID(owner) + "/projects",
+	}
+	decoded, err := listOwnerPages[gitlabProject](ctx, c.opts, c.header(), paths, url.Values{
+		"include_subgroups": {"true"},
+		"per_page":          {strconv.Itoa(perPage)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	repos := make([]Repository, 0, len(decoded))
+	for _, project := range decoded {
+		repos = append(repos, project.repository())
+	}
+	return repos, nil
+}
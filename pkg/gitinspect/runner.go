@@ -61,24 +61,27 @@ func (e *CommandError) Unwrap() error {
 }
 
 // CLIRunner invokes the Git CLI with optional repository locks disabled.
-type CLIRunner struct{}
+type CLIRunner struct {
+	// Env holds entries added to the environment of the commands only.
+	Env []string
+}
 
-func (CLIRunner) Run(ctx context.Context, dir string, args ...string) (Result, error) {
+func (r CLIRunner) Run(ctx context.Context, dir string, args ...string) (Result, error) {
 	var stdout bytes.Buffer
-	return runCLI(ctx, dir, &stdout, &stdout, args...)
+	return runCLI(ctx, dir, r.Env, &stdout, &stdout, args...)
 }
 
-func (CLIRunner) RunTo(ctx context.Context, dir string, stdout io.Writer, args ...string) (Result, error) {
+func (r CLIRunner) RunTo(ctx context.Context, dir string, stdout io.Writer, args ...string) (Result, error) {
 	if stdout == nil {
 		stdout = io.Discard
 	}
-	return runCLI(ctx, dir, stdout, nil, args...)
+	return runCLI(ctx, dir, r.Env, stdout, nil, args...)
 }
 
-func runCLI(ctx context.Context, dir string, stdout io.Writer, capturedStdout *bytes.Buffer, args ...string) (Result, error) {
+func runCLI(ctx context.Context, dir string, env []string, stdout io.Writer, capturedStdout *bytes.Buffer, args ...string) (Result, error) {
 	cmd := exec.CommandContext(ctx, "git", args...)
 	cmd.Dir = dir
-	cmd.Env = append(os.Environ(), "GIT_OPTIONAL_LOCKS=0")
+	cmd.Env = append(append(os.Environ(), "GIT_OPTIONAL_LOCKS=0"), env...)
 
 	var stderr bytes.Buffer
 	cmd.Stdout = stdout
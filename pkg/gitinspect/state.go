@@ -17,7 +17,8 @@ type State struct {
 	LocalRefCount   int        `json:"local_ref_count"`
 }
 
-// Reference identifies a Git ref and the commit it resolves to.
+// Reference identifies a Git ref and the commit it resolves to. The commit
+// of an upstream ref that is gone, such as after it was pruned, is empty.
 type Reference struct {
 	Ref    string `json:"ref,omitempty"`
 	Commit string `json:"commit,omitempty"`
@@ -53,13 +54,14 @@ func InspectState(ctx context.Context, repoPath string, runner Runner) (State, e
 			}
 			upstreamRef := strings.TrimSpace(upstreamOut.Stdout)
 			if upstreamRef != "" {
-				commitOut, commitErr := runner.Run(ctx, repoPath, "rev-parse", "--verify", upstreamRef)
+				state.Upstream = &Reference{Ref: upstreamRef}
+				commitOut, commitErr := runner.Run(ctx, repoPath, "rev-parse", "--verify", "-q", upstreamRef)
 				if commitErr != nil {
-					return state, commitErr
-				}
-				state.Upstream = &Reference{
-					Ref:    upstreamRef,
-					Commit: strings.TrimSpace(commitOut.Stdout),
+					if gitErr, ok := commitErr.(*CommandError); !ok || gitErr.ExitCode != 1 {
+						return state, commitErr
+					}
+				} else {
+					state.Upstream.Commit = strings.TrimSpace(commitOut.Stdout)
 				}
 			}
 		}
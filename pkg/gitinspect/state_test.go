@@ -31,7 +31,7 @@ func TestInspectState(t *testing.T) {
 		"for-each-ref\x00--format=%(upstream)\x00refs/heads/main": {
 			Stdout: "refs/remotes/origin/main\n",
 		},
-		"rev-parse\x00--verify\x00refs/remotes/origin/main": {
+		"rev-parse\x00--verify\x00-q\x00refs/remotes/origin/main": {
 			Stdout: "upstream-commit\n",
 		},
 		"for-each-ref\x00--sort=refname\x00--format=%(refname)%00%(objectname)\x00refs": {
@@ -0,0 +1,258 @@
+// Package gitlfs finds the Git LFS objects stored in a local repository and
+// asks an LFS server which of them it already has, using the batch API.
+package gitlfs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	giturls "github.com/whilp/git-urls"
+)
+
+// MediaType is the content type of LFS batch requests and responses.
+const MediaType = "application/vnd.git-lfs+json"
+
+// batchSize is the number of objects sent in one batch request, matching the
+// git-lfs client.
+const batchSize = 100
+
+// Object is an LFS object named by the SHA-256 of its content.
+type Object struct {
+	OID  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+// ValidOID reports whether oid is a lowercase SHA-256 digest.
+func ValidOID(oid string) bool {
+	if len(oid) != 64 || strings.ToLower(oid) != oid {
+		return false
+	}
+	_, err := hex.DecodeString(oid)
+	return err == nil
+}
+
+// ObjectPath returns where an object is stored below .git/lfs/objects, as a
+// slash-separated path.
+func ObjectPath(oid string) string {
+	return path.Join(oid[:2], oid[2:4], oid)
+}
+
+// LocalObjects lists the objects stored in the LFS directory of gitDir,
+// sorted by OID. Files that are not named like objects are ignored.
+func LocalObjects(gitDir string) ([]Object, error) {
+	root := filepath.Join(gitDir, "lfs", "objects")
+	var objects []Object
+	err := filepath.WalkDir(root, func(current string, entry fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			if current == root && errors.Is(walkErr, fs.ErrNotExist) {
+				return filepath.SkipAll
+			}
+			return walkErr
+		}
+		if !entry.Type().IsRegular() || !ValidOID(entry.Name()) {
+			return nil
+		}
+		relative, err := filepath.Rel(root, current)
+		if err != nil {
+			return err
+		}
+		if filepath.ToSlash(relative) != ObjectPath(entry.Name()) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, Object{OID: entry.Name(), Size: info.Size()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].OID < objects[j].OID })
+	return objects, nil
+}
+
+// Endpoint derives the LFS server URL of a Git remote the way git-lfs does
+// when lfs.url is not configured. SSH remotes map to HTTPS on the same host.
+func Endpoint(remoteURL string) (string, error) {
+	remoteURL = strings.TrimSpace(remoteURL)
+	lower := strings.ToLower(remoteURL)
+	var parsed *url.URL
+	var err error
+	if strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") {
+		parsed, err = url.Parse(remoteURL)
+	} else {
+		parsed, err = giturls.Parse(remoteURL)
+		if err == nil {
+			switch strings.ToLower(parsed.Scheme) {
+			case "ssh", "git+ssh", "git":
+				parsed.Scheme = "https"
+				parsed.User = nil
+				parsed.Host = parsed.Hostname()
+			default:
+				return "", fmt.Errorf("no LFS endpoint for %s remotes", parsed.Scheme)
+			}
+		}
+	}
+	if err != nil || parsed.Host == "" {
+		return "", errors.New("no LFS endpoint for remote URL")
+	}
+	parsed.Path = "/" + strings.Trim(parsed.Path, "/")
+	if !strings.HasSuffix(parsed.Path, ".git") {
+		parsed.Path += ".git"
+	}
+	parsed.Path += "/info/lfs"
+	parsed.RawQuery = ""
+	parsed.Fragment = ""
+	return parsed.String(), nil
+}
+
+// StatusError is returned when the LFS server rejects a batch request.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("LFS server returned HTTP %d", e.StatusCode)
+}
+
+// Client queries an LFS server. Credentials embedded in the endpoint URL are
+// sent as basic authentication.
+type Client struct {
+	HTTPClient *http.Client
+}
+
+type batchRequest struct {
+	Operation string   `json:"operation"`
+	Transfers []string `json:"transfers"`
+	Objects   []Object `json:"objects"`
+}
+
+type batchResponse struct {
+	Objects []struct {
+		Object
+		Actions map[string]json.RawMessage `json:"actions"`
+		Error   *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	} `json:"objects"`
+}
+
+// Missing returns the objects the server at endpoint cannot serve for
+// download. An object counts as present only when the server offers a
+// download action for exactly its OID and size.
+func (c *Client) Missing(ctx context.Context, endpoint string, objects []Object) ([]Object, error) {
+	var missing []Object
+	for start := 0; start < len(objects); start += batchSize {
+		batch := objects[start:min(start+batchSize, len(objects))]
+		present, err := c.batch(ctx, endpoint, batch)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range batch {
+			if !present[object] {
+				missing = append(missing, object)
+			}
+		}
+	}
+	return missing, nil
+}
+
+func (c *Client) batch(ctx context.Context, endpoint string, objects []Object) (map[Object]bool, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errors.New("invalid LFS endpoint")
+	}
+	user := parsed.User
+	parsed.User = nil
+	parsed.Path = strings.TrimSuffix(parsed.Path, "/") + "/objects/batch"
+
+	body, err := json.Marshal(batchRequest{Operation: "download", Transfers: []string{"basic"}, Objects: objects})
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, parsed.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", MediaType)
+	request.Header.Set("Content-Type", MediaType)
+	if user != nil {
+		password, _ := user.Password()
+		request.SetBasicAuth(user.Username(), password)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		// The error of a failed request repeats the URL, which may hold
+		// credentials, so only the cause is kept.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return nil, urlErr.Err
+		}
+		return nil, err
+	}
+	defer func() { _ = response.Body.Close() }()
+	if response.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 1<<20))
+		return nil, &StatusError{StatusCode: response.StatusCode}
+	}
+
+	var decoded batchResponse
+	if err := json.NewDecoder(io.LimitReader(response.Body, 64<<20)).Decode(&decoded); err != nil {
+		return nil, fmt.Errorf("decode LFS batch response: %w", err)
+	}
+	present := make(map[Object]bool, len(decoded.Objects))
+	for _, object := range decoded.Objects {
+		if object.Error == nil && object.Actions["download"] != nil {
+			present[object.Object] = true
+		}
+	}
+	return present, nil
+}
+
+// VerifyFile checks that the file at path holds the content of object.
+func VerifyFile(path string, object Object) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+	return Verify(file, object)
+}
+
+// Verify checks that r holds exactly the content of object.
+func Verify(r io.Reader, object Object) error {
+	hash := sha256.New()
+	size, err := io.Copy(hash, r)
+	if err != nil {
+		return err
+	}
+	if size != object.Size {
+		return fmt.Errorf("LFS object %s size mismatch", object.OID)
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != object.OID {
+		return fmt.Errorf("LFS object %s checksum mismatch", object.OID)
+	}
+	return nil
+}
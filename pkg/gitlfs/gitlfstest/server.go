@@ -0,0 +1,118 @@
+// Package gitlfstest provides an in-memory stand-in for a Git LFS server that
+// answers batch download requests, for tests.
+package gitlfstest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/zbiljic/fget/pkg/gitlfs"
+)
+
+// Server knows a set of LFS objects and offers a download action for each of
+// them. Every other object is reported with a 404 object error.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	objects  map[gitlfs.Object]bool
+	requests int
+	// Username and Password, when set, are required as basic authentication.
+	Username string
+	Password string
+}
+
+// NewServer starts a server that is closed when the test ends. Its Endpoint
+// can be used as lfs.url.
+func NewServer(t testing.TB, objects ...gitlfs.Object) *Server {
+	t.Helper()
+	server := &Server{objects: make(map[gitlfs.Object]bool)}
+	for _, object := range objects {
+		server.objects[object] = true
+	}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.serve))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// Endpoint returns the LFS endpoint URL served by the server.
+func (s *Server) Endpoint() string {
+	return s.URL + "/repo.git/info/lfs"
+}
+
+// Add makes the server report object as present.
+func (s *Server) Add(object gitlfs.Object) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[object] = true
+}
+
+// Requests returns the number of batch requests served.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+type batchObject struct {
+	gitlfs.Object
+	Actions map[string]any `json:"actions,omitempty"`
+	Error   *objectError   `json:"error,omitempty"`
+}
+
+type objectError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/info/lfs/objects/batch") {
+		http.NotFound(w, r)
+		return
+	}
+	if s.Username != "" || s.Password != "" {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != s.Username || password != s.Password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), gitlfs.MediaType) {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	var request struct {
+		Operation string          `json:"operation"`
+		Objects   []gitlfs.Object `json:"objects"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Operation != "download" {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	s.mu.Lock()
+	s.requests++
+	response := struct {
+		Transfer string        `json:"transfer"`
+		Objects  []batchObject `json:"objects"`
+	}{Transfer: "basic", Objects: make([]batchObject, 0, len(request.Objects))}
+	for _, object := range request.Objects {
+		entry := batchObject{Object: object}
+		if s.objects[object] {
+			entry.Actions = map[string]any{
+				"download": map[string]string{"href": s.URL + "/objects/" + object.OID},
+			}
+		} else {
+			entry.Error = &objectError{Code: http.StatusNotFound, Message: "Object does not exist"}
+		}
+		response.Objects = append(response.Objects, entry)
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", gitlfs.MediaType)
+	_ = json.NewEncoder(w).Encode(response)
+}
@@ -43,6 +43,12 @@ func WithLogger(logger interface{}) ClientOption {
 	}
 }
 
+func WithRetryMax(retryMax int) ClientOption {
+	return func(c *retryablehttp.Client) {
+		c.RetryMax = retryMax
+	}
+}
+
 func WithPassthroughErrorHandler() ClientOption {
 	return func(c *retryablehttp.Client) {
 		c.ErrorHandler = retryablehttp.PassthroughErrorHandler